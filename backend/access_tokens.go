@@ -0,0 +1,122 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	ScopeReadPlants     = "read:plants"
+	ScopeWriteSchedules = "write:schedules"
+	ScopeIngestSensors  = "ingest:sensors"
+)
+
+var accessTokenScopes = []string{ScopeReadPlants, ScopeWriteSchedules, ScopeIngestSensors}
+
+// Personal access tokens start with this so they can be told apart from
+// Supabase JWTs in the same Authorization header.
+const accessTokenPrefix = "gt_pat_"
+
+// The scope each route needs when called with an access token. Anything
+// not listed (including managing tokens themselves) needs a real login.
+var accessTokenRoutes = map[string]string{
+	"GET /plants":                             ScopeReadPlants,
+	"GET /schedules":                          ScopeReadPlants,
+	"GET /sensors":                            ScopeReadPlants,
+	"GET /sensors/:sensor_id/readings":        ScopeReadPlants,
+	"GET /valves":                             ScopeReadPlants,
+	"GET /valves/:valve_id/runs":              ScopeReadPlants,
+	"GET /schedules/:schedule_id/adjustments": ScopeReadPlants,
+	"GET /plants/:plantid/history":            ScopeReadPlants,
+	"GET /species":                            ScopeReadPlants,
+	"GET /species/:species_id":                ScopeReadPlants,
+	"POST /care/recommendation":               ScopeReadPlants,
+
+	"PATCH /schedules/:schedule_id":           ScopeWriteSchedules,
+	"PUT /schedules/:schedule_id":             ScopeWriteSchedules,
+	"DELETE /schedules/:schedule_id/override": ScopeWriteSchedules,
+	"PUT /schedules/:schedule_id/season":      ScopeWriteSchedules,
+	"POST /schedules/:schedule_id/snooze":     ScopeWriteSchedules,
+	"POST /schedules/:schedule_id/reschedule": ScopeWriteSchedules,
+	"POST /schedules/:schedule_id/skip":       ScopeWriteSchedules,
+	"PUT /schedules/:schedule_id/adaptive":    ScopeWriteSchedules,
+	"PUT /schedules/:schedule_id/assignment":  ScopeWriteSchedules,
+
+	"POST /schedules/:schedule_id/adjustments/:adjustment_id/:decision": ScopeWriteSchedules,
+
+	"POST /sensors/:sensor_id/readings": ScopeIngestSensors,
+}
+
+type AccessToken struct {
+	TokenID    int        `json:"token_id"`
+	Name       string     `json:"name"`
+	Scopes     []string   `json:"scopes"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UserID     string     `json:"-"`
+}
+
+// Where AccessTokenScopes leaves the authenticated token's user for
+// ExtractIDFromJWT.
+const accessTokenUserKey = "access_token_user_id"
+
+func isAccessToken(token string) bool {
+	return strings.HasPrefix(token, accessTokenPrefix)
+}
+
+func generateAccessToken() (string, error) {
+	token, err := generateToken(24)
+	if err != nil {
+		return "", err
+	}
+	return accessTokenPrefix + token, nil
+}
+
+func validateAccessTokenScopes(scopes []string) error {
+	if len(scopes) == 0 {
+		return fmt.Errorf("at least one scope is required")
+	}
+	for _, scope := range scopes {
+		if !slices.Contains(accessTokenScopes, scope) {
+			return fmt.Errorf("unknown scope %q, must be one of %s", scope, strings.Join(accessTokenScopes, ", "))
+		}
+	}
+	return nil
+}
+
+// Authenticates access tokens once per request and keeps them to the routes
+// their scopes allow. Handlers pick the user up through ExtractIDFromJWT.
+// JWT requests pass straight through.
+func AccessTokenScopes() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		tokenString := strings.TrimSpace(strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer "))
+		if !isAccessToken(tokenString) {
+			c.Next()
+			return
+		}
+
+		token, err := Handler.AuthenticateAccessToken(tokenString)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired access token"})
+			return
+		}
+
+		scope, ok := accessTokenRoutes[c.Request.Method+" "+c.FullPath()]
+		if !ok {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Access tokens can't be used for this endpoint"})
+			return
+		}
+		if !slices.Contains(token.Scopes, scope) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Access token is missing the required scope", "required_scope": scope})
+			return
+		}
+		c.Set(accessTokenUserKey, token.UserID)
+		c.Next()
+	}
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestGenerateAccessToken(t *testing.T) {
+	first, err := generateAccessToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := generateAccessToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !isAccessToken(first) {
+		t.Errorf("generated token %q isn't recognised as an access token", first)
+	}
+	if len(first) != len(accessTokenPrefix)+48 {
+		t.Errorf("token length = %d, want %d", len(first), len(accessTokenPrefix)+48)
+	}
+	if first == second {
+		t.Error("two generated tokens are the same")
+	}
+	if hashToken(first) == first || len(hashToken(first)) != 64 {
+		t.Errorf("hashToken() = %q, want a sha256 hex digest", hashToken(first))
+	}
+}
+
+func TestIsAccessToken(t *testing.T) {
+	tests := []struct {
+		token string
+		want  bool
+	}{
+		{"gt_pat_abc", true},
+		{"eyJhbGciOiJIUzI1NiJ9.e30.sig", false},
+		{"", false},
+		{"GT_PAT_abc", false},
+	}
+
+	for _, tt := range tests {
+		if got := isAccessToken(tt.token); got != tt.want {
+			t.Errorf("isAccessToken(%q) = %v, want %v", tt.token, got, tt.want)
+		}
+	}
+}
+
+func TestValidateAccessTokenScopes(t *testing.T) {
+	tests := []struct {
+		name    string
+		scopes  []string
+		wantErr bool
+	}{
+		{"one scope", []string{ScopeReadPlants}, false},
+		{"every scope", accessTokenScopes, false},
+		{"none", nil, true},
+		{"unknown", []string{ScopeReadPlants, "admin"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := validateAccessTokenScopes(tt.scopes); (err != nil) != tt.wantErr {
+				t.Errorf("validateAccessTokenScopes() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// A typo in accessTokenRoutes would silently lock tokens out of a route.
+func TestAccessTokenRoutesExist(t *testing.T) {
+	source, err := os.ReadFile("main.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for route, scope := range accessTokenRoutes {
+		method, path, _ := strings.Cut(route, " ")
+		if !strings.Contains(string(source), "router."+method+"(\""+path+"\",") {
+			t.Errorf("%s (%s) is not a registered route", route, scope)
+		}
+	}
+}
+
+func TestAccessTokenScopesPassesJWTs(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(AccessTokenScopes())
+	router.GET("/plants", func(c *gin.Context) {
+		c.Status(http.StatusNoContent)
+	})
+
+	for _, header := range []string{"", "Bearer eyJhbGciOiJIUzI1NiJ9.e30.sig"} {
+		req := httptest.NewRequest("GET", "/plants", nil)
+		req.Header.Set("Authorization", header)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		if rec.Code != http.StatusNoContent {
+			t.Errorf("Authorization %q got status %d, want it passed through", header, rec.Code)
+		}
+	}
+}
+
+func TestExtractIDFromJWTAccessToken(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	token := accessTokenPrefix + "abc123"
+
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	if _, err := ExtractIDFromJWT(c, token); err == nil {
+		t.Error("ExtractIDFromJWT() should fail for an access token the middleware didn't authenticate")
+	}
+
+	c.Set(accessTokenUserKey, "owner-1")
+	userID, err := ExtractIDFromJWT(c, token)
+	if err != nil || userID != "owner-1" {
+		t.Errorf("ExtractIDFromJWT() = (%q, %v), want the middleware's user", userID, err)
+	}
+}
@@ -0,0 +1,267 @@
+package main
+
+import (
+	"archive/zip"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	AccountDeletionPending  = "pending"
+	AccountDeletionRestored = "restored"
+	AccountDeletionPurged   = "purged"
+)
+
+// A deleted account can be restored for a week. After that the snapshot is
+// dropped and the photos are removed from storage.
+const accountDeletionGrace = 7 * 24 * time.Hour
+
+// Failed storage deletes are retried on later runs, then given up on.
+const maxStorageDeleteAttempts = 5
+
+type AccountDeletion struct {
+	DeletionID  int       `json:"deletion_id"`
+	Status      string    `json:"status"`
+	RequestedAt time.Time `json:"requested_at"`
+	PurgeAfter  time.Time `json:"purge_after"`
+}
+
+// A photo queued for removal once its account is purged.
+type storageObject struct {
+	ID        int
+	URL       string
+	Attempts  int
+	StillUsed bool
+}
+
+// One table of an export. Values are whatever the driver scanned, with
+// []byte turned into strings, so the same rows can go to JSON and CSV.
+type exportTable struct {
+	Name    string
+	Columns []string
+	Rows    [][]any
+}
+
+func scanExportTable(db sqlQueryer, name string, query string, args ...any) (exportTable, error) {
+	table := exportTable{Name: name}
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return table, fmt.Errorf("failed to export %s: %v", name, err)
+	}
+	defer rows.Close()
+
+	table.Columns, err = rows.Columns()
+	if err != nil {
+		return table, fmt.Errorf("failed to read %s columns: %v", name, err)
+	}
+
+	for rows.Next() {
+		values := make([]any, len(table.Columns))
+		pointers := make([]any, len(values))
+		for i := range values {
+			pointers[i] = &values[i]
+		}
+		if err := rows.Scan(pointers...); err != nil {
+			return table, fmt.Errorf("failed to scan %s: %v", name, err)
+		}
+		for i, value := range values {
+			if raw, ok := value.([]byte); ok {
+				values[i] = string(raw)
+			}
+		}
+		table.Rows = append(table.Rows, values)
+	}
+	return table, rows.Err()
+}
+
+func csvValue(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case time.Time:
+		return v.Format(time.RFC3339)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// Writes each table as <name>.json (an array of objects) and <name>.csv.
+func writeAccountExport(w io.Writer, tables []exportTable) error {
+	archive := zip.NewWriter(w)
+
+	for _, table := range tables {
+		objects := make([]map[string]any, 0, len(table.Rows))
+		for _, row := range table.Rows {
+			object := make(map[string]any, len(table.Columns))
+			for i, column := range table.Columns {
+				object[column] = row[i]
+			}
+			objects = append(objects, object)
+		}
+
+		jsonFile, err := archive.Create(table.Name + ".json")
+		if err != nil {
+			return fmt.Errorf("failed to add %s.json: %v", table.Name, err)
+		}
+		encoder := json.NewEncoder(jsonFile)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(objects); err != nil {
+			return fmt.Errorf("failed to write %s.json: %v", table.Name, err)
+		}
+
+		csvFile, err := archive.Create(table.Name + ".csv")
+		if err != nil {
+			return fmt.Errorf("failed to add %s.csv: %v", table.Name, err)
+		}
+		writer := csv.NewWriter(csvFile)
+		writer.Write(table.Columns)
+		for _, row := range table.Rows {
+			record := make([]string, len(row))
+			for i, value := range row {
+				record[i] = csvValue(value)
+			}
+			writer.Write(record)
+		}
+		writer.Flush()
+		if err := writer.Error(); err != nil {
+			return fmt.Errorf("failed to write %s.csv: %v", table.Name, err)
+		}
+	}
+
+	return archive.Close()
+}
+
+// Removes photos from Supabase Storage with the service role key. The app
+// stores public URLs, {SUPABASE_URL}/storage/v1/object/public/{bucket}/{path}.
+type StorageDeleter struct {
+	BaseURL        string
+	ServiceRoleKey string
+	Client         *http.Client
+}
+
+func NewStorageDeleterFromEnv() *StorageDeleter {
+	return &StorageDeleter{
+		BaseURL:        strings.TrimSuffix(os.Getenv("SUPABASE_URL"), "/"),
+		ServiceRoleKey: os.Getenv("SUPABASE_SERVICE_ROLE_KEY"),
+		Client:         &http.Client{Timeout: 15 * time.Second},
+	}
+}
+
+func (deleter *StorageDeleter) Enabled() bool {
+	return deleter.BaseURL != "" && deleter.ServiceRoleKey != ""
+}
+
+// The API URL for deleting the object behind a public URL, or false if the
+// URL isn't one of our storage objects.
+func (deleter *StorageDeleter) objectURL(public_url string) (string, bool) {
+	prefix := deleter.BaseURL + "/storage/v1/object/public/"
+	if !strings.HasPrefix(public_url, prefix) {
+		return "", false
+	}
+	path := strings.SplitN(strings.TrimPrefix(public_url, prefix), "?", 2)[0]
+	if !strings.Contains(path, "/") {
+		return "", false
+	}
+	return deleter.BaseURL + "/storage/v1/object/" + path, true
+}
+
+func (deleter *StorageDeleter) Delete(public_url string) error {
+	objectURL, ok := deleter.objectURL(public_url)
+	if !ok {
+		return fmt.Errorf("not a storage URL for %s", deleter.BaseURL)
+	}
+
+	req, err := http.NewRequest("DELETE", objectURL, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %v", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+deleter.ServiceRoleKey)
+	req.Header.Set("apikey", deleter.ServiceRoleKey)
+
+	resp, err := deleter.Client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to make request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	// Already gone is as good as deleted
+	if resp.StatusCode == http.StatusNotFound {
+		return nil
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		snippet, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("storage returned %d: %s", resp.StatusCode, string(snippet))
+	}
+	return nil
+}
+
+// Deletes the photos of purged accounts. URLs on some other host, or still
+// used by a plant (say one that was transferred away), are left alone.
+func (deleter *StorageDeleter) Run() (int, error) {
+	objects, err := Handler.FetchDueStorageDeletions(50)
+	if err != nil {
+		return 0, err
+	}
+
+	deleted := 0
+	for _, object := range objects {
+		if _, ours := deleter.objectURL(object.URL); object.StillUsed || !ours {
+			if err := Handler.RecordStorageDeletion(object.ID, "kept", nil); err != nil {
+				return deleted, err
+			}
+			continue
+		}
+
+		deleteErr := deleter.Delete(object.URL)
+		status := "deleted"
+		if deleteErr != nil {
+			status = "pending"
+			if object.Attempts+1 >= maxStorageDeleteAttempts {
+				status = "failed"
+			}
+		}
+		if err := Handler.RecordStorageDeletion(object.ID, status, deleteErr); err != nil {
+			return deleted, err
+		}
+		if deleteErr == nil {
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+// Drops the snapshots of deletions past their grace period, then removes
+// their photos. Without Supabase credentials the photos stay queued.
+func StartAccountPurge(deleter *StorageDeleter, interval time.Duration) {
+	if !deleter.Enabled() {
+		fmt.Println("SUPABASE_URL or SUPABASE_SERVICE_ROLE_KEY not set, photos of deleted accounts won't be removed from storage")
+	}
+
+	go func() {
+		for {
+			purged, err := Handler.PurgeAccountDeletions()
+			if err != nil {
+				fmt.Println("ERROR purging deleted accounts:", err)
+			} else if purged > 0 {
+				fmt.Println("Deleted accounts purged:", purged)
+			}
+
+			if deleter.Enabled() {
+				deleted, err := deleter.Run()
+				if err != nil {
+					fmt.Println("ERROR deleting storage objects:", err)
+				} else if deleted > 0 {
+					fmt.Println("Storage objects deleted:", deleted)
+				}
+			}
+			time.Sleep(interval)
+		}
+	}()
+}
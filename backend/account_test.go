@@ -0,0 +1,173 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCSVValue(t *testing.T) {
+	tests := []struct {
+		name  string
+		value any
+		want  string
+	}{
+		{"nil", nil, ""},
+		{"string", "Monstera", "Monstera"},
+		{"int", int64(42), "42"},
+		{"float", 1.5, "1.5"},
+		{"bool", true, "true"},
+		{"time", time.Date(2025, time.March, 10, 8, 30, 0, 0, time.UTC), "2025-03-10T08:30:00Z"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := csvValue(tt.value); got != tt.want {
+				t.Errorf("csvValue(%v) = %q, want %q", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStorageObjectURL(t *testing.T) {
+	deleter := &StorageDeleter{BaseURL: "https://abc.supabase.co"}
+
+	tests := []struct {
+		name   string
+		url    string
+		want   string
+		wantOK bool
+	}{
+		{"public object", "https://abc.supabase.co/storage/v1/object/public/plants/u1/photo.jpg", "https://abc.supabase.co/storage/v1/object/plants/u1/photo.jpg", true},
+		{"query string dropped", "https://abc.supabase.co/storage/v1/object/public/plants/photo.jpg?t=123", "https://abc.supabase.co/storage/v1/object/plants/photo.jpg", true},
+		{"bucket only", "https://abc.supabase.co/storage/v1/object/public/plants", "", false},
+		{"other project", "https://xyz.supabase.co/storage/v1/object/public/plants/photo.jpg", "", false},
+		{"other host", "https://images.example.com/photo.jpg", "", false},
+		{"signed URL", "https://abc.supabase.co/storage/v1/object/sign/plants/photo.jpg", "", false},
+		{"empty", "", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := deleter.objectURL(tt.url)
+			if ok != tt.wantOK || got != tt.want {
+				t.Errorf("objectURL(%q) = (%q, %v), want (%q, %v)", tt.url, got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestStorageDelete(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		wantErr bool
+	}{
+		{"deleted", http.StatusOK, false},
+		{"already gone", http.StatusNotFound, false},
+		{"unauthorized", http.StatusUnauthorized, true},
+		{"server error", http.StatusInternalServerError, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotPath, gotAuth string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				gotPath = r.Method + " " + r.URL.Path
+				gotAuth = r.Header.Get("Authorization")
+				w.WriteHeader(tt.status)
+			}))
+			defer server.Close()
+
+			deleter := &StorageDeleter{BaseURL: server.URL, ServiceRoleKey: "service-key", Client: server.Client()}
+			err := deleter.Delete(server.URL + "/storage/v1/object/public/plants/photo.jpg")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Delete() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if gotPath != "DELETE /storage/v1/object/plants/photo.jpg" {
+				t.Errorf("request = %q", gotPath)
+			}
+			if gotAuth != "Bearer service-key" {
+				t.Errorf("Authorization = %q", gotAuth)
+			}
+		})
+	}
+}
+
+func TestWriteAccountExport(t *testing.T) {
+	created := time.Date(2025, time.March, 10, 8, 30, 0, 0, time.UTC)
+	tables := []exportTable{
+		{Name: "plants", Columns: []string{"plant_id", "plant_pet_name", "created_at"}, Rows: [][]any{
+			{int64(1), "Fernando", created},
+			{int64(2), nil, created},
+		}},
+		{Name: "care_notes", Columns: []string{"note"}},
+	}
+
+	var buf bytes.Buffer
+	if err := writeAccountExport(&buf, tables); err != nil {
+		t.Fatal(err)
+	}
+
+	archive, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := map[string][]byte{}
+	for _, file := range archive.File {
+		reader, err := file.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		files[file.Name], _ = io.ReadAll(reader)
+		reader.Close()
+	}
+
+	tests := []struct {
+		file     string
+		wantRows int
+	}{
+		{"plants.json", 2},
+		{"plants.csv", 3},
+		{"care_notes.json", 0},
+		{"care_notes.csv", 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			content, ok := files[tt.file]
+			if !ok {
+				t.Fatalf("%s missing from the archive", tt.file)
+			}
+			var rows int
+			if strings.HasSuffix(tt.file, ".json") {
+				var objects []map[string]any
+				if err := json.Unmarshal(content, &objects); err != nil {
+					t.Fatal(err)
+				}
+				rows = len(objects)
+			} else {
+				records, err := csv.NewReader(bytes.NewReader(content)).ReadAll()
+				if err != nil {
+					t.Fatal(err)
+				}
+				rows = len(records)
+			}
+			if rows != tt.wantRows {
+				t.Errorf("%s has %d rows, want %d", tt.file, rows, tt.wantRows)
+			}
+		})
+	}
+
+	records, _ := csv.NewReader(bytes.NewReader(files["plants.csv"])).ReadAll()
+	if got := records[2]; got[1] != "" || got[2] != "2025-03-10T08:30:00Z" {
+		t.Errorf("plants.csv row = %q, want an empty name and an RFC 3339 time", got)
+	}
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+const (
+	AdaptiveModeOff     = "off"
+	AdaptiveModeSuggest = "suggest"
+	AdaptiveModeAuto    = "auto"
+)
+
+// What the care history says about a plant since its interval last changed.
+type IntervalSignals struct {
+	Completions   int     `json:"completions"`
+	AvgDaysLate   float64 `json:"avg_days_late"`
+	Postponements int     `json:"postponements"`
+	SoilWetNotes  int     `json:"soil_wet_notes"`
+	SoilDryNotes  int     `json:"soil_dry_notes"`
+	HealthChange  int     `json:"health_change"`
+	HealthScans   int     `json:"health_scans"`
+}
+
+type IntervalAdjustment struct {
+	AdjustmentID int       `json:"adjustment_id"`
+	ScheduleID   int       `json:"schedule_id"`
+	PlantID      int       `json:"plant_id"`
+	OldEvery     int       `json:"old_every"`
+	OldUnit      string    `json:"old_unit"`
+	NewEvery     int       `json:"new_every"`
+	NewUnit      string    `json:"new_unit"`
+	Reasons      []string  `json:"reasons"`
+	Status       string    `json:"status"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+func intervalInDays(every int, unit string) int {
+	days := every
+	switch strings.TrimSuffix(strings.ToLower(strings.TrimSpace(unit)), "s") {
+	case "week":
+		days = every * 7
+	case "month":
+		days = every * 30
+	case "year":
+		days = every * 365
+	}
+	if days < 1 {
+		return 1
+	}
+	return days
+}
+
+// Adjusted intervals stay within half and double the interval the plant
+// started with, and between 1 and 60 days.
+func adaptiveBounds(initial_days int) (int, int) {
+	low := int(math.Max(1, math.Floor(float64(initial_days)/2)))
+	high := int(math.Min(60, float64(initial_days*2)))
+	if high < low {
+		high = low
+	}
+	return low, high
+}
+
+// Returns the suggested interval in days and why. A suggestion equal to
+// current_days means the signals don't justify a change.
+func suggestInterval(current_days int, initial_days int, signals IntervalSignals) (int, []string) {
+	var reasons []string
+	step := int(math.Max(1, math.Round(float64(current_days)*0.25)))
+	change := 0
+
+	healthDropping := signals.HealthScans >= 2 && signals.HealthChange <= -10
+
+	switch {
+	case signals.SoilWetNotes >= 2 && signals.SoilWetNotes > signals.SoilDryNotes:
+		change = step
+		reasons = append(reasons, fmt.Sprintf("Soil was reported still wet %d times", signals.SoilWetNotes))
+		if healthDropping {
+			reasons = append(reasons, fmt.Sprintf("Health fell %d points, which can point to overwatering", -signals.HealthChange))
+		}
+	case signals.SoilDryNotes >= 2 && signals.SoilDryNotes > signals.SoilWetNotes:
+		change = -step
+		reasons = append(reasons, fmt.Sprintf("Soil was reported dry %d times", signals.SoilDryNotes))
+		if healthDropping {
+			reasons = append(reasons, fmt.Sprintf("Health fell %d points, which can point to underwatering", -signals.HealthChange))
+		}
+	case signals.Postponements >= 2 && !healthDropping:
+		change = step
+		reasons = append(reasons, fmt.Sprintf("Watering was snoozed, skipped or moved %d times", signals.Postponements))
+	case signals.Completions >= 3 && signals.AvgDaysLate >= 1 && !healthDropping:
+		change = int(math.Min(float64(step), math.Round(signals.AvgDaysLate)))
+		reasons = append(reasons, fmt.Sprintf("Watered on average %.1f days after it was due while health held up", signals.AvgDaysLate))
+	case signals.Completions >= 3 && signals.AvgDaysLate <= -1:
+		change = -int(math.Min(float64(step), math.Round(-signals.AvgDaysLate)))
+		reasons = append(reasons, fmt.Sprintf("Watered on average %.1f days before it was due", -signals.AvgDaysLate))
+	}
+
+	if change == 0 {
+		return current_days, nil
+	}
+
+	low, high := adaptiveBounds(initial_days)
+	suggested := current_days + change
+	if suggested < low {
+		suggested = low
+	}
+	if suggested > high {
+		suggested = high
+	}
+	if suggested != current_days+change {
+		reasons = append(reasons, fmt.Sprintf("Kept within the allowed range of %d to %d days", low, high))
+	}
+
+	return suggested, reasons
+}
+
+func StartAdaptiveIntervals(interval time.Duration) {
+	go func() {
+		for {
+			changed, err := Handler.EvaluateAdaptiveIntervals()
+			if err != nil {
+				fmt.Println("ERROR evaluating adaptive intervals:", err)
+			} else if changed > 0 {
+				fmt.Println("Adaptive interval adjustments created:", changed)
+			}
+			time.Sleep(interval)
+		}
+	}()
+}
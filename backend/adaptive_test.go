@@ -0,0 +1,80 @@
+package main
+
+import "testing"
+
+func TestIntervalInDays(t *testing.T) {
+	tests := []struct {
+		every int
+		unit  string
+		want  int
+	}{
+		{3, "day", 3},
+		{3, "days", 3},
+		{2, "Weeks", 14},
+		{1, " month ", 30},
+		{1, "year", 365},
+		{0, "day", 1},
+		{5, "fortnight", 5},
+	}
+
+	for _, tt := range tests {
+		if got := intervalInDays(tt.every, tt.unit); got != tt.want {
+			t.Errorf("intervalInDays(%d, %q) = %d, want %d", tt.every, tt.unit, got, tt.want)
+		}
+	}
+}
+
+func TestAdaptiveBounds(t *testing.T) {
+	tests := []struct {
+		initial int
+		low     int
+		high    int
+	}{
+		{7, 3, 14},
+		{1, 1, 2},
+		{40, 20, 60},
+		{200, 100, 100},
+	}
+
+	for _, tt := range tests {
+		low, high := adaptiveBounds(tt.initial)
+		if low != tt.low || high != tt.high {
+			t.Errorf("adaptiveBounds(%d) = %d, %d, want %d, %d", tt.initial, low, high, tt.low, tt.high)
+		}
+	}
+}
+
+func TestSuggestInterval(t *testing.T) {
+	tests := []struct {
+		name        string
+		current     int
+		initial     int
+		signals     IntervalSignals
+		want        int
+		wantReasons int
+	}{
+		{"no signals", 8, 8, IntervalSignals{}, 8, 0},
+		{"soil still wet", 8, 8, IntervalSignals{SoilWetNotes: 2}, 10, 1},
+		{"soil dry with falling health", 8, 8, IntervalSignals{SoilDryNotes: 3, HealthScans: 2, HealthChange: -15}, 6, 2},
+		{"wet and dry notes cancel out", 8, 8, IntervalSignals{SoilWetNotes: 2, SoilDryNotes: 2}, 8, 0},
+		{"postponed often", 8, 8, IntervalSignals{Postponements: 2}, 10, 1},
+		{"postponed but health falling", 8, 8, IntervalSignals{Postponements: 3, HealthScans: 2, HealthChange: -20}, 8, 0},
+		{"watered late", 8, 8, IntervalSignals{Completions: 3, AvgDaysLate: 1.2}, 9, 1},
+		{"watered early", 8, 8, IntervalSignals{Completions: 4, AvgDaysLate: -3}, 6, 1},
+		{"too few completions", 8, 8, IntervalSignals{Completions: 2, AvgDaysLate: 3}, 8, 0},
+		{"clamped to double the initial", 14, 7, IntervalSignals{SoilWetNotes: 3}, 14, 2},
+		{"clamped to half the initial", 4, 8, IntervalSignals{SoilDryNotes: 3}, 4, 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, reasons := suggestInterval(tt.current, tt.initial, tt.signals)
+			if got != tt.want {
+				t.Errorf("suggestInterval() = %d, want %d", got, tt.want)
+			}
+			if len(reasons) != tt.wantReasons {
+				t.Errorf("suggestInterval() reasons = %q, want %d", reasons, tt.wantReasons)
+			}
+		})
+	}
+}
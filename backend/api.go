@@ -1,12 +1,16 @@
 package main
 
 import (
+	"bytes"
 	"fmt"
 	"log"
 	"net/http"
+	"net/mail"
 	"os"
+	"slices"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
@@ -23,7 +27,7 @@ func HandleAddPlant(c *gin.Context) {
 	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
 	tokenString = strings.TrimSpace(tokenString)
 
-	userID, err := ExtractIDFromJWT(tokenString)
+	userID, err := ExtractIDFromJWT(c, tokenString)
 	if err != nil {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired JWT"})
 		return
@@ -32,8 +36,11 @@ func HandleAddPlant(c *gin.Context) {
 
 	// Define input struct accepting image_url and other plant fields
 	type AddPlantRequest struct {
-		ImageURL  string `json:"image_url" binding:"required"`
-		PlantName string `json:"plant_pet_name" binding:"required"`
+		ImageURL    string `json:"image_url" binding:"required"`
+		PlantName   string `json:"plant_pet_name" binding:"required"`
+		HouseholdID *int   `json:"household_id"`
+		PotSizeCM   int    `json:"pot_size_cm"`
+		Light       string `json:"light"`
 	}
 
 	var req AddPlantRequest
@@ -43,8 +50,17 @@ func HandleAddPlant(c *gin.Context) {
 		return
 	}
 
+	if err := validateCareConditions(req.PotSizeCM, req.Light); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
 	fmt.Println("Received image URL:", req.ImageURL)
 
+	if !checkCanAddToHousehold(c, userID, req.HouseholdID) {
+		return
+	}
+
 	openaiAPIKey := os.Getenv("OPENAI_API_KEY")
 	log.Println("Debug - HandleAddPlant - OPENAI_API_KEY exists:", openaiAPIKey != "")
 	log.Println("Debug - Current working directory:", os.Getenv("PWD"))
@@ -62,20 +78,35 @@ func HandleAddPlant(c *gin.Context) {
 	// // Classify the plant using OpenAI
 	fmt.Println("Classifying plant with OpenAI...")
 	classification, err := classifyPlantWithOpenAI(req.ImageURL, openaiAPIKey)
+	classified := err == nil
 	if err != nil {
 		fmt.Printf("OpenAI classification failed: %v\n", err)
-		// Fall back to default values if classification fails
+		// No confidence, so the interval comes from the offline rules below
 		classification = &PlantClassification{
-			PlantName:        "Unknown Plant",
-			ScientificName:   "Unknown Species",
-			Species:          "Unknown",
-			WaterRepeatEvery: 1,
-			WaterRepeatUnit:  "day",
-			PlantHealth:      100,
+			PlantName:      "Unknown Plant",
+			ScientificName: "Unknown Species",
+			Species:        "Unknown",
+			PlantHealth:    100,
 		}
 	}
 
 	fmt.Printf("Classification result: %+v\n", classification)
+	aiOutput := *classification
+
+	// Tie the answer to the catalog, whose interval wins if the AI wasn't sure
+	var speciesID *int
+	species := resolveClassification(classification)
+	if species != nil {
+		speciesID = &species.SpeciesID
+	}
+
+	// An interval the AI wasn't sure of is swapped for the care rules', which
+	// also account for the pot and light
+	care := recommendCareFor(userID, species, req.PotSizeCM, req.Light,
+		classification.PlantName, classification.ScientificName, classification.Species)
+	if classification.Unsure() {
+		classification.WaterRepeatEvery, classification.WaterRepeatUnit = care.WaterEveryDays, "day"
+	}
 
 	plant_id, err := Handler.AddPlant(
 		userID,
@@ -85,6 +116,8 @@ func HandleAddPlant(c *gin.Context) {
 		req.ImageURL,
 		req.PlantName,              // Generate a pet name based on the plant name
 		classification.PlantHealth, // Default health value
+		req.HouseholdID,
+		speciesID,
 	)
 	if err != nil {
 		fmt.Println(err)
@@ -92,19 +125,49 @@ func HandleAddPlant(c *gin.Context) {
 		return
 	}
 
-	msg, err := Handler.CreateNewSchedule(userID, plant_id, req.PlantName, classification.WaterRepeatEvery, classification.WaterRepeatUnit)
+	// Without a classification there's no health score to record, only the
+	// fallback. Kept as it came from the model, before the catalog or rules
+	// touched it.
+	if classified {
+		if err := Handler.RecordPlantHealth(userID, plant_id, classification.PlantHealth, req.ImageURL); err != nil {
+			fmt.Println(err)
+		}
+		if err := Handler.RecordClassification(userID, plant_id, req.ImageURL, aiOutput, speciesID); err != nil {
+			fmt.Println(err)
+		}
+	}
+
+	msg, err := Handler.CreateNewSchedule(userID, plant_id, req.PlantName, classification.WaterRepeatEvery, classification.WaterRepeatUnit,
+		parseWaterAmountML(classification.WaterAmount))
 	if err != nil {
 		fmt.Println(err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err})
 		return
 	}
 
+	// Apply the current season to the interval the model picked
+	if _, err := Handler.RecalculateSeasonalIntervals(userID); err != nil {
+		fmt.Println(err)
+	}
+
 	c.JSON(http.StatusOK, gin.H{
 		"message": msg,
+		"care":    care,
 	})
 }
 
-func ExtractIDFromJWT(jwtToken string) (string, error) {
+func ExtractIDFromJWT(c *gin.Context, jwtToken string) (string, error) {
+	// Personal access tokens are accepted anywhere a JWT is. The
+	// AccessTokenScopes middleware has already authenticated the token and
+	// checked its scopes, and left the user on the context.
+	if isAccessToken(jwtToken) {
+		userID := c.GetString(accessTokenUserKey)
+		if userID == "" {
+			return "", fmt.Errorf("access token was not authenticated")
+		}
+		return userID, nil
+	}
+
 	// Parse the JWT without verifying (for demo - for production always verify)
 	token, _, err := new(jwt.Parser).ParseUnverified(jwtToken, jwt.MapClaims{})
 	if err != nil {
@@ -120,6 +183,59 @@ func ExtractIDFromJWT(jwtToken string) (string, error) {
 	return "", fmt.Errorf("user id (sub) not found in token")
 }
 
+// Checks the signature against the Supabase project's JWT secret and that
+// the token hasn't expired. Anything that grants access on a claim other
+// than sub (an invited email, is_anonymous) has to go through this.
+func ParseVerifiedJWT(jwtToken string) (jwt.MapClaims, error) {
+	secret := os.Getenv("SUPABASE_JWT_SECRET")
+	if secret == "" {
+		return nil, fmt.Errorf("SUPABASE_JWT_SECRET is not set")
+	}
+
+	token, err := jwt.Parse(jwtToken, func(token *jwt.Token) (any, error) {
+		return []byte(secret), nil
+	}, jwt.WithValidMethods([]string{"HS256"}), jwt.WithExpirationRequired())
+	if err != nil {
+		return nil, err
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return nil, fmt.Errorf("unexpected claims in token")
+	}
+	return claims, nil
+}
+
+// Only trusted from a verified token, since invites are claimed by email.
+func ExtractEmailFromJWT(jwtToken string) (string, error) {
+	claims, err := ParseVerifiedJWT(jwtToken)
+	if err != nil {
+		return "", err
+	}
+
+	if email, ok := claims["email"].(string); ok && email != "" {
+		return email, nil
+	}
+	return "", fmt.Errorf("email not found in token")
+}
+
+// Supabase marks sessions from signInAnonymously with is_anonymous. Both
+// sides of an account merge go through this, so neither token is trusted
+// without a valid signature and expiry.
+func VerifiedJWTIdentity(jwtToken string) (string, bool, error) {
+	claims, err := ParseVerifiedJWT(jwtToken)
+	if err != nil {
+		return "", false, err
+	}
+
+	sub, ok := claims["sub"].(string)
+	if !ok || sub == "" {
+		return "", false, fmt.Errorf("user id (sub) not found in token")
+	}
+	anonymous, _ := claims["is_anonymous"].(bool)
+	return sub, anonymous, nil
+}
+
 func HandleFetchPlants(c *gin.Context) {
 	authHeader := c.GetHeader("Authorization")
 
@@ -130,7 +246,7 @@ func HandleFetchPlants(c *gin.Context) {
 
 	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
 	tokenString = strings.TrimSpace(tokenString)
-	userID, err := ExtractIDFromJWT(tokenString)
+	userID, err := ExtractIDFromJWT(c, tokenString)
 	if err != nil {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired JWT"})
 		return
@@ -153,7 +269,7 @@ func HandleFetchSchedule(c *gin.Context) {
 
 	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
 	tokenString = strings.TrimSpace(tokenString)
-	userID, err := ExtractIDFromJWT(tokenString)
+	userID, err := ExtractIDFromJWT(c, tokenString)
 	if err != nil {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired JWT"})
 		return
@@ -179,7 +295,7 @@ func HandleCanAddPlant(c *gin.Context) {
 	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
 	tokenString = strings.TrimSpace(tokenString)
 
-	userID, err := ExtractIDFromJWT(tokenString)
+	userID, err := ExtractIDFromJWT(c, tokenString)
 	if err != nil {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired JWT"})
 		return
@@ -211,7 +327,7 @@ func HandleUpdatePlantPetName(c *gin.Context) {
 	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
 	tokenString = strings.TrimSpace(tokenString)
 
-	userID, err := ExtractIDFromJWT(tokenString)
+	userID, err := ExtractIDFromJWT(c, tokenString)
 	if err != nil {
 		print("ERROR", err)
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired JWT"})
@@ -225,6 +341,11 @@ func HandleUpdatePlantPetName(c *gin.Context) {
 		return
 	}
 
+	ownerID, ok := resolvePlantAccess(c, userID, plantID, HouseholdEditor)
+	if !ok {
+		return
+	}
+
 	var request struct {
 		NewPetName string `json:"plant_pet_name" binding:"required"`
 	}
@@ -236,7 +357,7 @@ func HandleUpdatePlantPetName(c *gin.Context) {
 	newPetName := request.NewPetName
 	print("TESTING", plantID, newPetName)
 
-	msg, err := Handler.UpdatePlantPetName(userID, plantID, newPetName)
+	msg, err := Handler.UpdatePlantPetName(ownerID, plantID, newPetName)
 	if err != nil {
 		print("ERROR", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update plant pet name", "details": err.Error()})
@@ -256,7 +377,7 @@ func HandleCompleteSchedule(c *gin.Context) {
 
 	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
 	tokenString = strings.TrimSpace(tokenString)
-	userID, err := ExtractIDFromJWT(tokenString)
+	userID, err := ExtractIDFromJWT(c, tokenString)
 	if err != nil {
 		fmt.Println("ERR", err)
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired JWT"})
@@ -271,7 +392,12 @@ func HandleCompleteSchedule(c *gin.Context) {
 		return
 	}
 
-	msg, err := Handler.CompleteWaterSchedule(userID, scheduleID)
+	ownerID, ok := resolveScheduleAccess(c, userID, scheduleID, HouseholdEditor)
+	if !ok {
+		return
+	}
+
+	msg, err := Handler.completeWaterScheduleBy(ownerID, scheduleID, memberAttribution(ownerID, userID))
 	if err != nil {
 		fmt.Println("ERR", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update plant pet name", "details": err.Error()})
@@ -292,7 +418,7 @@ func HandleDeletePlant(c *gin.Context) {
 	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
 	tokenString = strings.TrimSpace(tokenString)
 
-	userID, err := ExtractIDFromJWT(tokenString)
+	userID, err := ExtractIDFromJWT(c, tokenString)
 	if err != nil {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired JWT"})
 		return
@@ -305,7 +431,12 @@ func HandleDeletePlant(c *gin.Context) {
 		return
 	}
 
-	msg, err := Handler.DeletePlant(userID, plantID)
+	ownerID, ok := resolvePlantAccess(c, userID, plantID, HouseholdOwner)
+	if !ok {
+		return
+	}
+
+	msg, err := Handler.DeletePlant(ownerID, plantID)
 	if err != nil {
 		print(err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update plant pet name", "details": err.Error()})
@@ -324,7 +455,7 @@ func HandleUpdatePlantPhoto(c *gin.Context) {
 
 	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
 	tokenString = strings.TrimSpace(tokenString)
-	userID, err := ExtractIDFromJWT(tokenString)
+	userID, err := ExtractIDFromJWT(c, tokenString)
 	if err != nil {
 		fmt.Println("ERR", err)
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired JWT"})
@@ -339,6 +470,11 @@ func HandleUpdatePlantPhoto(c *gin.Context) {
 		return
 	}
 
+	ownerID, ok := resolvePlantAccess(c, userID, plantID, HouseholdEditor)
+	if !ok {
+		return
+	}
+
 	var request struct {
 		ImageURL string `json:"image_url" binding:"required"`
 	}
@@ -348,12 +484,3497 @@ func HandleUpdatePlantPhoto(c *gin.Context) {
 		return
 	}
 
-	msg, err := Handler.UpdatePlantPhoto(userID, plantID, request.ImageURL)
+	msg, err := Handler.UpdatePlantPhoto(ownerID, plantID, request.ImageURL)
 	if err != nil {
 		fmt.Println("ERR", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update plant pet name", "details": err.Error()})
 		return
 	}
 
+	// A new photo is a chance to re-check health, the trend feeds adaptive
+	// watering. The species is already known, so only health is asked for.
+	scientificName, err := Handler.FetchPlantScientificName(ownerID, plantID)
+	if err != nil {
+		fmt.Println(err)
+	} else if score, err := checkPlantHealthWithOpenAI(request.ImageURL, os.Getenv("OPENAI_API_KEY"), scientificName); err != nil {
+		fmt.Println(err)
+	} else if err := Handler.RecordPlantHealth(ownerID, plantID, score, request.ImageURL); err != nil {
+		fmt.Println(err)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": msg})
+}
+
+func HandleSaveLocation(c *gin.Context) {
+	authHeader := c.GetHeader("Authorization")
+	if authHeader == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "JWT_Token header is required"})
+		return
+	}
+
+	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
+	tokenString = strings.TrimSpace(tokenString)
+	userID, err := ExtractIDFromJWT(c, tokenString)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired JWT"})
+		return
+	}
+
+	var request struct {
+		Latitude  *float64 `json:"latitude" binding:"required"`
+		Longitude *float64 `json:"longitude" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+		return
+	}
+
+	if *request.Latitude < -90 || *request.Latitude > 90 || *request.Longitude < -180 || *request.Longitude > 180 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Latitude or longitude out of range"})
+		return
+	}
+
+	msg, err := Handler.SaveUserLocation(userID, *request.Latitude, *request.Longitude)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save location", "details": err.Error()})
+		return
+	}
+
+	// The hemisphere may have changed, so bring the intervals up to date
+	if _, err := Handler.RecalculateSeasonalIntervals(userID); err != nil {
+		fmt.Println(err)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": msg})
+}
+
+func HandleFetchSeasonalProfiles(c *gin.Context) {
+	authHeader := c.GetHeader("Authorization")
+	if authHeader == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "JWT_Token header is required"})
+		return
+	}
+
+	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
+	tokenString = strings.TrimSpace(tokenString)
+	userID, err := ExtractIDFromJWT(c, tokenString)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired JWT"})
+		return
+	}
+
+	profiles, err := Handler.FetchSeasonalProfiles(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch seasonal profiles", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"profiles": profiles, "defaults": defaultSeasonalProfiles})
+}
+
+func HandleAddSeasonalProfile(c *gin.Context) {
+	authHeader := c.GetHeader("Authorization")
+	if authHeader == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "JWT_Token header is required"})
+		return
+	}
+
+	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
+	tokenString = strings.TrimSpace(tokenString)
+	userID, err := ExtractIDFromJWT(c, tokenString)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired JWT"})
+		return
+	}
+
+	var request struct {
+		PlantID    *int    `json:"plant_id"`
+		Species    string  `json:"species"`
+		Label      string  `json:"label"`
+		StartMonth int     `json:"start_month" binding:"required"`
+		EndMonth   int     `json:"end_month" binding:"required"`
+		Multiplier float64 `json:"multiplier" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+		return
+	}
+
+	profile := SeasonalProfile{
+		PlantID:    request.PlantID,
+		Species:    strings.TrimSpace(request.Species),
+		Label:      request.Label,
+		StartMonth: request.StartMonth,
+		EndMonth:   request.EndMonth,
+		Multiplier: request.Multiplier,
+	}
+	if err := validateSeasonalProfile(profile); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// A plant's own profile lives with the plant's owner, whose schedules it
+	// adjusts
+	ownerID := userID
+	if profile.PlantID != nil {
+		var ok bool
+		if ownerID, ok = resolvePlantAccess(c, userID, *profile.PlantID, HouseholdEditor); !ok {
+			return
+		}
+	}
+
+	profileID, err := Handler.AddSeasonalProfile(ownerID, profile)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create seasonal profile", "details": err.Error()})
+		return
+	}
+
+	if _, err := Handler.RecalculateSeasonalIntervals(ownerID); err != nil {
+		fmt.Println(err)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"profile_id": profileID})
+}
+
+func HandleDeleteSeasonalProfile(c *gin.Context) {
+	authHeader := c.GetHeader("Authorization")
+	if authHeader == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "JWT_Token header is required"})
+		return
+	}
+
+	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
+	tokenString = strings.TrimSpace(tokenString)
+	userID, err := ExtractIDFromJWT(c, tokenString)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired JWT"})
+		return
+	}
+
+	profileID, err := strconv.Atoi(c.Param("profile_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid profile ID"})
+		return
+	}
+
+	ownerID, plantID, err := Handler.FetchSeasonalProfileOwner(profileID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Seasonal profile not found", "details": err.Error()})
+		return
+	}
+	if ownerID != userID {
+		if plantID == nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Seasonal profile not found"})
+			return
+		}
+		if _, ok := resolvePlantAccess(c, userID, *plantID, HouseholdEditor); !ok {
+			return
+		}
+	}
+
+	msg, err := Handler.DeleteSeasonalProfile(ownerID, profileID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete seasonal profile", "details": err.Error()})
+		return
+	}
+
+	if _, err := Handler.RecalculateSeasonalIntervals(ownerID); err != nil {
+		fmt.Println(err)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": msg})
+}
+
+func HandleOverrideSeasonMultiplier(c *gin.Context) {
+	authHeader := c.GetHeader("Authorization")
+	if authHeader == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "JWT_Token header is required"})
+		return
+	}
+
+	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
+	tokenString = strings.TrimSpace(tokenString)
+	userID, err := ExtractIDFromJWT(c, tokenString)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired JWT"})
+		return
+	}
+
+	scheduleID, err := strconv.Atoi(c.Param("schedule_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid schedule ID"})
+		return
+	}
+
+	ownerID, ok := resolveScheduleAccess(c, userID, scheduleID, HouseholdEditor)
+	if !ok {
+		return
+	}
+
+	// Sending "multiplier": null removes the override
+	var request struct {
+		Multiplier *float64 `json:"multiplier"`
+	}
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+		return
+	}
+
+	if request.Multiplier != nil && (*request.Multiplier <= 0 || *request.Multiplier > 10) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "multiplier must be greater than 0 and at most 10"})
+		return
+	}
+
+	msg, err := Handler.SetSeasonMultiplierOverride(ownerID, scheduleID, request.Multiplier)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update season multiplier", "details": err.Error()})
+		return
+	}
+
+	if _, err := Handler.RecalculateSeasonalIntervals(ownerID); err != nil {
+		fmt.Println(err)
+	}
+
 	c.JSON(http.StatusOK, gin.H{"message": msg})
 }
+
+func HandleUpdatePlantEnvironment(c *gin.Context) {
+	authHeader := c.GetHeader("Authorization")
+	if authHeader == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "JWT_Token header is required"})
+		return
+	}
+
+	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
+	tokenString = strings.TrimSpace(tokenString)
+	userID, err := ExtractIDFromJWT(c, tokenString)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired JWT"})
+		return
+	}
+
+	plantID, err := strconv.Atoi(c.Param("plantid"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid plant ID"})
+		return
+	}
+
+	ownerID, ok := resolvePlantAccess(c, userID, plantID, HouseholdEditor)
+	if !ok {
+		return
+	}
+
+	// Leaving out latitude/longitude falls back to the user's location
+	var request struct {
+		IsOutdoor *bool    `json:"is_outdoor" binding:"required"`
+		Latitude  *float64 `json:"latitude"`
+		Longitude *float64 `json:"longitude"`
+	}
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+		return
+	}
+
+	if (request.Latitude == nil) != (request.Longitude == nil) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "latitude and longitude must be provided together"})
+		return
+	}
+	if request.Latitude != nil && (*request.Latitude < -90 || *request.Latitude > 90 || *request.Longitude < -180 || *request.Longitude > 180) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Latitude or longitude out of range"})
+		return
+	}
+
+	msg, err := Handler.UpdatePlantEnvironment(ownerID, plantID, *request.IsOutdoor, request.Latitude, request.Longitude)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update plant environment", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": msg})
+}
+
+// Accepts Go durations ("90m", "4h") plus whole days ("2d").
+func parseSnoozeDuration(value string) (time.Duration, error) {
+	value = strings.TrimSpace(value)
+	var duration time.Duration
+	if days, found := strings.CutSuffix(value, "d"); found {
+		n, err := strconv.Atoi(days)
+		if err != nil {
+			return 0, fmt.Errorf("invalid duration %q", value)
+		}
+		duration = time.Duration(n) * 24 * time.Hour
+	} else {
+		parsed, err := time.ParseDuration(value)
+		if err != nil {
+			return 0, fmt.Errorf("invalid duration %q", value)
+		}
+		duration = parsed
+	}
+
+	if duration <= 0 || duration > 30*24*time.Hour {
+		return 0, fmt.Errorf("duration must be positive and at most 30 days")
+	}
+	return duration, nil
+}
+
+func HandleSnoozeSchedule(c *gin.Context) {
+	authHeader := c.GetHeader("Authorization")
+	if authHeader == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "JWT_Token header is required"})
+		return
+	}
+
+	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
+	tokenString = strings.TrimSpace(tokenString)
+	userID, err := ExtractIDFromJWT(c, tokenString)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired JWT"})
+		return
+	}
+
+	scheduleID, err := strconv.Atoi(c.Param("schedule_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid schedule ID"})
+		return
+	}
+
+	ownerID, ok := resolveScheduleAccess(c, userID, scheduleID, HouseholdEditor)
+	if !ok {
+		return
+	}
+
+	var request struct {
+		Duration string `json:"duration" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+		return
+	}
+
+	duration, err := parseSnoozeDuration(request.Duration)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	until, err := Handler.SnoozeSchedule(ownerID, scheduleID, duration)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to snooze schedule", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Schedule snoozed successfully", "snoozed_until": until})
+}
+
+func HandleRescheduleSchedule(c *gin.Context) {
+	authHeader := c.GetHeader("Authorization")
+	if authHeader == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "JWT_Token header is required"})
+		return
+	}
+
+	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
+	tokenString = strings.TrimSpace(tokenString)
+	userID, err := ExtractIDFromJWT(c, tokenString)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired JWT"})
+		return
+	}
+
+	scheduleID, err := strconv.Atoi(c.Param("schedule_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid schedule ID"})
+		return
+	}
+
+	ownerID, ok := resolveScheduleAccess(c, userID, scheduleID, HouseholdEditor)
+	if !ok {
+		return
+	}
+
+	var request struct {
+		Date string `json:"date" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+		return
+	}
+
+	date, err := time.Parse("2006-01-02", request.Date)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "date must be in YYYY-MM-DD format"})
+		return
+	}
+	if date.Before(time.Now().Truncate(24 * time.Hour)) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "date cannot be in the past"})
+		return
+	}
+
+	msg, err := Handler.RescheduleSchedule(ownerID, scheduleID, date)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reschedule", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": msg})
+}
+
+func HandleSkipSchedule(c *gin.Context) {
+	authHeader := c.GetHeader("Authorization")
+	if authHeader == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "JWT_Token header is required"})
+		return
+	}
+
+	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
+	tokenString = strings.TrimSpace(tokenString)
+	userID, err := ExtractIDFromJWT(c, tokenString)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired JWT"})
+		return
+	}
+
+	scheduleID, err := strconv.Atoi(c.Param("schedule_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid schedule ID"})
+		return
+	}
+
+	ownerID, ok := resolveScheduleAccess(c, userID, scheduleID, HouseholdEditor)
+	if !ok {
+		return
+	}
+
+	msg, err := Handler.SkipScheduleOccurrence(ownerID, scheduleID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to skip schedule", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": msg})
+}
+
+func HandleCreateVacation(c *gin.Context) {
+	authHeader := c.GetHeader("Authorization")
+	if authHeader == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "JWT_Token header is required"})
+		return
+	}
+
+	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
+	tokenString = strings.TrimSpace(tokenString)
+	userID, err := ExtractIDFromJWT(c, tokenString)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired JWT"})
+		return
+	}
+
+	var request struct {
+		StartDate   string `json:"start_date" binding:"required"`
+		EndDate     string `json:"end_date" binding:"required"`
+		Mode        string `json:"mode" binding:"required"`
+		SitterName  string `json:"sitter_name"`
+		SitterEmail string `json:"sitter_email"`
+		ShareLink   bool   `json:"share_link"`
+	}
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+		return
+	}
+
+	startDate, err := time.Parse("2006-01-02", request.StartDate)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "start_date must be in YYYY-MM-DD format"})
+		return
+	}
+	endDate, err := time.Parse("2006-01-02", request.EndDate)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "end_date must be in YYYY-MM-DD format"})
+		return
+	}
+	if endDate.Before(startDate) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "end_date cannot be before start_date"})
+		return
+	}
+
+	if request.Mode != VacationModePause && request.Mode != VacationModeSitter {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "mode must be 'pause' or 'sitter'"})
+		return
+	}
+	if request.Mode == VacationModeSitter && request.SitterEmail == "" && !request.ShareLink {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "a sitter needs either sitter_email or share_link"})
+		return
+	}
+
+	vacation := Vacation{
+		StartDate:   startDate,
+		EndDate:     endDate,
+		Mode:        request.Mode,
+		SitterName:  strings.TrimSpace(request.SitterName),
+		SitterEmail: strings.TrimSpace(request.SitterEmail),
+	}
+
+	// The share token is only ever returned here, we keep a hash of it
+	shareToken := ""
+	if request.Mode == VacationModeSitter && request.ShareLink {
+		shareToken, err = generateToken(24)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create share link", "details": err.Error()})
+			return
+		}
+	}
+
+	tokenHash := ""
+	if shareToken != "" {
+		tokenHash = hashToken(shareToken)
+	}
+
+	vacationID, err := Handler.CreateVacation(userID, vacation, tokenHash)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create vacation", "details": err.Error()})
+		return
+	}
+
+	response := gin.H{"vacation_id": vacationID}
+	if shareToken != "" {
+		response["share_token"] = shareToken
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+func HandleFetchVacations(c *gin.Context) {
+	authHeader := c.GetHeader("Authorization")
+	if authHeader == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "JWT_Token header is required"})
+		return
+	}
+
+	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
+	tokenString = strings.TrimSpace(tokenString)
+	userID, err := ExtractIDFromJWT(c, tokenString)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired JWT"})
+		return
+	}
+
+	vacations, err := Handler.FetchVacations(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch vacations", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"vacations": vacations})
+}
+
+func HandleCancelVacation(c *gin.Context) {
+	authHeader := c.GetHeader("Authorization")
+	if authHeader == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "JWT_Token header is required"})
+		return
+	}
+
+	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
+	tokenString = strings.TrimSpace(tokenString)
+	userID, err := ExtractIDFromJWT(c, tokenString)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired JWT"})
+		return
+	}
+
+	vacationID, err := strconv.Atoi(c.Param("vacation_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid vacation ID"})
+		return
+	}
+
+	msg, err := Handler.CancelVacation(userID, vacationID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to cancel vacation", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": msg})
+}
+
+func HandleFetchVacationSummary(c *gin.Context) {
+	authHeader := c.GetHeader("Authorization")
+	if authHeader == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "JWT_Token header is required"})
+		return
+	}
+
+	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
+	tokenString = strings.TrimSpace(tokenString)
+	userID, err := ExtractIDFromJWT(c, tokenString)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired JWT"})
+		return
+	}
+
+	vacationID, err := strconv.Atoi(c.Param("vacation_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid vacation ID"})
+		return
+	}
+
+	vacations, err := Handler.FetchVacations(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch vacations", "details": err.Error()})
+		return
+	}
+
+	for _, vacation := range vacations {
+		if vacation.VacationID != vacationID {
+			continue
+		}
+		if vacation.Summary != nil {
+			c.JSON(http.StatusOK, gin.H{"summary": vacation.Summary, "final": true})
+			return
+		}
+
+		// Still running (or not summarized yet), so show progress so far
+		summary, err := Handler.BuildVacationSummary(vacation)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to build vacation summary", "details": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"summary": summary, "final": false})
+		return
+	}
+
+	c.JSON(http.StatusNotFound, gin.H{"error": "Vacation not found"})
+}
+
+func HandleFetchSittingVacations(c *gin.Context) {
+	authHeader := c.GetHeader("Authorization")
+	if authHeader == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "JWT_Token header is required"})
+		return
+	}
+
+	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
+	tokenString = strings.TrimSpace(tokenString)
+	userID, err := ExtractIDFromJWT(c, tokenString)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired JWT"})
+		return
+	}
+	email, _ := ExtractEmailFromJWT(tokenString)
+
+	vacations, err := Handler.FetchSittingVacations(userID, email)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch vacations", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"vacations": vacations})
+}
+
+// A sitter either presents the share token in X-Sitter-Token or signs in
+// with the invited email. Returns the vacation and how to attribute the
+// sitter's actions. Writes the error response itself when access is refused.
+func resolveSitterAccess(c *gin.Context) (Vacation, string, bool) {
+	vacationID, err := strconv.Atoi(c.Param("vacation_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid vacation ID"})
+		return Vacation{}, "", false
+	}
+
+	vacation, tokenHash, err := Handler.fetchVacationForSitter(vacationID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Vacation not found"})
+		return Vacation{}, "", false
+	}
+
+	if vacation.Mode != VacationModeSitter || !vacation.activeOn(time.Now()) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Sitter access is not active for this vacation"})
+		return Vacation{}, "", false
+	}
+
+	if shareToken := c.GetHeader("X-Sitter-Token"); shareToken != "" {
+		if tokenHash == "" || hashToken(shareToken) != tokenHash {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Invalid share link"})
+			return Vacation{}, "", false
+		}
+		return vacation, sitterAttribution(vacation, ""), true
+	}
+
+	authHeader := c.GetHeader("Authorization")
+	if authHeader == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "JWT_Token header or X-Sitter-Token is required"})
+		return Vacation{}, "", false
+	}
+
+	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
+	tokenString = strings.TrimSpace(tokenString)
+	userID, err := ExtractIDFromJWT(c, tokenString)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired JWT"})
+		return Vacation{}, "", false
+	}
+
+	if vacation.SitterUserID != nil && *vacation.SitterUserID == userID {
+		return vacation, sitterAttribution(vacation, userID), true
+	}
+
+	email, err := ExtractEmailFromJWT(tokenString)
+	if err != nil || vacation.SitterUserID != nil || !strings.EqualFold(email, vacation.SitterEmail) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You are not the sitter for this vacation"})
+		return Vacation{}, "", false
+	}
+
+	if err := Handler.ClaimSitterInvite(vacation.VacationID, userID); err != nil {
+		fmt.Println(err)
+	}
+	return vacation, sitterAttribution(vacation, userID), true
+}
+
+func HandleSitterFetchSchedule(c *gin.Context) {
+	vacation, _, ok := resolveSitterAccess(c)
+	if !ok {
+		return
+	}
+
+	schedules, err := Handler.FetchSchedule(vacation.UserID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch schedule", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"schedule": schedules, "vacation_ends": vacation.EndDate})
+}
+
+func HandleSitterCompleteSchedule(c *gin.Context) {
+	vacation, performedBy, ok := resolveSitterAccess(c)
+	if !ok {
+		return
+	}
+
+	scheduleID, err := strconv.Atoi(c.Param("schedule_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid schedule ID"})
+		return
+	}
+
+	// Only ever marks it watered, so a double tap can't undo it
+	watered, err := Handler.MarkWatered(vacation.UserID, scheduleID, performedBy)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to complete schedule", "details": err.Error()})
+		return
+	}
+
+	msg := "Plant marked as watered"
+	if !watered {
+		msg = "Plant was already watered today"
+	}
+	c.JSON(http.StatusOK, gin.H{"message": msg})
+}
+
+func HandleAddCareNote(c *gin.Context) {
+	authHeader := c.GetHeader("Authorization")
+	if authHeader == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "JWT_Token header is required"})
+		return
+	}
+
+	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
+	tokenString = strings.TrimSpace(tokenString)
+	userID, err := ExtractIDFromJWT(c, tokenString)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired JWT"})
+		return
+	}
+
+	plantID, err := strconv.Atoi(c.Param("plantid"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid plant ID"})
+		return
+	}
+
+	ownerID, ok := resolvePlantAccess(c, userID, plantID, HouseholdEditor)
+	if !ok {
+		return
+	}
+
+	var request struct {
+		Kind  string `json:"kind" binding:"required"`
+		Notes string `json:"notes"`
+	}
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+		return
+	}
+
+	if request.Kind != "soil_wet" && request.Kind != "soil_dry" && request.Kind != "note" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "kind must be 'soil_wet', 'soil_dry' or 'note'"})
+		return
+	}
+
+	msg, err := Handler.AddCareNote(ownerID, plantID, request.Kind, request.Notes, memberAttribution(ownerID, userID))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save care note", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": msg})
+}
+
+func HandleSetAdaptiveMode(c *gin.Context) {
+	authHeader := c.GetHeader("Authorization")
+	if authHeader == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "JWT_Token header is required"})
+		return
+	}
+
+	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
+	tokenString = strings.TrimSpace(tokenString)
+	userID, err := ExtractIDFromJWT(c, tokenString)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired JWT"})
+		return
+	}
+
+	scheduleID, err := strconv.Atoi(c.Param("schedule_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid schedule ID"})
+		return
+	}
+
+	ownerID, ok := resolveScheduleAccess(c, userID, scheduleID, HouseholdEditor)
+	if !ok {
+		return
+	}
+
+	var request struct {
+		Mode string `json:"mode" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+		return
+	}
+
+	if request.Mode != AdaptiveModeOff && request.Mode != AdaptiveModeSuggest && request.Mode != AdaptiveModeAuto {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "mode must be 'off', 'suggest' or 'auto'"})
+		return
+	}
+
+	msg, err := Handler.SetAdaptiveMode(ownerID, scheduleID, request.Mode)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update adaptive mode", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": msg})
+}
+
+func HandleFetchIntervalAdjustments(c *gin.Context) {
+	authHeader := c.GetHeader("Authorization")
+	if authHeader == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "JWT_Token header is required"})
+		return
+	}
+
+	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
+	tokenString = strings.TrimSpace(tokenString)
+	userID, err := ExtractIDFromJWT(c, tokenString)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired JWT"})
+		return
+	}
+
+	scheduleID, err := strconv.Atoi(c.Param("schedule_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid schedule ID"})
+		return
+	}
+
+	ownerID, ok := resolveScheduleAccess(c, userID, scheduleID, HouseholdViewer)
+	if !ok {
+		return
+	}
+
+	adjustments, err := Handler.FetchIntervalAdjustments(ownerID, scheduleID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch interval adjustments", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"adjustments": adjustments})
+}
+
+func HandleResolveIntervalAdjustment(c *gin.Context) {
+	authHeader := c.GetHeader("Authorization")
+	if authHeader == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "JWT_Token header is required"})
+		return
+	}
+
+	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
+	tokenString = strings.TrimSpace(tokenString)
+	userID, err := ExtractIDFromJWT(c, tokenString)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired JWT"})
+		return
+	}
+
+	scheduleID, err := strconv.Atoi(c.Param("schedule_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid schedule ID"})
+		return
+	}
+
+	ownerID, ok := resolveScheduleAccess(c, userID, scheduleID, HouseholdEditor)
+	if !ok {
+		return
+	}
+
+	adjustmentID, err := strconv.Atoi(c.Param("adjustment_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid adjustment ID"})
+		return
+	}
+
+	var accept bool
+	switch c.Param("decision") {
+	case "accept":
+		accept = true
+	case "dismiss":
+		accept = false
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "decision must be 'accept' or 'dismiss'"})
+		return
+	}
+
+	msg, err := Handler.ResolveIntervalAdjustment(ownerID, scheduleID, adjustmentID, accept)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to resolve interval adjustment", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": msg})
+}
+
+func HandleEditSchedule(c *gin.Context) {
+	authHeader := c.GetHeader("Authorization")
+	if authHeader == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "JWT_Token header is required"})
+		return
+	}
+
+	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
+	tokenString = strings.TrimSpace(tokenString)
+	userID, err := ExtractIDFromJWT(c, tokenString)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired JWT"})
+		return
+	}
+
+	scheduleID, err := strconv.Atoi(c.Param("schedule_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid schedule ID"})
+		return
+	}
+
+	ownerID, ok := resolveScheduleAccess(c, userID, scheduleID, HouseholdEditor)
+	if !ok {
+		return
+	}
+
+	var request struct {
+		WaterRepeatEvery *int     `json:"water_repeat_every"`
+		WaterRepeatUnit  *string  `json:"water_repeat_unit"`
+		AnchorDate       *string  `json:"anchor_date"`
+		TaskTypes        []string `json:"task_types"`
+		WaterAmountML    *int     `json:"water_amount_ml"`
+	}
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+		return
+	}
+
+	edit := ScheduleEdit{WaterRepeatEvery: request.WaterRepeatEvery, TaskTypes: request.TaskTypes, WaterAmountML: request.WaterAmountML}
+
+	if request.WaterAmountML != nil && (*request.WaterAmountML < 1 || *request.WaterAmountML > 100000) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "water_amount_ml must be between 1 and 100000"})
+		return
+	}
+
+	if request.WaterRepeatEvery != nil && (*request.WaterRepeatEvery < 1 || *request.WaterRepeatEvery > 365) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "water_repeat_every must be between 1 and 365"})
+		return
+	}
+
+	if request.WaterRepeatUnit != nil {
+		unit := strings.ToLower(strings.TrimSpace(*request.WaterRepeatUnit))
+		switch strings.TrimSuffix(unit, "s") {
+		case "day", "week", "month":
+		default:
+			c.JSON(http.StatusBadRequest, gin.H{"error": "water_repeat_unit must be days, weeks or months"})
+			return
+		}
+		edit.WaterRepeatUnit = &unit
+	}
+
+	if request.AnchorDate != nil {
+		anchor, err := time.Parse("2006-01-02", *request.AnchorDate)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "anchor_date must be in YYYY-MM-DD format"})
+			return
+		}
+		edit.AnchorDate = &anchor
+	}
+
+	if request.TaskTypes != nil {
+		if len(request.TaskTypes) == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "task_types cannot be empty"})
+			return
+		}
+		for _, taskType := range request.TaskTypes {
+			if !slices.Contains(careTaskTypes, taskType) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown task type: " + taskType, "task_types": careTaskTypes})
+				return
+			}
+		}
+	}
+
+	msg, err := Handler.EditSchedule(ownerID, scheduleID, edit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update schedule", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": msg})
+}
+
+func HandleClearScheduleOverride(c *gin.Context) {
+	authHeader := c.GetHeader("Authorization")
+	if authHeader == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "JWT_Token header is required"})
+		return
+	}
+
+	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
+	tokenString = strings.TrimSpace(tokenString)
+	userID, err := ExtractIDFromJWT(c, tokenString)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired JWT"})
+		return
+	}
+
+	scheduleID, err := strconv.Atoi(c.Param("schedule_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid schedule ID"})
+		return
+	}
+
+	ownerID, ok := resolveScheduleAccess(c, userID, scheduleID, HouseholdEditor)
+	if !ok {
+		return
+	}
+
+	msg, err := Handler.ClearScheduleOverride(ownerID, scheduleID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to clear override", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": msg})
+}
+
+func HandleRegisterDevice(c *gin.Context) {
+	authHeader := c.GetHeader("Authorization")
+	if authHeader == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "JWT_Token header is required"})
+		return
+	}
+
+	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
+	tokenString = strings.TrimSpace(tokenString)
+	userID, err := ExtractIDFromJWT(c, tokenString)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired JWT"})
+		return
+	}
+
+	var request struct {
+		Token    string `json:"token" binding:"required"`
+		Platform string `json:"platform"`
+		Timezone string `json:"timezone"`
+	}
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+		return
+	}
+
+	if !strings.HasPrefix(request.Token, "ExponentPushToken[") && !strings.HasPrefix(request.Token, "ExpoPushToken[") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "token must be an Expo push token"})
+		return
+	}
+
+	if request.Timezone != "" {
+		if _, err := time.LoadLocation(request.Timezone); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown timezone: " + request.Timezone})
+			return
+		}
+	}
+
+	msg, err := Handler.RegisterDevice(userID, request.Token, request.Platform, request.Timezone)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to register device", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": msg})
+}
+
+func HandleUnregisterDevice(c *gin.Context) {
+	authHeader := c.GetHeader("Authorization")
+	if authHeader == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "JWT_Token header is required"})
+		return
+	}
+
+	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
+	tokenString = strings.TrimSpace(tokenString)
+	userID, err := ExtractIDFromJWT(c, tokenString)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired JWT"})
+		return
+	}
+
+	var request struct {
+		Token string `json:"token" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+		return
+	}
+
+	msg, err := Handler.UnregisterDevice(userID, request.Token)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to unregister device", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": msg})
+}
+
+func HandleFetchEmailDigest(c *gin.Context) {
+	authHeader := c.GetHeader("Authorization")
+	if authHeader == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "JWT_Token header is required"})
+		return
+	}
+
+	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
+	tokenString = strings.TrimSpace(tokenString)
+	userID, err := ExtractIDFromJWT(c, tokenString)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired JWT"})
+		return
+	}
+
+	enabled, email, err := Handler.FetchEmailDigest(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch email digest", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"enabled": enabled, "email": email})
+}
+
+func HandleUpdateEmailDigest(c *gin.Context) {
+	authHeader := c.GetHeader("Authorization")
+	if authHeader == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "JWT_Token header is required"})
+		return
+	}
+
+	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
+	tokenString = strings.TrimSpace(tokenString)
+	userID, err := ExtractIDFromJWT(c, tokenString)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired JWT"})
+		return
+	}
+
+	// Without an explicit address we use the one the user signed in with
+	var request struct {
+		Enabled *bool  `json:"enabled" binding:"required"`
+		Email   string `json:"email"`
+	}
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+		return
+	}
+
+	email := strings.TrimSpace(request.Email)
+	if email == "" {
+		email, _ = ExtractEmailFromJWT(tokenString)
+	}
+	if email != "" {
+		if _, err := mail.ParseAddress(email); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid email address"})
+			return
+		}
+	}
+
+	if *request.Enabled {
+		_, saved, err := Handler.FetchEmailDigest(userID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch email digest", "details": err.Error()})
+			return
+		}
+		if email == "" && saved == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "An email address is required to enable the digest"})
+			return
+		}
+	}
+
+	msg, err := Handler.SetEmailDigest(userID, *request.Enabled, email)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update email digest", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": msg})
+}
+
+func HandleFetchNotificationPreferences(c *gin.Context) {
+	authHeader := c.GetHeader("Authorization")
+	if authHeader == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "JWT_Token header is required"})
+		return
+	}
+
+	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
+	tokenString = strings.TrimSpace(tokenString)
+	userID, err := ExtractIDFromJWT(c, tokenString)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired JWT"})
+		return
+	}
+
+	prefs, err := Handler.FetchNotificationPreferences(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch notification preferences", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"preferences": prefs})
+}
+
+// Fields left out of the body keep their current value. Sending null for
+// both quiet hours turns them off.
+func HandleUpdateNotificationPreferences(c *gin.Context) {
+	authHeader := c.GetHeader("Authorization")
+	if authHeader == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "JWT_Token header is required"})
+		return
+	}
+
+	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
+	tokenString = strings.TrimSpace(tokenString)
+	userID, err := ExtractIDFromJWT(c, tokenString)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired JWT"})
+		return
+	}
+
+	prefs, err := Handler.FetchNotificationPreferences(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch notification preferences", "details": err.Error()})
+		return
+	}
+
+	if err := c.ShouldBindJSON(&prefs); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+		return
+	}
+	if prefs.Channels == nil {
+		prefs.Channels = []string{}
+	}
+	if prefs.TaskTypes == nil {
+		prefs.TaskTypes = []string{}
+	}
+
+	if err := validateNotificationPreferences(prefs); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	msg, err := Handler.SaveNotificationPreferences(userID, prefs)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update notification preferences", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": msg, "preferences": prefs})
+}
+
+// Target of the signed "mark watered" links in the email digest. The token
+// stands in for the JWT, so it's opened straight from the mail client.
+// Opening the link only asks; mail scanners and link previews follow GET
+// links, so the plant is marked watered by the form's POST.
+func HandleConfirmScheduleFromLink(c *gin.Context) {
+	scheduleID, err := strconv.Atoi(c.Param("schedule_id"))
+	if err != nil {
+		c.Data(http.StatusBadRequest, "text/html; charset=utf-8", []byte("<p>Invalid link.</p>"))
+		return
+	}
+
+	token := c.Query("token")
+	if _, err := verifyCompletionToken(token, scheduleID); err != nil {
+		c.Data(http.StatusForbidden, "text/html; charset=utf-8", []byte("<p>This link is invalid or has expired.</p>"))
+		return
+	}
+
+	var page bytes.Buffer
+	if err := completionPageTemplate.Execute(&page, token); err != nil {
+		fmt.Println(err)
+		c.Data(http.StatusInternalServerError, "text/html; charset=utf-8", []byte("<p>Something went wrong, please try again from the app.</p>"))
+		return
+	}
+	c.Data(http.StatusOK, "text/html; charset=utf-8", page.Bytes())
+}
+
+func HandleCompleteScheduleFromLink(c *gin.Context) {
+	scheduleID, err := strconv.Atoi(c.Param("schedule_id"))
+	if err != nil {
+		c.Data(http.StatusBadRequest, "text/html; charset=utf-8", []byte("<p>Invalid link.</p>"))
+		return
+	}
+
+	claims, err := verifyCompletionToken(c.PostForm("token"), scheduleID)
+	if err != nil {
+		c.Data(http.StatusForbidden, "text/html; charset=utf-8", []byte("<p>This link is invalid or has expired.</p>"))
+		return
+	}
+
+	watered, err := Handler.MarkWatered(claims.UserID, scheduleID, "")
+	if err != nil {
+		fmt.Println(err)
+		c.Data(http.StatusInternalServerError, "text/html; charset=utf-8", []byte("<p>Something went wrong, please try again from the app.</p>"))
+		return
+	}
+
+	if !watered {
+		c.Data(http.StatusOK, "text/html; charset=utf-8", []byte("<p>Already marked as watered today 🌱</p>"))
+		return
+	}
+	c.Data(http.StatusOK, "text/html; charset=utf-8", []byte("<p>Marked as watered 🌱</p>"))
+}
+
+// The signing secret is only ever returned here, when the endpoint is made.
+func HandleCreateWebhook(c *gin.Context) {
+	authHeader := c.GetHeader("Authorization")
+	if authHeader == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "JWT_Token header is required"})
+		return
+	}
+
+	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
+	tokenString = strings.TrimSpace(tokenString)
+	userID, err := ExtractIDFromJWT(c, tokenString)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired JWT"})
+		return
+	}
+
+	var request struct {
+		URL    string   `json:"url" binding:"required"`
+		Events []string `json:"events" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+		return
+	}
+
+	if err := validateWebhookURL(request.URL); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if len(request.Events) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Subscribe to at least one event"})
+		return
+	}
+	for _, event := range request.Events {
+		if !slices.Contains(webhookEvents, event) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown event: " + event})
+			return
+		}
+	}
+
+	secret, err := generateToken(24)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate webhook secret", "details": err.Error()})
+		return
+	}
+
+	endpoint, err := Handler.CreateWebhookEndpoint(userID, request.URL, request.Events, secret)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create webhook", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"webhook": endpoint, "secret": secret})
+}
+
+func HandleFetchWebhooks(c *gin.Context) {
+	authHeader := c.GetHeader("Authorization")
+	if authHeader == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "JWT_Token header is required"})
+		return
+	}
+
+	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
+	tokenString = strings.TrimSpace(tokenString)
+	userID, err := ExtractIDFromJWT(c, tokenString)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired JWT"})
+		return
+	}
+
+	endpoints, err := Handler.FetchWebhookEndpoints(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch webhooks", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"webhooks": endpoints})
+}
+
+func HandleDeleteWebhook(c *gin.Context) {
+	authHeader := c.GetHeader("Authorization")
+	if authHeader == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "JWT_Token header is required"})
+		return
+	}
+
+	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
+	tokenString = strings.TrimSpace(tokenString)
+	userID, err := ExtractIDFromJWT(c, tokenString)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired JWT"})
+		return
+	}
+
+	endpointID, err := strconv.Atoi(c.Param("endpoint_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid webhook ID"})
+		return
+	}
+
+	msg, err := Handler.DeleteWebhookEndpoint(userID, endpointID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete webhook", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": msg})
+}
+
+func HandleFetchWebhookDeliveries(c *gin.Context) {
+	authHeader := c.GetHeader("Authorization")
+	if authHeader == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "JWT_Token header is required"})
+		return
+	}
+
+	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
+	tokenString = strings.TrimSpace(tokenString)
+	userID, err := ExtractIDFromJWT(c, tokenString)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired JWT"})
+		return
+	}
+
+	endpointID, err := strconv.Atoi(c.Param("endpoint_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid webhook ID"})
+		return
+	}
+
+	deliveries, err := Handler.FetchWebhookDeliveries(userID, endpointID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch webhook deliveries", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"deliveries": deliveries})
+}
+
+func HandleRedeliverWebhook(c *gin.Context) {
+	authHeader := c.GetHeader("Authorization")
+	if authHeader == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "JWT_Token header is required"})
+		return
+	}
+
+	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
+	tokenString = strings.TrimSpace(tokenString)
+	userID, err := ExtractIDFromJWT(c, tokenString)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired JWT"})
+		return
+	}
+
+	endpointID, err := strconv.Atoi(c.Param("endpoint_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid webhook ID"})
+		return
+	}
+	deliveryID, err := strconv.Atoi(c.Param("delivery_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid delivery ID"})
+		return
+	}
+
+	newID, err := Handler.RedeliverWebhook(userID, endpointID, deliveryID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to redeliver webhook", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Webhook queued for redelivery", "delivery_id": newID})
+}
+
+// The token is shown once; the sensor sends it with every reading.
+func HandleRegisterSensor(c *gin.Context) {
+	authHeader := c.GetHeader("Authorization")
+	if authHeader == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "JWT_Token header is required"})
+		return
+	}
+
+	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
+	tokenString = strings.TrimSpace(tokenString)
+	userID, err := ExtractIDFromJWT(c, tokenString)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired JWT"})
+		return
+	}
+
+	var request struct {
+		PlantID      int      `json:"plant_id" binding:"required"`
+		Name         string   `json:"name" binding:"required"`
+		DryThreshold *float64 `json:"dry_threshold"`
+		WetThreshold *float64 `json:"wet_threshold"`
+	}
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+		return
+	}
+
+	sensor := Sensor{PlantID: request.PlantID, Name: strings.TrimSpace(request.Name), DryThreshold: 30, WetThreshold: 60}
+	if request.DryThreshold != nil {
+		sensor.DryThreshold = *request.DryThreshold
+	}
+	if request.WetThreshold != nil {
+		sensor.WetThreshold = *request.WetThreshold
+	}
+	if err := validateSensorThresholds(sensor.DryThreshold, sensor.WetThreshold); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	token, err := generateToken(24)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate sensor token", "details": err.Error()})
+		return
+	}
+
+	ownerID, ok := resolvePlantAccess(c, userID, sensor.PlantID, HouseholdEditor)
+	if !ok {
+		return
+	}
+
+	sensor, err = Handler.RegisterSensor(ownerID, sensor, hashToken(token))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to register sensor", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"sensor": sensor, "token": token})
+}
+
+func HandleFetchSensors(c *gin.Context) {
+	authHeader := c.GetHeader("Authorization")
+	if authHeader == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "JWT_Token header is required"})
+		return
+	}
+
+	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
+	tokenString = strings.TrimSpace(tokenString)
+	userID, err := ExtractIDFromJWT(c, tokenString)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired JWT"})
+		return
+	}
+
+	sensors, err := Handler.FetchSensors(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch sensors", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"sensors": sensors})
+}
+
+// Renames a sensor or changes its thresholds. Fields left out keep their
+// current value.
+func HandleUpdateSensor(c *gin.Context) {
+	authHeader := c.GetHeader("Authorization")
+	if authHeader == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "JWT_Token header is required"})
+		return
+	}
+
+	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
+	tokenString = strings.TrimSpace(tokenString)
+	userID, err := ExtractIDFromJWT(c, tokenString)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired JWT"})
+		return
+	}
+
+	sensorID, err := strconv.Atoi(c.Param("sensor_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid sensor ID"})
+		return
+	}
+
+	sensor, err := Handler.FetchSensor(userID, sensorID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Sensor not found"})
+		return
+	}
+
+	var request struct {
+		Name         *string  `json:"name"`
+		DryThreshold *float64 `json:"dry_threshold"`
+		WetThreshold *float64 `json:"wet_threshold"`
+	}
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+		return
+	}
+
+	if request.Name != nil && strings.TrimSpace(*request.Name) != "" {
+		sensor.Name = strings.TrimSpace(*request.Name)
+	}
+	if request.DryThreshold != nil {
+		sensor.DryThreshold = *request.DryThreshold
+	}
+	if request.WetThreshold != nil {
+		sensor.WetThreshold = *request.WetThreshold
+	}
+	if err := validateSensorThresholds(sensor.DryThreshold, sensor.WetThreshold); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	msg, err := Handler.UpdateSensor(userID, sensorID, sensor.Name, sensor.DryThreshold, sensor.WetThreshold)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update sensor", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": msg})
+}
+
+func HandleDeleteSensor(c *gin.Context) {
+	authHeader := c.GetHeader("Authorization")
+	if authHeader == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "JWT_Token header is required"})
+		return
+	}
+
+	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
+	tokenString = strings.TrimSpace(tokenString)
+	userID, err := ExtractIDFromJWT(c, tokenString)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired JWT"})
+		return
+	}
+
+	sensorID, err := strconv.Atoi(c.Param("sensor_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid sensor ID"})
+		return
+	}
+
+	msg, err := Handler.DeleteSensor(userID, sensorID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete sensor", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": msg})
+}
+
+// Defaults to the last 7 days; ?since= takes an RFC 3339 timestamp.
+func HandleFetchSensorReadings(c *gin.Context) {
+	authHeader := c.GetHeader("Authorization")
+	if authHeader == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "JWT_Token header is required"})
+		return
+	}
+
+	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
+	tokenString = strings.TrimSpace(tokenString)
+	userID, err := ExtractIDFromJWT(c, tokenString)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired JWT"})
+		return
+	}
+
+	sensorID, err := strconv.Atoi(c.Param("sensor_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid sensor ID"})
+		return
+	}
+
+	since := time.Now().AddDate(0, 0, -7)
+	if raw := c.Query("since"); raw != "" {
+		since, err = time.Parse(time.RFC3339, raw)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "since must be an RFC 3339 timestamp"})
+			return
+		}
+	}
+
+	readings, err := Handler.FetchSensorReadings(userID, sensorID, since)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch sensor readings", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"readings": readings})
+}
+
+// Called by the sensor itself, authenticated with its own token in the
+// X-Sensor-Token header (or "token" in the body). Takes a single reading or
+// a buffered batch under "readings".
+func HandleIngestSensorReadings(c *gin.Context) {
+	sensorID, err := strconv.Atoi(c.Param("sensor_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid sensor ID"})
+		return
+	}
+
+	var request struct {
+		sensorPayload
+		Readings []sensorPayload `json:"readings"`
+	}
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+		return
+	}
+
+	// Either the sensor's own token, or a user credential such as an access
+	// token with ingest:sensors for boards that report several sensors
+	var sensor Sensor
+	token := c.GetHeader("X-Sensor-Token")
+	if token == "" {
+		token = request.Token
+	}
+	if authHeader := c.GetHeader("Authorization"); token == "" && authHeader != "" {
+		userID, err := ExtractIDFromJWT(c, strings.TrimSpace(strings.TrimPrefix(authHeader, "Bearer ")))
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired JWT"})
+			return
+		}
+		sensor, err = Handler.FetchSensor(userID, sensorID)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Sensor not found", "details": err.Error()})
+			return
+		}
+	} else {
+		sensor, err = Handler.AuthenticateSensor(sensorID, token)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid sensor token"})
+			return
+		}
+	}
+
+	payloads := request.Readings
+	if len(payloads) == 0 {
+		payloads = []sensorPayload{request.sensorPayload}
+	}
+	if len(payloads) > 500 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "At most 500 readings per request"})
+		return
+	}
+
+	readings := make([]SensorReading, 0, len(payloads))
+	for _, payload := range payloads {
+		reading, err := payload.reading()
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		readings = append(readings, reading)
+	}
+
+	if err := ingestSensorReadings(sensor, readings); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record readings", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Readings recorded", "count": len(readings)})
+}
+
+// The token is shown once. Controllers use it to report feedback.
+func HandleRegisterValve(c *gin.Context) {
+	authHeader := c.GetHeader("Authorization")
+	if authHeader == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "JWT_Token header is required"})
+		return
+	}
+
+	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
+	tokenString = strings.TrimSpace(tokenString)
+	userID, err := ExtractIDFromJWT(c, tokenString)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired JWT"})
+		return
+	}
+
+	// Safety limits default to 5 minutes a run and 15 minutes a day
+	valve := Valve{MaxRunSeconds: 300, MaxDailySeconds: 900, StartHour: 6}
+	if err := c.ShouldBindJSON(&valve); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+		return
+	}
+
+	valve.Name = strings.TrimSpace(valve.Name)
+	if valve.Name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "name is required"})
+		return
+	}
+	if err := validateValve(valve); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Valves act on their owner's schedules, so a zone can't mix plants
+	// belonging to different people
+	ownerID := ""
+	for _, plantID := range valve.PlantIDs {
+		plantOwner, ok := resolvePlantAccess(c, userID, plantID, HouseholdEditor)
+		if !ok {
+			return
+		}
+		if ownerID != "" && plantOwner != ownerID {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "All plants on a valve must belong to the same person"})
+			return
+		}
+		ownerID = plantOwner
+	}
+
+	token, err := generateToken(24)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate valve token", "details": err.Error()})
+		return
+	}
+
+	valve, err = Handler.RegisterValve(ownerID, valve, hashToken(token))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to register valve", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"valve": valve, "token": token})
+}
+
+func HandleFetchValves(c *gin.Context) {
+	authHeader := c.GetHeader("Authorization")
+	if authHeader == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "JWT_Token header is required"})
+		return
+	}
+
+	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
+	tokenString = strings.TrimSpace(tokenString)
+	userID, err := ExtractIDFromJWT(c, tokenString)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired JWT"})
+		return
+	}
+
+	valves, err := Handler.FetchValves(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch valves", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"valves": valves})
+}
+
+func HandleDeleteValve(c *gin.Context) {
+	authHeader := c.GetHeader("Authorization")
+	if authHeader == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "JWT_Token header is required"})
+		return
+	}
+
+	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
+	tokenString = strings.TrimSpace(tokenString)
+	userID, err := ExtractIDFromJWT(c, tokenString)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired JWT"})
+		return
+	}
+
+	valveID, err := strconv.Atoi(c.Param("valve_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid valve ID"})
+		return
+	}
+
+	msg, err := Handler.DeleteValve(userID, valveID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete valve", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": msg})
+}
+
+func HandleFetchIrrigationRuns(c *gin.Context) {
+	authHeader := c.GetHeader("Authorization")
+	if authHeader == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "JWT_Token header is required"})
+		return
+	}
+
+	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
+	tokenString = strings.TrimSpace(tokenString)
+	userID, err := ExtractIDFromJWT(c, tokenString)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired JWT"})
+		return
+	}
+
+	valveID, err := strconv.Atoi(c.Param("valve_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid valve ID"})
+		return
+	}
+
+	runs, err := Handler.FetchIrrigationRuns(userID, valveID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch irrigation runs", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"runs": runs})
+}
+
+// Called by HTTP valve controllers that confirm a run after the fact,
+// authenticated with the valve's token in X-Valve-Token.
+func HandleValveFeedback(c *gin.Context) {
+	valveID, err := strconv.Atoi(c.Param("valve_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid valve ID"})
+		return
+	}
+
+	var feedback ValveFeedback
+	if err := c.ShouldBindJSON(&feedback); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+		return
+	}
+
+	token := c.GetHeader("X-Valve-Token")
+	if token == "" {
+		token = feedback.Token
+	}
+	valve, err := Handler.AuthenticateValve(valveID, token)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid valve token"})
+		return
+	}
+
+	if feedback.CommandID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "command_id is required"})
+		return
+	}
+
+	if err := handleValveFeedback(valve, feedback); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record feedback", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Feedback recorded"})
+}
+
+func homeAssistantResponse(enabled bool, node_id string) gin.H {
+	response := gin.H{"enabled": enabled, "node_id": node_id}
+	if node_id != "" {
+		response["topic_prefix"] = mqttTopicPrefix() + "/ha/" + node_id
+		response["discovery_prefix"] = haDiscoveryPrefix()
+	}
+	return response
+}
+
+func HandleFetchHomeAssistant(c *gin.Context) {
+	authHeader := c.GetHeader("Authorization")
+	if authHeader == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "JWT_Token header is required"})
+		return
+	}
+
+	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
+	tokenString = strings.TrimSpace(tokenString)
+	userID, err := ExtractIDFromJWT(c, tokenString)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired JWT"})
+		return
+	}
+
+	enabled, nodeID, err := Handler.FetchHomeAssistant(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch Home Assistant settings", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, homeAssistantResponse(enabled, nodeID))
+}
+
+// Turning the integration on publishes the user's plants to the broker for
+// Home Assistant to discover; turning it off removes them again. Each enable
+// picks a new command key, so old mark watered topics stop working.
+func HandleUpdateHomeAssistant(c *gin.Context) {
+	authHeader := c.GetHeader("Authorization")
+	if authHeader == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "JWT_Token header is required"})
+		return
+	}
+
+	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
+	tokenString = strings.TrimSpace(tokenString)
+	userID, err := ExtractIDFromJWT(c, tokenString)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired JWT"})
+		return
+	}
+
+	var request struct {
+		Enabled *bool `json:"enabled" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+		return
+	}
+
+	newNodeID, err := generateToken(6)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate node ID", "details": err.Error()})
+		return
+	}
+
+	commandKey, err := generateToken(32)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate command key", "details": err.Error()})
+		return
+	}
+
+	nodeID, err := Handler.SetHomeAssistant(userID, *request.Enabled, newNodeID, commandKey)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update Home Assistant settings", "details": err.Error()})
+		return
+	}
+	notifyPlantChanged(userID)
+
+	c.JSON(http.StatusOK, homeAssistantResponse(*request.Enabled, nodeID))
+}
+
+// The token is shown once. It's used as a Bearer token in place of a JWT,
+// limited to the routes its scopes cover.
+func HandleCreateAccessToken(c *gin.Context) {
+	authHeader := c.GetHeader("Authorization")
+	if authHeader == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "JWT_Token header is required"})
+		return
+	}
+
+	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
+	tokenString = strings.TrimSpace(tokenString)
+	userID, err := ExtractIDFromJWT(c, tokenString)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired JWT"})
+		return
+	}
+
+	// expires_in_days defaults to 90; 0 means the token never expires
+	var request struct {
+		Name          string   `json:"name" binding:"required"`
+		Scopes        []string `json:"scopes" binding:"required"`
+		ExpiresInDays *int     `json:"expires_in_days"`
+	}
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+		return
+	}
+
+	name := strings.TrimSpace(request.Name)
+	if name == "" || len(name) > 100 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "name must be between 1 and 100 characters"})
+		return
+	}
+	if err := validateAccessTokenScopes(request.Scopes); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	days := 90
+	if request.ExpiresInDays != nil {
+		days = *request.ExpiresInDays
+	}
+	if days < 0 || days > 365 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "expires_in_days must be between 0 and 365"})
+		return
+	}
+	var expiresAt *time.Time
+	if days > 0 {
+		expiry := time.Now().AddDate(0, 0, days)
+		expiresAt = &expiry
+	}
+
+	token, err := generateAccessToken()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate access token", "details": err.Error()})
+		return
+	}
+
+	accessToken, err := Handler.CreateAccessToken(userID, name, slices.Compact(slices.Sorted(slices.Values(request.Scopes))), expiresAt, hashToken(token))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create access token", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"access_token": accessToken, "token": token})
+}
+
+func HandleFetchAccessTokens(c *gin.Context) {
+	authHeader := c.GetHeader("Authorization")
+	if authHeader == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "JWT_Token header is required"})
+		return
+	}
+
+	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
+	tokenString = strings.TrimSpace(tokenString)
+	userID, err := ExtractIDFromJWT(c, tokenString)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired JWT"})
+		return
+	}
+
+	tokens, err := Handler.FetchAccessTokens(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch access tokens", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"access_tokens": tokens})
+}
+
+func HandleDeleteAccessToken(c *gin.Context) {
+	authHeader := c.GetHeader("Authorization")
+	if authHeader == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "JWT_Token header is required"})
+		return
+	}
+
+	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
+	tokenString = strings.TrimSpace(tokenString)
+	userID, err := ExtractIDFromJWT(c, tokenString)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired JWT"})
+		return
+	}
+
+	tokenID, err := strconv.Atoi(c.Param("token_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid token ID"})
+		return
+	}
+
+	msg, err := Handler.DeleteAccessToken(userID, tokenID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke access token", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": msg})
+}
+
+func HandleCreateHousehold(c *gin.Context) {
+	authHeader := c.GetHeader("Authorization")
+	if authHeader == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "JWT_Token header is required"})
+		return
+	}
+
+	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
+	tokenString = strings.TrimSpace(tokenString)
+	userID, err := ExtractIDFromJWT(c, tokenString)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired JWT"})
+		return
+	}
+
+	var request struct {
+		Name string `json:"name" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+		return
+	}
+
+	name := strings.TrimSpace(request.Name)
+	if name == "" || len(name) > 100 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "name must be between 1 and 100 characters"})
+		return
+	}
+
+	household, err := Handler.CreateHousehold(userID, name)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create household", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"household": household})
+}
+
+func HandleFetchHouseholds(c *gin.Context) {
+	authHeader := c.GetHeader("Authorization")
+	if authHeader == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "JWT_Token header is required"})
+		return
+	}
+
+	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
+	tokenString = strings.TrimSpace(tokenString)
+	userID, err := ExtractIDFromJWT(c, tokenString)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired JWT"})
+		return
+	}
+
+	households, err := Handler.FetchHouseholds(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch households", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"households": households})
+}
+
+func HandleDeleteHousehold(c *gin.Context) {
+	authHeader := c.GetHeader("Authorization")
+	if authHeader == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "JWT_Token header is required"})
+		return
+	}
+
+	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
+	tokenString = strings.TrimSpace(tokenString)
+	userID, err := ExtractIDFromJWT(c, tokenString)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired JWT"})
+		return
+	}
+
+	householdID, ok := resolveHouseholdRole(c, userID, HouseholdOwner)
+	if !ok {
+		return
+	}
+
+	msg, err := Handler.DeleteHousehold(householdID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete household", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": msg})
+}
+
+func HandleFetchHouseholdMembers(c *gin.Context) {
+	authHeader := c.GetHeader("Authorization")
+	if authHeader == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "JWT_Token header is required"})
+		return
+	}
+
+	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
+	tokenString = strings.TrimSpace(tokenString)
+	userID, err := ExtractIDFromJWT(c, tokenString)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired JWT"})
+		return
+	}
+
+	householdID, ok := resolveHouseholdRole(c, userID, HouseholdViewer)
+	if !ok {
+		return
+	}
+
+	members, err := Handler.FetchHouseholdMembers(householdID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch household members", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"members": members})
+}
+
+func HandleUpdateHouseholdMember(c *gin.Context) {
+	authHeader := c.GetHeader("Authorization")
+	if authHeader == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "JWT_Token header is required"})
+		return
+	}
+
+	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
+	tokenString = strings.TrimSpace(tokenString)
+	userID, err := ExtractIDFromJWT(c, tokenString)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired JWT"})
+		return
+	}
+
+	householdID, ok := resolveHouseholdRole(c, userID, HouseholdOwner)
+	if !ok {
+		return
+	}
+
+	var request struct {
+		Role string `json:"role" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+		return
+	}
+	if !validHouseholdRole(request.Role) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "role must be owner, editor or viewer"})
+		return
+	}
+
+	msg, err := Handler.SetHouseholdMemberRole(householdID, c.Param("user_id"), request.Role)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update member", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": msg})
+}
+
+// Owners can remove anyone, and every member can remove themselves.
+func HandleRemoveHouseholdMember(c *gin.Context) {
+	authHeader := c.GetHeader("Authorization")
+	if authHeader == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "JWT_Token header is required"})
+		return
+	}
+
+	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
+	tokenString = strings.TrimSpace(tokenString)
+	userID, err := ExtractIDFromJWT(c, tokenString)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired JWT"})
+		return
+	}
+
+	minRole := HouseholdOwner
+	if c.Param("user_id") == userID {
+		minRole = HouseholdViewer
+	}
+	householdID, ok := resolveHouseholdRole(c, userID, minRole)
+	if !ok {
+		return
+	}
+
+	msg, err := Handler.RemoveHouseholdMember(householdID, c.Param("user_id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove member", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": msg})
+}
+
+// With an email the invite shows up for that user under GET /invites.
+// Without one a link token is returned, once, for the owner to share.
+func HandleCreateHouseholdInvite(c *gin.Context) {
+	authHeader := c.GetHeader("Authorization")
+	if authHeader == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "JWT_Token header is required"})
+		return
+	}
+
+	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
+	tokenString = strings.TrimSpace(tokenString)
+	userID, err := ExtractIDFromJWT(c, tokenString)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired JWT"})
+		return
+	}
+
+	householdID, ok := resolveHouseholdRole(c, userID, HouseholdOwner)
+	if !ok {
+		return
+	}
+
+	var request struct {
+		Role  string `json:"role"`
+		Email string `json:"email"`
+	}
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+		return
+	}
+
+	if request.Role == "" {
+		request.Role = HouseholdEditor
+	}
+	if !validHouseholdRole(request.Role) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "role must be owner, editor or viewer"})
+		return
+	}
+
+	email := strings.TrimSpace(request.Email)
+	if email != "" {
+		if _, err := mail.ParseAddress(email); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid email address"})
+			return
+		}
+	}
+
+	// The link token is only ever returned here, we keep a hash of it
+	linkToken := ""
+	tokenHash := ""
+	if email == "" {
+		linkToken, err = generateToken(24)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate invite link", "details": err.Error()})
+			return
+		}
+		tokenHash = hashToken(linkToken)
+	}
+
+	invite, err := Handler.CreateHouseholdInvite(householdID, userID, request.Role, email, tokenHash)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create invite", "details": err.Error()})
+		return
+	}
+
+	response := gin.H{"invite": invite}
+	if linkToken != "" {
+		response["invite_token"] = linkToken
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+func HandleFetchHouseholdInvites(c *gin.Context) {
+	authHeader := c.GetHeader("Authorization")
+	if authHeader == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "JWT_Token header is required"})
+		return
+	}
+
+	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
+	tokenString = strings.TrimSpace(tokenString)
+	userID, err := ExtractIDFromJWT(c, tokenString)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired JWT"})
+		return
+	}
+
+	householdID, ok := resolveHouseholdRole(c, userID, HouseholdOwner)
+	if !ok {
+		return
+	}
+
+	invites, err := Handler.FetchHouseholdInvites(householdID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch invites", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"invites": invites})
+}
+
+func HandleDeleteHouseholdInvite(c *gin.Context) {
+	authHeader := c.GetHeader("Authorization")
+	if authHeader == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "JWT_Token header is required"})
+		return
+	}
+
+	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
+	tokenString = strings.TrimSpace(tokenString)
+	userID, err := ExtractIDFromJWT(c, tokenString)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired JWT"})
+		return
+	}
+
+	householdID, ok := resolveHouseholdRole(c, userID, HouseholdOwner)
+	if !ok {
+		return
+	}
+
+	inviteID, err := strconv.Atoi(c.Param("invite_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid invite ID"})
+		return
+	}
+
+	msg, err := Handler.DeleteHouseholdInvite(householdID, inviteID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke invite", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": msg})
+}
+
+// Household invites sent to the email on the caller's JWT.
+func HandleFetchMyInvites(c *gin.Context) {
+	authHeader := c.GetHeader("Authorization")
+	if authHeader == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "JWT_Token header is required"})
+		return
+	}
+
+	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
+	tokenString = strings.TrimSpace(tokenString)
+	if _, err := ExtractIDFromJWT(c, tokenString); err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired JWT"})
+		return
+	}
+
+	email, err := ExtractEmailFromJWT(tokenString)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"invites": []HouseholdInvite{}})
+		return
+	}
+
+	invites, err := Handler.FetchInvitesForEmail(email)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch invites", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"invites": invites})
+}
+
+// Takes either the token from an invite link, or the id of an invite sent to
+// the caller's email.
+func HandleAcceptHouseholdInvite(c *gin.Context) {
+	authHeader := c.GetHeader("Authorization")
+	if authHeader == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "JWT_Token header is required"})
+		return
+	}
+
+	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
+	tokenString = strings.TrimSpace(tokenString)
+	userID, err := ExtractIDFromJWT(c, tokenString)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired JWT"})
+		return
+	}
+
+	var request struct {
+		Token    string `json:"token"`
+		InviteID *int   `json:"invite_id"`
+	}
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+		return
+	}
+
+	var household Household
+	switch {
+	case request.Token != "":
+		household, err = Handler.AcceptHouseholdInviteLink(userID, request.Token)
+	case request.InviteID != nil:
+		email, emailErr := ExtractEmailFromJWT(tokenString)
+		if emailErr != nil {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Your account has no email to match the invite against"})
+			return
+		}
+		household, err = Handler.AcceptHouseholdInviteEmail(userID, email, *request.InviteID)
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "token or invite_id is required"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Failed to accept invite", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"household": household})
+}
+
+// Only whoever added the plant can move it, and they need to be an editor
+// in the household it moves into. A null household_id makes it personal again.
+func HandleSetPlantHousehold(c *gin.Context) {
+	authHeader := c.GetHeader("Authorization")
+	if authHeader == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "JWT_Token header is required"})
+		return
+	}
+
+	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
+	tokenString = strings.TrimSpace(tokenString)
+	userID, err := ExtractIDFromJWT(c, tokenString)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired JWT"})
+		return
+	}
+
+	plantID, err := strconv.Atoi(c.Param("plantid"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid plant ID"})
+		return
+	}
+
+	var request struct {
+		HouseholdID *int `json:"household_id"`
+	}
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+		return
+	}
+
+	if request.HouseholdID != nil {
+		role, err := Handler.HouseholdRole(userID, *request.HouseholdID)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Household not found", "details": err.Error()})
+			return
+		}
+		if !roleAllows(role, HouseholdEditor) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "You need to be an editor to add plants to this household"})
+			return
+		}
+	}
+
+	msg, err := Handler.SetPlantHousehold(userID, plantID, request.HouseholdID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to move plant", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": msg})
+}
+
+// Only for plants in a household. An empty rotation keeps the assignee
+// fixed; a null assignee with a rotation lets the rotation pick.
+func HandleSetAssignment(c *gin.Context) {
+	authHeader := c.GetHeader("Authorization")
+	if authHeader == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "JWT_Token header is required"})
+		return
+	}
+
+	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
+	tokenString = strings.TrimSpace(tokenString)
+	userID, err := ExtractIDFromJWT(c, tokenString)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired JWT"})
+		return
+	}
+
+	scheduleID, err := strconv.Atoi(c.Param("schedule_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid schedule ID"})
+		return
+	}
+
+	ownerID, ok := resolveScheduleAccess(c, userID, scheduleID, HouseholdEditor)
+	if !ok {
+		return
+	}
+
+	var assignment Assignment
+	if err := c.ShouldBindJSON(&assignment); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+		return
+	}
+	if !validRotation(assignment.Rotation) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "rotation must be empty, round_robin, weekly or least_recent"})
+		return
+	}
+
+	assignment, err = Handler.SetAssignment(ownerID, scheduleID, assignment)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to update assignment", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"assignment": assignment})
+}
+
+// Most recent first, ?limit= up to 200 (default 50).
+func HandleFetchCareHistory(c *gin.Context) {
+	authHeader := c.GetHeader("Authorization")
+	if authHeader == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "JWT_Token header is required"})
+		return
+	}
+
+	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
+	tokenString = strings.TrimSpace(tokenString)
+	userID, err := ExtractIDFromJWT(c, tokenString)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired JWT"})
+		return
+	}
+
+	plantID, err := strconv.Atoi(c.Param("plantid"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid plant ID"})
+		return
+	}
+
+	ownerID, ok := resolvePlantAccess(c, userID, plantID, HouseholdViewer)
+	if !ok {
+		return
+	}
+
+	limit := 50
+	if raw := c.Query("limit"); raw != "" {
+		limit, err = strconv.Atoi(raw)
+		if err != nil || limit < 1 || limit > 200 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be between 1 and 200"})
+			return
+		}
+	}
+
+	history, err := Handler.FetchCareHistory(ownerID, plantID, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch care history", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"history": history})
+}
+
+// Offers one of the caller's own plants to whoever signs in with to_email.
+// Household plants leave the household when the transfer is accepted.
+func HandleOfferPlantTransfer(c *gin.Context) {
+	authHeader := c.GetHeader("Authorization")
+	if authHeader == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "JWT_Token header is required"})
+		return
+	}
+
+	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
+	tokenString = strings.TrimSpace(tokenString)
+	userID, err := ExtractIDFromJWT(c, tokenString)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired JWT"})
+		return
+	}
+
+	plantID, err := strconv.Atoi(c.Param("plantid"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid plant ID"})
+		return
+	}
+
+	var request struct {
+		ToEmail string `json:"to_email" binding:"required"`
+		Message string `json:"message"`
+	}
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+		return
+	}
+
+	toEmail := strings.TrimSpace(request.ToEmail)
+	ownEmail, _ := ExtractEmailFromJWT(tokenString)
+	if err := validateTransferOffer(toEmail, ownEmail, request.Message); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	transfer, err := Handler.OfferPlantTransfer(userID, plantID, toEmail, strings.TrimSpace(request.Message))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to offer plant", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"transfer": transfer})
+}
+
+func HandleFetchPlantTransfers(c *gin.Context) {
+	authHeader := c.GetHeader("Authorization")
+	if authHeader == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "JWT_Token header is required"})
+		return
+	}
+
+	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
+	tokenString = strings.TrimSpace(tokenString)
+	userID, err := ExtractIDFromJWT(c, tokenString)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired JWT"})
+		return
+	}
+
+	// Without an email only sent and already accepted transfers show up
+	email, _ := ExtractEmailFromJWT(tokenString)
+
+	transfers, err := Handler.FetchPlantTransfers(userID, email)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch transfers", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"transfers": transfers})
+}
+
+// The recipient answers an offer sent to their email with accept or decline.
+// The user's side of every accepted transfer, including plants they've
+// since given away.
+func HandleFetchPlantTransferEvents(c *gin.Context) {
+	authHeader := c.GetHeader("Authorization")
+	if authHeader == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "JWT_Token header is required"})
+		return
+	}
+
+	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
+	tokenString = strings.TrimSpace(tokenString)
+	userID, err := ExtractIDFromJWT(c, tokenString)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired JWT"})
+		return
+	}
+
+	events, err := Handler.FetchPlantTransferEvents(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch transfer history", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"events": events})
+}
+
+func HandleRespondPlantTransfer(c *gin.Context) {
+	authHeader := c.GetHeader("Authorization")
+	if authHeader == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "JWT_Token header is required"})
+		return
+	}
+
+	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
+	tokenString = strings.TrimSpace(tokenString)
+	userID, err := ExtractIDFromJWT(c, tokenString)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired JWT"})
+		return
+	}
+
+	transferID, err := strconv.Atoi(c.Param("transfer_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid transfer ID"})
+		return
+	}
+
+	email, err := ExtractEmailFromJWT(tokenString)
+	if err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Your account has no email to match the transfer against"})
+		return
+	}
+
+	switch c.Param("decision") {
+	case "accept":
+		transfer, err := Handler.AcceptPlantTransfer(userID, email, transferID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to accept transfer", "details": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"transfer": transfer})
+	case "decline":
+		msg, err := Handler.DeclinePlantTransfer(email, transferID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to decline transfer", "details": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": msg})
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "decision must be accept or decline"})
+	}
+}
+
+func HandleCancelPlantTransfer(c *gin.Context) {
+	authHeader := c.GetHeader("Authorization")
+	if authHeader == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "JWT_Token header is required"})
+		return
+	}
+
+	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
+	tokenString = strings.TrimSpace(tokenString)
+	userID, err := ExtractIDFromJWT(c, tokenString)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired JWT"})
+		return
+	}
+
+	transferID, err := strconv.Atoi(c.Param("transfer_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid transfer ID"})
+		return
+	}
+
+	msg, err := Handler.CancelPlantTransfer(userID, transferID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to cancel transfer", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": msg})
+}
+
+// Called from the permanent account with the anonymous session's token in
+// the body. Both tokens have to be current, so the caller holds both
+// accounts.
+func HandleMergeAccount(c *gin.Context) {
+	authHeader := c.GetHeader("Authorization")
+	if authHeader == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "JWT_Token header is required"})
+		return
+	}
+
+	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
+	tokenString = strings.TrimSpace(tokenString)
+	userID, permanentIsAnonymous, err := VerifiedJWTIdentity(tokenString)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired JWT", "details": err.Error()})
+		return
+	}
+
+	var request struct {
+		AnonymousToken string `json:"anonymous_token" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+		return
+	}
+
+	anonymousToken := strings.TrimSpace(strings.TrimPrefix(request.AnonymousToken, "Bearer "))
+	anonymousID, anonymous, err := VerifiedJWTIdentity(anonymousToken)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid anonymous token", "details": err.Error()})
+		return
+	}
+
+	switch {
+	case permanentIsAnonymous:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Sign in to a permanent account before merging"})
+		return
+	case !anonymous:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Only anonymous accounts can be merged"})
+		return
+	case anonymousID == userID:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Both tokens belong to the same account"})
+		return
+	}
+
+	result, err := Handler.MergeAccounts(anonymousID, userID)
+	if err != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "Failed to merge accounts", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Accounts merged successfully", "result": result})
+}
+
+func HandleExportAccount(c *gin.Context) {
+	authHeader := c.GetHeader("Authorization")
+	if authHeader == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "JWT_Token header is required"})
+		return
+	}
+
+	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
+	tokenString = strings.TrimSpace(tokenString)
+	userID, err := ExtractIDFromJWT(c, tokenString)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired JWT"})
+		return
+	}
+
+	tables, err := Handler.ExportAccount(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to export account", "details": err.Error()})
+		return
+	}
+
+	var archive bytes.Buffer
+	if err := writeAccountExport(&archive, tables); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to build export", "details": err.Error()})
+		return
+	}
+
+	filename := "greenthumb-export-" + time.Now().UTC().Format("2006-01-02") + ".zip"
+	c.Header("Content-Disposition", `attachment; filename="`+filename+`"`)
+	c.Data(http.StatusOK, "application/zip", archive.Bytes())
+}
+
+func HandleDeleteAccount(c *gin.Context) {
+	authHeader := c.GetHeader("Authorization")
+	if authHeader == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "JWT_Token header is required"})
+		return
+	}
+
+	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
+	tokenString = strings.TrimSpace(tokenString)
+	userID, err := ExtractIDFromJWT(c, tokenString)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired JWT"})
+		return
+	}
+
+	deletion, err := Handler.DeleteAccount(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete account", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Account deleted, it can be restored until purge_after", "deletion": deletion})
+}
+
+func HandleRestoreAccount(c *gin.Context) {
+	authHeader := c.GetHeader("Authorization")
+	if authHeader == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "JWT_Token header is required"})
+		return
+	}
+
+	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
+	tokenString = strings.TrimSpace(tokenString)
+	userID, err := ExtractIDFromJWT(c, tokenString)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired JWT"})
+		return
+	}
+
+	deletion, err := Handler.RestoreAccount(userID)
+	if err != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "Failed to restore account", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Account restored successfully", "deletion": deletion})
+}
+
+// Takes an export in any of the importers' formats, picked by ?format= or
+// else csv or json by the Content-Type. With ?dry_run=true nothing is
+// created and the report says what would be.
+func HandleImportPlants(c *gin.Context) {
+	authHeader := c.GetHeader("Authorization")
+	if authHeader == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "JWT_Token header is required"})
+		return
+	}
+
+	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
+	tokenString = strings.TrimSpace(tokenString)
+	userID, err := ExtractIDFromJWT(c, tokenString)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired JWT"})
+		return
+	}
+
+	format := c.Query("format")
+	if format == "" {
+		format = "json"
+		if strings.Contains(c.ContentType(), "csv") {
+			format = "csv"
+		}
+	}
+	dryRun := c.Query("dry_run") == "true"
+
+	rows, err := parseImportRows(format, http.MaxBytesReader(c.Writer, c.Request.Body, 1<<20))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid import file", "details": err.Error()})
+		return
+	}
+
+	report, err := importPlants(userID, format, rows, dryRun)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to import plants", "details": err.Error()})
+		return
+	}
+
+	if !dryRun && report.Invalid > 0 {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Some rows are invalid, nothing was imported", "report": report})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"report": report})
+}
+
+func HandleSearchSpecies(c *gin.Context) {
+	authHeader := c.GetHeader("Authorization")
+	if authHeader == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "JWT_Token header is required"})
+		return
+	}
+
+	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
+	tokenString = strings.TrimSpace(tokenString)
+	if _, err := ExtractIDFromJWT(c, tokenString); err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired JWT"})
+		return
+	}
+
+	limit := 20
+	if raw := c.Query("limit"); raw != "" {
+		parsed, err := strconv.Atoi(raw)
+		if err != nil || parsed < 1 || parsed > 100 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be between 1 and 100"})
+			return
+		}
+		limit = parsed
+	}
+
+	species, err := Handler.SearchSpecies(c.Query("q"), limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to search species", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"species": species})
+}
+
+func HandleFetchSpecies(c *gin.Context) {
+	authHeader := c.GetHeader("Authorization")
+	if authHeader == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "JWT_Token header is required"})
+		return
+	}
+
+	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
+	tokenString = strings.TrimSpace(tokenString)
+	if _, err := ExtractIDFromJWT(c, tokenString); err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired JWT"})
+		return
+	}
+
+	speciesID, err := strconv.Atoi(c.Param("species_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid species ID"})
+		return
+	}
+
+	species, err := Handler.FetchSpecies(speciesID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Species not found", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"species": species})
+}
+
+// Like HandleAddPlant for when the user already knows the species (or
+// OpenAI is down): no classification, the schedule comes from the catalog
+// and the care rules.
+// A photo still gets a health check.
+func HandleAddPlantFromCatalog(c *gin.Context) {
+	authHeader := c.GetHeader("Authorization")
+	if authHeader == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "JWT_Token header is required"})
+		return
+	}
+
+	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
+	tokenString = strings.TrimSpace(tokenString)
+	userID, err := ExtractIDFromJWT(c, tokenString)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired JWT"})
+		return
+	}
+
+	var request struct {
+		SpeciesID   int    `json:"species_id" binding:"required"`
+		PlantName   string `json:"plant_pet_name" binding:"required"`
+		ImageURL    string `json:"image_url"`
+		HouseholdID *int   `json:"household_id"`
+		PotSizeCM   int    `json:"pot_size_cm"`
+		Light       string `json:"light"`
+	}
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+		return
+	}
+
+	if err := validateCareConditions(request.PotSizeCM, request.Light); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !checkCanAddToHousehold(c, userID, request.HouseholdID) {
+		return
+	}
+
+	// Checked before the health check so a full account doesn't cost an AI
+	// call. AddPlant enforces the limit again in its transaction.
+	count, err := Handler.CountPlants(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to count plants", "details": err.Error()})
+		return
+	}
+	if count >= maxPlantsPerUser {
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("You already have the maximum of %d plants", maxPlantsPerUser)})
+		return
+	}
+
+	species, err := Handler.FetchSpecies(request.SpeciesID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Species not found", "details": err.Error()})
+		return
+	}
+
+	health := 100
+	healthChecked := false
+	if request.ImageURL != "" {
+		score, err := checkPlantHealthWithOpenAI(request.ImageURL, os.Getenv("OPENAI_API_KEY"), species.ScientificName)
+		if err != nil {
+			fmt.Println(err)
+		} else {
+			health, healthChecked = score, true
+		}
+	}
+
+	plantID, err := Handler.AddPlant(
+		userID,
+		species.CommonName,
+		species.ScientificName,
+		species.ScientificName,
+		request.ImageURL,
+		request.PlantName,
+		health,
+		request.HouseholdID,
+		&species.SpeciesID,
+	)
+	if err != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("Failed to add plant, you may be at the limit of %d", maxPlantsPerUser), "details": err.Error()})
+		return
+	}
+
+	if healthChecked {
+		if err := Handler.RecordPlantHealth(userID, plantID, health, request.ImageURL); err != nil {
+			fmt.Println(err)
+		}
+	}
+
+	care := recommendCareFor(userID, &species, request.PotSizeCM, request.Light)
+
+	msg, err := Handler.CreateNewSchedule(userID, plantID, request.PlantName, care.WaterEveryDays, "day", nil)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create schedule", "details": err.Error()})
+		return
+	}
+
+	// Apply the current season to the catalog interval
+	if _, err := Handler.RecalculateSeasonalIntervals(userID); err != nil {
+		fmt.Println(err)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": msg, "plant_id": plantID, "care": care})
+}
+
+// Watering, fertilizing and repotting advice from the offline care rules,
+// for a catalog species or a free text name.
+func HandleCareRecommendation(c *gin.Context) {
+	authHeader := c.GetHeader("Authorization")
+	if authHeader == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "JWT_Token header is required"})
+		return
+	}
+
+	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
+	tokenString = strings.TrimSpace(tokenString)
+	userID, err := ExtractIDFromJWT(c, tokenString)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired JWT"})
+		return
+	}
+
+	var request struct {
+		SpeciesID *int   `json:"species_id"`
+		Name      string `json:"name"`
+		PotSizeCM int    `json:"pot_size_cm"`
+		Light     string `json:"light"`
+	}
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+		return
+	}
+
+	if request.SpeciesID == nil && strings.TrimSpace(request.Name) == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "species_id or name is required"})
+		return
+	}
+	if err := validateCareConditions(request.PotSizeCM, request.Light); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var species *CatalogSpecies
+	if request.SpeciesID != nil {
+		found, err := Handler.FetchSpecies(*request.SpeciesID)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Species not found", "details": err.Error()})
+			return
+		}
+		species = &found
+	} else {
+		species, err = Handler.ResolveSpecies(request.Name)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to look up species", "details": err.Error()})
+			return
+		}
+	}
+
+	care := recommendCareFor(userID, species, request.PotSizeCM, request.Light, request.Name)
+	c.JSON(http.StatusOK, gin.H{"species": species, "care": care})
+}
+
+// Fixes a species the AI got wrong, from the catalog or as free text. The
+// correction is kept with what the AI originally said.
+func HandleCorrectPlantSpecies(c *gin.Context) {
+	authHeader := c.GetHeader("Authorization")
+	if authHeader == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "JWT_Token header is required"})
+		return
+	}
+
+	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
+	tokenString = strings.TrimSpace(tokenString)
+	userID, err := ExtractIDFromJWT(c, tokenString)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired JWT"})
+		return
+	}
+
+	plantID, err := strconv.Atoi(c.Param("plantid"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid plant ID"})
+		return
+	}
+
+	ownerID, ok := resolvePlantAccess(c, userID, plantID, HouseholdEditor)
+	if !ok {
+		return
+	}
+
+	var request struct {
+		SpeciesID          *int   `json:"species_id"`
+		PlantName          string `json:"plant_name"`
+		ScientificName     string `json:"scientific_name"`
+		Species            string `json:"species"`
+		RegenerateSchedule bool   `json:"regenerate_schedule"`
+	}
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+		return
+	}
+
+	correction := SpeciesCorrection{
+		PlantName:      strings.TrimSpace(request.PlantName),
+		ScientificName: strings.TrimSpace(request.ScientificName),
+		Species:        strings.TrimSpace(request.Species),
+	}
+	if request.SpeciesID == nil && correction.PlantName == "" && correction.ScientificName == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "species_id, plant_name or scientific_name is required"})
+		return
+	}
+	if len(correction.PlantName) > 75 || len(correction.ScientificName) > 100 || len(correction.Species) > 100 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "plant_name can be at most 75 characters, scientific_name and species 100"})
+		return
+	}
+
+	var species *CatalogSpecies
+	if request.SpeciesID != nil {
+		found, err := Handler.FetchSpecies(*request.SpeciesID)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Species not found", "details": err.Error()})
+			return
+		}
+		species = &found
+	} else {
+		// Free text still gets linked when it names a catalog species
+		species, err = Handler.ResolveSpecies(correction.ScientificName, correction.PlantName, correction.Species)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to look up species", "details": err.Error()})
+			return
+		}
+	}
+	completeCorrection(&correction, species)
+
+	regenerateEvery := 0
+	if request.RegenerateSchedule {
+		care := recommendCareFor(ownerID, species, 0, "", correction.PlantName, correction.ScientificName, correction.Species)
+		regenerateEvery = care.WaterEveryDays
+	}
+
+	correction, err = Handler.CorrectPlantSpecies(ownerID, userID, plantID, correction, regenerateEvery)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to correct species", "details": err.Error()})
+		return
+	}
+
+	if correction.ScheduleRegenerated {
+		if _, err := Handler.RecalculateSeasonalIntervals(ownerID); err != nil {
+			fmt.Println(err)
+		}
+	}
+
+	msg := "Species corrected"
+	if request.RegenerateSchedule && !correction.ScheduleRegenerated {
+		msg = "Species corrected, the schedule was kept because you set its interval yourself"
+	}
+	c.JSON(http.StatusOK, gin.H{"message": msg, "correction": correction})
+}
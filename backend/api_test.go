@@ -0,0 +1,184 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const testJWTSecret = "test-secret"
+
+func signTestJWT(t *testing.T, secret string, claims jwt.MapClaims) string {
+	t.Helper()
+	signed, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(secret))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+func TestParseSnoozeDuration(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    time.Duration
+		wantErr bool
+	}{
+		{"90m", 90 * time.Minute, false},
+		{"4h", 4 * time.Hour, false},
+		{" 2d ", 48 * time.Hour, false},
+		{"30d", 30 * 24 * time.Hour, false},
+		{"31d", 0, true},
+		{"0h", 0, true},
+		{"-1d", 0, true},
+		{"d", 0, true},
+		{"tomorrow", 0, true},
+		{"", 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := parseSnoozeDuration(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseSnoozeDuration(%q) error = %v, wantErr %v", tt.value, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("parseSnoozeDuration(%q) = %v, want %v", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExtractEmailFromJWT(t *testing.T) {
+	t.Setenv("SUPABASE_JWT_SECRET", testJWTSecret)
+	future := time.Now().Add(time.Hour).Unix()
+	past := time.Now().Add(-time.Hour).Unix()
+
+	unsigned, err := jwt.NewWithClaims(jwt.SigningMethodNone, jwt.MapClaims{"sub": "u", "email": "sam@example.com", "exp": future}).
+		SignedString(jwt.UnsafeAllowNoneSignatureType)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		token   string
+		want    string
+		wantErr bool
+	}{
+		{"verified", signTestJWT(t, testJWTSecret, jwt.MapClaims{"sub": "u", "email": "sam@example.com", "exp": future}), "sam@example.com", false},
+		{"wrong secret", signTestJWT(t, "forged", jwt.MapClaims{"sub": "u", "email": "sam@example.com", "exp": future}), "", true},
+		{"expired", signTestJWT(t, testJWTSecret, jwt.MapClaims{"sub": "u", "email": "sam@example.com", "exp": past}), "", true},
+		{"no expiry", signTestJWT(t, testJWTSecret, jwt.MapClaims{"sub": "u", "email": "sam@example.com"}), "", true},
+		{"unsigned", unsigned, "", true},
+		{"no email", signTestJWT(t, testJWTSecret, jwt.MapClaims{"sub": "u", "exp": future}), "", true},
+		{"garbage", "not-a-jwt", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ExtractEmailFromJWT(tt.token)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ExtractEmailFromJWT() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ExtractEmailFromJWT() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExtractEmailFromJWTWithoutSecret(t *testing.T) {
+	t.Setenv("SUPABASE_JWT_SECRET", "")
+	token := signTestJWT(t, testJWTSecret, jwt.MapClaims{"sub": "u", "email": "sam@example.com", "exp": time.Now().Add(time.Hour).Unix()})
+	if _, err := ExtractEmailFromJWT(token); err == nil {
+		t.Error("expected an error without SUPABASE_JWT_SECRET")
+	}
+}
+
+func TestVerifiedJWTIdentity(t *testing.T) {
+	t.Setenv("SUPABASE_JWT_SECRET", testJWTSecret)
+	future := time.Now().Add(time.Hour).Unix()
+	past := time.Now().Add(-time.Hour).Unix()
+
+	unsigned, err := jwt.NewWithClaims(jwt.SigningMethodNone, jwt.MapClaims{"sub": "anon", "is_anonymous": true, "exp": future}).
+		SignedString(jwt.UnsafeAllowNoneSignatureType)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name          string
+		token         string
+		wantID        string
+		wantAnonymous bool
+		wantErr       bool
+	}{
+		{"anonymous", signTestJWT(t, testJWTSecret, jwt.MapClaims{"sub": "anon", "is_anonymous": true, "exp": future}), "anon", true, false},
+		{"permanent", signTestJWT(t, testJWTSecret, jwt.MapClaims{"sub": "u", "is_anonymous": false, "exp": future}), "u", false, false},
+		{"no is_anonymous claim", signTestJWT(t, testJWTSecret, jwt.MapClaims{"sub": "u", "exp": future}), "u", false, false},
+		{"wrong secret", signTestJWT(t, "forged", jwt.MapClaims{"sub": "anon", "is_anonymous": true, "exp": future}), "", false, true},
+		{"unsigned", unsigned, "", false, true},
+		{"expired", signTestJWT(t, testJWTSecret, jwt.MapClaims{"sub": "anon", "is_anonymous": true, "exp": past}), "", false, true},
+		{"no expiry", signTestJWT(t, testJWTSecret, jwt.MapClaims{"sub": "anon", "is_anonymous": true}), "", false, true},
+		{"no sub", signTestJWT(t, testJWTSecret, jwt.MapClaims{"is_anonymous": true, "exp": future}), "", false, true},
+		{"garbage", "not-a-jwt", "", false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			id, anonymous, err := VerifiedJWTIdentity(tt.token)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("VerifiedJWTIdentity() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if id != tt.wantID || anonymous != tt.wantAnonymous {
+				t.Errorf("VerifiedJWTIdentity() = (%q, %v), want (%q, %v)", id, anonymous, tt.wantID, tt.wantAnonymous)
+			}
+		})
+	}
+}
+
+// Every case here is rejected before the database is touched.
+func TestHandleMergeAccountRejects(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	t.Setenv("SUPABASE_JWT_SECRET", testJWTSecret)
+	future := time.Now().Add(time.Hour).Unix()
+	past := time.Now().Add(-time.Hour).Unix()
+
+	permanent := signTestJWT(t, testJWTSecret, jwt.MapClaims{"sub": "u", "exp": future})
+	anonymous := signTestJWT(t, testJWTSecret, jwt.MapClaims{"sub": "anon", "is_anonymous": true, "exp": future})
+
+	tests := []struct {
+		name       string
+		permanent  string
+		anonymous  string
+		wantStatus int
+	}{
+		{"forged permanent token", signTestJWT(t, "forged", jwt.MapClaims{"sub": "u", "exp": future}), anonymous, http.StatusUnauthorized},
+		{"expired permanent token", signTestJWT(t, testJWTSecret, jwt.MapClaims{"sub": "u", "exp": past}), anonymous, http.StatusUnauthorized},
+		{"forged anonymous token", permanent, signTestJWT(t, "forged", jwt.MapClaims{"sub": "anon", "is_anonymous": true, "exp": future}), http.StatusUnauthorized},
+		{"expired anonymous token", permanent, signTestJWT(t, testJWTSecret, jwt.MapClaims{"sub": "anon", "is_anonymous": true, "exp": past}), http.StatusUnauthorized},
+		{"anonymous token is an access token", permanent, accessTokenPrefix + "0123456789", http.StatusUnauthorized},
+		{"permanent token is anonymous", anonymous, anonymous, http.StatusBadRequest},
+		{"other token is permanent", permanent, signTestJWT(t, testJWTSecret, jwt.MapClaims{"sub": "v", "exp": future}), http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(rec)
+			c.Request = httptest.NewRequest(http.MethodPost, "/account/merge", strings.NewReader(`{"anonymous_token": "`+tt.anonymous+`"}`))
+			c.Request.Header.Set("Authorization", "Bearer "+tt.permanent)
+			c.Request.Header.Set("Content-Type", "application/json")
+
+			HandleMergeAccount(c)
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+// Light levels, the same values the species catalog uses.
+const (
+	LightLow            = "low"
+	LightMedium         = "medium"
+	LightBrightIndirect = "bright_indirect"
+	LightFullSun        = "full_sun"
+)
+
+// Starting points per care group, before pot size, light and season. The
+// catalog's own intervals replace these when the species is known.
+type careRule struct {
+	WaterEveryDays     int
+	FertilizeEveryDays int
+	RepotEveryMonths   int
+	FeedWhenDormant    bool
+}
+
+var careRules = map[string]careRule{
+	CareGroupSucculent: {WaterEveryDays: 14, FertilizeEveryDays: 60, RepotEveryMonths: 24},
+	CareGroupFern:      {WaterEveryDays: 4, FertilizeEveryDays: 30, RepotEveryMonths: 18},
+	CareGroupAroid:     {WaterEveryDays: 7, FertilizeEveryDays: 30, RepotEveryMonths: 18},
+	CareGroupHerb:      {WaterEveryDays: 3, FertilizeEveryDays: 21, RepotEveryMonths: 12},
+	CareGroupFoliage:   {WaterEveryDays: 7, FertilizeEveryDays: 30, RepotEveryMonths: 24},
+	CareGroupFlowering: {WaterEveryDays: 5, FertilizeEveryDays: 14, RepotEveryMonths: 12, FeedWhenDormant: true},
+}
+
+// Anything we can't place is treated as a generic houseplant.
+const defaultCareGroup = CareGroupFoliage
+
+// Words that give away the care group when the species isn't in the catalog.
+// Checked in order, so "asparagus fern" is a fern before anything else.
+var careGroupKeywords = []struct {
+	group    string
+	keywords []string
+}{
+	{CareGroupFern, []string{"fern", "nephrolepis", "adiantum", "asplenium", "platycerium", "pteris"}},
+	{CareGroupSucculent, []string{"succulent", "cactus", "cacti", "aloe", "echeveria", "haworthia", "sedum", "crassula",
+		"jade", "agave", "sansevieria", "dracaena trifasciata", "snake plant", "zamioculcas", "euphorbia", "kalanchoe", "lithops"}},
+	{CareGroupAroid, []string{"monstera", "philodendron", "pothos", "epipremnum", "anthurium", "alocasia", "colocasia",
+		"aglaonema", "syngonium", "spathiphyllum", "peace lily", "dieffenbachia", "scindapsus", "aroid"}},
+	{CareGroupHerb, []string{"basil", "ocimum", "mint", "mentha", "rosemary", "salvia rosmarinus", "thyme", "thymus",
+		"parsley", "petroselinum", "cilantro", "coriander", "oregano", "origanum", "sage", "chive", "dill", "lavender", "herb"}},
+	{CareGroupFlowering, []string{"orchid", "phalaenopsis", "begonia", "african violet", "saintpaulia", "hibiscus",
+		"geranium", "pelargonium", "rose", "cyclamen", "gardenia", "jasmine", "bromeliad"}},
+}
+
+// Everything the engine looks at. Zero values mean unknown.
+type CareConditions struct {
+	CareGroup          string
+	WaterEveryDays     int
+	FertilizeEveryDays int
+	PotSizeCM          int
+	Light              string
+	Date               time.Time
+	Southern           bool
+}
+
+type CareRecommendation struct {
+	CareGroup              string   `json:"care_group"`
+	WaterEveryDays         int      `json:"water_every_days"`
+	SeasonalWaterEveryDays int      `json:"seasonal_water_every_days"`
+	FertilizeEveryDays     int      `json:"fertilize_every_days"`
+	FertilizePaused        bool     `json:"fertilize_paused"`
+	RepotEveryMonths       int      `json:"repot_every_months"`
+	RepotNow               bool     `json:"repot_now"`
+	Reasons                []string `json:"reasons"`
+}
+
+func validLight(light string) bool {
+	switch light {
+	case "", LightLow, LightMedium, LightBrightIndirect, LightFullSun:
+		return true
+	}
+	return false
+}
+
+func validateCareConditions(pot_size_cm int, light string) error {
+	if pot_size_cm < 0 || pot_size_cm > 200 {
+		return fmt.Errorf("pot_size_cm must be between 0 (unknown) and 200")
+	}
+	if !validLight(light) {
+		return fmt.Errorf("light must be one of low, medium, bright_indirect or full_sun")
+	}
+	return nil
+}
+
+func guessCareGroup(names ...string) string {
+	text := strings.ToLower(strings.Join(names, " "))
+	for _, entry := range careGroupKeywords {
+		for _, keyword := range entry.keywords {
+			if strings.Contains(text, keyword) {
+				return entry.group
+			}
+		}
+	}
+	return defaultCareGroup
+}
+
+func scaleDays(days int, factor float64) int {
+	scaled := int(math.Round(float64(days) * factor))
+	if scaled < 1 {
+		return 1
+	}
+	return scaled
+}
+
+// Spring, for repotting. Shifted six months in the southern hemisphere like
+// the seasonal profiles.
+var repotSeason = SeasonalProfile{Label: "Spring", StartMonth: 3, EndMonth: 5}
+
+// The same answer for the same inputs, no network involved. Watering comes
+// back both as the base interval the schedule stores and as what it works
+// out to this season.
+func recommendCare(conditions CareConditions) CareRecommendation {
+	group := conditions.CareGroup
+	rule, ok := careRules[group]
+	if !ok {
+		group = defaultCareGroup
+		rule = careRules[group]
+	}
+
+	rec := CareRecommendation{
+		CareGroup:          group,
+		WaterEveryDays:     rule.WaterEveryDays,
+		FertilizeEveryDays: rule.FertilizeEveryDays,
+		RepotEveryMonths:   rule.RepotEveryMonths,
+	}
+	if conditions.WaterEveryDays > 0 {
+		rec.WaterEveryDays = conditions.WaterEveryDays
+	}
+	if conditions.FertilizeEveryDays > 0 {
+		rec.FertilizeEveryDays = conditions.FertilizeEveryDays
+	}
+	rec.Reasons = append(rec.Reasons, fmt.Sprintf("%s: water every %d days, feed every %d days", group, rec.WaterEveryDays, rec.FertilizeEveryDays))
+
+	// Small pots dry out fast and get rootbound sooner, big ones hold water
+	switch {
+	case conditions.PotSizeCM > 0 && conditions.PotSizeCM < 12:
+		rec.WaterEveryDays = scaleDays(rec.WaterEveryDays, 0.75)
+		rec.RepotEveryMonths = scaleDays(rec.RepotEveryMonths, 0.75)
+		rec.Reasons = append(rec.Reasons, "small pot: water and repot sooner")
+	case conditions.PotSizeCM >= 25:
+		rec.WaterEveryDays = scaleDays(rec.WaterEveryDays, 1.25)
+		rec.RepotEveryMonths = scaleDays(rec.RepotEveryMonths, 1.5)
+		rec.Reasons = append(rec.Reasons, "large pot: water and repot less often")
+	}
+
+	// Less light means slower growth and slower drying
+	switch conditions.Light {
+	case LightLow:
+		rec.WaterEveryDays = scaleDays(rec.WaterEveryDays, 1.3)
+		rec.FertilizeEveryDays = scaleDays(rec.FertilizeEveryDays, 1.5)
+		rec.Reasons = append(rec.Reasons, "low light: water and feed less often")
+	case LightBrightIndirect:
+		rec.WaterEveryDays = scaleDays(rec.WaterEveryDays, 0.9)
+	case LightFullSun:
+		rec.WaterEveryDays = scaleDays(rec.WaterEveryDays, 0.75)
+		rec.Reasons = append(rec.Reasons, "full sun: water more often")
+	}
+
+	date := conditions.Date
+	if date.IsZero() {
+		date = time.Now()
+	}
+	multiplier := seasonalMultiplier(nil, 0, "", "", date, conditions.Southern)
+	rec.SeasonalWaterEveryDays = adjustedRepeatEvery(rec.WaterEveryDays, multiplier)
+	if multiplier != 1 {
+		rec.Reasons = append(rec.Reasons, fmt.Sprintf("dormant season: water every %d days for now", rec.SeasonalWaterEveryDays))
+		if !rule.FeedWhenDormant {
+			rec.FertilizePaused = true
+			rec.Reasons = append(rec.Reasons, "dormant season: hold off on fertilizer")
+		}
+	}
+
+	rec.RepotNow = repotSeason.activeOn(date, conditions.Southern)
+	if rec.RepotNow {
+		rec.Reasons = append(rec.Reasons, "spring is the time to repot if it's due")
+	}
+	return rec
+}
+
+// Conditions for a plant, from the catalog when the species resolved and
+// from its names otherwise. The catalog's light is what the species likes,
+// not where it sits, so it's left for the caller.
+func careConditionsFor(species *CatalogSpecies, names ...string) CareConditions {
+	if species != nil {
+		return CareConditions{
+			CareGroup:          species.CareGroup,
+			WaterEveryDays:     species.WaterEveryDays,
+			FertilizeEveryDays: species.FertilizeEveryDays,
+		}
+	}
+	return CareConditions{CareGroup: guessCareGroup(names...)}
+}
+
+// recommendCare with the user's hemisphere filled in.
+func recommendCareFor(user_id string, species *CatalogSpecies, pot_size_cm int, light string, names ...string) CareRecommendation {
+	conditions := careConditionsFor(species, names...)
+	conditions.PotSizeCM, conditions.Light = pot_size_cm, light
+
+	latitude, err := Handler.FetchUserLatitude(user_id)
+	if err != nil {
+		fmt.Println(err)
+	}
+	conditions.Southern = isSouthernHemisphere(latitude)
+	return recommendCare(conditions)
+}
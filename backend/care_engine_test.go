@@ -0,0 +1,192 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestValidLight(t *testing.T) {
+	tests := []struct {
+		light string
+		want  bool
+	}{
+		{"", true},
+		{LightLow, true},
+		{LightMedium, true},
+		{LightBrightIndirect, true},
+		{LightFullSun, true},
+		{"bright", false},
+		{"Low", false},
+		{"shade", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.light, func(t *testing.T) {
+			if got := validLight(tt.light); got != tt.want {
+				t.Errorf("validLight(%q) = %v, want %v", tt.light, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateCareConditions(t *testing.T) {
+	tests := []struct {
+		name    string
+		potSize int
+		light   string
+		wantErr bool
+	}{
+		{"nothing given", 0, "", false},
+		{"smallest pot", 1, LightLow, false},
+		{"largest pot", 200, LightFullSun, false},
+		{"negative pot", -1, "", true},
+		{"pot too large", 201, "", true},
+		{"unknown light", 15, "dim", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateCareConditions(tt.potSize, tt.light)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("validateCareConditions(%d, %q) error = %v, wantErr %v", tt.potSize, tt.light, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestGuessCareGroup(t *testing.T) {
+	tests := []struct {
+		names []string
+		want  string
+	}{
+		{[]string{"Boston Fern", "Nephrolepis exaltata"}, CareGroupFern},
+		{[]string{"Asparagus fern"}, CareGroupFern},
+		{[]string{"Snake Plant"}, CareGroupSucculent},
+		{[]string{"", "Echeveria elegans"}, CareGroupSucculent},
+		{[]string{"Monty", "Monstera deliciosa"}, CareGroupAroid},
+		{[]string{"PEACE LILY"}, CareGroupAroid},
+		{[]string{"Sweet Basil"}, CareGroupHerb},
+		{[]string{"Moth Orchid", "Phalaenopsis"}, CareGroupFlowering},
+		{[]string{"Fiddle Leaf Fig", "Ficus lyrata"}, defaultCareGroup},
+		{nil, defaultCareGroup},
+	}
+
+	for _, tt := range tests {
+		t.Run(firstNonEmpty(tt.names), func(t *testing.T) {
+			if got := guessCareGroup(tt.names...); got != tt.want {
+				t.Errorf("guessCareGroup(%q) = %q, want %q", tt.names, got, tt.want)
+			}
+		})
+	}
+}
+
+func firstNonEmpty(names []string) string {
+	for _, name := range names {
+		if name != "" {
+			return name
+		}
+	}
+	return "none"
+}
+
+func TestScaleDays(t *testing.T) {
+	tests := []struct {
+		name   string
+		days   int
+		factor float64
+		want   int
+	}{
+		{"unchanged", 7, 1, 7},
+		{"rounds half up", 14, 0.75, 11},
+		{"rounds down", 7, 1.3, 9},
+		{"longer", 24, 1.5, 36},
+		{"never below a day", 1, 0.25, 1},
+		{"zero stays a day", 0, 1, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := scaleDays(tt.days, tt.factor); got != tt.want {
+				t.Errorf("scaleDays(%d, %v) = %d, want %d", tt.days, tt.factor, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRecommendCare(t *testing.T) {
+	summer := time.Date(2025, time.July, 15, 12, 0, 0, 0, time.UTC)
+	winter := time.Date(2025, time.January, 15, 12, 0, 0, 0, time.UTC)
+	spring := time.Date(2025, time.April, 15, 12, 0, 0, 0, time.UTC)
+	october := time.Date(2025, time.October, 15, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name          string
+		conditions    CareConditions
+		wantGroup     string
+		wantWater     int
+		wantSeasonal  int
+		wantFertilize int
+		wantRepot     int
+		wantPaused    bool
+		wantRepotNow  bool
+	}{
+		{"aroid in summer", CareConditions{CareGroup: CareGroupAroid, Date: summer}, CareGroupAroid, 7, 7, 30, 18, false, false},
+		{"unknown group", CareConditions{CareGroup: "cycad", Date: summer}, defaultCareGroup, 7, 7, 30, 24, false, false},
+		{"catalog intervals", CareConditions{CareGroup: CareGroupAroid, WaterEveryDays: 10, FertilizeEveryDays: 20, Date: summer}, CareGroupAroid, 10, 10, 20, 18, false, false},
+		{"small pot", CareConditions{CareGroup: CareGroupSucculent, PotSizeCM: 10, Date: summer}, CareGroupSucculent, 11, 11, 60, 18, false, false},
+		{"large pot", CareConditions{CareGroup: CareGroupFern, PotSizeCM: 30, Date: summer}, CareGroupFern, 5, 5, 30, 27, false, false},
+		{"medium pot", CareConditions{CareGroup: CareGroupFern, PotSizeCM: 18, Date: summer}, CareGroupFern, 4, 4, 30, 18, false, false},
+		{"low light", CareConditions{CareGroup: CareGroupAroid, Light: LightLow, Date: summer}, CareGroupAroid, 9, 9, 45, 18, false, false},
+		{"bright indirect", CareConditions{CareGroup: CareGroupAroid, Light: LightBrightIndirect, Date: summer}, CareGroupAroid, 6, 6, 30, 18, false, false},
+		{"full sun", CareConditions{CareGroup: CareGroupAroid, Light: LightFullSun, Date: summer}, CareGroupAroid, 5, 5, 30, 18, false, false},
+		{"dormant", CareConditions{CareGroup: CareGroupAroid, Date: winter}, CareGroupAroid, 7, 11, 30, 18, true, false},
+		{"flowering keeps feeding", CareConditions{CareGroup: CareGroupFlowering, Date: winter}, CareGroupFlowering, 5, 8, 14, 12, false, false},
+		{"southern summer", CareConditions{CareGroup: CareGroupAroid, Date: winter, Southern: true}, CareGroupAroid, 7, 7, 30, 18, false, false},
+		{"spring repotting", CareConditions{CareGroup: CareGroupAroid, Date: spring}, CareGroupAroid, 7, 7, 30, 18, false, true},
+		{"southern spring", CareConditions{CareGroup: CareGroupAroid, Date: october, Southern: true}, CareGroupAroid, 7, 7, 30, 18, false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := recommendCare(tt.conditions)
+			if got.CareGroup != tt.wantGroup {
+				t.Errorf("CareGroup = %q, want %q", got.CareGroup, tt.wantGroup)
+			}
+			if got.WaterEveryDays != tt.wantWater || got.SeasonalWaterEveryDays != tt.wantSeasonal {
+				t.Errorf("water = %d (%d this season), want %d (%d)", got.WaterEveryDays, got.SeasonalWaterEveryDays, tt.wantWater, tt.wantSeasonal)
+			}
+			if got.FertilizeEveryDays != tt.wantFertilize || got.FertilizePaused != tt.wantPaused {
+				t.Errorf("fertilize = %d (paused %v), want %d (paused %v)", got.FertilizeEveryDays, got.FertilizePaused, tt.wantFertilize, tt.wantPaused)
+			}
+			if got.RepotEveryMonths != tt.wantRepot || got.RepotNow != tt.wantRepotNow {
+				t.Errorf("repot = %d (now %v), want %d (now %v)", got.RepotEveryMonths, got.RepotNow, tt.wantRepot, tt.wantRepotNow)
+			}
+			if len(got.Reasons) == 0 {
+				t.Error("no reasons given")
+			}
+		})
+	}
+}
+
+func TestCareConditionsFor(t *testing.T) {
+	species := &CatalogSpecies{CareGroup: CareGroupSucculent, WaterEveryDays: 21, FertilizeEveryDays: 90, Light: LightFullSun}
+
+	tests := []struct {
+		name    string
+		species *CatalogSpecies
+		names   []string
+		want    CareConditions
+	}{
+		{"catalog species", species, []string{"Basil"}, CareConditions{CareGroup: CareGroupSucculent, WaterEveryDays: 21, FertilizeEveryDays: 90}},
+		{"guessed from names", nil, []string{"Basil"}, CareConditions{CareGroup: CareGroupHerb}},
+		{"nothing to go on", nil, nil, CareConditions{CareGroup: defaultCareGroup}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := careConditionsFor(tt.species, tt.names...); got != tt.want {
+				t.Errorf("careConditionsFor() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
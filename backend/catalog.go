@@ -0,0 +1,111 @@
+package main
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// The species we know care defaults for. Seeded into the species table on
+// startup, matched on slug so ids stay the same between releases.
+//
+//go:embed species_catalog.json
+var speciesCatalogJSON []byte
+
+// How plants are grouped for care, which doesn't always follow the botanical
+// family (a ZZ plant is an aroid but wants watering like a succulent).
+const (
+	CareGroupSucculent = "succulent"
+	CareGroupFern      = "fern"
+	CareGroupAroid     = "aroid"
+	CareGroupHerb      = "herb"
+	CareGroupFoliage   = "foliage"
+	CareGroupFlowering = "flowering"
+)
+
+// Below this the AI's watering interval isn't trusted, and the catalog's is
+// used instead when the species resolves.
+const classificationConfidenceThreshold = 0.6
+
+type CatalogSpecies struct {
+	SpeciesID          int      `json:"species_id"`
+	Slug               string   `json:"slug"`
+	CommonName         string   `json:"common_name"`
+	ScientificName     string   `json:"scientific_name"`
+	Family             string   `json:"family"`
+	CareGroup          string   `json:"care_group"`
+	Synonyms           []string `json:"synonyms"`
+	WaterEveryDays     int      `json:"water_every_days"`
+	FertilizeEveryDays int      `json:"fertilize_every_days"`
+	Light              string   `json:"light"`
+}
+
+func loadSpeciesCatalog() ([]CatalogSpecies, error) {
+	var catalog []CatalogSpecies
+	if err := json.Unmarshal(speciesCatalogJSON, &catalog); err != nil {
+		return nil, fmt.Errorf("failed to read species catalog: %v", err)
+	}
+	for _, species := range catalog {
+		if species.Slug == "" || species.ScientificName == "" || species.WaterEveryDays < 1 {
+			return nil, fmt.Errorf("species catalog entry %q is missing a slug, scientific name or interval", species.Slug)
+		}
+	}
+	return catalog, nil
+}
+
+// Names to try when matching free text to the catalog, most specific first.
+// Something that looks like a scientific name with a cultivar or author
+// ("Monstera deliciosa 'Thai Constellation'") is also tried as just genus
+// and species.
+func speciesCandidates(names ...string) []string {
+	var candidates []string
+	seen := map[string]bool{}
+	add := func(name string) {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name != "" && !seen[name] {
+			seen[name] = true
+			candidates = append(candidates, name)
+		}
+	}
+	for _, name := range names {
+		add(name)
+		if words := strings.Fields(name); len(words) > 2 && unicode.IsUpper([]rune(words[0])[0]) && unicode.IsLower([]rune(words[1])[0]) {
+			add(words[0] + " " + words[1])
+		}
+	}
+	return candidates
+}
+
+func (classification *PlantClassification) Unsure() bool {
+	return classification.Confidence < classificationConfidenceThreshold || classification.WaterRepeatEvery < 1
+}
+
+// Ties an AI classification to the catalog. When the AI wasn't sure, the
+// species' own interval replaces the one it guessed. Returns nil if the
+// species isn't in the catalog.
+func resolveClassification(classification *PlantClassification) *CatalogSpecies {
+	species, err := Handler.ResolveSpecies(classification.ScientificName, classification.PlantName, classification.Species)
+	if err != nil {
+		fmt.Println(err)
+		return nil
+	}
+	if species != nil && classification.Unsure() {
+		classification.WaterRepeatEvery, classification.WaterRepeatUnit = species.WaterEveryDays, "day"
+	}
+	return species
+}
+
+func seedSpeciesCatalog() error {
+	catalog, err := loadSpeciesCatalog()
+	if err != nil {
+		return err
+	}
+	seeded, err := Handler.SeedSpeciesCatalog(catalog)
+	if err != nil {
+		return err
+	}
+	fmt.Println("Species catalog seeded:", seeded)
+	return nil
+}
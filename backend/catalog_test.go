@@ -0,0 +1,79 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSpeciesCandidates(t *testing.T) {
+	tests := []struct {
+		name  string
+		names []string
+		want  []string
+	}{
+		{"none", nil, nil},
+		{"blank names skipped", []string{"", "  "}, nil},
+		{"common name", []string{"Golden Pothos"}, []string{"golden pothos"}},
+		{"duplicates dropped", []string{"Monstera deliciosa", "monstera deliciosa "}, []string{"monstera deliciosa"}},
+		{"cultivar trimmed", []string{"Monstera deliciosa 'Thai Constellation'"}, []string{"monstera deliciosa 'thai constellation'", "monstera deliciosa"}},
+		{"author trimmed", []string{"Ficus lyrata Warb."}, []string{"ficus lyrata warb.", "ficus lyrata"}},
+		{"three word common name kept whole", []string{"Swiss Cheese Plant"}, []string{"swiss cheese plant"}},
+		{"order kept", []string{"Epipremnum aureum", "Pothos"}, []string{"epipremnum aureum", "pothos"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := speciesCandidates(tt.names...); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("speciesCandidates(%q) = %q, want %q", tt.names, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClassificationUnsure(t *testing.T) {
+	tests := []struct {
+		name           string
+		classification PlantClassification
+		want           bool
+	}{
+		{"confident", PlantClassification{Confidence: 0.9, WaterRepeatEvery: 7}, false},
+		{"at the threshold", PlantClassification{Confidence: classificationConfidenceThreshold, WaterRepeatEvery: 7}, false},
+		{"below the threshold", PlantClassification{Confidence: 0.59, WaterRepeatEvery: 7}, true},
+		{"no confidence given", PlantClassification{WaterRepeatEvery: 7}, true},
+		{"no interval", PlantClassification{Confidence: 0.9}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.classification.Unsure(); got != tt.want {
+				t.Errorf("Unsure() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadSpeciesCatalog(t *testing.T) {
+	catalog, err := loadSpeciesCatalog()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(catalog) == 0 {
+		t.Fatal("species catalog is empty")
+	}
+
+	slugs := map[string]bool{}
+	for _, species := range catalog {
+		t.Run(species.Slug, func(t *testing.T) {
+			if slugs[species.Slug] {
+				t.Errorf("duplicate slug %q", species.Slug)
+			}
+			slugs[species.Slug] = true
+			if _, ok := careRules[species.CareGroup]; !ok {
+				t.Errorf("care group %q has no care rule", species.CareGroup)
+			}
+			if !validLight(species.Light) {
+				t.Errorf("light %q isn't one we know", species.Light)
+			}
+		})
+	}
+}
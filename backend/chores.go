@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// How a household schedule's assignee changes over time. With no rotation
+// the assignee stays whoever was picked.
+const (
+	RotationRoundRobin  = "round_robin"
+	RotationWeekly      = "weekly"
+	RotationLeastRecent = "least_recent"
+)
+
+var rotationStrategies = []string{RotationRoundRobin, RotationWeekly, RotationLeastRecent}
+
+// Once a task assigned to someone is this many days overdue, every other
+// editor and owner in the household gets the reminder too.
+const assigneeEscalationDays = 1
+
+// Someone who can be given tasks (editors and owners), with when they last
+// did anything for the household's plants.
+type choreMember struct {
+	UserID   string
+	LastDone *time.Time
+}
+
+type Assignment struct {
+	AssigneeUserID *string `json:"assignee_user_id"`
+	Rotation       string  `json:"rotation"`
+}
+
+func validRotation(rotation string) bool {
+	if rotation == "" {
+		return true
+	}
+	for _, strategy := range rotationStrategies {
+		if rotation == strategy {
+			return true
+		}
+	}
+	return false
+}
+
+// Weeks since the Monday of the Unix epoch, so weekly rotation turns over
+// on Mondays.
+func weekNumber(day time.Time) int {
+	epochMonday := time.Date(1970, 1, 5, 0, 0, 0, 0, time.UTC)
+	day = time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, time.UTC)
+	return int(day.Sub(epochMonday).Hours() / 24 / 7)
+}
+
+// Who should have the task next. members are in join order, current is the
+// assignee now (empty if none or they left). Round-robin moves on to the next
+// member, weekly follows the calendar, and least-recent picks whoever has
+// gone longest without doing anything (never beats ever).
+func nextAssignee(strategy string, members []choreMember, current string, today time.Time) (string, error) {
+	if len(members) == 0 {
+		return "", fmt.Errorf("household has no editors or owners to assign to")
+	}
+
+	switch strategy {
+	case RotationRoundRobin:
+		for i, member := range members {
+			if member.UserID == current {
+				return members[(i+1)%len(members)].UserID, nil
+			}
+		}
+		return members[0].UserID, nil
+	case RotationWeekly:
+		return members[weekNumber(today)%len(members)].UserID, nil
+	case RotationLeastRecent:
+		pick := members[0]
+		for _, member := range members[1:] {
+			if pick.LastDone == nil {
+				break
+			}
+			if member.LastDone == nil || member.LastDone.Before(*pick.LastDone) {
+				pick = member
+			}
+		}
+		return pick.UserID, nil
+	}
+	return "", fmt.Errorf("unknown rotation %q", strategy)
+}
+
+// Weekly rotation turns over with the calendar rather than on completion,
+// and anyone who left the household has their tasks handed on.
+func StartChoreRotation(interval time.Duration) {
+	go func() {
+		for {
+			changed, err := Handler.RefreshAssignments()
+			if err != nil {
+				fmt.Println("ERROR refreshing chore assignments:", err)
+			} else if changed > 0 {
+				fmt.Println("Chore assignments changed:", changed)
+			}
+			time.Sleep(interval)
+		}
+	}()
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestWeekNumber(t *testing.T) {
+	sunday := testDate(2025, time.June, 8)
+	monday := testDate(2025, time.June, 9)
+	nextSunday := testDate(2025, time.June, 15)
+
+	if weekNumber(monday) != weekNumber(sunday)+1 {
+		t.Errorf("week should turn over on Monday: sunday %d, monday %d", weekNumber(sunday), weekNumber(monday))
+	}
+	if weekNumber(nextSunday) != weekNumber(monday) {
+		t.Errorf("monday %d and the following sunday %d should share a week", weekNumber(monday), weekNumber(nextSunday))
+	}
+	if got := weekNumber(time.Date(1970, 1, 5, 23, 0, 0, 0, time.UTC)); got != 0 {
+		t.Errorf("weekNumber(epoch monday) = %d, want 0", got)
+	}
+}
+
+func TestValidRotation(t *testing.T) {
+	tests := []struct {
+		rotation string
+		want     bool
+	}{
+		{"", true},
+		{RotationRoundRobin, true},
+		{RotationWeekly, true},
+		{RotationLeastRecent, true},
+		{"random", false},
+	}
+
+	for _, tt := range tests {
+		if got := validRotation(tt.rotation); got != tt.want {
+			t.Errorf("validRotation(%q) = %v, want %v", tt.rotation, got, tt.want)
+		}
+	}
+}
+
+func TestNextAssignee(t *testing.T) {
+	monday := testDate(2025, time.June, 9)
+	early := testDate(2025, time.June, 1)
+	late := testDate(2025, time.June, 7)
+
+	members := []choreMember{{UserID: "a", LastDone: &late}, {UserID: "b", LastDone: &early}, {UserID: "c", LastDone: &late}}
+	weekly := members[weekNumber(monday)%len(members)].UserID
+
+	tests := []struct {
+		name     string
+		strategy string
+		members  []choreMember
+		current  string
+		today    time.Time
+		want     string
+		wantErr  bool
+	}{
+		{"round robin moves on", RotationRoundRobin, members, "a", monday, "b", false},
+		{"round robin wraps", RotationRoundRobin, members, "c", monday, "a", false},
+		{"round robin after the assignee left", RotationRoundRobin, members, "gone", monday, "a", false},
+		{"weekly follows the calendar", RotationWeekly, members, "a", monday, weekly, false},
+		{"weekly ignores the current assignee", RotationWeekly, members, "c", monday.AddDate(0, 0, 3), weekly, false},
+		{"least recent", RotationLeastRecent, members, "", monday, "b", false},
+		{
+			"never beats ever",
+			RotationLeastRecent,
+			[]choreMember{{UserID: "a", LastDone: &early}, {UserID: "b"}, {UserID: "c"}},
+			"", monday, "b", false,
+		},
+		{"first member when nobody has done anything", RotationLeastRecent, []choreMember{{UserID: "a"}, {UserID: "b"}}, "", monday, "a", false},
+		{"no members", RotationRoundRobin, nil, "", monday, "", true},
+		{"unknown strategy", "random", members, "", monday, "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := nextAssignee(tt.strategy, tt.members, tt.current, tt.today)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("nextAssignee() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("nextAssignee() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -2,10 +2,32 @@ package main
 
 import (
 	"database/sql"
+	"encoding/json"
 	"fmt"
+	"slices"
+	"strings"
 	"time"
+
+	"github.com/lib/pq"
 )
 
+// Plants a user can own at once, however they arrive.
+const maxPlantsPerUser = 5
+
+// Takes a lock on the user's plant count until the transaction ends, then
+// counts their plants. Everything that adds plants goes through this so two
+// of them can't both see room for one more.
+func countPlantsLocked(tx sqlQueryer, user_id string) (int, error) {
+	if _, err := tx.Exec("SELECT pg_advisory_xact_lock(hashtext('plant_limit:' || $1))", user_id); err != nil {
+		return 0, fmt.Errorf("failed to lock plant count: %v", err)
+	}
+	var count int
+	if err := tx.QueryRow("SELECT COUNT(*) FROM plants WHERE user_id::text = $1", user_id).Scan(&count); err != nil {
+		return 0, fmt.Errorf("failed to count plants: %v", err)
+	}
+	return count, nil
+}
+
 func (handler *DatabaseHandler) AddPlant(
 	user_id string,
 	plant_name string,
@@ -14,46 +36,84 @@ func (handler *DatabaseHandler) AddPlant(
 	image_url string,
 	plant_pet_name string,
 	plant_health int,
+	household_id *int,
+	species_id *int,
 ) (int, error) {
 	insertQuery := `
 		WITH plant_count AS (
 			SELECT COUNT(*) AS count FROM plants WHERE user_id = $1
 		),
 		insert_if_under_limit AS (
-			INSERT INTO plants (user_id, plant_name, scientific_name, species, image_url, plant_pet_name, plant_health)
-			SELECT $1, $2, $3, $4, $5, $6, $7
+			INSERT INTO plants (user_id, plant_name, scientific_name, species, image_url, plant_pet_name, plant_health, household_id, species_id)
+			SELECT $1, $2, $3, $4, $5, $6, $7, $8, $9
 			FROM plant_count
-			WHERE plant_count.count < 5
+			WHERE plant_count.count < $10
 			RETURNING plant_id  -- Assumes 'id' is your PK column
 		)
 		SELECT plant_id FROM insert_if_under_limit;
 	`
 
+	tx, err := handler.Db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := countPlantsLocked(tx, user_id); err != nil {
+		return 0, err
+	}
+
 	var plantID int // Change type to int if your 'id' is integer
-	err := handler.Db.QueryRow(insertQuery, user_id, plant_name, scientific_name, species, image_url, plant_pet_name, plant_health).Scan(&plantID)
+	err = tx.QueryRow(insertQuery, user_id, plant_name, scientific_name, species, image_url, plant_pet_name, plant_health, household_id, species_id, maxPlantsPerUser).Scan(&plantID)
 	if err != nil {
 		fmt.Println("ERROR inserting plant:", err)
 		return 0, err
 	}
 
+	err = enqueueWebhookEvent(tx, user_id, WebhookPlantCreated, Plant{
+		PlantID:        plantID,
+		PlantName:      plant_name,
+		ScientificName: scientific_name,
+		Species:        species,
+		ImageURL:       image_url,
+		PlantPetName:   plant_pet_name,
+		PlantHealth:    plant_health,
+		HouseholdID:    household_id,
+		SpeciesID:      species_id,
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit transaction: %v", err)
+	}
+	notifyPlantChanged(user_id)
+
 	return plantID, nil
 }
 
 type Plant struct {
-	PlantID        int    `json:"plant_id"`
-	PlantName      string `json:"plant_name"`
-	ScientificName string `json:"scientific_name"`
-	Species        string `json:"species"`
-	ImageURL       string `json:"image_url"`
-	PlantPetName   string `json:"plant_pet_name"`
-	PlantHealth    int    `json:"plant_health"`
+	PlantID        int      `json:"plant_id"`
+	PlantName      string   `json:"plant_name"`
+	ScientificName string   `json:"scientific_name"`
+	Species        string   `json:"species"`
+	ImageURL       string   `json:"image_url"`
+	PlantPetName   string   `json:"plant_pet_name"`
+	PlantHealth    int      `json:"plant_health"`
+	IsOutdoor      bool     `json:"is_outdoor"`
+	Latitude       *float64 `json:"latitude"`
+	Longitude      *float64 `json:"longitude"`
+	HouseholdID    *int     `json:"household_id"`
+	SpeciesID      *int     `json:"species_id"`
 }
 
 func (handler *DatabaseHandler) FetchPlants(user_id string) ([]Plant, error) {
 	query :=
-		`SELECT plant_id, plant_name, scientific_name, species, image_url, plant_pet_name, plant_health
-	FROM plants
-	WHERE user_id = $1`
+		`SELECT p.plant_id, p.plant_name, p.scientific_name, p.species, p.image_url, p.plant_pet_name, p.plant_health,
+		COALESCE(p.is_outdoor, false), p.latitude, p.longitude, p.household_id, p.species_id
+	FROM plants p
+	WHERE ` + accessiblePlantsCondition
 
 	rows, err := handler.Db.Query(query, user_id)
 	if err != nil {
@@ -65,7 +125,8 @@ func (handler *DatabaseHandler) FetchPlants(user_id string) ([]Plant, error) {
 	var plants []Plant
 	for rows.Next() {
 		var plant Plant
-		err := rows.Scan(&plant.PlantID, &plant.PlantName, &plant.ScientificName, &plant.Species, &plant.ImageURL, &plant.PlantPetName, &plant.PlantHealth)
+		err := rows.Scan(&plant.PlantID, &plant.PlantName, &plant.ScientificName, &plant.Species, &plant.ImageURL, &plant.PlantPetName, &plant.PlantHealth,
+			&plant.IsOutdoor, &plant.Latitude, &plant.Longitude, &plant.HouseholdID, &plant.SpeciesID)
 		if err != nil {
 			fmt.Println("2", err)
 			return nil, fmt.Errorf("failed to scan plant: %w", err)
@@ -77,27 +138,59 @@ func (handler *DatabaseHandler) FetchPlants(user_id string) ([]Plant, error) {
 }
 
 type ScheduleDisplay struct {
-	ScheduleID       int       `json:"schedule_id"`
-	PlantID          int       `json:"plant_id"`
-	PlantPetName     string    `json:"plant_pet_name"`
-	WateringDate     time.Time `json:"watering_date"`
-	NextWateringDate time.Time `json:"next_watering_date"`
-	WaterIsCompleted bool      `json:"water_is_completed"`
+	ScheduleID       int        `json:"schedule_id"`
+	PlantID          int        `json:"plant_id"`
+	PlantPetName     string     `json:"plant_pet_name"`
+	WateringDate     time.Time  `json:"watering_date"`
+	NextWateringDate time.Time  `json:"next_watering_date"`
+	WaterIsCompleted bool       `json:"water_is_completed"`
+	SeasonMultiplier float64    `json:"season_multiplier"`
+	PostponedReason  string     `json:"postponed_reason,omitempty"`
+	SnoozedUntil     *time.Time `json:"snoozed_until,omitempty"`
+	TaskTypes        []string   `json:"task_types"`
+	Overridden       bool       `json:"interval_overridden"`
+	WaterAmountML    *int       `json:"water_amount_ml"`
+	AssigneeUserID   *string    `json:"assignee_user_id"`
+	Rotation         string     `json:"rotation"`
 }
 
+// A schedule (aliased as s) is due once its next date arrives, unless it was
+// already watered that day or is snoozed. day is a SQL date expression.
+func dueScheduleConditionOn(day string) string {
+	return `
+	DATE(s.next_watering_date) <= ` + day + `
+	AND NOT (s.water_is_completed AND DATE(s.watering_date) = ` + day + `)
+	AND (s.snoozed_until IS NULL OR s.snoozed_until <= NOW())
+`
+}
+
+var dueScheduleCondition = dueScheduleConditionOn("CURRENT_DATE")
+
 func (handler *DatabaseHandler) FetchSchedule(user_id string) ([]ScheduleDisplay, error) {
+	return handler.fetchSchedule(user_id, "CURRENT_DATE")
+}
+
+// FetchSchedule for a given local day rather than the server's.
+func (handler *DatabaseHandler) FetchScheduleOn(user_id string, local_date time.Time) ([]ScheduleDisplay, error) {
+	return handler.fetchSchedule(user_id, "$2::date", local_date.Format("2006-01-02"))
+}
+
+func (handler *DatabaseHandler) fetchSchedule(user_id string, today string, args ...any) ([]ScheduleDisplay, error) {
 	query :=
-		`SELECT schedule_id, plant_id, plant_pet_name, water_is_completed, watering_date, next_watering_date
+		`SELECT schedule_id, plant_id, plant_pet_name, water_is_completed, watering_date, next_watering_date,
+		COALESCE(season_multiplier_override, season_multiplier, 1), COALESCE(postponed_reason, ''), snoozed_until,
+		COALESCE(task_types, '{water}'), COALESCE(interval_overridden, false), water_amount_ml,
+		assignee_user_id::text, COALESCE(rotation, '')
 	FROM schedule
-	WHERE user_id = $1
+	WHERE plant_id IN (SELECT p.plant_id FROM plants p WHERE ` + accessiblePlantsCondition + `)
 	AND (
-		DATE(watering_date) = CURRENT_DATE
+		DATE(watering_date) = ` + today + `
 		OR
-		DATE(next_watering_date) <= CURRENT_DATE
+		DATE(next_watering_date) <= ` + today + `
 	)
 	`
 
-	rows, err := handler.Db.Query(query, user_id)
+	rows, err := handler.Db.Query(query, append([]any{user_id}, args...)...)
 	if err != nil {
 		fmt.Println("1", err)
 		return nil, fmt.Errorf("failed to fetch schedules: %w", err)
@@ -107,7 +200,8 @@ func (handler *DatabaseHandler) FetchSchedule(user_id string) ([]ScheduleDisplay
 	var schedules []ScheduleDisplay
 	for rows.Next() {
 		var schedule ScheduleDisplay
-		err := rows.Scan(&schedule.ScheduleID, &schedule.PlantID, &schedule.PlantPetName, &schedule.WaterIsCompleted, &schedule.WateringDate, &schedule.NextWateringDate)
+		err := rows.Scan(&schedule.ScheduleID, &schedule.PlantID, &schedule.PlantPetName, &schedule.WaterIsCompleted, &schedule.WateringDate, &schedule.NextWateringDate, &schedule.SeasonMultiplier, &schedule.PostponedReason, &schedule.SnoozedUntil,
+			pq.Array(&schedule.TaskTypes), &schedule.Overridden, &schedule.WaterAmountML, &schedule.AssigneeUserID, &schedule.Rotation)
 		if err != nil {
 			fmt.Println("2", err)
 			return nil, fmt.Errorf("failed to scan schedule: %w", err)
@@ -127,7 +221,7 @@ func (handler *DatabaseHandler) LengthPlants(user_id string) (bool, error) {
 		return false, err
 	}
 
-	return count < 5, nil
+	return count < maxPlantsPerUser, nil
 }
 
 func (handler *DatabaseHandler) UpdatePlantPetName(user_id string, plant_id int, new_pet_name string) (string, error) {
@@ -176,9 +270,15 @@ func (handler *DatabaseHandler) UpdatePlantPetName(user_id string, plant_id int,
 }
 
 func (handler *DatabaseHandler) CompleteWaterSchedule(user_id string, schedule_id int) (string, error) {
+	return handler.completeWaterScheduleBy(user_id, schedule_id, "")
+}
+
+// performed_by is empty when the owner did it, otherwise it names whoever
+// watered on the owner's behalf (e.g. a plant sitter).
+func (handler *DatabaseHandler) completeWaterScheduleBy(user_id string, schedule_id int, performed_by string) (string, error) {
 	query := `
 		WITH previous AS (
-			SELECT water_is_completed, water_repeat_every, water_repeat_unit 
+			SELECT water_is_completed, water_repeat_every, water_repeat_unit, next_watering_date
 			FROM schedule 
 			WHERE user_id = $1 AND schedule_id = $2
 		)
@@ -192,17 +292,56 @@ func (handler *DatabaseHandler) CompleteWaterSchedule(user_id string, schedule_i
 			watering_date = CASE
 				WHEN (SELECT water_is_completed FROM previous) = false THEN CURRENT_DATE
 				ELSE watering_date
+			END,
+			postponed_reason = CASE
+				WHEN (SELECT water_is_completed FROM previous) = false THEN NULL
+				ELSE postponed_reason
+			END,
+			snoozed_until = CASE
+				WHEN (SELECT water_is_completed FROM previous) = false THEN NULL
+				ELSE snoozed_until
 			END
-		WHERE user_id = $1 AND schedule_id = $2;
+		WHERE user_id = $1 AND schedule_id = $2
+		RETURNING plant_id, water_is_completed, (SELECT DATE(next_watering_date) FROM previous);
 
     `
 
-	_, err := handler.Db.Exec(query, user_id, schedule_id)
+	tx, err := handler.Db.Begin()
+	if err != nil {
+		return "Failed to check plant", fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	var plantID int
+	var completed bool
+	var dueDate time.Time
+	err = tx.QueryRow(query, user_id, schedule_id).Scan(&plantID, &completed, &dueDate)
 	if err != nil {
 		fmt.Println("ERROR inserting plant:", err)
+		if err == sql.ErrNoRows {
+			return "Failed to check plant", fmt.Errorf("schedule with ID %d not found for user %s", schedule_id, user_id)
+		}
 		return "Failed to check plant", err
 	}
 
+	if completed {
+		entry := CareHistoryEntry{UserID: user_id, PlantID: plantID, Action: "water", PerformedBy: performed_by, DueDate: &dueDate}
+		if err := insertCareHistory(tx, entry); err != nil {
+			return "Failed to check plant", err
+		}
+		if err := enqueueTaskCompleted(tx, user_id, schedule_id, entry); err != nil {
+			return "Failed to check plant", err
+		}
+		if _, err := assignNext(tx, schedule_id, true); err != nil {
+			return "Failed to check plant", err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return "Failed to check plant", fmt.Errorf("failed to commit transaction: %v", err)
+	}
+	notifyPlantChanged(user_id)
+
 	return "Plant checked successfully", nil
 }
 
@@ -221,6 +360,7 @@ func (handler *DatabaseHandler) CreateNewSchedule(
 	plant_pet_name string,
 	water_repeat_every int,
 	water_repeat_unit string,
+	water_amount_ml *int,
 ) (string, error) {
 
 	// SQL query: use $6 for string version of water_repeat_every to avoid type conflicts
@@ -232,15 +372,18 @@ func (handler *DatabaseHandler) CreateNewSchedule(
             water_is_completed,
             water_repeat_every,
             water_repeat_unit,
+            base_repeat_every,
+            initial_repeat_days,
             watering_date,
-            next_watering_date
+            next_watering_date,
+            water_amount_ml
         )
 
-        VALUES ($1, $2, $3, false, $4, $5, CURRENT_DATE, CURRENT_DATE)
+        VALUES ($1, $2, $3, false, $4, $5, $4, $6, CURRENT_DATE, CURRENT_DATE, $7)
     `
 
 	// Execute query with parameters, passing waterRepeatEveryStr as $6
-	_, err := handler.Db.Exec(query, user_id, plant_id, plant_pet_name, water_repeat_every, water_repeat_unit)
+	_, err := handler.Db.Exec(query, user_id, plant_id, plant_pet_name, water_repeat_every, water_repeat_unit, intervalInDays(water_repeat_every, water_repeat_unit), water_amount_ml)
 	if err != nil {
 		return "", fmt.Errorf("failed to create schedule: %v", err)
 	}
@@ -262,6 +405,23 @@ func (handler *DatabaseHandler) DeletePlant(user_id string, plant_id int) (strin
 		return "", fmt.Errorf("failed to delete from schedule: %v", err)
 	}
 
+	// Health scans, sensors and valves reference the plant. Its care history
+	// is kept, the reference is cleared instead.
+	_, err = tx.Exec("DELETE FROM sensors WHERE user_id = $1 AND plant_id = $2", user_id, plant_id)
+	if err != nil {
+		return "", fmt.Errorf("failed to delete from sensors: %v", err)
+	}
+
+	_, err = tx.Exec("UPDATE valves SET plant_ids = array_remove(plant_ids, $2) WHERE user_id = $1", user_id, plant_id)
+	if err != nil {
+		return "", fmt.Errorf("failed to unlink valves: %v", err)
+	}
+
+	_, err = tx.Exec("DELETE FROM plant_health WHERE plant_id IN (SELECT plant_id FROM plants WHERE user_id = $1 AND plant_id = $2)", user_id, plant_id)
+	if err != nil {
+		return "", fmt.Errorf("failed to delete from plant_health: %v", err)
+	}
+
 	// Delete from plants where user_id and plant_id match
 	result, err := tx.Exec("DELETE FROM plants WHERE user_id = $1 AND plant_id = $2", user_id, plant_id)
 	if err != nil {
@@ -277,10 +437,15 @@ func (handler *DatabaseHandler) DeletePlant(user_id string, plant_id int) (strin
 		return "", fmt.Errorf("no plant found for given user and plant_id")
 	}
 
+	if err := enqueueWebhookEvent(tx, user_id, WebhookPlantDeleted, map[string]any{"plant_id": plant_id}); err != nil {
+		return "", err
+	}
+
 	err = tx.Commit()
 	if err != nil {
 		return "", fmt.Errorf("failed to commit transaction: %v", err)
 	}
+	notifyPlantChanged(user_id)
 
 	return "Plant deleted successfully", nil
 }
@@ -301,3 +466,4369 @@ func (handler *DatabaseHandler) UpdatePlantPhoto(user_id string, plant_id int, n
 
 	return "Plant photo updated successfully", nil
 }
+
+// What the plant was identified as, for checks that take the species as
+// given rather than classifying again.
+func (handler *DatabaseHandler) FetchPlantScientificName(user_id string, plant_id int) (string, error) {
+	var name string
+	err := handler.Db.QueryRow("SELECT COALESCE(scientific_name, '') FROM plants WHERE user_id = $1 AND plant_id = $2", user_id, plant_id).Scan(&name)
+	if err == sql.ErrNoRows {
+		return "", fmt.Errorf("no plant found for given user and plant_id")
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to fetch plant: %v", err)
+	}
+	return name, nil
+}
+
+// nil when the user hasn't shared a location.
+func (handler *DatabaseHandler) FetchUserLatitude(user_id string) (*float64, error) {
+	var latitude float64
+	err := handler.Db.QueryRow(`SELECT latitude FROM user_locations WHERE user_id::text = $1`, user_id).Scan(&latitude)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch location: %v", err)
+	}
+	return &latitude, nil
+}
+
+func (handler *DatabaseHandler) SaveUserLocation(user_id string, latitude float64, longitude float64) (string, error) {
+	query := `
+		INSERT INTO user_locations (user_id, latitude, longitude, updated_at)
+		VALUES ($1, $2, $3, NOW())
+		ON CONFLICT (user_id) DO UPDATE
+		SET latitude = EXCLUDED.latitude, longitude = EXCLUDED.longitude, updated_at = NOW()
+	`
+
+	_, err := handler.Db.Exec(query, user_id, latitude, longitude)
+	if err != nil {
+		return "", fmt.Errorf("failed to save location: %v", err)
+	}
+
+	return "Location saved successfully", nil
+}
+
+func (handler *DatabaseHandler) FetchSeasonalProfiles(user_id string) ([]SeasonalProfile, error) {
+	query := `
+		SELECT profile_id, plant_id, COALESCE(species, ''), COALESCE(label, ''), start_month, end_month, multiplier
+		FROM seasonal_profiles
+		WHERE user_id = $1
+		ORDER BY profile_id
+	`
+
+	rows, err := handler.Db.Query(query, user_id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch seasonal profiles: %w", err)
+	}
+	defer rows.Close()
+
+	var profiles []SeasonalProfile
+	for rows.Next() {
+		var profile SeasonalProfile
+		var plantID sql.NullInt64
+		err := rows.Scan(&profile.ProfileID, &plantID, &profile.Species, &profile.Label, &profile.StartMonth, &profile.EndMonth, &profile.Multiplier)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan seasonal profile: %w", err)
+		}
+		if plantID.Valid {
+			id := int(plantID.Int64)
+			profile.PlantID = &id
+		}
+		profiles = append(profiles, profile)
+	}
+
+	return profiles, nil
+}
+
+func (handler *DatabaseHandler) AddSeasonalProfile(user_id string, profile SeasonalProfile) (int, error) {
+	if profile.PlantID != nil {
+		var exists bool
+		err := handler.Db.QueryRow("SELECT EXISTS (SELECT 1 FROM plants WHERE user_id = $1 AND plant_id = $2)", user_id, *profile.PlantID).Scan(&exists)
+		if err != nil {
+			return 0, fmt.Errorf("failed to look up plant: %v", err)
+		}
+		if !exists {
+			return 0, fmt.Errorf("plant with ID %d not found for user %s", *profile.PlantID, user_id)
+		}
+	}
+
+	query := `
+		INSERT INTO seasonal_profiles (user_id, plant_id, species, label, start_month, end_month, multiplier)
+		VALUES ($1, $2, NULLIF($3, ''), $4, $5, $6, $7)
+		RETURNING profile_id
+	`
+
+	var profileID int
+	err := handler.Db.QueryRow(query, user_id, profile.PlantID, profile.Species, profile.Label, profile.StartMonth, profile.EndMonth, profile.Multiplier).Scan(&profileID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create seasonal profile: %v", err)
+	}
+
+	return profileID, nil
+}
+
+// Who a profile belongs to and the plant it's for, if any, so household
+// members can manage profiles on the plants they share.
+func (handler *DatabaseHandler) FetchSeasonalProfileOwner(profile_id int) (string, *int, error) {
+	var ownerID string
+	var plantID *int
+	err := handler.Db.QueryRow("SELECT user_id::text, plant_id FROM seasonal_profiles WHERE profile_id = $1", profile_id).Scan(&ownerID, &plantID)
+	if err == sql.ErrNoRows {
+		return "", nil, fmt.Errorf("no seasonal profile found for given profile_id")
+	}
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to fetch seasonal profile: %v", err)
+	}
+	return ownerID, plantID, nil
+}
+
+func (handler *DatabaseHandler) DeleteSeasonalProfile(user_id string, profile_id int) (string, error) {
+	result, err := handler.Db.Exec("DELETE FROM seasonal_profiles WHERE user_id = $1 AND profile_id = $2", user_id, profile_id)
+	if err != nil {
+		return "", fmt.Errorf("failed to delete seasonal profile: %v", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return "", fmt.Errorf("unable to check rows affected: %v", err)
+	}
+
+	if rowsAffected == 0 {
+		return "", fmt.Errorf("no seasonal profile found for given user and profile_id")
+	}
+
+	return "Seasonal profile deleted successfully", nil
+}
+
+// A nil multiplier clears the override and goes back to the seasonal profiles.
+func (handler *DatabaseHandler) SetSeasonMultiplierOverride(user_id string, schedule_id int, multiplier *float64) (string, error) {
+	query := `
+		UPDATE schedule
+		SET season_multiplier_override = $3
+		WHERE user_id = $1 AND schedule_id = $2
+	`
+
+	result, err := handler.Db.Exec(query, user_id, schedule_id, multiplier)
+	if err != nil {
+		return "", fmt.Errorf("failed to update season multiplier: %v", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return "", fmt.Errorf("unable to check rows affected: %v", err)
+	}
+
+	if rowsAffected == 0 {
+		return "", fmt.Errorf("no schedule found for given user and schedule_id")
+	}
+
+	return "Season multiplier updated successfully", nil
+}
+
+// Recomputes water_repeat_every from the base interval and the season that
+// applies today. An empty user_id recalculates every user's schedules.
+func (handler *DatabaseHandler) RecalculateSeasonalIntervals(user_id string) (int, error) {
+	query := `
+		SELECT s.schedule_id, s.user_id, s.plant_id, COALESCE(p.species, ''), COALESCE(p.scientific_name, ''),
+			COALESCE(s.base_repeat_every, s.water_repeat_every), s.water_repeat_every,
+			COALESCE(s.season_multiplier, 1), s.season_multiplier_override, l.latitude
+		FROM schedule s
+		JOIN plants p ON p.plant_id = s.plant_id
+		LEFT JOIN user_locations l ON l.user_id = s.user_id
+		WHERE $1 = '' OR s.user_id::text = $1
+	`
+
+	rows, err := handler.Db.Query(query, user_id)
+	if err != nil {
+		return 0, fmt.Errorf("failed to fetch schedules: %w", err)
+	}
+
+	type seasonalRow struct {
+		scheduleID       int
+		userID           string
+		plantID          int
+		species          string
+		scientificName   string
+		baseRepeatEvery  int
+		waterRepeatEvery int
+		multiplier       float64
+		override         sql.NullFloat64
+		latitude         sql.NullFloat64
+	}
+
+	var pending []seasonalRow
+	for rows.Next() {
+		var row seasonalRow
+		err := rows.Scan(&row.scheduleID, &row.userID, &row.plantID, &row.species, &row.scientificName,
+			&row.baseRepeatEvery, &row.waterRepeatEvery, &row.multiplier, &row.override, &row.latitude)
+		if err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("failed to scan schedule: %w", err)
+		}
+		pending = append(pending, row)
+	}
+	rows.Close()
+
+	profilesByUser := map[string][]SeasonalProfile{}
+	today := time.Now()
+	updated := 0
+
+	for _, row := range pending {
+		profiles, ok := profilesByUser[row.userID]
+		if !ok {
+			profiles, err = handler.FetchSeasonalProfiles(row.userID)
+			if err != nil {
+				return updated, err
+			}
+			profilesByUser[row.userID] = profiles
+		}
+
+		var latitude *float64
+		if row.latitude.Valid {
+			latitude = &row.latitude.Float64
+		}
+
+		multiplier := seasonalMultiplier(profiles, row.plantID, row.species, row.scientificName, today, isSouthernHemisphere(latitude))
+		effective := multiplier
+		if row.override.Valid {
+			effective = row.override.Float64
+		}
+		repeatEvery := adjustedRepeatEvery(row.baseRepeatEvery, effective)
+
+		if multiplier == row.multiplier && repeatEvery == row.waterRepeatEvery {
+			continue
+		}
+
+		updateQuery := `
+			UPDATE schedule
+			SET base_repeat_every = $2,
+				season_multiplier = $3,
+				water_repeat_every = $4,
+				next_watering_date = CASE
+					WHEN water_is_completed THEN watering_date + ($4::int || ' ' || water_repeat_unit)::interval
+					ELSE next_watering_date
+				END
+			WHERE schedule_id = $1
+		`
+		_, err = handler.Db.Exec(updateQuery, row.scheduleID, row.baseRepeatEvery, multiplier, repeatEvery)
+		if err != nil {
+			return updated, fmt.Errorf("failed to update schedule %d: %v", row.scheduleID, err)
+		}
+		updated++
+	}
+
+	return updated, nil
+}
+
+type sqlExecer interface {
+	Exec(query string, args ...any) (sql.Result, error)
+}
+
+// Like sqlExecer, for helpers that also read inside the caller's transaction.
+type sqlQueryer interface {
+	sqlExecer
+	Query(query string, args ...any) (*sql.Rows, error)
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+// Works with both the handler's db and an open transaction.
+func recordCareHistory(db sqlExecer, user_id string, plant_id int, action string, notes string) error {
+	return recordCareHistoryBy(db, user_id, plant_id, action, notes, "")
+}
+
+// Like recordCareHistory, for actions done by someone other than the owner.
+func recordCareHistoryBy(db sqlExecer, user_id string, plant_id int, action string, notes string, performed_by string) error {
+	return insertCareHistory(db, CareHistoryEntry{UserID: user_id, PlantID: plant_id, Action: action, Notes: notes, PerformedBy: performed_by})
+}
+
+type CareHistoryEntry struct {
+	UserID      string
+	PlantID     int
+	Action      string
+	Notes       string
+	PerformedBy string
+	// For waterings, the day the watering was due
+	DueDate *time.Time
+	// When it happened, if not now (e.g. imported from another app)
+	ActionDate *time.Time
+	// Whatever else another app's export said about it
+	Metadata map[string]any
+}
+
+func insertCareHistory(db sqlExecer, entry CareHistoryEntry) error {
+	query := `
+		INSERT INTO plant_care_history (plant_id, user_id, action, notes, performed_by, due_date, action_date, metadata)
+		VALUES ($1, $2, $3, $4, NULLIF($5, ''), $6, COALESCE($7, NOW()), $8::jsonb)
+	`
+
+	var metadata []byte
+	if len(entry.Metadata) > 0 {
+		var err error
+		if metadata, err = json.Marshal(entry.Metadata); err != nil {
+			return fmt.Errorf("failed to marshal care history metadata: %v", err)
+		}
+	}
+
+	_, err := db.Exec(query, entry.PlantID, entry.UserID, entry.Action, entry.Notes, entry.PerformedBy, entry.DueDate, entry.ActionDate, metadata)
+	if err != nil {
+		return fmt.Errorf("failed to record care history: %v", err)
+	}
+	return nil
+}
+
+func (handler *DatabaseHandler) UpdatePlantEnvironment(user_id string, plant_id int, is_outdoor bool, latitude *float64, longitude *float64) (string, error) {
+	query := `
+		UPDATE plants
+		SET is_outdoor = $3, latitude = $4, longitude = $5
+		WHERE user_id = $1 AND plant_id = $2
+	`
+
+	result, err := handler.Db.Exec(query, user_id, plant_id, is_outdoor, latitude, longitude)
+	if err != nil {
+		return "", fmt.Errorf("failed to update plant environment: %v", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return "", fmt.Errorf("unable to check rows affected: %v", err)
+	}
+
+	if rowsAffected == 0 {
+		return "", fmt.Errorf("no plant found for given user and plant_id")
+	}
+
+	return "Plant environment updated successfully", nil
+}
+
+// Pushes due watering for outdoor plants back a day when enough rain has
+// fallen or is on the way. Plants without their own coordinates use the
+// owner's stored location. Days are the owner's own, and a rain event only
+// postpones a schedule once.
+func (handler *DatabaseHandler) ApplyWeatherSkips(provider WeatherProvider, threshold_mm float64) (int, error) {
+	query := `
+		SELECT s.schedule_id, s.user_id, s.plant_id,
+			COALESCE(p.latitude, l.latitude), COALESCE(p.longitude, l.longitude),
+			t.local_now::date, COALESCE(to_char(s.rain_event_date, 'YYYY-MM-DD'), '')
+		FROM schedule s
+		JOIN plants p ON p.plant_id = s.plant_id
+		LEFT JOIN user_locations l ON l.user_id = s.user_id
+		LEFT JOIN user_settings us ON us.user_id = s.user_id
+		CROSS JOIN LATERAL (SELECT NOW() AT TIME ZONE COALESCE(us.timezone, 'UTC') AS local_now) t
+		WHERE p.is_outdoor
+		AND COALESCE(p.latitude, l.latitude) IS NOT NULL
+		AND COALESCE(p.longitude, l.longitude) IS NOT NULL
+		AND ` + dueScheduleConditionOn("t.local_now::date")
+
+	rows, err := handler.Db.Query(query)
+	if err != nil {
+		return 0, fmt.Errorf("failed to fetch outdoor schedules: %w", err)
+	}
+
+	type outdoorSchedule struct {
+		scheduleID    int
+		userID        string
+		plantID       int
+		latitude      float64
+		longitude     float64
+		localToday    time.Time
+		rainEventDate string
+	}
+
+	var due []outdoorSchedule
+	for rows.Next() {
+		var schedule outdoorSchedule
+		err := rows.Scan(&schedule.scheduleID, &schedule.userID, &schedule.plantID, &schedule.latitude, &schedule.longitude,
+			&schedule.localToday, &schedule.rainEventDate)
+		if err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("failed to scan schedule: %w", err)
+		}
+		due = append(due, schedule)
+	}
+	rows.Close()
+
+	reports := map[string]RainfallReport{}
+	postponed := 0
+
+	for _, schedule := range due {
+		key := coordinateKey(schedule.latitude, schedule.longitude)
+		report, ok := reports[key]
+		if !ok {
+			report, err = provider.Rainfall(schedule.latitude, schedule.longitude)
+			if err != nil {
+				fmt.Println("ERROR fetching rainfall for", key, err)
+				continue
+			}
+			reports[key] = report
+		}
+
+		if report.RecentMM+report.ForecastMM < threshold_mm {
+			continue
+		}
+		// Already postponed for this rain
+		if report.LastRainDate != "" && report.LastRainDate == schedule.rainEventDate {
+			continue
+		}
+
+		err := handler.postponeSchedule(schedule.userID, schedule.plantID, schedule.scheduleID, rainSkipReason(report),
+			schedule.localToday.AddDate(0, 0, 1), report.LastRainDate)
+		if err != nil {
+			return postponed, err
+		}
+		postponed++
+	}
+
+	return postponed, nil
+}
+
+func (handler *DatabaseHandler) postponeSchedule(user_id string, plant_id int, schedule_id int, reason string, until time.Time, rain_event_date string) error {
+	tx, err := handler.Db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	query := `
+		UPDATE schedule
+		SET next_watering_date = $3, postponed_reason = $2, rain_event_date = NULLIF($4, '')::date
+		WHERE schedule_id = $1
+	`
+	if _, err := tx.Exec(query, schedule_id, reason, until.Format("2006-01-02"), rain_event_date); err != nil {
+		return fmt.Errorf("failed to postpone schedule %d: %v", schedule_id, err)
+	}
+
+	if err := recordCareHistory(tx, user_id, plant_id, "weather_skip", reason); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %v", err)
+	}
+	return nil
+}
+
+// Runs a single-row schedule update for the user and logs it to the care
+// history in the same transaction. The query gets user_id and schedule_id as
+// $1 and $2 and must return the plant_id.
+func (handler *DatabaseHandler) updateScheduleWithHistory(user_id string, schedule_id int, query string, args []any, action string, notes string) error {
+	tx, err := handler.Db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	var plantID int
+	err = tx.QueryRow(query, append([]any{user_id, schedule_id}, args...)...).Scan(&plantID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return fmt.Errorf("schedule with ID %d not found for user %s", schedule_id, user_id)
+		}
+		return fmt.Errorf("error updating schedule table: %v", err)
+	}
+
+	if err := recordCareHistory(tx, user_id, plantID, action, notes); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %v", err)
+	}
+	return nil
+}
+
+// Hides the task from reminders for a while. If the snooze runs past today
+// the task moves to the day the snooze ends.
+func (handler *DatabaseHandler) SnoozeSchedule(user_id string, schedule_id int, duration time.Duration) (time.Time, error) {
+	until := time.Now().Add(duration)
+	query := `
+		UPDATE schedule
+		SET snoozed_until = $3,
+			next_watering_date = GREATEST(next_watering_date, DATE($3::timestamptz)),
+			postponed_reason = NULL
+		WHERE user_id = $1 AND schedule_id = $2
+		RETURNING plant_id
+	`
+
+	err := handler.updateScheduleWithHistory(user_id, schedule_id, query, []any{until}, "snooze", "Snoozed for "+duration.String())
+	if err != nil {
+		return time.Time{}, err
+	}
+	return until, nil
+}
+
+// Moves only the upcoming occurrence. The interval is untouched, so the
+// occurrence after that is still counted from when the plant is watered.
+func (handler *DatabaseHandler) RescheduleSchedule(user_id string, schedule_id int, date time.Time) (string, error) {
+	query := `
+		UPDATE schedule
+		SET next_watering_date = $3, snoozed_until = NULL, postponed_reason = NULL
+		WHERE user_id = $1 AND schedule_id = $2
+		RETURNING plant_id
+	`
+
+	day := date.Format("2006-01-02")
+	err := handler.updateScheduleWithHistory(user_id, schedule_id, query, []any{day}, "reschedule", "Moved to "+day)
+	if err != nil {
+		return "", err
+	}
+	return "Schedule moved to " + day, nil
+}
+
+// Drops the upcoming occurrence without marking the plant watered.
+func (handler *DatabaseHandler) SkipScheduleOccurrence(user_id string, schedule_id int) (string, error) {
+	query := `
+		UPDATE schedule
+		SET next_watering_date = GREATEST(next_watering_date, CURRENT_DATE) + (water_repeat_every || ' ' || water_repeat_unit)::interval,
+			snoozed_until = NULL,
+			postponed_reason = NULL
+		WHERE user_id = $1 AND schedule_id = $2
+		RETURNING plant_id
+	`
+
+	err := handler.updateScheduleWithHistory(user_id, schedule_id, query, nil, "skip", "Skipped one occurrence")
+	if err != nil {
+		return "", err
+	}
+	return "Occurrence skipped successfully", nil
+}
+
+func (handler *DatabaseHandler) CreateVacation(user_id string, vacation Vacation, share_token_hash string) (int, error) {
+	query := `
+		INSERT INTO vacations (user_id, start_date, end_date, mode, sitter_name, sitter_email, share_token_hash)
+		VALUES ($1, $2, $3, $4, NULLIF($5, ''), NULLIF(LOWER($6), ''), NULLIF($7, ''))
+		RETURNING vacation_id
+	`
+
+	var vacationID int
+	err := handler.Db.QueryRow(query, user_id, vacation.StartDate, vacation.EndDate, vacation.Mode,
+		vacation.SitterName, vacation.SitterEmail, share_token_hash).Scan(&vacationID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create vacation: %v", err)
+	}
+
+	return vacationID, nil
+}
+
+const vacationColumns = `
+	vacation_id, user_id, start_date, end_date, mode, COALESCE(sitter_name, ''), COALESCE(sitter_email, ''),
+	sitter_user_id, share_token_hash IS NOT NULL, summary
+`
+
+// extra receives any columns selected after vacationColumns.
+func scanVacation(row interface{ Scan(...any) error }, extra ...any) (Vacation, error) {
+	var vacation Vacation
+	var summary []byte
+	dest := []any{&vacation.VacationID, &vacation.UserID, &vacation.StartDate, &vacation.EndDate, &vacation.Mode,
+		&vacation.SitterName, &vacation.SitterEmail, &vacation.SitterUserID, &vacation.HasShareLink, &summary}
+	err := row.Scan(append(dest, extra...)...)
+	if err != nil {
+		return vacation, err
+	}
+
+	if summary != nil {
+		vacation.Summary = &VacationSummary{}
+		if err := json.Unmarshal(summary, vacation.Summary); err != nil {
+			return vacation, fmt.Errorf("failed to parse vacation summary: %v", err)
+		}
+	}
+	return vacation, nil
+}
+
+func (handler *DatabaseHandler) fetchVacations(query string, args ...any) ([]Vacation, error) {
+	rows, err := handler.Db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch vacations: %w", err)
+	}
+	defer rows.Close()
+
+	var vacations []Vacation
+	for rows.Next() {
+		vacation, err := scanVacation(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan vacation: %w", err)
+		}
+		vacations = append(vacations, vacation)
+	}
+
+	return vacations, nil
+}
+
+func (handler *DatabaseHandler) FetchVacations(user_id string) ([]Vacation, error) {
+	return handler.fetchVacations(`SELECT `+vacationColumns+` FROM vacations WHERE user_id = $1 ORDER BY start_date DESC`, user_id)
+}
+
+// Vacations a signed-in user has been invited to sit for that are running today.
+func (handler *DatabaseHandler) FetchSittingVacations(sitter_user_id string, sitter_email string) ([]Vacation, error) {
+	query := `SELECT ` + vacationColumns + ` FROM vacations
+		WHERE mode = 'sitter'
+		AND (sitter_user_id::text = $1 OR (sitter_email IS NOT NULL AND sitter_email = LOWER($2)))
+		AND CURRENT_DATE BETWEEN start_date AND end_date
+		ORDER BY start_date`
+	return handler.fetchVacations(query, sitter_user_id, sitter_email)
+}
+
+// The vacation covering today for the user, or nil when they're home.
+func (handler *DatabaseHandler) ActiveVacation(user_id string) (*Vacation, error) {
+	query := `SELECT ` + vacationColumns + ` FROM vacations
+		WHERE user_id = $1 AND CURRENT_DATE BETWEEN start_date AND end_date
+		ORDER BY start_date DESC
+		LIMIT 1`
+
+	vacation, err := scanVacation(handler.Db.QueryRow(query, user_id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch active vacation: %v", err)
+	}
+	return &vacation, nil
+}
+
+// Looks a vacation up for sitter access, along with its share token hash.
+func (handler *DatabaseHandler) fetchVacationForSitter(vacation_id int) (Vacation, string, error) {
+	var tokenHash sql.NullString
+	query := `SELECT ` + vacationColumns + `, share_token_hash FROM vacations WHERE vacation_id = $1`
+
+	vacation, err := scanVacation(handler.Db.QueryRow(query, vacation_id), &tokenHash)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return Vacation{}, "", fmt.Errorf("vacation with ID %d not found", vacation_id)
+		}
+		return Vacation{}, "", fmt.Errorf("failed to fetch vacation: %v", err)
+	}
+	return vacation, tokenHash.String, nil
+}
+
+// Remembers which account accepted an email invite.
+func (handler *DatabaseHandler) ClaimSitterInvite(vacation_id int, sitter_user_id string) error {
+	_, err := handler.Db.Exec("UPDATE vacations SET sitter_user_id = $2 WHERE vacation_id = $1 AND sitter_user_id IS NULL", vacation_id, sitter_user_id)
+	if err != nil {
+		return fmt.Errorf("failed to claim sitter invite: %v", err)
+	}
+	return nil
+}
+
+func (handler *DatabaseHandler) CancelVacation(user_id string, vacation_id int) (string, error) {
+	result, err := handler.Db.Exec("DELETE FROM vacations WHERE user_id = $1 AND vacation_id = $2", user_id, vacation_id)
+	if err != nil {
+		return "", fmt.Errorf("failed to cancel vacation: %v", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return "", fmt.Errorf("unable to check rows affected: %v", err)
+	}
+
+	if rowsAffected == 0 {
+		return "", fmt.Errorf("no vacation found for given user and vacation_id")
+	}
+
+	return "Vacation cancelled successfully", nil
+}
+
+// Done is everything logged against the owner's plants during the vacation.
+// Missed are schedules that came due before the vacation ended and still
+// haven't been watered.
+func (handler *DatabaseHandler) BuildVacationSummary(vacation Vacation) (VacationSummary, error) {
+	summary := VacationSummary{Done: []VacationCareAction{}, Missed: []VacationMissedTask{}}
+
+	doneQuery := `
+		SELECT h.plant_id, COALESCE(p.plant_pet_name, ''), h.action, h.action_date, COALESCE(h.performed_by, 'owner')
+		FROM plant_care_history h
+		JOIN plants p ON p.plant_id = h.plant_id
+		WHERE h.user_id = $1 AND DATE(h.action_date) BETWEEN $2 AND $3
+		ORDER BY h.action_date
+	`
+	rows, err := handler.Db.Query(doneQuery, vacation.UserID, vacation.StartDate, vacation.EndDate)
+	if err != nil {
+		return summary, fmt.Errorf("failed to fetch care history: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var action VacationCareAction
+		if err := rows.Scan(&action.PlantID, &action.PlantPetName, &action.Action, &action.ActionDate, &action.PerformedBy); err != nil {
+			return summary, fmt.Errorf("failed to scan care history: %w", err)
+		}
+		summary.Done = append(summary.Done, action)
+	}
+
+	missedQuery := `
+		SELECT schedule_id, plant_id, plant_pet_name, next_watering_date
+		FROM schedule
+		WHERE user_id = $1 AND DATE(next_watering_date) BETWEEN $2 AND $3
+		ORDER BY next_watering_date
+	`
+	missedRows, err := handler.Db.Query(missedQuery, vacation.UserID, vacation.StartDate, vacation.EndDate)
+	if err != nil {
+		return summary, fmt.Errorf("failed to fetch schedules: %w", err)
+	}
+	defer missedRows.Close()
+
+	for missedRows.Next() {
+		var task VacationMissedTask
+		if err := missedRows.Scan(&task.ScheduleID, &task.PlantID, &task.PlantPetName, &task.DueDate); err != nil {
+			return summary, fmt.Errorf("failed to scan schedule: %w", err)
+		}
+		summary.Missed = append(summary.Missed, task)
+	}
+
+	return summary, nil
+}
+
+func (handler *DatabaseHandler) SummarizeEndedVacations() (int, error) {
+	vacations, err := handler.fetchVacations(`SELECT ` + vacationColumns + ` FROM vacations WHERE end_date < CURRENT_DATE AND summary IS NULL`)
+	if err != nil {
+		return 0, err
+	}
+
+	summarized := 0
+	for _, vacation := range vacations {
+		summary, err := handler.BuildVacationSummary(vacation)
+		if err != nil {
+			return summarized, err
+		}
+
+		encoded, err := json.Marshal(summary)
+		if err != nil {
+			return summarized, fmt.Errorf("failed to encode vacation summary: %v", err)
+		}
+
+		_, err = handler.Db.Exec("UPDATE vacations SET summary = $2, share_token_hash = NULL WHERE vacation_id = $1", vacation.VacationID, encoded)
+		if err != nil {
+			return summarized, fmt.Errorf("failed to save vacation summary: %v", err)
+		}
+		summarized++
+	}
+
+	return summarized, nil
+}
+
+// Logs a health scan and makes it the plant's current health.
+func (handler *DatabaseHandler) RecordPlantHealth(user_id string, plant_id int, health_score int, image_url string) error {
+	tx, err := handler.Db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	var previous sql.NullInt64
+	err = tx.QueryRow("SELECT plant_health FROM plants WHERE user_id = $1 AND plant_id = $2 FOR UPDATE", user_id, plant_id).Scan(&previous)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("no plant found for given user and plant_id")
+	}
+	if err != nil {
+		return fmt.Errorf("failed to look up plant health: %v", err)
+	}
+
+	if _, err := tx.Exec("UPDATE plants SET plant_health = $3 WHERE user_id = $1 AND plant_id = $2", user_id, plant_id, health_score); err != nil {
+		return fmt.Errorf("failed to update plant health: %v", err)
+	}
+
+	_, err = tx.Exec("INSERT INTO plant_health (plant_id, health_score, image_url) VALUES ($1, $2, $3)", plant_id, health_score, image_url)
+	if err != nil {
+		return fmt.Errorf("failed to record plant health: %v", err)
+	}
+
+	if previous.Valid && int64(health_score) < previous.Int64 {
+		err := enqueueWebhookEvent(tx, user_id, WebhookHealthDropped, map[string]any{
+			"plant_id":        plant_id,
+			"previous_health": previous.Int64,
+			"plant_health":    health_score,
+			"image_url":       image_url,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %v", err)
+	}
+	notifyPlantChanged(user_id)
+	return nil
+}
+
+// Care notes such as "soil still wet" feed the adaptive interval engine.
+func (handler *DatabaseHandler) AddCareNote(user_id string, plant_id int, action string, notes string, performed_by string) (string, error) {
+	var exists bool
+	err := handler.Db.QueryRow("SELECT EXISTS (SELECT 1 FROM plants WHERE user_id = $1 AND plant_id = $2)", user_id, plant_id).Scan(&exists)
+	if err != nil {
+		return "", fmt.Errorf("failed to look up plant: %v", err)
+	}
+	if !exists {
+		return "", fmt.Errorf("plant with ID %d not found for user %s", plant_id, user_id)
+	}
+
+	if err := recordCareHistoryBy(handler.Db, user_id, plant_id, action, notes, performed_by); err != nil {
+		return "", err
+	}
+	return "Care note saved successfully", nil
+}
+
+func (handler *DatabaseHandler) SetAdaptiveMode(user_id string, schedule_id int, mode string) (string, error) {
+	result, err := handler.Db.Exec("UPDATE schedule SET adaptive_mode = $3 WHERE user_id = $1 AND schedule_id = $2", user_id, schedule_id, mode)
+	if err != nil {
+		return "", fmt.Errorf("failed to update adaptive mode: %v", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return "", fmt.Errorf("unable to check rows affected: %v", err)
+	}
+	if rowsAffected == 0 {
+		return "", fmt.Errorf("no schedule found for given user and schedule_id")
+	}
+
+	return "Adaptive mode updated successfully", nil
+}
+
+func (handler *DatabaseHandler) FetchIntervalAdjustments(user_id string, schedule_id int) ([]IntervalAdjustment, error) {
+	query := `
+		SELECT adjustment_id, schedule_id, plant_id, old_every, old_unit, new_every, new_unit, reasons, status, created_at
+		FROM interval_adjustments
+		WHERE user_id = $1 AND schedule_id = $2
+		ORDER BY created_at DESC
+	`
+
+	rows, err := handler.Db.Query(query, user_id, schedule_id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch interval adjustments: %w", err)
+	}
+	defer rows.Close()
+
+	var adjustments []IntervalAdjustment
+	for rows.Next() {
+		var adjustment IntervalAdjustment
+		var reasons []byte
+		err := rows.Scan(&adjustment.AdjustmentID, &adjustment.ScheduleID, &adjustment.PlantID, &adjustment.OldEvery, &adjustment.OldUnit,
+			&adjustment.NewEvery, &adjustment.NewUnit, &reasons, &adjustment.Status, &adjustment.CreatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan interval adjustment: %w", err)
+		}
+		if err := json.Unmarshal(reasons, &adjustment.Reasons); err != nil {
+			return nil, fmt.Errorf("failed to parse adjustment reasons: %v", err)
+		}
+		adjustments = append(adjustments, adjustment)
+	}
+
+	return adjustments, nil
+}
+
+func (handler *DatabaseHandler) fetchIntervalSignals(plant_id int, since time.Time) (IntervalSignals, error) {
+	var signals IntervalSignals
+
+	historyQuery := `
+		SELECT
+			COUNT(*) FILTER (WHERE action = 'water'),
+			COALESCE(AVG(DATE(action_date) - due_date) FILTER (WHERE action = 'water' AND due_date IS NOT NULL), 0),
+			COUNT(*) FILTER (WHERE action IN ('snooze', 'skip', 'reschedule')),
+			COUNT(*) FILTER (WHERE action = 'soil_wet'),
+			COUNT(*) FILTER (WHERE action = 'soil_dry')
+		FROM plant_care_history
+		WHERE plant_id = $1 AND action_date >= $2
+	`
+	err := handler.Db.QueryRow(historyQuery, plant_id, since).Scan(&signals.Completions, &signals.AvgDaysLate,
+		&signals.Postponements, &signals.SoilWetNotes, &signals.SoilDryNotes)
+	if err != nil {
+		return signals, fmt.Errorf("failed to fetch care history signals: %v", err)
+	}
+
+	healthQuery := `
+		SELECT COUNT(*),
+			COALESCE((ARRAY_AGG(health_score ORDER BY scan_date DESC))[1] - (ARRAY_AGG(health_score ORDER BY scan_date ASC))[1], 0)
+		FROM plant_health
+		WHERE plant_id = $1 AND scan_date >= $2
+	`
+	err = handler.Db.QueryRow(healthQuery, plant_id, since).Scan(&signals.HealthScans, &signals.HealthChange)
+	if err != nil {
+		return signals, fmt.Errorf("failed to fetch health signals: %v", err)
+	}
+
+	return signals, nil
+}
+
+// Sets the schedule's base interval and re-applies the season multiplier so
+// water_repeat_every and the next date stay consistent.
+func applyInterval(db sqlExecer, schedule_id int, every int, unit string, multiplier float64) error {
+	query := `
+		UPDATE schedule
+		SET base_repeat_every = $2,
+			water_repeat_unit = $4,
+			water_repeat_every = $3,
+			next_watering_date = CASE
+				WHEN water_is_completed THEN watering_date + ($3::int || ' ' || $4)::interval
+				ELSE next_watering_date
+			END
+		WHERE schedule_id = $1
+	`
+
+	_, err := db.Exec(query, schedule_id, every, adjustedRepeatEvery(every, multiplier), unit)
+	if err != nil {
+		return fmt.Errorf("failed to apply interval to schedule %d: %v", schedule_id, err)
+	}
+	return nil
+}
+
+// Looks at each schedule with adaptive tuning enabled at most once a week
+// and either logs a suggestion or, in auto mode, applies it.
+func (handler *DatabaseHandler) EvaluateAdaptiveIntervals() (int, error) {
+	query := `
+		SELECT s.schedule_id, s.user_id, s.plant_id,
+			COALESCE(s.base_repeat_every, s.water_repeat_every), s.water_repeat_unit,
+			COALESCE(s.initial_repeat_days, 0), COALESCE(s.adaptive_mode, 'suggest'),
+			COALESCE(s.season_multiplier_override, s.season_multiplier, 1),
+			(SELECT MAX(created_at) FROM interval_adjustments a WHERE a.schedule_id = s.schedule_id),
+			(SELECT MAX(created_at) FROM interval_adjustments a WHERE a.schedule_id = s.schedule_id AND a.status IN ('applied', 'accepted')),
+			EXISTS (SELECT 1 FROM interval_adjustments a WHERE a.schedule_id = s.schedule_id AND a.status = 'suggested'),
+			COALESCE(s.interval_overridden, false)
+		FROM schedule s
+		WHERE COALESCE(s.adaptive_mode, 'suggest') <> 'off'
+	`
+
+	rows, err := handler.Db.Query(query)
+	if err != nil {
+		return 0, fmt.Errorf("failed to fetch schedules: %w", err)
+	}
+
+	type adaptiveRow struct {
+		scheduleID      int
+		userID          string
+		plantID         int
+		baseRepeatEvery int
+		unit            string
+		initialDays     int
+		mode            string
+		multiplier      float64
+		lastAdjustment  sql.NullTime
+		lastChange      sql.NullTime
+		pending         bool
+		overridden      bool
+	}
+
+	var candidates []adaptiveRow
+	for rows.Next() {
+		var row adaptiveRow
+		err := rows.Scan(&row.scheduleID, &row.userID, &row.plantID, &row.baseRepeatEvery, &row.unit, &row.initialDays,
+			&row.mode, &row.multiplier, &row.lastAdjustment, &row.lastChange, &row.pending, &row.overridden)
+		if err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("failed to scan schedule: %w", err)
+		}
+		candidates = append(candidates, row)
+	}
+	rows.Close()
+
+	now := time.Now()
+	created := 0
+
+	for _, row := range candidates {
+		if row.pending || (row.lastAdjustment.Valid && now.Sub(row.lastAdjustment.Time) < 7*24*time.Hour) {
+			continue
+		}
+
+		// Only count what happened under the current interval
+		since := now.AddDate(0, 0, -60)
+		if row.lastChange.Valid && row.lastChange.Time.After(since) {
+			since = row.lastChange.Time
+		}
+
+		signals, err := handler.fetchIntervalSignals(row.plantID, since)
+		if err != nil {
+			return created, err
+		}
+
+		currentDays := intervalInDays(row.baseRepeatEvery, row.unit)
+		initialDays := row.initialDays
+		if initialDays == 0 {
+			initialDays = currentDays
+		}
+
+		suggested, reasons := suggestInterval(currentDays, initialDays, signals)
+		if suggested == currentDays {
+			continue
+		}
+
+		// A manually set interval is never changed without the user accepting it
+		apply := row.mode == AdaptiveModeAuto && !row.overridden
+		if row.mode == AdaptiveModeAuto && row.overridden {
+			reasons = append(reasons, "The interval was set manually, so this needs your approval")
+		}
+
+		if err := handler.createIntervalAdjustment(row.userID, row.scheduleID, row.plantID, row.baseRepeatEvery, row.unit,
+			suggested, reasons, apply, row.multiplier); err != nil {
+			return created, err
+		}
+		created++
+	}
+
+	return created, nil
+}
+
+func (handler *DatabaseHandler) createIntervalAdjustment(user_id string, schedule_id int, plant_id int, old_every int, old_unit string,
+	new_days int, reasons []string, apply bool, multiplier float64) error {
+	encoded, err := json.Marshal(reasons)
+	if err != nil {
+		return fmt.Errorf("failed to encode adjustment reasons: %v", err)
+	}
+
+	tx, err := handler.Db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	status := "suggested"
+	if apply {
+		status = "applied"
+		if err := applyInterval(tx, schedule_id, new_days, "days", multiplier); err != nil {
+			return err
+		}
+	}
+
+	query := `
+		INSERT INTO interval_adjustments (schedule_id, plant_id, user_id, old_every, old_unit, new_every, new_unit, reasons, status)
+		VALUES ($1, $2, $3, $4, $5, $6, 'days', $7, $8)
+	`
+	_, err = tx.Exec(query, schedule_id, plant_id, user_id, old_every, old_unit, new_days, encoded, status)
+	if err != nil {
+		return fmt.Errorf("failed to record interval adjustment: %v", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %v", err)
+	}
+	return nil
+}
+
+// Accepting applies a pending suggestion, dismissing just closes it.
+func (handler *DatabaseHandler) ResolveIntervalAdjustment(user_id string, schedule_id int, adjustment_id int, accept bool) (string, error) {
+	tx, err := handler.Db.Begin()
+	if err != nil {
+		return "", fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	var newDays int
+	var multiplier float64
+	query := `
+		SELECT a.new_every, COALESCE(s.season_multiplier_override, s.season_multiplier, 1)
+		FROM interval_adjustments a
+		JOIN schedule s ON s.schedule_id = a.schedule_id
+		WHERE a.user_id = $1 AND a.schedule_id = $2 AND a.adjustment_id = $3 AND a.status = 'suggested'
+		FOR UPDATE OF a
+	`
+	err = tx.QueryRow(query, user_id, schedule_id, adjustment_id).Scan(&newDays, &multiplier)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return "", fmt.Errorf("no pending adjustment %d for schedule %d", adjustment_id, schedule_id)
+		}
+		return "", fmt.Errorf("failed to fetch interval adjustment: %v", err)
+	}
+
+	status := "dismissed"
+	if accept {
+		status = "accepted"
+		if err := applyInterval(tx, schedule_id, newDays, "days", multiplier); err != nil {
+			return "", err
+		}
+	}
+
+	if _, err := tx.Exec("UPDATE interval_adjustments SET status = $2 WHERE adjustment_id = $1", adjustment_id, status); err != nil {
+		return "", fmt.Errorf("failed to update interval adjustment: %v", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return "", fmt.Errorf("failed to commit transaction: %v", err)
+	}
+
+	return "Interval adjustment " + status, nil
+}
+
+var careTaskTypes = []string{"water", "fertilize", "mist", "rotate", "prune", "repot"}
+
+// Fields left nil are not changed. Changing the interval marks it as
+// overridden so automatic tuning and re-classification leave it alone.
+type ScheduleEdit struct {
+	WaterRepeatEvery *int
+	WaterRepeatUnit  *string
+	AnchorDate       *time.Time
+	TaskTypes        []string
+	WaterAmountML    *int
+}
+
+// The interval after the edit, keeping whichever half it leaves out.
+func (edit ScheduleEdit) interval(every int, unit string) (int, string) {
+	if edit.WaterRepeatEvery != nil {
+		every = *edit.WaterRepeatEvery
+	}
+	if edit.WaterRepeatUnit != nil {
+		unit = *edit.WaterRepeatUnit
+	}
+	return every, unit
+}
+
+// Whether the edit actually moves the stored interval. Sending back the
+// current every and unit doesn't count as an override.
+func (edit ScheduleEdit) changesInterval(every int, unit string) bool {
+	newEvery, newUnit := edit.interval(every, unit)
+	return newEvery != every || newUnit != unit
+}
+
+// The first occurrence on or after today in the series anchor, anchor +
+// interval, anchor + 2*interval, ...
+func nextOccurrence(anchor time.Time, interval_days int, today time.Time) time.Time {
+	anchor = time.Date(anchor.Year(), anchor.Month(), anchor.Day(), 0, 0, 0, 0, time.UTC)
+	today = time.Date(today.Year(), today.Month(), today.Day(), 0, 0, 0, 0, time.UTC)
+	if !anchor.Before(today) {
+		return anchor
+	}
+
+	elapsed := int(today.Sub(anchor).Hours() / 24)
+	steps := (elapsed + interval_days - 1) / interval_days
+	return anchor.AddDate(0, 0, steps*interval_days)
+}
+
+func (handler *DatabaseHandler) EditSchedule(user_id string, schedule_id int, edit ScheduleEdit) (string, error) {
+	tx, err := handler.Db.Begin()
+	if err != nil {
+		return "", fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	var plantID, every int
+	var unit string
+	var multiplier float64
+	query := `
+		SELECT plant_id, COALESCE(base_repeat_every, water_repeat_every), water_repeat_unit,
+			COALESCE(season_multiplier_override, season_multiplier, 1)
+		FROM schedule
+		WHERE user_id = $1 AND schedule_id = $2
+		FOR UPDATE
+	`
+	err = tx.QueryRow(query, user_id, schedule_id).Scan(&plantID, &every, &unit, &multiplier)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return "", fmt.Errorf("schedule with ID %d not found for user %s", schedule_id, user_id)
+		}
+		return "", fmt.Errorf("failed to fetch schedule: %v", err)
+	}
+
+	var changes []string
+	intervalChanged := edit.changesInterval(every, unit)
+
+	if intervalChanged {
+		every, unit = edit.interval(every, unit)
+		if err := applyInterval(tx, schedule_id, every, unit, multiplier); err != nil {
+			return "", err
+		}
+		changes = append(changes, fmt.Sprintf("interval set to every %d %s", every, unit))
+	}
+
+	if edit.AnchorDate != nil {
+		next := nextOccurrence(*edit.AnchorDate, intervalInDays(adjustedRepeatEvery(every, multiplier), unit), time.Now())
+		_, err := tx.Exec("UPDATE schedule SET next_watering_date = $2, snoozed_until = NULL, postponed_reason = NULL WHERE schedule_id = $1",
+			schedule_id, next.Format("2006-01-02"))
+		if err != nil {
+			return "", fmt.Errorf("failed to update anchor date: %v", err)
+		}
+		changes = append(changes, "anchored on "+edit.AnchorDate.Format("2006-01-02"))
+	}
+
+	if edit.TaskTypes != nil {
+		if _, err := tx.Exec("UPDATE schedule SET task_types = $2 WHERE schedule_id = $1", schedule_id, pq.Array(edit.TaskTypes)); err != nil {
+			return "", fmt.Errorf("failed to update task types: %v", err)
+		}
+		changes = append(changes, "task types set to "+strings.Join(edit.TaskTypes, ", "))
+	}
+
+	if edit.WaterAmountML != nil {
+		if _, err := tx.Exec("UPDATE schedule SET water_amount_ml = $2 WHERE schedule_id = $1", schedule_id, *edit.WaterAmountML); err != nil {
+			return "", fmt.Errorf("failed to update water amount: %v", err)
+		}
+		changes = append(changes, fmt.Sprintf("water amount set to %d ml", *edit.WaterAmountML))
+	}
+
+	if len(changes) == 0 {
+		return "", fmt.Errorf("nothing to change")
+	}
+
+	if intervalChanged {
+		if _, err := tx.Exec("UPDATE schedule SET interval_overridden = true, overridden_at = NOW() WHERE schedule_id = $1", schedule_id); err != nil {
+			return "", fmt.Errorf("failed to flag override: %v", err)
+		}
+
+		// Pending suggestions were made against the old interval
+		if _, err := tx.Exec("UPDATE interval_adjustments SET status = 'dismissed' WHERE schedule_id = $1 AND status = 'suggested'", schedule_id); err != nil {
+			return "", fmt.Errorf("failed to dismiss pending adjustments: %v", err)
+		}
+	}
+
+	if err := recordCareHistory(tx, user_id, plantID, "schedule_edit", strings.Join(changes, "; ")); err != nil {
+		return "", err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return "", fmt.Errorf("failed to commit transaction: %v", err)
+	}
+
+	return "Schedule updated successfully", nil
+}
+
+// Lets automatic tuning and re-classification manage the interval again.
+func (handler *DatabaseHandler) ClearScheduleOverride(user_id string, schedule_id int) (string, error) {
+	result, err := handler.Db.Exec("UPDATE schedule SET interval_overridden = false, overridden_at = NULL WHERE user_id = $1 AND schedule_id = $2", user_id, schedule_id)
+	if err != nil {
+		return "", fmt.Errorf("failed to clear override: %v", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return "", fmt.Errorf("unable to check rows affected: %v", err)
+	}
+	if rowsAffected == 0 {
+		return "", fmt.Errorf("no schedule found for given user and schedule_id")
+	}
+
+	return "Schedule override cleared", nil
+}
+
+// Registering also records the device's timezone, which decides when the
+// user's day starts for reminders.
+func (handler *DatabaseHandler) RegisterDevice(user_id string, token string, platform string, timezone string) (string, error) {
+	tx, err := handler.Db.Begin()
+	if err != nil {
+		return "", fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	// A device that changes hands moves to the new user
+	query := `
+		INSERT INTO device_tokens (user_id, token, platform, last_seen_at)
+		VALUES ($1, $2, $3, NOW())
+		ON CONFLICT (token) DO UPDATE
+		SET user_id = EXCLUDED.user_id, platform = EXCLUDED.platform, last_seen_at = NOW()
+	`
+	if _, err := tx.Exec(query, user_id, token, platform); err != nil {
+		return "", fmt.Errorf("failed to register device: %v", err)
+	}
+
+	if timezone != "" {
+		settingsQuery := `
+			INSERT INTO user_settings (user_id, timezone, updated_at)
+			VALUES ($1, $2, NOW())
+			ON CONFLICT (user_id) DO UPDATE SET timezone = EXCLUDED.timezone, updated_at = NOW()
+		`
+		if _, err := tx.Exec(settingsQuery, user_id, timezone); err != nil {
+			return "", fmt.Errorf("failed to save timezone: %v", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return "", fmt.Errorf("failed to commit transaction: %v", err)
+	}
+	return "Device registered successfully", nil
+}
+
+func (handler *DatabaseHandler) UnregisterDevice(user_id string, token string) (string, error) {
+	result, err := handler.Db.Exec("DELETE FROM device_tokens WHERE user_id = $1 AND token = $2", user_id, token)
+	if err != nil {
+		return "", fmt.Errorf("failed to unregister device: %v", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return "", fmt.Errorf("unable to check rows affected: %v", err)
+	}
+	if rowsAffected == 0 {
+		return "", fmt.Errorf("no device found for given user and token")
+	}
+
+	return "Device unregistered successfully", nil
+}
+
+func (handler *DatabaseHandler) FetchRecipient(user_id string) (Recipient, error) {
+	recipient := Recipient{UserID: user_id}
+
+	err := handler.Db.QueryRow("SELECT COALESCE(email, '') FROM user_settings WHERE user_id = $1", user_id).Scan(&recipient.Email)
+	if err != nil && err != sql.ErrNoRows {
+		return recipient, fmt.Errorf("failed to fetch user settings: %v", err)
+	}
+
+	webhookQuery := "SELECT EXISTS (SELECT 1 FROM webhook_endpoints WHERE user_id = $1 AND active AND $2 = ANY(events))"
+	if err := handler.Db.QueryRow(webhookQuery, user_id, WebhookTaskDue).Scan(&recipient.TaskDueWebhooks); err != nil {
+		return recipient, fmt.Errorf("failed to check webhook endpoints: %v", err)
+	}
+
+	rows, err := handler.Db.Query("SELECT token FROM device_tokens WHERE user_id = $1 ORDER BY device_id", user_id)
+	if err != nil {
+		return recipient, fmt.Errorf("failed to fetch device tokens: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var token string
+		if err := rows.Scan(&token); err != nil {
+			return recipient, fmt.Errorf("failed to scan device token: %w", err)
+		}
+		recipient.PushTokens = append(recipient.PushTokens, token)
+	}
+
+	return recipient, nil
+}
+
+// Identifies one occurrence of a schedule (aliased as s). Snoozing gives the
+// occurrence a new key so the reminder goes out again when the snooze ends.
+const reminderOccurrenceKey = `DATE(s.next_watering_date)::text || COALESCE('@' || EXTRACT(EPOCH FROM s.snoozed_until)::bigint::text, '')`
+
+// Due tasks in each owner's own timezone that haven't been claimed on this
+// channel yet. Paused vacations are left out and a sitter with an account
+// receives the owner's reminders. Household tasks go to their assignee, and
+// to the household's other editors and owners once they're overdue.
+// Recipients who turned the channel or the task type off never see them, so
+// they aren't fetched again every run. Quiet hours are up to the dispatcher.
+func (handler *DatabaseHandler) FetchDueReminders(channel string) ([]DueReminder, error) {
+	query := `
+		WITH due AS (
+			SELECT DISTINCT ON (s.schedule_id)
+				s.schedule_id, s.plant_id, s.user_id::text AS owner_id,
+				CASE
+					WHEN v.mode = 'sitter' THEN v.sitter_user_id::text
+					WHEN a.user_id IS NOT NULL THEN a.user_id::text
+					ELSE s.user_id::text
+				END AS recipient_id,
+				COALESCE(s.plant_pet_name, '') AS plant_pet_name, COALESCE(p.image_url, '') AS image_url,
+				DATE(s.next_watering_date) AS due_date, t.local_now::date AS local_date,
+				` + reminderOccurrenceKey + ` AS occurrence_key, COALESCE(NULLIF(s.task_types, '{}'), '{water}') AS task_types,
+				p.household_id, a.user_id IS NOT NULL AND COALESCE(v.mode, '') <> 'sitter' AS assigned
+			FROM schedule s
+			JOIN plants p ON p.plant_id = s.plant_id
+			LEFT JOIN household_members a ON a.household_id = p.household_id AND a.user_id = s.assignee_user_id AND a.role IN ('owner', 'editor')
+			LEFT JOIN user_settings us ON us.user_id = s.user_id
+			CROSS JOIN LATERAL (SELECT NOW() AT TIME ZONE COALESCE(us.timezone, 'UTC') AS local_now) t
+			LEFT JOIN vacations v ON v.user_id = s.user_id AND t.local_now::date BETWEEN v.start_date AND v.end_date
+			WHERE ` + dueScheduleConditionOn("t.local_now::date") + `
+			AND COALESCE(v.mode, '') <> 'pause'
+			AND NOT (COALESCE(v.mode, '') = 'sitter' AND v.sitter_user_id IS NULL)
+			ORDER BY s.schedule_id, v.start_date DESC
+		),
+		recipients AS (
+			SELECT schedule_id, plant_id, owner_id, recipient_id, plant_pet_name, image_url,
+				due_date, local_date, occurrence_key, task_types, false AS escalated
+			FROM due
+			UNION ALL
+			SELECT due.schedule_id, due.plant_id, due.owner_id, m.user_id::text, due.plant_pet_name, due.image_url,
+				due.due_date, due.local_date, due.occurrence_key, due.task_types, true
+			FROM due
+			JOIN household_members m ON m.household_id = due.household_id AND m.role IN ('owner', 'editor')
+			WHERE due.assigned AND m.user_id::text <> due.recipient_id
+			AND due.local_date - due.due_date >= $2
+		)
+		SELECT r.* FROM recipients r
+		LEFT JOIN notification_preferences np ON np.user_id::text = r.recipient_id
+		WHERE (np.user_id IS NULL OR ($1 = ANY(np.channels) AND r.task_types && np.task_types))
+		AND NOT EXISTS (
+			SELECT 1 FROM notification_log n
+			WHERE n.schedule_id = r.schedule_id
+			AND n.recipient_id::text = r.recipient_id
+			AND n.channel = $1
+			AND n.occurrence_key = r.occurrence_key
+			AND NOT (n.status = 'failed' AND n.retry_at <= NOW())
+		)
+		ORDER BY recipient_id, due_date
+	`
+
+	rows, err := handler.Db.Query(query, channel, assigneeEscalationDays)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch due reminders: %w", err)
+	}
+	defer rows.Close()
+
+	var reminders []DueReminder
+	for rows.Next() {
+		var reminder DueReminder
+		err := rows.Scan(&reminder.ScheduleID, &reminder.PlantID, &reminder.OwnerID, &reminder.RecipientID, &reminder.PlantPetName,
+			&reminder.ImageURL, &reminder.DueDate, &reminder.LocalDate, &reminder.OccurrenceKey, pq.Array(&reminder.TaskTypes), &reminder.Escalated)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan due reminder: %w", err)
+		}
+		reminders = append(reminders, reminder)
+	}
+
+	return reminders, nil
+}
+
+// Returns the reminders this batch now owns. Anything already claimed by an
+// earlier (or concurrent) run is dropped, unless that run failed to send and
+// its retry time has come.
+func (handler *DatabaseHandler) ClaimReminders(batch_id string, channel string, reminders []DueReminder) ([]DueReminder, error) {
+	query := `
+		INSERT INTO notification_log (batch_id, schedule_id, recipient_id, channel, occurrence_key, status, attempts)
+		VALUES ($1, $2, $3, $4, $5, 'pending', 1)
+		ON CONFLICT (schedule_id, recipient_id, channel, occurrence_key) DO UPDATE
+		SET batch_id = EXCLUDED.batch_id, status = 'pending', error = NULL, retry_at = NULL,
+			attempts = notification_log.attempts + 1
+		WHERE notification_log.status = 'failed' AND notification_log.retry_at <= NOW()
+	`
+
+	var claimed []DueReminder
+	for _, reminder := range reminders {
+		result, err := handler.Db.Exec(query, batch_id, reminder.ScheduleID, reminder.RecipientID, channel, reminder.OccurrenceKey)
+		if err != nil {
+			return claimed, fmt.Errorf("failed to claim reminder: %v", err)
+		}
+		if n, _ := result.RowsAffected(); n > 0 {
+			claimed = append(claimed, reminder)
+		}
+	}
+
+	return claimed, nil
+}
+
+func (handler *DatabaseHandler) RecordDeliveries(batch_id string, recipient_id string, channel string, results []DeliveryResult, send_err error) error {
+	tx, err := handler.Db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	query := `
+		INSERT INTO notification_deliveries (batch_id, recipient_id, channel, target, ticket_id, status, error)
+		VALUES ($1, $2, $3, $4, NULLIF($5, ''), $6, NULLIF($7, ''))
+	`
+
+	status := "failed"
+	for _, result := range results {
+		if _, err := tx.Exec(query, batch_id, recipient_id, channel, result.Target, result.TicketID, result.Status, result.Error); err != nil {
+			return fmt.Errorf("failed to record delivery: %v", err)
+		}
+		if result.Status == "sent" {
+			status = "sent"
+		}
+		if channel == "push" && strings.HasPrefix(result.Error, "DeviceNotRegistered") {
+			if _, err := tx.Exec("DELETE FROM device_tokens WHERE token = $1", result.Target); err != nil {
+				return fmt.Errorf("failed to remove unregistered device: %v", err)
+			}
+		}
+	}
+
+	errorText := ""
+	if send_err != nil {
+		errorText = send_err.Error()
+	}
+	// The provider never took the batch, so try again later with a growing
+	// gap. A provider rejecting each target is final.
+	logQuery := `
+		UPDATE notification_log
+		SET status = $2, error = NULLIF($3, ''), sent_at = NOW(),
+			retry_at = CASE WHEN $4 AND attempts < $5 THEN NOW() + make_interval(secs => $6 * power(2, attempts - 1)) END
+		WHERE batch_id = $1
+	`
+	_, err = tx.Exec(logQuery, batch_id, status, errorText, send_err != nil, maxReminderAttempts, int(reminderRetryDelay.Seconds()))
+	if err != nil {
+		return fmt.Errorf("failed to update notification log: %v", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %v", err)
+	}
+	return nil
+}
+
+// Tickets old enough for the provider to know whether they arrived, and not
+// so old that it has forgotten them.
+func (handler *DatabaseHandler) FetchUncheckedTickets(channel string, min_age time.Duration, max_age time.Duration) ([]string, error) {
+	query := `
+		SELECT ticket_id FROM notification_deliveries
+		WHERE channel = $1 AND status = 'sent' AND ticket_id IS NOT NULL AND receipt_status IS NULL
+		AND created_at <= NOW() - make_interval(secs => $2)
+		AND created_at > NOW() - make_interval(secs => $3)
+		ORDER BY created_at
+		LIMIT 1000
+	`
+
+	rows, err := handler.Db.Query(query, channel, int(min_age.Seconds()), int(max_age.Seconds()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch tickets: %w", err)
+	}
+	defer rows.Close()
+
+	var ticketIDs []string
+	for rows.Next() {
+		var ticketID string
+		if err := rows.Scan(&ticketID); err != nil {
+			return nil, fmt.Errorf("failed to scan ticket: %w", err)
+		}
+		ticketIDs = append(ticketIDs, ticketID)
+	}
+
+	return ticketIDs, nil
+}
+
+// Tickets the provider never produced a receipt for stop being checked.
+func (handler *DatabaseHandler) ExpireUncheckedTickets(channel string, max_age time.Duration) error {
+	query := `
+		UPDATE notification_deliveries
+		SET receipt_status = 'expired', checked_at = NOW()
+		WHERE channel = $1 AND status = 'sent' AND ticket_id IS NOT NULL AND receipt_status IS NULL
+		AND created_at <= NOW() - make_interval(secs => $2)
+	`
+
+	if _, err := handler.Db.Exec(query, channel, int(max_age.Seconds())); err != nil {
+		return fmt.Errorf("failed to expire tickets: %v", err)
+	}
+	return nil
+}
+
+// Devices the provider reports as gone are removed so we stop sending to them.
+func (handler *DatabaseHandler) RecordReceipts(channel string, receipts map[string]DeliveryResult) error {
+	for ticketID, receipt := range receipts {
+		var target string
+		query := `
+			UPDATE notification_deliveries
+			SET receipt_status = $3, receipt_error = NULLIF($4, ''), checked_at = NOW()
+			WHERE channel = $1 AND ticket_id = $2
+			RETURNING target
+		`
+		err := handler.Db.QueryRow(query, channel, ticketID, receipt.Status, receipt.Error).Scan(&target)
+		if err != nil && err != sql.ErrNoRows {
+			return fmt.Errorf("failed to record receipt: %v", err)
+		}
+
+		if channel == "push" && strings.HasPrefix(receipt.Error, "DeviceNotRegistered") {
+			if _, err := handler.Db.Exec("DELETE FROM device_tokens WHERE token = $1", target); err != nil {
+				return fmt.Errorf("failed to remove unregistered device: %v", err)
+			}
+		}
+	}
+	return nil
+}
+
+func (handler *DatabaseHandler) SetEmailDigest(user_id string, enabled bool, email string) (string, error) {
+	query := `
+		INSERT INTO user_settings (user_id, email, email_digest, updated_at)
+		VALUES ($1, NULLIF($2, ''), $3, NOW())
+		ON CONFLICT (user_id) DO UPDATE
+		SET email = COALESCE(NULLIF($2, ''), user_settings.email), email_digest = $3, updated_at = NOW()
+	`
+
+	if _, err := handler.Db.Exec(query, user_id, email, enabled); err != nil {
+		return "", fmt.Errorf("failed to update email digest: %v", err)
+	}
+
+	if enabled {
+		return "Email digest enabled", nil
+	}
+	return "Email digest disabled", nil
+}
+
+func (handler *DatabaseHandler) FetchEmailDigest(user_id string) (bool, string, error) {
+	var enabled bool
+	var email string
+	err := handler.Db.QueryRow("SELECT COALESCE(email_digest, false), COALESCE(email, '') FROM user_settings WHERE user_id = $1", user_id).Scan(&enabled, &email)
+	if err == sql.ErrNoRows {
+		return false, "", nil
+	}
+	if err != nil {
+		return false, "", fmt.Errorf("failed to fetch email digest: %v", err)
+	}
+	return enabled, email, nil
+}
+
+// Falls back to the defaults for anything the user hasn't saved yet.
+func (handler *DatabaseHandler) FetchNotificationPreferences(user_id string) (NotificationPreferences, error) {
+	prefs := defaultNotificationPreferences()
+
+	query := `
+		SELECT COALESCE(us.timezone, 'UTC'), np.user_id IS NOT NULL, np.channels, np.task_types,
+			to_char(np.quiet_start, 'HH24:MI'), to_char(np.quiet_end, 'HH24:MI'), COALESCE(np.batching, '')
+		FROM (SELECT $1::uuid AS user_id) u
+		LEFT JOIN user_settings us ON us.user_id = u.user_id
+		LEFT JOIN notification_preferences np ON np.user_id = u.user_id
+	`
+
+	var saved bool
+	var channels, taskTypes []string
+	var quietStart, quietEnd sql.NullString
+	var batching string
+	err := handler.Db.QueryRow(query, user_id).Scan(&prefs.Timezone, &saved, pq.Array(&channels), pq.Array(&taskTypes),
+		&quietStart, &quietEnd, &batching)
+	if err != nil {
+		return prefs, fmt.Errorf("failed to fetch notification preferences: %v", err)
+	}
+	if !saved {
+		return prefs, nil
+	}
+
+	prefs.Channels = channels
+	prefs.TaskTypes = taskTypes
+	prefs.QuietStart, prefs.QuietEnd = nil, nil
+	if quietStart.Valid && quietEnd.Valid {
+		prefs.QuietStart = &quietStart.String
+		prefs.QuietEnd = &quietEnd.String
+	}
+	prefs.Batching = batching
+	return prefs, nil
+}
+
+func (handler *DatabaseHandler) SaveNotificationPreferences(user_id string, prefs NotificationPreferences) (string, error) {
+	tx, err := handler.Db.Begin()
+	if err != nil {
+		return "", fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	query := `
+		INSERT INTO notification_preferences (user_id, channels, task_types, quiet_start, quiet_end, batching, updated_at)
+		VALUES ($1, $2, $3, $4::time, $5::time, $6, NOW())
+		ON CONFLICT (user_id) DO UPDATE
+		SET channels = EXCLUDED.channels, task_types = EXCLUDED.task_types, quiet_start = EXCLUDED.quiet_start,
+			quiet_end = EXCLUDED.quiet_end, batching = EXCLUDED.batching, updated_at = NOW()
+	`
+	_, err = tx.Exec(query, user_id, pq.Array(prefs.Channels), pq.Array(prefs.TaskTypes), prefs.QuietStart, prefs.QuietEnd, prefs.Batching)
+	if err != nil {
+		return "", fmt.Errorf("failed to save notification preferences: %v", err)
+	}
+
+	settingsQuery := `
+		INSERT INTO user_settings (user_id, timezone, updated_at)
+		VALUES ($1, $2, NOW())
+		ON CONFLICT (user_id) DO UPDATE SET timezone = EXCLUDED.timezone, updated_at = NOW()
+	`
+	if _, err := tx.Exec(settingsQuery, user_id, prefs.Timezone); err != nil {
+		return "", fmt.Errorf("failed to save timezone: %v", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return "", fmt.Errorf("failed to commit transaction: %v", err)
+	}
+	return "Notification preferences updated successfully", nil
+}
+
+// Opted-in users whose local time has reached digest_hour and who haven't
+// had today's digest yet, along with what day it is for them. Anyone who
+// paused reminders for a vacation is left out.
+func (handler *DatabaseHandler) FetchDigestRecipients(digest_hour int) ([]DigestRecipient, error) {
+	query := `
+		SELECT us.user_id, us.email, t.local_now::date
+		FROM user_settings us
+		CROSS JOIN LATERAL (SELECT NOW() AT TIME ZONE us.timezone AS local_now) t
+		WHERE us.email_digest AND us.email IS NOT NULL
+		AND EXTRACT(HOUR FROM t.local_now) >= $1
+		AND (us.last_digest_date IS NULL OR us.last_digest_date < t.local_now::date)
+		AND NOT EXISTS (
+			SELECT 1 FROM vacations v
+			WHERE v.user_id = us.user_id AND v.mode = 'pause'
+			AND t.local_now::date BETWEEN v.start_date AND v.end_date
+		)
+	`
+
+	rows, err := handler.Db.Query(query, digest_hour)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch digest recipients: %w", err)
+	}
+	defer rows.Close()
+
+	var recipients []DigestRecipient
+	for rows.Next() {
+		var recipient DigestRecipient
+		if err := rows.Scan(&recipient.UserID, &recipient.Email, &recipient.LocalDate); err != nil {
+			return nil, fmt.Errorf("failed to scan digest recipient: %w", err)
+		}
+		recipients = append(recipients, recipient)
+	}
+
+	return recipients, nil
+}
+
+func (handler *DatabaseHandler) MarkDigestSent(user_id string) error {
+	query := `UPDATE user_settings SET last_digest_date = (NOW() AT TIME ZONE timezone)::date WHERE user_id = $1`
+	if _, err := handler.Db.Exec(query, user_id); err != nil {
+		return fmt.Errorf("failed to mark digest sent: %v", err)
+	}
+	return nil
+}
+
+// Unlike the completion toggle this only ever marks the plant watered, so
+// following a link twice can't undo it. Returns false if it was already
+// watered today.
+func (handler *DatabaseHandler) MarkWatered(user_id string, schedule_id int, performed_by string) (bool, error) {
+	query := `
+		WITH previous AS (
+			SELECT next_watering_date FROM schedule WHERE user_id = $1 AND schedule_id = $2
+		)
+		UPDATE schedule
+		SET water_is_completed = true,
+			watering_date = CURRENT_DATE,
+			next_watering_date = CURRENT_DATE + (water_repeat_every || ' ' || water_repeat_unit)::interval,
+			postponed_reason = NULL,
+			snoozed_until = NULL
+		WHERE user_id = $1 AND schedule_id = $2
+		AND NOT (water_is_completed AND DATE(watering_date) = CURRENT_DATE)
+		RETURNING plant_id, (SELECT DATE(next_watering_date) FROM previous)
+	`
+
+	tx, err := handler.Db.Begin()
+	if err != nil {
+		return false, fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	var plantID int
+	var dueDate time.Time
+	err = tx.QueryRow(query, user_id, schedule_id).Scan(&plantID, &dueDate)
+	if err == sql.ErrNoRows {
+		var exists bool
+		if err := handler.Db.QueryRow("SELECT EXISTS (SELECT 1 FROM schedule WHERE user_id = $1 AND schedule_id = $2)", user_id, schedule_id).Scan(&exists); err != nil {
+			return false, fmt.Errorf("failed to look up schedule: %v", err)
+		}
+		if !exists {
+			return false, fmt.Errorf("schedule with ID %d not found for user %s", schedule_id, user_id)
+		}
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("error updating schedule table: %v", err)
+	}
+
+	entry := CareHistoryEntry{UserID: user_id, PlantID: plantID, Action: "water", PerformedBy: performed_by, DueDate: &dueDate}
+	if err := insertCareHistory(tx, entry); err != nil {
+		return false, err
+	}
+	if err := enqueueTaskCompleted(tx, user_id, schedule_id, entry); err != nil {
+		return false, err
+	}
+	if _, err := assignNext(tx, schedule_id, true); err != nil {
+		return false, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return false, fmt.Errorf("failed to commit transaction: %v", err)
+	}
+	notifyPlantChanged(user_id)
+	return true, nil
+}
+
+// Writes an event to the outbox as part of the caller's transaction, so it
+// only goes out if the change it describes commits. Users without a matching
+// endpoint don't get a row at all.
+func enqueueWebhookEvent(db sqlExecer, user_id string, event_type string, data any) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("failed to marshal webhook event: %v", err)
+	}
+
+	query := `
+		INSERT INTO webhook_outbox (user_id, event_type, payload)
+		SELECT $1, $2, $3
+		WHERE EXISTS (SELECT 1 FROM webhook_endpoints WHERE user_id = $1 AND active AND $2 = ANY(events))
+	`
+	if _, err := db.Exec(query, user_id, event_type, string(payload)); err != nil {
+		return fmt.Errorf("failed to enqueue webhook event: %v", err)
+	}
+	return nil
+}
+
+func enqueueTaskCompleted(db sqlExecer, user_id string, schedule_id int, entry CareHistoryEntry) error {
+	return enqueueWebhookEvent(db, user_id, WebhookTaskCompleted, map[string]any{
+		"schedule_id":  schedule_id,
+		"plant_id":     entry.PlantID,
+		"task":         entry.Action,
+		"due_date":     entry.DueDate.Format("2006-01-02"),
+		"performed_by": entry.PerformedBy,
+	})
+}
+
+// The secret is returned here once and never shown again.
+func (handler *DatabaseHandler) CreateWebhookEndpoint(user_id string, url string, events []string, secret string) (WebhookEndpoint, error) {
+	endpoint := WebhookEndpoint{URL: url, Events: events, Active: true}
+
+	query := `
+		INSERT INTO webhook_endpoints (user_id, url, secret, events)
+		VALUES ($1, $2, $3, $4)
+		RETURNING endpoint_id, created_at
+	`
+	err := handler.Db.QueryRow(query, user_id, url, secret, pq.Array(events)).Scan(&endpoint.EndpointID, &endpoint.CreatedAt)
+	if err != nil {
+		return endpoint, fmt.Errorf("failed to create webhook endpoint: %v", err)
+	}
+	return endpoint, nil
+}
+
+func (handler *DatabaseHandler) FetchWebhookEndpoints(user_id string) ([]WebhookEndpoint, error) {
+	query := `
+		SELECT endpoint_id, url, events, active, created_at
+		FROM webhook_endpoints
+		WHERE user_id = $1
+		ORDER BY endpoint_id
+	`
+
+	rows, err := handler.Db.Query(query, user_id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch webhook endpoints: %w", err)
+	}
+	defer rows.Close()
+
+	endpoints := []WebhookEndpoint{}
+	for rows.Next() {
+		var endpoint WebhookEndpoint
+		if err := rows.Scan(&endpoint.EndpointID, &endpoint.URL, pq.Array(&endpoint.Events), &endpoint.Active, &endpoint.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan webhook endpoint: %w", err)
+		}
+		endpoints = append(endpoints, endpoint)
+	}
+
+	return endpoints, nil
+}
+
+func (handler *DatabaseHandler) DeleteWebhookEndpoint(user_id string, endpoint_id int) (string, error) {
+	result, err := handler.Db.Exec("DELETE FROM webhook_endpoints WHERE user_id = $1 AND endpoint_id = $2", user_id, endpoint_id)
+	if err != nil {
+		return "", fmt.Errorf("failed to delete webhook endpoint: %v", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return "", fmt.Errorf("unable to check rows affected: %v", err)
+	}
+	if rowsAffected == 0 {
+		return "", fmt.Errorf("no webhook endpoint found for given user and endpoint_id")
+	}
+
+	return "Webhook endpoint deleted successfully", nil
+}
+
+// Most recent first, for the endpoint's delivery log.
+func (handler *DatabaseHandler) FetchWebhookDeliveries(user_id string, endpoint_id int) ([]WebhookDelivery, error) {
+	query := `
+		SELECT d.delivery_id, d.event_id, o.event_type, d.status, d.attempts, d.next_attempt_at,
+			d.last_status_code, COALESCE(d.last_error, ''), d.created_at, d.delivered_at
+		FROM webhook_deliveries d
+		JOIN webhook_endpoints e ON e.endpoint_id = d.endpoint_id
+		JOIN webhook_outbox o ON o.event_id = d.event_id
+		WHERE e.user_id = $1 AND e.endpoint_id = $2
+		ORDER BY d.delivery_id DESC
+		LIMIT 100
+	`
+
+	rows, err := handler.Db.Query(query, user_id, endpoint_id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch webhook deliveries: %w", err)
+	}
+	defer rows.Close()
+
+	deliveries := []WebhookDelivery{}
+	for rows.Next() {
+		var delivery WebhookDelivery
+		err := rows.Scan(&delivery.DeliveryID, &delivery.EventID, &delivery.EventType, &delivery.Status, &delivery.Attempts,
+			&delivery.NextAttemptAt, &delivery.StatusCode, &delivery.Error, &delivery.CreatedAt, &delivery.DeliveredAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan webhook delivery: %w", err)
+		}
+		deliveries = append(deliveries, delivery)
+	}
+
+	return deliveries, nil
+}
+
+// Queues a fresh delivery of the same event so the original attempt stays in
+// the log.
+func (handler *DatabaseHandler) RedeliverWebhook(user_id string, endpoint_id int, delivery_id int) (int, error) {
+	query := `
+		INSERT INTO webhook_deliveries (event_id, endpoint_id)
+		SELECT d.event_id, d.endpoint_id
+		FROM webhook_deliveries d
+		JOIN webhook_endpoints e ON e.endpoint_id = d.endpoint_id
+		WHERE e.user_id = $1 AND e.endpoint_id = $2 AND d.delivery_id = $3
+		RETURNING delivery_id
+	`
+
+	var newID int
+	err := handler.Db.QueryRow(query, user_id, endpoint_id, delivery_id).Scan(&newID)
+	if err == sql.ErrNoRows {
+		return 0, fmt.Errorf("no webhook delivery found for given user and delivery_id")
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to redeliver webhook: %v", err)
+	}
+	return newID, nil
+}
+
+// Creates a delivery for every active endpoint subscribed to each new outbox
+// event. Rows are locked so two workers never fan out the same event.
+func (handler *DatabaseHandler) FanOutWebhookEvents() (int, error) {
+	tx, err := handler.Db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	query := `
+		WITH pending AS (
+			SELECT event_id, user_id, event_type FROM webhook_outbox
+			WHERE dispatched_at IS NULL
+			ORDER BY event_id
+			LIMIT 500
+			FOR UPDATE SKIP LOCKED
+		),
+		fanned AS (
+			INSERT INTO webhook_deliveries (event_id, endpoint_id)
+			SELECT p.event_id, e.endpoint_id
+			FROM pending p
+			JOIN webhook_endpoints e ON e.user_id = p.user_id AND e.active AND p.event_type = ANY(e.events)
+			RETURNING 1
+		)
+		UPDATE webhook_outbox SET dispatched_at = NOW()
+		WHERE event_id IN (SELECT event_id FROM pending)
+		RETURNING (SELECT COUNT(*) FROM fanned)
+	`
+
+	rows, err := tx.Query(query)
+	if err != nil {
+		return 0, fmt.Errorf("failed to fan out webhook events: %v", err)
+	}
+	fanned := 0
+	for rows.Next() {
+		if err := rows.Scan(&fanned); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("failed to scan fanned out events: %v", err)
+		}
+	}
+	rows.Close()
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit transaction: %v", err)
+	}
+	return fanned, nil
+}
+
+// Takes up to limit due deliveries and pushes their next attempt out a few
+// minutes, which acts as a lease if the worker dies mid-send.
+func (handler *DatabaseHandler) ClaimWebhookDeliveries(limit int) ([]pendingWebhook, error) {
+	query := `
+		WITH due AS (
+			SELECT delivery_id FROM webhook_deliveries
+			WHERE status = 'pending' AND next_attempt_at <= NOW()
+			ORDER BY next_attempt_at
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		)
+		UPDATE webhook_deliveries d
+		SET next_attempt_at = NOW() + INTERVAL '5 minutes'
+		FROM due, webhook_outbox o, webhook_endpoints e
+		WHERE d.delivery_id = due.delivery_id AND o.event_id = d.event_id AND e.endpoint_id = d.endpoint_id
+		RETURNING d.delivery_id, o.event_id, o.event_type, o.payload, o.created_at, e.url, e.secret, d.attempts
+	`
+
+	rows, err := handler.Db.Query(query, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim webhook deliveries: %w", err)
+	}
+	defer rows.Close()
+
+	var deliveries []pendingWebhook
+	for rows.Next() {
+		var delivery pendingWebhook
+		var payload []byte
+		err := rows.Scan(&delivery.DeliveryID, &delivery.EventID, &delivery.EventType, &payload, &delivery.CreatedAt,
+			&delivery.URL, &delivery.Secret, &delivery.Attempts)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan webhook delivery: %w", err)
+		}
+		delivery.Payload = payload
+		deliveries = append(deliveries, delivery)
+	}
+
+	return deliveries, nil
+}
+
+func (handler *DatabaseHandler) RecordWebhookAttempt(delivery pendingWebhook, status_code int, send_err error) error {
+	attempts := delivery.Attempts + 1
+	var statusCode *int
+	if status_code != 0 {
+		statusCode = &status_code
+	}
+
+	if send_err == nil {
+		query := `
+			UPDATE webhook_deliveries
+			SET status = 'succeeded', attempts = $2, last_status_code = $3, last_error = NULL, next_attempt_at = NULL, delivered_at = NOW()
+			WHERE delivery_id = $1
+		`
+		if _, err := handler.Db.Exec(query, delivery.DeliveryID, attempts, statusCode); err != nil {
+			return fmt.Errorf("failed to record webhook attempt: %v", err)
+		}
+		return nil
+	}
+
+	status := "pending"
+	var retrySeconds *int
+	if delay, ok := webhookRetryDelay(attempts); ok {
+		seconds := int(delay.Seconds())
+		retrySeconds = &seconds
+	} else {
+		status = "failed"
+	}
+
+	// Timed by the database like every other next_attempt_at, so clock skew
+	// between workers can't send a retry early
+	query := `
+		UPDATE webhook_deliveries
+		SET status = $2, attempts = $3, last_status_code = $4, last_error = $5,
+			next_attempt_at = CASE WHEN $6::int IS NULL THEN NULL ELSE NOW() + make_interval(secs => $6::int) END
+		WHERE delivery_id = $1
+	`
+	if _, err := handler.Db.Exec(query, delivery.DeliveryID, status, attempts, statusCode, send_err.Error(), retrySeconds); err != nil {
+		return fmt.Errorf("failed to record webhook attempt: %v", err)
+	}
+	return nil
+}
+
+const sensorColumns = `sensor_id, plant_id, name, dry_threshold, wet_threshold, last_moisture, last_reading_at, created_at, user_id::text`
+
+func scanSensor(row interface{ Scan(...any) error }) (Sensor, error) {
+	var sensor Sensor
+	err := row.Scan(&sensor.SensorID, &sensor.PlantID, &sensor.Name, &sensor.DryThreshold, &sensor.WetThreshold,
+		&sensor.LastMoisture, &sensor.LastReadingAt, &sensor.CreatedAt, &sensor.UserID)
+	return sensor, err
+}
+
+func (handler *DatabaseHandler) RegisterSensor(user_id string, sensor Sensor, token_hash string) (Sensor, error) {
+	query := `
+		INSERT INTO sensors (user_id, plant_id, name, dry_threshold, wet_threshold, token_hash)
+		SELECT $1, plant_id, $3, $4, $5, $6
+		FROM plants WHERE user_id = $1 AND plant_id = $2
+		RETURNING ` + sensorColumns
+
+	registered, err := scanSensor(handler.Db.QueryRow(query, user_id, sensor.PlantID, sensor.Name, sensor.DryThreshold, sensor.WetThreshold, token_hash))
+	if err == sql.ErrNoRows {
+		return registered, fmt.Errorf("no plant found for given user and plant_id")
+	}
+	if err != nil {
+		return registered, fmt.Errorf("failed to register sensor: %v", err)
+	}
+	return registered, nil
+}
+
+func (handler *DatabaseHandler) FetchSensors(user_id string) ([]Sensor, error) {
+	rows, err := handler.Db.Query("SELECT "+sensorColumns+" FROM sensors WHERE user_id = $1 ORDER BY sensor_id", user_id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch sensors: %w", err)
+	}
+	defer rows.Close()
+
+	sensors := []Sensor{}
+	for rows.Next() {
+		sensor, err := scanSensor(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan sensor: %w", err)
+		}
+		sensors = append(sensors, sensor)
+	}
+
+	return sensors, nil
+}
+
+func (handler *DatabaseHandler) UpdateSensor(user_id string, sensor_id int, name string, dry_threshold float64, wet_threshold float64) (string, error) {
+	query := `
+		UPDATE sensors SET name = $3, dry_threshold = $4, wet_threshold = $5
+		WHERE user_id = $1 AND sensor_id = $2
+	`
+	result, err := handler.Db.Exec(query, user_id, sensor_id, name, dry_threshold, wet_threshold)
+	if err != nil {
+		return "", fmt.Errorf("failed to update sensor: %v", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return "", fmt.Errorf("unable to check rows affected: %v", err)
+	}
+	if rowsAffected == 0 {
+		return "", fmt.Errorf("no sensor found for given user and sensor_id")
+	}
+
+	return "Sensor updated successfully", nil
+}
+
+func (handler *DatabaseHandler) FetchSensor(user_id string, sensor_id int) (Sensor, error) {
+	sensor, err := scanSensor(handler.Db.QueryRow("SELECT "+sensorColumns+" FROM sensors WHERE user_id = $1 AND sensor_id = $2", user_id, sensor_id))
+	if err == sql.ErrNoRows {
+		return sensor, fmt.Errorf("no sensor found for given user and sensor_id")
+	}
+	if err != nil {
+		return sensor, fmt.Errorf("failed to fetch sensor: %v", err)
+	}
+	return sensor, nil
+}
+
+// Readings cascade with the sensor.
+func (handler *DatabaseHandler) DeleteSensor(user_id string, sensor_id int) (string, error) {
+	result, err := handler.Db.Exec("DELETE FROM sensors WHERE user_id = $1 AND sensor_id = $2", user_id, sensor_id)
+	if err != nil {
+		return "", fmt.Errorf("failed to delete sensor: %v", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return "", fmt.Errorf("unable to check rows affected: %v", err)
+	}
+	if rowsAffected == 0 {
+		return "", fmt.Errorf("no sensor found for given user and sensor_id")
+	}
+
+	return "Sensor deleted successfully", nil
+}
+
+// Sensors authenticate with the token they were given at registration, not
+// a user JWT.
+func (handler *DatabaseHandler) AuthenticateSensor(sensor_id int, token string) (Sensor, error) {
+	if token == "" {
+		return Sensor{}, fmt.Errorf("sensor token is required")
+	}
+
+	query := "SELECT " + sensorColumns + " FROM sensors WHERE sensor_id = $1 AND token_hash = $2"
+	sensor, err := scanSensor(handler.Db.QueryRow(query, sensor_id, hashToken(token)))
+	if err == sql.ErrNoRows {
+		return sensor, fmt.Errorf("invalid sensor token")
+	}
+	if err != nil {
+		return sensor, fmt.Errorf("failed to authenticate sensor: %v", err)
+	}
+	return sensor, nil
+}
+
+func (handler *DatabaseHandler) RecordSensorReadings(sensor_id int, readings []SensorReading) error {
+	tx, err := handler.Db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	for _, reading := range readings {
+		_, err := tx.Exec("INSERT INTO sensor_readings (sensor_id, moisture, recorded_at) VALUES ($1, $2, $3)", sensor_id, reading.Moisture, reading.RecordedAt)
+		if err != nil {
+			return fmt.Errorf("failed to record sensor reading: %v", err)
+		}
+	}
+
+	// Out-of-order batches shouldn't make the latest value go backwards
+	query := `
+		UPDATE sensors s
+		SET last_moisture = r.moisture, last_reading_at = r.recorded_at
+		FROM (
+			SELECT moisture, recorded_at FROM sensor_readings
+			WHERE sensor_id = $1 ORDER BY recorded_at DESC LIMIT 1
+		) r
+		WHERE s.sensor_id = $1
+	`
+	if _, err := tx.Exec(query, sensor_id); err != nil {
+		return fmt.Errorf("failed to update sensor: %v", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %v", err)
+	}
+	return nil
+}
+
+func (handler *DatabaseHandler) FetchSensorReadings(user_id string, sensor_id int, since time.Time) ([]SensorReading, error) {
+	query := `
+		SELECT r.moisture, r.recorded_at
+		FROM sensor_readings r
+		JOIN sensors s ON s.sensor_id = r.sensor_id
+		WHERE s.user_id = $1 AND s.sensor_id = $2 AND r.recorded_at >= $3
+		ORDER BY r.recorded_at
+		LIMIT 5000
+	`
+
+	rows, err := handler.Db.Query(query, user_id, sensor_id, since)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch sensor readings: %w", err)
+	}
+	defer rows.Close()
+
+	readings := []SensorReading{}
+	for rows.Next() {
+		var reading SensorReading
+		if err := rows.Scan(&reading.Moisture, &reading.RecordedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan sensor reading: %w", err)
+		}
+		readings = append(readings, reading)
+	}
+
+	return readings, nil
+}
+
+// Brings the plant's watering forward to today. Schedules that are already
+// due, watered today or snoozed are left alone. Logged as soil_dry so the
+// adaptive engine learns from it like a manual note.
+func (handler *DatabaseHandler) MarkPlantDueFromSensor(sensor Sensor, moisture float64) error {
+	tx, err := handler.Db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	query := `
+		UPDATE schedule s
+		SET next_watering_date = CURRENT_DATE, postponed_reason = NULL
+		WHERE s.user_id = $1 AND s.plant_id = $2
+		AND 'water' = ANY(COALESCE(s.task_types, '{water}'))
+		AND DATE(s.next_watering_date) > CURRENT_DATE
+		AND NOT (s.water_is_completed AND DATE(s.watering_date) = CURRENT_DATE)
+		AND (s.snoozed_until IS NULL OR s.snoozed_until <= NOW())
+	`
+	result, err := tx.Exec(query, sensor.UserID, sensor.PlantID)
+	if err != nil {
+		return fmt.Errorf("failed to bring schedule forward: %v", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return nil
+	}
+
+	notes := fmt.Sprintf("Soil moisture at %.0f%% (dry below %.0f%%)", moisture, sensor.DryThreshold)
+	if err := recordCareHistoryBy(tx, sensor.UserID, sensor.PlantID, "soil_dry", notes, sensor.attribution()); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %v", err)
+	}
+	return nil
+}
+
+// Wet soil on a due day means someone (or the rain) already watered.
+func (handler *DatabaseHandler) CompleteDueWateringFromSensor(sensor Sensor) error {
+	query := `
+		SELECT s.schedule_id FROM schedule s
+		WHERE s.user_id = $1 AND s.plant_id = $2
+		AND 'water' = ANY(COALESCE(s.task_types, '{water}'))
+		AND ` + dueScheduleCondition
+
+	rows, err := handler.Db.Query(query, sensor.UserID, sensor.PlantID)
+	if err != nil {
+		return fmt.Errorf("failed to fetch due schedules: %w", err)
+	}
+	var scheduleIDs []int
+	for rows.Next() {
+		var scheduleID int
+		if err := rows.Scan(&scheduleID); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan schedule: %w", err)
+		}
+		scheduleIDs = append(scheduleIDs, scheduleID)
+	}
+	rows.Close()
+
+	for _, scheduleID := range scheduleIDs {
+		if _, err := handler.MarkWatered(sensor.UserID, scheduleID, sensor.attribution()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func int64Array(ids []int) pq.Int64Array {
+	array := make(pq.Int64Array, len(ids))
+	for i, id := range ids {
+		array[i] = int64(id)
+	}
+	return array
+}
+
+func intsOf(array pq.Int64Array) []int {
+	ids := make([]int, len(array))
+	for i, id := range array {
+		ids[i] = int(id)
+	}
+	return ids
+}
+
+const valveColumns = `v.valve_id, v.name, v.driver, COALESCE(v.address, ''), v.plant_ids, v.flow_ml_per_minute, v.default_amount_ml,
+	v.max_run_seconds, v.max_daily_seconds, v.start_hour, v.enabled, v.created_at, v.user_id::text`
+
+func scanValve(row interface{ Scan(...any) error }, extra ...any) (Valve, error) {
+	var valve Valve
+	var plantIDs pq.Int64Array
+	dest := append([]any{&valve.ValveID, &valve.Name, &valve.Driver, &valve.Address, &plantIDs, &valve.FlowMLPerMinute, &valve.DefaultAmountML,
+		&valve.MaxRunSeconds, &valve.MaxDailySeconds, &valve.StartHour, &valve.Enabled, &valve.CreatedAt, &valve.UserID}, extra...)
+	err := row.Scan(dest...)
+	valve.PlantIDs = intsOf(plantIDs)
+	return valve, err
+}
+
+// Every linked plant has to belong to the user.
+func (handler *DatabaseHandler) RegisterValve(user_id string, valve Valve, token_hash string) (Valve, error) {
+	query := `
+		INSERT INTO valves AS v (user_id, name, driver, address, plant_ids, flow_ml_per_minute, default_amount_ml,
+			max_run_seconds, max_daily_seconds, start_hour, token_hash)
+		SELECT $1, $2, $3, NULLIF($4, ''), $5, $6, $7, $8, $9, $10, $11
+		WHERE (SELECT COUNT(*) FROM plants WHERE user_id = $1 AND plant_id = ANY($5)) = cardinality($5::int[])
+		RETURNING ` + valveColumns
+
+	registered, err := scanValve(handler.Db.QueryRow(query, user_id, valve.Name, valve.Driver, valve.Address, int64Array(valve.PlantIDs),
+		valve.FlowMLPerMinute, valve.DefaultAmountML, valve.MaxRunSeconds, valve.MaxDailySeconds, valve.StartHour, token_hash))
+	if err == sql.ErrNoRows {
+		return registered, fmt.Errorf("no plant found for given user and plant_ids")
+	}
+	if err != nil {
+		return registered, fmt.Errorf("failed to register valve: %v", err)
+	}
+	return registered, nil
+}
+
+func (handler *DatabaseHandler) FetchValves(user_id string) ([]Valve, error) {
+	rows, err := handler.Db.Query("SELECT "+valveColumns+" FROM valves v WHERE v.user_id = $1 ORDER BY v.valve_id", user_id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch valves: %w", err)
+	}
+	defer rows.Close()
+
+	valves := []Valve{}
+	for rows.Next() {
+		valve, err := scanValve(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan valve: %w", err)
+		}
+		valves = append(valves, valve)
+	}
+
+	return valves, nil
+}
+
+// Run history cascades with the valve.
+func (handler *DatabaseHandler) DeleteValve(user_id string, valve_id int) (string, error) {
+	result, err := handler.Db.Exec("DELETE FROM valves WHERE user_id = $1 AND valve_id = $2", user_id, valve_id)
+	if err != nil {
+		return "", fmt.Errorf("failed to delete valve: %v", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return "", fmt.Errorf("unable to check rows affected: %v", err)
+	}
+	if rowsAffected == 0 {
+		return "", fmt.Errorf("no valve found for given user and valve_id")
+	}
+
+	return "Valve deleted successfully", nil
+}
+
+func (handler *DatabaseHandler) AuthenticateValve(valve_id int, token string) (Valve, error) {
+	if token == "" {
+		return Valve{}, fmt.Errorf("valve token is required")
+	}
+
+	valve, err := scanValve(handler.Db.QueryRow("SELECT "+valveColumns+" FROM valves v WHERE v.valve_id = $1 AND v.token_hash = $2", valve_id, hashToken(token)))
+	if err == sql.ErrNoRows {
+		return valve, fmt.Errorf("invalid valve token")
+	}
+	if err != nil {
+		return valve, fmt.Errorf("failed to authenticate valve: %v", err)
+	}
+	return valve, nil
+}
+
+// Due watering behind each enabled valve, once the owner's local time reaches
+// the valve's start hour. Schedules the valve already tried in the last 20
+// hours are skipped, whatever came of it.
+func (handler *DatabaseHandler) FetchDueIrrigation() ([]IrrigationJob, error) {
+	query := `
+		SELECT ` + valveColumns + `, array_agg(s.schedule_id ORDER BY s.schedule_id), MAX(COALESCE(s.water_amount_ml, v.default_amount_ml))
+		FROM valves v
+		JOIN schedule s ON s.user_id = v.user_id AND s.plant_id = ANY(v.plant_ids)
+		LEFT JOIN user_settings us ON us.user_id = v.user_id
+		CROSS JOIN LATERAL (SELECT NOW() AT TIME ZONE COALESCE(us.timezone, 'UTC') AS local_now) t
+		WHERE v.enabled
+		AND 'water' = ANY(COALESCE(s.task_types, '{water}'))
+		AND EXTRACT(HOUR FROM t.local_now) >= v.start_hour
+		AND ` + dueScheduleConditionOn("t.local_now::date") + `
+		AND NOT EXISTS (
+			SELECT 1 FROM irrigation_runs r
+			WHERE r.valve_id = v.valve_id AND s.schedule_id = ANY(r.schedule_ids)
+			AND r.created_at > NOW() - INTERVAL '20 hours'
+		)
+		GROUP BY v.valve_id
+	`
+
+	rows, err := handler.Db.Query(query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch due irrigation: %w", err)
+	}
+	defer rows.Close()
+
+	var jobs []IrrigationJob
+	for rows.Next() {
+		var job IrrigationJob
+		var scheduleIDs pq.Int64Array
+		job.Valve, err = scanValve(rows, &scheduleIDs, &job.AmountML)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan irrigation job: %w", err)
+		}
+		job.ScheduleIDs = intsOf(scheduleIDs)
+		jobs = append(jobs, job)
+	}
+
+	return jobs, nil
+}
+
+// Seconds the valve has been (or may have been) open over the last 24 hours.
+// Runs we never heard back about count in full, and so do failed ones: the
+// valve may have opened before the error.
+func (handler *DatabaseHandler) ValveRuntimeToday(valve_id int) (int, error) {
+	query := `
+		SELECT COALESCE(SUM(COALESCE(seconds_run, requested_seconds)), 0)
+		FROM irrigation_runs
+		WHERE valve_id = $1 AND status NOT IN ('capped', 'unsent')
+		AND created_at > NOW() - INTERVAL '24 hours'
+	`
+	var seconds int
+	if err := handler.Db.QueryRow(query, valve_id).Scan(&seconds); err != nil {
+		return 0, fmt.Errorf("failed to fetch valve runtime: %v", err)
+	}
+	return seconds, nil
+}
+
+func (handler *DatabaseHandler) CreateIrrigationRun(valve_id int, schedule_ids []int, command_id string, requested_seconds int, status string, error_text string) error {
+	query := `
+		INSERT INTO irrigation_runs (valve_id, schedule_ids, command_id, requested_seconds, status, error)
+		VALUES ($1, $2, $3, $4, $5, NULLIF($6, ''))
+	`
+	if _, err := handler.Db.Exec(query, valve_id, int64Array(schedule_ids), command_id, requested_seconds, status, error_text); err != nil {
+		return fmt.Errorf("failed to record irrigation run: %v", err)
+	}
+	return nil
+}
+
+func (handler *DatabaseHandler) UpdateIrrigationRun(valve_id int, command_id string, status string, seconds_run *int, error_text string) error {
+	query := `
+		UPDATE irrigation_runs
+		SET status = $3, seconds_run = COALESCE($4, seconds_run), error = NULLIF($5, ''),
+			confirmed_at = CASE WHEN $3 IN ('confirmed', 'incomplete') THEN NOW() ELSE confirmed_at END
+		WHERE valve_id = $1 AND command_id = $2
+	`
+	result, err := handler.Db.Exec(query, valve_id, command_id, status, seconds_run, error_text)
+	if err != nil {
+		return fmt.Errorf("failed to update irrigation run: %v", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("unable to check rows affected: %v", err)
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("no irrigation run found for given valve and command_id")
+	}
+	return nil
+}
+
+const irrigationRunColumns = `run_id, schedule_ids, command_id, requested_seconds, status, seconds_run, COALESCE(error, ''), created_at, confirmed_at`
+
+func scanIrrigationRun(row interface{ Scan(...any) error }) (IrrigationRun, error) {
+	var run IrrigationRun
+	var scheduleIDs pq.Int64Array
+	err := row.Scan(&run.RunID, &scheduleIDs, &run.CommandID, &run.RequestedSeconds, &run.Status, &run.SecondsRun, &run.Error, &run.CreatedAt, &run.ConfirmedAt)
+	run.ScheduleIDs = intsOf(scheduleIDs)
+	return run, err
+}
+
+func (handler *DatabaseHandler) FetchIrrigationRun(valve_id int, command_id string) (IrrigationRun, error) {
+	run, err := scanIrrigationRun(handler.Db.QueryRow("SELECT "+irrigationRunColumns+" FROM irrigation_runs WHERE valve_id = $1 AND command_id = $2", valve_id, command_id))
+	if err == sql.ErrNoRows {
+		return run, fmt.Errorf("no irrigation run found for given valve and command_id")
+	}
+	if err != nil {
+		return run, fmt.Errorf("failed to fetch irrigation run: %v", err)
+	}
+	return run, nil
+}
+
+func (handler *DatabaseHandler) FetchIrrigationRuns(user_id string, valve_id int) ([]IrrigationRun, error) {
+	query := `
+		SELECT ` + irrigationRunColumns + `
+		FROM irrigation_runs
+		WHERE valve_id = (SELECT valve_id FROM valves WHERE user_id = $1 AND valve_id = $2)
+		ORDER BY run_id DESC
+		LIMIT 100
+	`
+
+	rows, err := handler.Db.Query(query, user_id, valve_id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch irrigation runs: %w", err)
+	}
+	defer rows.Close()
+
+	runs := []IrrigationRun{}
+	for rows.Next() {
+		run, err := scanIrrigationRun(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan irrigation run: %w", err)
+		}
+		runs = append(runs, run)
+	}
+
+	return runs, nil
+}
+
+// Runs that should long have finished without the controller confirming.
+func (handler *DatabaseHandler) ExpireIrrigationRuns() (int, error) {
+	query := `
+		UPDATE irrigation_runs SET status = 'timeout', error = 'no confirmation from valve'
+		WHERE status IN ('sent', 'opened')
+		AND created_at + make_interval(secs => requested_seconds) + INTERVAL '15 minutes' < NOW()
+	`
+	result, err := handler.Db.Exec(query)
+	if err != nil {
+		return 0, fmt.Errorf("failed to expire irrigation runs: %v", err)
+	}
+	n, _ := result.RowsAffected()
+	return int(n), nil
+}
+
+// Keeps the node id across off/on so Home Assistant entity ids stay stable.
+// The command key is replaced on every enable and dropped on disable.
+func (handler *DatabaseHandler) SetHomeAssistant(user_id string, enabled bool, node_id string, command_key string) (string, error) {
+	query := `
+		INSERT INTO user_settings (user_id, ha_enabled, ha_node_id, ha_command_key, updated_at)
+		VALUES ($1, $2, $3, CASE WHEN $2 THEN $4 END, NOW())
+		ON CONFLICT (user_id) DO UPDATE
+		SET ha_enabled = $2, ha_node_id = COALESCE(user_settings.ha_node_id, $3),
+			ha_command_key = CASE WHEN $2 THEN $4 END, updated_at = NOW()
+		RETURNING ha_node_id
+	`
+
+	var nodeID string
+	if err := handler.Db.QueryRow(query, user_id, enabled, node_id, command_key).Scan(&nodeID); err != nil {
+		return "", fmt.Errorf("failed to update Home Assistant settings: %v", err)
+	}
+	return nodeID, nil
+}
+
+func (handler *DatabaseHandler) FetchHomeAssistant(user_id string) (bool, string, error) {
+	var enabled bool
+	var nodeID string
+	query := "SELECT COALESCE(ha_enabled, false), COALESCE(ha_node_id, '') FROM user_settings WHERE user_id = $1"
+	err := handler.Db.QueryRow(query, user_id).Scan(&enabled, &nodeID)
+	if err == sql.ErrNoRows {
+		return false, "", nil
+	}
+	if err != nil {
+		return false, "", fmt.Errorf("failed to fetch Home Assistant settings: %v", err)
+	}
+	return enabled, nodeID, nil
+}
+
+func (handler *DatabaseHandler) FetchHomeAssistantNodes() ([]haNode, error) {
+	rows, err := handler.Db.Query("SELECT user_id::text, ha_node_id, COALESCE(ha_command_key, '') FROM user_settings WHERE ha_enabled AND ha_node_id IS NOT NULL")
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch Home Assistant nodes: %w", err)
+	}
+	defer rows.Close()
+
+	var nodes []haNode
+	for rows.Next() {
+		var node haNode
+		if err := rows.Scan(&node.UserID, &node.NodeID, &node.CommandKey); err != nil {
+			return nil, fmt.Errorf("failed to scan Home Assistant node: %w", err)
+		}
+		nodes = append(nodes, node)
+	}
+
+	return nodes, nil
+}
+
+func (handler *DatabaseHandler) FetchHomeAssistantNode(node_id string) (haNode, error) {
+	node := haNode{NodeID: node_id}
+	query := "SELECT user_id::text, ha_command_key FROM user_settings WHERE ha_enabled AND ha_node_id = $1 AND ha_command_key IS NOT NULL"
+	err := handler.Db.QueryRow(query, node_id).Scan(&node.UserID, &node.CommandKey)
+	if err == sql.ErrNoRows {
+		return node, fmt.Errorf("no enabled Home Assistant node %s", node_id)
+	}
+	if err != nil {
+		return node, fmt.Errorf("failed to look up Home Assistant node: %v", err)
+	}
+	return node, nil
+}
+
+// One row per plant with its earliest upcoming watering and whether any of
+// its watering schedules is due in the user's own timezone.
+func (handler *DatabaseHandler) FetchHomeAssistantPlants(user_id string) ([]haPlantState, error) {
+	query := `
+		SELECT p.plant_id, COALESCE(p.plant_pet_name, ''), COALESCE(p.plant_name, ''), COALESCE(p.plant_health, 0),
+			MIN(DATE(s.next_watering_date)),
+			COALESCE(BOOL_OR(` + dueScheduleConditionOn("t.local_now::date") + `), false)
+		FROM plants p
+		LEFT JOIN user_settings us ON us.user_id = p.user_id
+		CROSS JOIN LATERAL (SELECT NOW() AT TIME ZONE COALESCE(us.timezone, 'UTC') AS local_now) t
+		LEFT JOIN schedule s ON s.plant_id = p.plant_id AND s.user_id = p.user_id
+			AND 'water' = ANY(COALESCE(s.task_types, '{water}'))
+		WHERE p.user_id = $1
+		GROUP BY p.plant_id
+		ORDER BY p.plant_id
+	`
+
+	rows, err := handler.Db.Query(query, user_id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch plant states: %w", err)
+	}
+	defer rows.Close()
+
+	var plants []haPlantState
+	for rows.Next() {
+		var plant haPlantState
+		if err := rows.Scan(&plant.PlantID, &plant.PlantPetName, &plant.PlantName, &plant.Health, &plant.NextWatering, &plant.NeedsWater); err != nil {
+			return nil, fmt.Errorf("failed to scan plant state: %w", err)
+		}
+		plants = append(plants, plant)
+	}
+
+	return plants, nil
+}
+
+func (handler *DatabaseHandler) FetchWaterScheduleIDs(user_id string, plant_id int) ([]int, error) {
+	query := `
+		SELECT schedule_id FROM schedule
+		WHERE user_id = $1 AND plant_id = $2 AND 'water' = ANY(COALESCE(task_types, '{water}'))
+		ORDER BY schedule_id
+	`
+
+	rows, err := handler.Db.Query(query, user_id, plant_id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch schedules: %w", err)
+	}
+	defer rows.Close()
+
+	var scheduleIDs []int
+	for rows.Next() {
+		var scheduleID int
+		if err := rows.Scan(&scheduleID); err != nil {
+			return nil, fmt.Errorf("failed to scan schedule: %w", err)
+		}
+		scheduleIDs = append(scheduleIDs, scheduleID)
+	}
+
+	return scheduleIDs, nil
+}
+
+const accessTokenColumns = "token_id, user_id, name, scopes, expires_at, last_used_at, created_at"
+
+func scanAccessToken(row interface{ Scan(...any) error }) (AccessToken, error) {
+	var token AccessToken
+	err := row.Scan(&token.TokenID, &token.UserID, &token.Name, pq.Array(&token.Scopes), &token.ExpiresAt, &token.LastUsedAt, &token.CreatedAt)
+	return token, err
+}
+
+func (handler *DatabaseHandler) CreateAccessToken(user_id string, name string, scopes []string, expires_at *time.Time, token_hash string) (AccessToken, error) {
+	query := `
+		INSERT INTO personal_access_tokens (user_id, name, scopes, expires_at, token_hash)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING ` + accessTokenColumns
+
+	token, err := scanAccessToken(handler.Db.QueryRow(query, user_id, name, pq.Array(scopes), expires_at, token_hash))
+	if err != nil {
+		return token, fmt.Errorf("failed to create access token: %v", err)
+	}
+	return token, nil
+}
+
+func (handler *DatabaseHandler) FetchAccessTokens(user_id string) ([]AccessToken, error) {
+	rows, err := handler.Db.Query("SELECT "+accessTokenColumns+" FROM personal_access_tokens WHERE user_id = $1 ORDER BY token_id", user_id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch access tokens: %w", err)
+	}
+	defer rows.Close()
+
+	tokens := []AccessToken{}
+	for rows.Next() {
+		token, err := scanAccessToken(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan access token: %w", err)
+		}
+		tokens = append(tokens, token)
+	}
+
+	return tokens, nil
+}
+
+func (handler *DatabaseHandler) DeleteAccessToken(user_id string, token_id int) (string, error) {
+	result, err := handler.Db.Exec("DELETE FROM personal_access_tokens WHERE user_id = $1 AND token_id = $2", user_id, token_id)
+	if err != nil {
+		return "", fmt.Errorf("failed to delete access token: %v", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return "", fmt.Errorf("unable to check rows affected: %v", err)
+	}
+	if rowsAffected == 0 {
+		return "", fmt.Errorf("no access token found for given user and token_id")
+	}
+
+	return "Access token revoked successfully", nil
+}
+
+// Looks the token up by hash and bumps last_used_at. The bump is skipped if
+// it was used in the last minute, so a chatty script doesn't write every call.
+func (handler *DatabaseHandler) AuthenticateAccessToken(token string) (AccessToken, error) {
+	query := "SELECT " + accessTokenColumns + " FROM personal_access_tokens WHERE token_hash = $1 AND (expires_at IS NULL OR expires_at > NOW())"
+	accessToken, err := scanAccessToken(handler.Db.QueryRow(query, hashToken(token)))
+	if err == sql.ErrNoRows {
+		return accessToken, fmt.Errorf("invalid or expired access token")
+	}
+	if err != nil {
+		return accessToken, fmt.Errorf("failed to authenticate access token: %v", err)
+	}
+
+	query = `
+		UPDATE personal_access_tokens SET last_used_at = NOW()
+		WHERE token_id = $1 AND (last_used_at IS NULL OR last_used_at < NOW() - INTERVAL '1 minute')
+	`
+	if _, err := handler.Db.Exec(query, accessToken.TokenID); err != nil {
+		return accessToken, fmt.Errorf("failed to record access token use: %v", err)
+	}
+	return accessToken, nil
+}
+
+// The caller's role on a plant: owner for their personal plants, otherwise
+// their role in the plant's household. Also returns the user the plant's rows
+// are keyed by.
+func (handler *DatabaseHandler) PlantAccess(user_id string, plant_id int) (string, string, error) {
+	query := `
+		SELECT p.user_id, CASE WHEN p.household_id IS NULL THEN 'owner' ELSE m.role END
+		FROM plants p
+		LEFT JOIN household_members m ON m.household_id = p.household_id AND m.user_id = $1
+		WHERE p.plant_id = $2 AND ((p.household_id IS NULL AND p.user_id = $1) OR m.user_id IS NOT NULL)
+	`
+
+	var ownerID, role string
+	err := handler.Db.QueryRow(query, user_id, plant_id).Scan(&ownerID, &role)
+	if err == sql.ErrNoRows {
+		return "", "", fmt.Errorf("no plant found for given user and plant_id")
+	}
+	if err != nil {
+		return "", "", fmt.Errorf("failed to check plant access: %v", err)
+	}
+	return ownerID, role, nil
+}
+
+func (handler *DatabaseHandler) ScheduleAccess(user_id string, schedule_id int) (string, string, error) {
+	query := `
+		SELECT s.user_id, CASE WHEN p.household_id IS NULL THEN 'owner' ELSE m.role END
+		FROM schedule s
+		JOIN plants p ON p.plant_id = s.plant_id
+		LEFT JOIN household_members m ON m.household_id = p.household_id AND m.user_id = $1
+		WHERE s.schedule_id = $2 AND ((p.household_id IS NULL AND p.user_id = $1) OR m.user_id IS NOT NULL)
+	`
+
+	var ownerID, role string
+	err := handler.Db.QueryRow(query, user_id, schedule_id).Scan(&ownerID, &role)
+	if err == sql.ErrNoRows {
+		return "", "", fmt.Errorf("no schedule found for given user and schedule_id")
+	}
+	if err != nil {
+		return "", "", fmt.Errorf("failed to check schedule access: %v", err)
+	}
+	return ownerID, role, nil
+}
+
+func (handler *DatabaseHandler) HouseholdRole(user_id string, household_id int) (string, error) {
+	var role string
+	err := handler.Db.QueryRow("SELECT role FROM household_members WHERE user_id = $1 AND household_id = $2", user_id, household_id).Scan(&role)
+	if err == sql.ErrNoRows {
+		return "", fmt.Errorf("no household found for given user and household_id")
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to fetch household role: %v", err)
+	}
+	return role, nil
+}
+
+func (handler *DatabaseHandler) CreateHousehold(user_id string, name string) (Household, error) {
+	household := Household{Name: name, Role: HouseholdOwner}
+
+	tx, err := handler.Db.Begin()
+	if err != nil {
+		return household, fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRow("INSERT INTO households (name, created_by) VALUES ($1, $2) RETURNING household_id, created_at", name, user_id).
+		Scan(&household.HouseholdID, &household.CreatedAt)
+	if err != nil {
+		return household, fmt.Errorf("failed to create household: %v", err)
+	}
+
+	_, err = tx.Exec("INSERT INTO household_members (household_id, user_id, role) VALUES ($1, $2, $3)", household.HouseholdID, user_id, HouseholdOwner)
+	if err != nil {
+		return household, fmt.Errorf("failed to add household owner: %v", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return household, fmt.Errorf("failed to commit transaction: %v", err)
+	}
+	return household, nil
+}
+
+func (handler *DatabaseHandler) FetchHouseholds(user_id string) ([]Household, error) {
+	query := `
+		SELECT h.household_id, h.name, m.role, h.created_at
+		FROM households h
+		JOIN household_members m ON m.household_id = h.household_id
+		WHERE m.user_id = $1
+		ORDER BY h.household_id
+	`
+
+	rows, err := handler.Db.Query(query, user_id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch households: %w", err)
+	}
+	defer rows.Close()
+
+	households := []Household{}
+	for rows.Next() {
+		var household Household
+		if err := rows.Scan(&household.HouseholdID, &household.Name, &household.Role, &household.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan household: %w", err)
+		}
+		households = append(households, household)
+	}
+
+	return households, nil
+}
+
+// Plants in the household go back to being personal plants of whoever
+// added them (the foreign key sets household_id to NULL).
+func (handler *DatabaseHandler) DeleteHousehold(household_id int) (string, error) {
+	result, err := handler.Db.Exec("DELETE FROM households WHERE household_id = $1", household_id)
+	if err != nil {
+		return "", fmt.Errorf("failed to delete household: %v", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return "", fmt.Errorf("unable to check rows affected: %v", err)
+	}
+	if rowsAffected == 0 {
+		return "", fmt.Errorf("no household found for given household_id")
+	}
+
+	return "Household deleted successfully", nil
+}
+
+func (handler *DatabaseHandler) FetchHouseholdMembers(household_id int) ([]HouseholdMember, error) {
+	rows, err := handler.Db.Query("SELECT user_id, role, joined_at FROM household_members WHERE household_id = $1 ORDER BY joined_at", household_id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch household members: %w", err)
+	}
+	defer rows.Close()
+
+	members := []HouseholdMember{}
+	for rows.Next() {
+		var member HouseholdMember
+		if err := rows.Scan(&member.UserID, &member.Role, &member.JoinedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan household member: %w", err)
+		}
+		members = append(members, member)
+	}
+
+	return members, nil
+}
+
+// Runs a change to the member list, refusing it if it would leave the
+// household without an owner.
+func (handler *DatabaseHandler) changeHouseholdMember(household_id int, member_user_id string, query string, args ...any) error {
+	tx, err := handler.Db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	// Lock the member list so two owners can't demote each other at once
+	if _, err := tx.Exec("SELECT 1 FROM household_members WHERE household_id = $1 FOR UPDATE", household_id); err != nil {
+		return fmt.Errorf("failed to lock household members: %v", err)
+	}
+
+	result, err := tx.Exec(query, append([]any{household_id, member_user_id}, args...)...)
+	if err != nil {
+		return fmt.Errorf("failed to update household member: %v", err)
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("unable to check rows affected: %v", err)
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("no member found for given household and user_id")
+	}
+
+	var owners int
+	if err := tx.QueryRow("SELECT COUNT(*) FROM household_members WHERE household_id = $1 AND role = 'owner'", household_id).Scan(&owners); err != nil {
+		return fmt.Errorf("failed to count owners: %v", err)
+	}
+	if owners == 0 {
+		return fmt.Errorf("a household needs at least one owner, delete the household instead")
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %v", err)
+	}
+	return nil
+}
+
+func (handler *DatabaseHandler) SetHouseholdMemberRole(household_id int, member_user_id string, role string) (string, error) {
+	err := handler.changeHouseholdMember(household_id, member_user_id, "UPDATE household_members SET role = $3 WHERE household_id = $1 AND user_id = $2", role)
+	if err != nil {
+		return "", err
+	}
+	return "Member role updated successfully", nil
+}
+
+// Plants the member added stay in the household.
+func (handler *DatabaseHandler) RemoveHouseholdMember(household_id int, member_user_id string) (string, error) {
+	err := handler.changeHouseholdMember(household_id, member_user_id, "DELETE FROM household_members WHERE household_id = $1 AND user_id = $2")
+	if err != nil {
+		return "", err
+	}
+	return "Member removed successfully", nil
+}
+
+func (handler *DatabaseHandler) CreateHouseholdInvite(household_id int, invited_by string, role string, email string, token_hash string) (HouseholdInvite, error) {
+	query := `
+		INSERT INTO household_invites (household_id, invited_by, role, email, token_hash, expires_at)
+		VALUES ($1, $2, $3, NULLIF($4, ''), NULLIF($5, ''), NOW() + $6 * INTERVAL '1 second')
+		RETURNING invite_id, expires_at, created_at
+	`
+
+	invite := HouseholdInvite{HouseholdID: household_id, Role: role, Email: email}
+	err := handler.Db.QueryRow(query, household_id, invited_by, role, email, token_hash, int(householdInviteTTL.Seconds())).
+		Scan(&invite.InviteID, &invite.ExpiresAt, &invite.CreatedAt)
+	if err != nil {
+		return invite, fmt.Errorf("failed to create invite: %v", err)
+	}
+	return invite, nil
+}
+
+func (handler *DatabaseHandler) fetchHouseholdInvites(condition string, args ...any) ([]HouseholdInvite, error) {
+	query := `
+		SELECT i.invite_id, i.household_id, h.name, i.role, COALESCE(i.email, ''), i.expires_at, i.created_at
+		FROM household_invites i
+		JOIN households h ON h.household_id = i.household_id
+		WHERE i.accepted_by IS NULL AND i.expires_at > NOW() AND ` + condition + `
+		ORDER BY i.invite_id
+	`
+
+	rows, err := handler.Db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch invites: %w", err)
+	}
+	defer rows.Close()
+
+	invites := []HouseholdInvite{}
+	for rows.Next() {
+		var invite HouseholdInvite
+		if err := rows.Scan(&invite.InviteID, &invite.HouseholdID, &invite.HouseholdName, &invite.Role, &invite.Email, &invite.ExpiresAt, &invite.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan invite: %w", err)
+		}
+		invites = append(invites, invite)
+	}
+
+	return invites, nil
+}
+
+func (handler *DatabaseHandler) FetchHouseholdInvites(household_id int) ([]HouseholdInvite, error) {
+	return handler.fetchHouseholdInvites("i.household_id = $1", household_id)
+}
+
+// Pending invites sent to the user's email address.
+func (handler *DatabaseHandler) FetchInvitesForEmail(email string) ([]HouseholdInvite, error) {
+	return handler.fetchHouseholdInvites("LOWER(i.email) = LOWER($1)", email)
+}
+
+func (handler *DatabaseHandler) DeleteHouseholdInvite(household_id int, invite_id int) (string, error) {
+	result, err := handler.Db.Exec("DELETE FROM household_invites WHERE household_id = $1 AND invite_id = $2 AND accepted_by IS NULL", household_id, invite_id)
+	if err != nil {
+		return "", fmt.Errorf("failed to delete invite: %v", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return "", fmt.Errorf("unable to check rows affected: %v", err)
+	}
+	if rowsAffected == 0 {
+		return "", fmt.Errorf("no pending invite found for given household and invite_id")
+	}
+
+	return "Invite revoked successfully", nil
+}
+
+// Uses up the invite matched by condition ($2 onwards) and adds the user.
+// Someone who is already a member keeps their current role.
+func (handler *DatabaseHandler) acceptHouseholdInvite(user_id string, condition string, args ...any) (Household, error) {
+	var household Household
+
+	tx, err := handler.Db.Begin()
+	if err != nil {
+		return household, fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	query := `
+		UPDATE household_invites SET accepted_by = $1, accepted_at = NOW()
+		WHERE accepted_by IS NULL AND expires_at > NOW() AND ` + condition + `
+		RETURNING household_id, role
+	`
+	err = tx.QueryRow(query, append([]any{user_id}, args...)...).Scan(&household.HouseholdID, &household.Role)
+	if err == sql.ErrNoRows {
+		return household, fmt.Errorf("invite not found, already used or expired")
+	}
+	if err != nil {
+		return household, fmt.Errorf("failed to accept invite: %v", err)
+	}
+
+	query = `
+		INSERT INTO household_members (household_id, user_id, role) VALUES ($1, $2, $3)
+		ON CONFLICT (household_id, user_id) DO NOTHING
+	`
+	if _, err := tx.Exec(query, household.HouseholdID, user_id, household.Role); err != nil {
+		return household, fmt.Errorf("failed to add household member: %v", err)
+	}
+
+	err = tx.QueryRow(`
+		SELECT h.name, h.created_at, m.role FROM households h
+		JOIN household_members m ON m.household_id = h.household_id AND m.user_id = $2
+		WHERE h.household_id = $1`, household.HouseholdID, user_id).Scan(&household.Name, &household.CreatedAt, &household.Role)
+	if err != nil {
+		return household, fmt.Errorf("failed to fetch household: %v", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return household, fmt.Errorf("failed to commit transaction: %v", err)
+	}
+	return household, nil
+}
+
+func (handler *DatabaseHandler) AcceptHouseholdInviteLink(user_id string, token string) (Household, error) {
+	return handler.acceptHouseholdInvite(user_id, "token_hash = $2", hashToken(token))
+}
+
+func (handler *DatabaseHandler) AcceptHouseholdInviteEmail(user_id string, email string, invite_id int) (Household, error) {
+	return handler.acceptHouseholdInvite(user_id, "invite_id = $2 AND LOWER(email) = LOWER($3)", invite_id, email)
+}
+
+// Moves one of the user's own plants into a household, or back out when
+// household_id is nil.
+func (handler *DatabaseHandler) SetPlantHousehold(user_id string, plant_id int, household_id *int) (string, error) {
+	result, err := handler.Db.Exec("UPDATE plants SET household_id = $3 WHERE user_id = $1 AND plant_id = $2", user_id, plant_id, household_id)
+	if err != nil {
+		return "", fmt.Errorf("failed to move plant: %v", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return "", fmt.Errorf("unable to check rows affected: %v", err)
+	}
+	if rowsAffected == 0 {
+		return "", fmt.Errorf("no plant found for given user and plant_id")
+	}
+
+	notifyPlantChanged(user_id)
+	return "Plant moved successfully", nil
+}
+
+// Editors and owners of the household in join order, with the last time each
+// did anything for its plants. Owners log their own care without a
+// performed_by, so that falls back to the plant owner.
+func fetchChoreMembers(db sqlQueryer, household_id int) ([]choreMember, error) {
+	query := `
+		SELECT m.user_id::text, MAX(h.action_date)
+		FROM household_members m
+		LEFT JOIN plant_care_history h
+			ON COALESCE(h.performed_by, h.user_id::text) = m.user_id::text
+			AND h.plant_id IN (SELECT plant_id FROM plants WHERE household_id = m.household_id)
+		WHERE m.household_id = $1 AND m.role IN ('owner', 'editor')
+		GROUP BY m.user_id, m.joined_at
+		ORDER BY m.joined_at, m.user_id
+	`
+
+	rows, err := db.Query(query, household_id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch household members: %w", err)
+	}
+	defer rows.Close()
+
+	var members []choreMember
+	for rows.Next() {
+		var member choreMember
+		if err := rows.Scan(&member.UserID, &member.LastDone); err != nil {
+			return nil, fmt.Errorf("failed to scan household member: %w", err)
+		}
+		members = append(members, member)
+	}
+
+	return members, nil
+}
+
+// Brings a schedule's assignee in line with its rotation. completed says the
+// task was just done, which is when round-robin and least-recent move on.
+// Assignees who are no longer editors in the household are replaced (or
+// dropped, without a rotation). Returns whether the assignee changed.
+func assignNext(db sqlQueryer, schedule_id int, completed bool) (bool, error) {
+	query := `
+		SELECT COALESCE(s.rotation, ''), COALESCE(s.assignee_user_id::text, ''), p.household_id
+		FROM schedule s
+		JOIN plants p ON p.plant_id = s.plant_id
+		WHERE s.schedule_id = $1
+	`
+
+	var rotation, assignee string
+	var householdID *int
+	if err := db.QueryRow(query, schedule_id).Scan(&rotation, &assignee, &householdID); err != nil {
+		return false, fmt.Errorf("failed to fetch schedule assignment: %v", err)
+	}
+	if rotation == "" && assignee == "" {
+		return false, nil
+	}
+
+	var members []choreMember
+	if householdID != nil {
+		var err error
+		if members, err = fetchChoreMembers(db, *householdID); err != nil {
+			return false, err
+		}
+	}
+
+	current := ""
+	for _, member := range members {
+		if member.UserID == assignee {
+			current = assignee
+		}
+	}
+
+	next := current
+	switch {
+	case householdID == nil || len(members) == 0:
+		next = ""
+	case rotation == RotationWeekly, rotation != "" && (completed || current == ""):
+		var err error
+		if next, err = nextAssignee(rotation, members, current, time.Now()); err != nil {
+			return false, err
+		}
+	}
+
+	if next == assignee {
+		return false, nil
+	}
+
+	_, err := db.Exec("UPDATE schedule SET assignee_user_id = NULLIF($2, '')::uuid WHERE schedule_id = $1", schedule_id, next)
+	if err != nil {
+		return false, fmt.Errorf("failed to update assignee: %v", err)
+	}
+	return true, nil
+}
+
+func (handler *DatabaseHandler) RefreshAssignments() (int, error) {
+	rows, err := handler.Db.Query("SELECT schedule_id FROM schedule WHERE assignee_user_id IS NOT NULL OR rotation IS NOT NULL")
+	if err != nil {
+		return 0, fmt.Errorf("failed to fetch assigned schedules: %w", err)
+	}
+
+	var scheduleIDs []int
+	for rows.Next() {
+		var scheduleID int
+		if err := rows.Scan(&scheduleID); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("failed to scan schedule: %w", err)
+		}
+		scheduleIDs = append(scheduleIDs, scheduleID)
+	}
+	rows.Close()
+
+	changed := 0
+	for _, scheduleID := range scheduleIDs {
+		ok, err := assignNext(handler.Db, scheduleID, false)
+		if err != nil {
+			return changed, err
+		}
+		if ok {
+			changed++
+		}
+	}
+	return changed, nil
+}
+
+// Sets who does a household schedule and how that rotates. With a rotation
+// but no assignee, the rotation picks the first one.
+func (handler *DatabaseHandler) SetAssignment(user_id string, schedule_id int, assignment Assignment) (Assignment, error) {
+	tx, err := handler.Db.Begin()
+	if err != nil {
+		return assignment, fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	var householdID *int
+	err = tx.QueryRow("SELECT p.household_id FROM schedule s JOIN plants p ON p.plant_id = s.plant_id WHERE s.user_id = $1 AND s.schedule_id = $2", user_id, schedule_id).
+		Scan(&householdID)
+	if err == sql.ErrNoRows {
+		return assignment, fmt.Errorf("no schedule found for given user and schedule_id")
+	}
+	if err != nil {
+		return assignment, fmt.Errorf("failed to fetch schedule: %v", err)
+	}
+	if householdID == nil && (assignment.AssigneeUserID != nil || assignment.Rotation != "") {
+		return assignment, fmt.Errorf("only plants in a household can be assigned")
+	}
+
+	if assignment.AssigneeUserID != nil {
+		var role string
+		err := tx.QueryRow("SELECT role FROM household_members WHERE household_id = $1 AND user_id::text = $2", *householdID, *assignment.AssigneeUserID).Scan(&role)
+		if err == sql.ErrNoRows || (err == nil && !roleAllows(role, HouseholdEditor)) {
+			return assignment, fmt.Errorf("assignee must be an editor or owner in the household")
+		}
+		if err != nil {
+			return assignment, fmt.Errorf("failed to look up assignee: %v", err)
+		}
+	}
+
+	_, err = tx.Exec("UPDATE schedule SET assignee_user_id = $2, rotation = NULLIF($3, '') WHERE schedule_id = $1", schedule_id, assignment.AssigneeUserID, assignment.Rotation)
+	if err != nil {
+		return assignment, fmt.Errorf("failed to update assignment: %v", err)
+	}
+	if _, err := assignNext(tx, schedule_id, false); err != nil {
+		return assignment, err
+	}
+
+	err = tx.QueryRow("SELECT assignee_user_id::text, COALESCE(rotation, '') FROM schedule WHERE schedule_id = $1", schedule_id).
+		Scan(&assignment.AssigneeUserID, &assignment.Rotation)
+	if err != nil {
+		return assignment, fmt.Errorf("failed to fetch assignment: %v", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return assignment, fmt.Errorf("failed to commit transaction: %v", err)
+	}
+	return assignment, nil
+}
+
+type CareHistoryItem struct {
+	Action      string     `json:"action"`
+	Notes       string     `json:"notes"`
+	PerformedBy string     `json:"performed_by"`
+	ActionDate  time.Time  `json:"action_date"`
+	DueDate     *time.Time `json:"due_date"`
+}
+
+// performed_by is filled with the owner's user id when they did it
+// themselves, so shared plants always show who it was.
+func (handler *DatabaseHandler) FetchCareHistory(user_id string, plant_id int, limit int) ([]CareHistoryItem, error) {
+	query := `
+		SELECT action, COALESCE(notes, ''), COALESCE(performed_by, user_id::text), action_date, due_date
+		FROM plant_care_history
+		WHERE user_id::text = $1 AND plant_id = $2
+		ORDER BY action_date DESC
+		LIMIT $3
+	`
+
+	rows, err := handler.Db.Query(query, user_id, plant_id, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch care history: %w", err)
+	}
+	defer rows.Close()
+
+	history := []CareHistoryItem{}
+	for rows.Next() {
+		var item CareHistoryItem
+		if err := rows.Scan(&item.Action, &item.Notes, &item.PerformedBy, &item.ActionDate, &item.DueDate); err != nil {
+			return nil, fmt.Errorf("failed to scan care history: %w", err)
+		}
+		history = append(history, item)
+	}
+
+	return history, nil
+}
+
+// Offers still marked offered past their expiry read as expired.
+const plantTransferColumns = `transfer_id, plant_id, plant_pet_name, from_user_id::text, to_email, to_user_id::text,
+	CASE WHEN status = 'offered' AND expires_at <= NOW() THEN 'expired' ELSE status END,
+	COALESCE(message, ''), expires_at, created_at, responded_at`
+
+func scanPlantTransfer(row interface{ Scan(...any) error }) (PlantTransfer, error) {
+	var transfer PlantTransfer
+	err := row.Scan(&transfer.TransferID, &transfer.PlantID, &transfer.PlantPetName, &transfer.FromUserID, &transfer.ToEmail, &transfer.ToUserID,
+		&transfer.Status, &transfer.Message, &transfer.ExpiresAt, &transfer.CreatedAt, &transfer.RespondedAt)
+	return transfer, err
+}
+
+func (handler *DatabaseHandler) OfferPlantTransfer(user_id string, plant_id int, to_email string, message string) (PlantTransfer, error) {
+	tx, err := handler.Db.Begin()
+	if err != nil {
+		return PlantTransfer{}, fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	// A lapsed offer shouldn't block a new one
+	_, err = tx.Exec("UPDATE plant_transfers SET status = 'expired' WHERE plant_id = $1 AND status = 'offered' AND expires_at <= NOW()", plant_id)
+	if err != nil {
+		return PlantTransfer{}, fmt.Errorf("failed to expire old offers: %v", err)
+	}
+
+	query := `
+		INSERT INTO plant_transfers (plant_id, plant_pet_name, from_user_id, to_email, message, status, expires_at)
+		SELECT plant_id, COALESCE(plant_pet_name, ''), user_id, $3, NULLIF($4, ''), 'offered', NOW() + $5 * INTERVAL '1 second'
+		FROM plants WHERE user_id = $1 AND plant_id = $2
+		ON CONFLICT (plant_id) WHERE status = 'offered' DO NOTHING
+		RETURNING ` + plantTransferColumns
+
+	transfer, err := scanPlantTransfer(tx.QueryRow(query, user_id, plant_id, to_email, message, int(plantTransferTTL.Seconds())))
+	if err == sql.ErrNoRows {
+		return transfer, fmt.Errorf("plant not found, or it already has a pending transfer")
+	}
+	if err != nil {
+		return transfer, fmt.Errorf("failed to offer transfer: %v", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return transfer, fmt.Errorf("failed to commit transaction: %v", err)
+	}
+	return transfer, nil
+}
+
+// Plants the user has given away or received, newest first.
+func (handler *DatabaseHandler) FetchPlantTransferEvents(user_id string) ([]PlantTransferEvent, error) {
+	query := `
+		SELECT event_id, transfer_id, user_id::text, direction, other_user_id::text, plant_id, plant_pet_name, created_at
+		FROM plant_transfer_events
+		WHERE user_id::text = $1
+		ORDER BY created_at DESC
+	`
+
+	rows, err := handler.Db.Query(query, user_id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch transfer events: %w", err)
+	}
+	defer rows.Close()
+
+	events := []PlantTransferEvent{}
+	for rows.Next() {
+		var event PlantTransferEvent
+		if err := rows.Scan(&event.EventID, &event.TransferID, &event.UserID, &event.Direction, &event.OtherUserID, &event.PlantID, &event.PlantPetName, &event.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan transfer event: %w", err)
+		}
+		events = append(events, event)
+	}
+
+	return events, nil
+}
+
+// Everything the user sent or received, plus offers waiting on their email.
+func (handler *DatabaseHandler) FetchPlantTransfers(user_id string, email string) ([]PlantTransfer, error) {
+	query := `
+		SELECT ` + plantTransferColumns + `
+		FROM plant_transfers
+		WHERE from_user_id::text = $1 OR to_user_id::text = $1
+		OR (status = 'offered' AND $2 <> '' AND LOWER(to_email) = LOWER($2))
+		ORDER BY created_at DESC
+	`
+
+	rows, err := handler.Db.Query(query, user_id, email)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch transfers: %w", err)
+	}
+	defer rows.Close()
+
+	transfers := []PlantTransfer{}
+	for rows.Next() {
+		transfer, err := scanPlantTransfer(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan transfer: %w", err)
+		}
+		transfers = append(transfers, transfer)
+	}
+
+	return transfers, nil
+}
+
+// Closes a pending offer without moving the plant. The sender cancels, the
+// recipient (matched by email) declines.
+func (handler *DatabaseHandler) closePlantTransfer(transfer_id int, status string, condition string, args ...any) (string, error) {
+	query := `
+		UPDATE plant_transfers SET status = $2, responded_at = NOW()
+		WHERE transfer_id = $1 AND status = 'offered' AND expires_at > NOW() AND ` + condition
+
+	result, err := handler.Db.Exec(query, append([]any{transfer_id, status}, args...)...)
+	if err != nil {
+		return "", fmt.Errorf("failed to update transfer: %v", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return "", fmt.Errorf("unable to check rows affected: %v", err)
+	}
+	if rowsAffected == 0 {
+		return "", fmt.Errorf("no pending transfer found for given user and transfer_id")
+	}
+
+	return "Transfer " + status, nil
+}
+
+func (handler *DatabaseHandler) CancelPlantTransfer(user_id string, transfer_id int) (string, error) {
+	return handler.closePlantTransfer(transfer_id, TransferCancelled, "from_user_id::text = $3", user_id)
+}
+
+func (handler *DatabaseHandler) DeclinePlantTransfer(email string, transfer_id int) (string, error) {
+	return handler.closePlantTransfer(transfer_id, TransferDeclined, "LOWER(to_email) = LOWER($3)", email)
+}
+
+// Moves the plant with its schedules, care and health history, photos and
+// seasonal profiles to the recipient, within their plant limit. Sensors and
+// valves are the sender's hardware, so they're detached. Both sides get a
+// care history entry.
+func (handler *DatabaseHandler) AcceptPlantTransfer(user_id string, email string, transfer_id int) (PlantTransfer, error) {
+	tx, err := handler.Db.Begin()
+	if err != nil {
+		return PlantTransfer{}, fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	query := `
+		UPDATE plant_transfers SET status = 'accepted', to_user_id = $2, responded_at = NOW()
+		WHERE transfer_id = $1 AND status = 'offered' AND expires_at > NOW() AND LOWER(to_email) = LOWER($3)
+		RETURNING ` + plantTransferColumns
+
+	transfer, err := scanPlantTransfer(tx.QueryRow(query, transfer_id, user_id, email))
+	if err == sql.ErrNoRows {
+		return transfer, fmt.Errorf("no pending transfer found for given user and transfer_id")
+	}
+	if err != nil {
+		return transfer, fmt.Errorf("failed to accept transfer: %v", err)
+	}
+	if transfer.FromUserID == user_id {
+		return transfer, fmt.Errorf("you can't transfer a plant to yourself")
+	}
+
+	var plant Plant
+	err = tx.QueryRow(`
+		SELECT plant_id, plant_name, scientific_name, species, image_url, plant_pet_name, plant_health
+		FROM plants WHERE plant_id = $1 AND user_id::text = $2 FOR UPDATE`, transfer.PlantID, transfer.FromUserID).
+		Scan(&plant.PlantID, &plant.PlantName, &plant.ScientificName, &plant.Species, &plant.ImageURL, &plant.PlantPetName, &plant.PlantHealth)
+	if err == sql.ErrNoRows {
+		return transfer, fmt.Errorf("the plant is no longer available")
+	}
+	if err != nil {
+		return transfer, fmt.Errorf("failed to fetch plant: %v", err)
+	}
+
+	count, err := countPlantsLocked(tx, user_id)
+	if err != nil {
+		return transfer, err
+	}
+	if count >= maxPlantsPerUser {
+		return transfer, fmt.Errorf("you already have the maximum of %d plants", maxPlantsPerUser)
+	}
+
+	moves := []struct {
+		table string
+		query string
+	}{
+		{"plants", "UPDATE plants SET user_id = $2, household_id = NULL WHERE plant_id = $1"},
+		{"schedule", "UPDATE schedule SET user_id = $2, assignee_user_id = NULL, rotation = NULL WHERE plant_id = $1"},
+		{"plant_care_history", "UPDATE plant_care_history SET user_id = $2 WHERE plant_id = $1"},
+		{"interval_adjustments", "UPDATE interval_adjustments SET user_id = $2 WHERE plant_id = $1"},
+		{"seasonal_profiles", "UPDATE seasonal_profiles SET user_id = $2 WHERE plant_id = $1"},
+	}
+	for _, move := range moves {
+		if _, err := tx.Exec(move.query, transfer.PlantID, user_id); err != nil {
+			return transfer, fmt.Errorf("failed to move %s: %v", move.table, err)
+		}
+	}
+
+	if _, err := tx.Exec("DELETE FROM sensors WHERE plant_id = $1", transfer.PlantID); err != nil {
+		return transfer, fmt.Errorf("failed to delete from sensors: %v", err)
+	}
+	if _, err := tx.Exec("UPDATE valves SET plant_ids = array_remove(plant_ids, $1) WHERE $1 = ANY(plant_ids)", transfer.PlantID); err != nil {
+		return transfer, fmt.Errorf("failed to unlink valves: %v", err)
+	}
+
+	// The plant's history goes with the plant, so the sender's audit entry
+	// lives in plant_transfer_events instead
+	entry := CareHistoryEntry{UserID: user_id, PlantID: transfer.PlantID, Action: "transfer", Notes: "Received from " + transfer.FromUserID}
+	if err := insertCareHistory(tx, entry); err != nil {
+		return transfer, err
+	}
+	for _, event := range plantTransferEvents(transfer, user_id) {
+		_, err := tx.Exec(`
+			INSERT INTO plant_transfer_events (transfer_id, user_id, direction, other_user_id, plant_id, plant_pet_name)
+			VALUES ($1, $2, $3, $4, $5, $6)`,
+			event.TransferID, event.UserID, event.Direction, event.OtherUserID, event.PlantID, event.PlantPetName)
+		if err != nil {
+			return transfer, fmt.Errorf("failed to record transfer event: %v", err)
+		}
+	}
+
+	if err := enqueueWebhookEvent(tx, transfer.FromUserID, WebhookPlantDeleted, map[string]any{"plant_id": transfer.PlantID, "transferred_to": user_id}); err != nil {
+		return transfer, err
+	}
+	if err := enqueueWebhookEvent(tx, user_id, WebhookPlantCreated, plant); err != nil {
+		return transfer, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return transfer, fmt.Errorf("failed to commit transaction: %v", err)
+	}
+	notifyPlantChanged(transfer.FromUserID)
+	notifyPlantChanged(user_id)
+
+	transfer.Status = TransferAccepted
+	return transfer, nil
+}
+
+type MergeResult struct {
+	PlantsMoved    int `json:"plants_moved"`
+	SchedulesMoved int `json:"schedules_moved"`
+}
+
+// Moves everything the anonymous user built up to the permanent account in
+// one transaction, then deletes what's left of the anonymous user. Fails
+// without changing anything if the plants wouldn't fit the permanent
+// account's limit.
+func (handler *DatabaseHandler) MergeAccounts(anonymous_id string, user_id string) (MergeResult, error) {
+	var result MergeResult
+
+	tx, err := handler.Db.Begin()
+	if err != nil {
+		return result, fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	// Locked in a fixed order so two merges can't deadlock
+	owners := []string{anonymous_id, user_id}
+	slices.Sort(owners)
+	total := 0
+	for _, owner := range owners {
+		count, err := countPlantsLocked(tx, owner)
+		if err != nil {
+			return result, err
+		}
+		total += count
+	}
+	if total > maxPlantsPerUser {
+		return result, fmt.Errorf("merging would give you %d plants, the limit is %d", total, maxPlantsPerUser)
+	}
+
+	moves := []struct {
+		table string
+		query string
+	}{
+		// Plants stay in a household only if the permanent account is in it too
+		{"plants", `UPDATE plants SET user_id = $2,
+			household_id = CASE WHEN household_id IN (SELECT household_id FROM household_members WHERE user_id::text = $2) THEN household_id END
+			WHERE user_id::text = $1`},
+		{"schedule", "UPDATE schedule SET user_id = $2 WHERE user_id::text = $1"},
+		{"plant_classifications", "UPDATE plant_classifications SET user_id = $2 WHERE user_id::text = $1"},
+		{"species_corrections", "UPDATE species_corrections SET user_id = $2 WHERE user_id::text = $1"},
+		{"plant_care_history", "UPDATE plant_care_history SET user_id = $2 WHERE user_id::text = $1"},
+		{"interval_adjustments", "UPDATE interval_adjustments SET user_id = $2 WHERE user_id::text = $1"},
+		{"seasonal_profiles", "UPDATE seasonal_profiles SET user_id = $2 WHERE user_id::text = $1"},
+		{"plant_transfer_events", "UPDATE plant_transfer_events SET user_id = $2 WHERE user_id::text = $1"},
+		{"sensors", "UPDATE sensors SET user_id = $2 WHERE user_id::text = $1"},
+		{"valves", "UPDATE valves SET user_id = $2 WHERE user_id::text = $1"},
+		{"user_locations", "UPDATE user_locations SET user_id = $2 WHERE user_id::text = $1 AND NOT EXISTS (SELECT 1 FROM user_locations WHERE user_id::text = $2)"},
+	}
+	for _, move := range moves {
+		moved, err := tx.Exec(move.query, anonymous_id, user_id)
+		if err != nil {
+			return result, fmt.Errorf("failed to move %s: %v", move.table, err)
+		}
+		n, _ := moved.RowsAffected()
+		switch move.table {
+		case "plants":
+			result.PlantsMoved = int(n)
+		case "schedule":
+			result.SchedulesMoved = int(n)
+		}
+	}
+
+	// Settings, devices and integrations belonged to a throwaway session
+	cleanup := []struct {
+		table string
+		query string
+	}{
+		{"user_locations", "DELETE FROM user_locations WHERE user_id::text = $1"},
+		{"user_settings", "DELETE FROM user_settings WHERE user_id::text = $1"},
+		{"notification_preferences", "DELETE FROM notification_preferences WHERE user_id::text = $1"},
+		{"device_tokens", "DELETE FROM device_tokens WHERE user_id::text = $1"},
+		{"notification_log", "DELETE FROM notification_log WHERE recipient_id::text = $1"},
+		{"notification_deliveries", "DELETE FROM notification_deliveries WHERE recipient_id::text = $1"},
+		{"vacations", "DELETE FROM vacations WHERE user_id::text = $1"},
+		{"webhook_outbox", "DELETE FROM webhook_outbox WHERE user_id::text = $1"},
+		{"webhook_endpoints", "DELETE FROM webhook_endpoints WHERE user_id::text = $1"},
+		{"personal_access_tokens", "DELETE FROM personal_access_tokens WHERE user_id::text = $1"},
+		{"households", `DELETE FROM households h
+			WHERE h.household_id IN (SELECT household_id FROM household_members WHERE user_id::text = $1)
+			AND NOT EXISTS (SELECT 1 FROM household_members m WHERE m.household_id = h.household_id AND m.user_id::text <> $1)`},
+		{"household_members", "DELETE FROM household_members WHERE user_id::text = $1"},
+		{"plant_transfers", "UPDATE plant_transfers SET status = 'cancelled', responded_at = NOW() WHERE from_user_id::text = $1 AND status = 'offered'"},
+	}
+	for _, step := range cleanup {
+		if _, err := tx.Exec(step.query, anonymous_id); err != nil {
+			return result, fmt.Errorf("failed to clean up %s: %v", step.table, err)
+		}
+	}
+
+	_, err = tx.Exec("INSERT INTO account_merges (anonymous_id, user_id, plants_moved) VALUES ($1, $2, $3)", anonymous_id, user_id, result.PlantsMoved)
+	if err != nil {
+		return result, fmt.Errorf("failed to record merge: %v", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return result, fmt.Errorf("failed to commit transaction: %v", err)
+	}
+	notifyPlantChanged(anonymous_id)
+	notifyPlantChanged(user_id)
+
+	return result, nil
+}
+
+// Rows the user can download from /account/export.
+func (handler *DatabaseHandler) ExportAccount(user_id string) ([]exportTable, error) {
+	userPlants := "plant_id IN (SELECT plant_id FROM plants WHERE user_id::text = $1)"
+	queries := []struct {
+		name  string
+		query string
+	}{
+		{"plants", "SELECT * FROM plants WHERE user_id::text = $1 ORDER BY plant_id"},
+		{"schedules", "SELECT * FROM schedule WHERE user_id::text = $1 ORDER BY schedule_id"},
+		{"care_history", "SELECT * FROM plant_care_history WHERE user_id::text = $1 ORDER BY action_date, history_id"},
+		{"health_records", "SELECT * FROM plant_health WHERE " + userPlants + " ORDER BY scan_date, health_id"},
+		{"photos", `SELECT plant_id, 'plant' AS source, image_url AS url, added_at AS taken_at
+			FROM plants WHERE user_id::text = $1 AND COALESCE(image_url, '') <> ''
+			UNION ALL
+			SELECT plant_id, 'health_scan', image_url, scan_date
+			FROM plant_health WHERE ` + userPlants + ` AND COALESCE(image_url, '') <> ''
+			ORDER BY plant_id, taken_at`},
+	}
+
+	var tables []exportTable
+	for _, q := range queries {
+		table, err := scanExportTable(handler.Db, q.name, q.query, user_id)
+		if err != nil {
+			return nil, err
+		}
+		tables = append(tables, table)
+	}
+	return tables, nil
+}
+
+// Households where the user ($1) is the only member left.
+const soleHouseholdsQuery = `SELECT h.household_id FROM households h
+	WHERE h.household_id IN (SELECT household_id FROM household_members WHERE user_id::text = $1)
+	AND NOT EXISTS (SELECT 1 FROM household_members m WHERE m.household_id = h.household_id AND m.user_id::text <> $1)`
+
+// A table holding account data and which of its rows are the user's ($1).
+// restore is the SELECT that puts the snapshot ($1) back, when rows might
+// point at something that's gone since.
+type accountTable struct {
+	name    string
+	where   string
+	restore string
+}
+
+// Parents first, the order a restore inserts in.
+var accountTables = []accountTable{
+	{name: "households", where: "household_id IN (" + soleHouseholdsQuery + ")"},
+	{name: "household_members", where: "user_id::text = $1",
+		restore: "SELECT * FROM jsonb_populate_recordset(NULL::household_members, $1::jsonb) WHERE household_id IN (SELECT household_id FROM households)"},
+	{name: "household_invites", where: "household_id IN (" + soleHouseholdsQuery + ")",
+		restore: "SELECT * FROM jsonb_populate_recordset(NULL::household_invites, $1::jsonb) WHERE household_id IN (SELECT household_id FROM households)"},
+	{name: "plants", where: "user_id::text = $1",
+		restore: `SELECT (jsonb_populate_record(NULL::plants, CASE
+			WHEN (r->>'household_id')::int IN (SELECT household_id FROM households) THEN r
+			ELSE r || '{"household_id": null}' END)).*
+			FROM jsonb_array_elements($1::jsonb) r`},
+	{name: "plant_classifications", where: "user_id::text = $1"},
+	{name: "species_corrections", where: "user_id::text = $1"},
+	{name: "schedule", where: "user_id::text = $1"},
+	{name: "plant_health", where: "plant_id IN (SELECT plant_id FROM plants WHERE user_id::text = $1)"},
+	{name: "plant_care_history", where: "user_id::text = $1"},
+	{name: "interval_adjustments", where: "user_id::text = $1"},
+	{name: "seasonal_profiles", where: "user_id::text = $1"},
+	{name: "plant_transfer_events", where: "user_id::text = $1"},
+	{name: "sensors", where: "user_id::text = $1"},
+	{name: "sensor_readings", where: "sensor_id IN (SELECT sensor_id FROM sensors WHERE user_id::text = $1)"},
+	{name: "valves", where: "user_id::text = $1"},
+	{name: "irrigation_runs", where: "valve_id IN (SELECT valve_id FROM valves WHERE user_id::text = $1)"},
+	{name: "user_locations", where: "user_id::text = $1"},
+	{name: "user_settings", where: "user_id::text = $1"},
+	{name: "notification_preferences", where: "user_id::text = $1"},
+	{name: "device_tokens", where: "user_id::text = $1"},
+	{name: "vacations", where: "user_id::text = $1"},
+	{name: "webhook_endpoints", where: "user_id::text = $1"},
+	{name: "personal_access_tokens", where: "user_id::text = $1"},
+}
+
+// Deleted along with the account but not worth bringing back.
+var accountLogTables = []accountTable{
+	{name: "notification_log", where: "recipient_id::text = $1"},
+	{name: "notification_deliveries", where: "recipient_id::text = $1"},
+	{name: "webhook_outbox", where: "user_id::text = $1"},
+}
+
+// Removes all of the user's rows in one transaction, keeping a snapshot so
+// RestoreAccount can undo it until the grace period runs out. Their photos
+// are queued for deletion from storage once it does.
+func (handler *DatabaseHandler) DeleteAccount(user_id string) (AccountDeletion, error) {
+	var deletion AccountDeletion
+
+	tx, err := handler.Db.Begin()
+	if err != nil {
+		return deletion, fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	snapshot := map[string]json.RawMessage{}
+	for _, table := range accountTables {
+		var rows []byte
+		query := fmt.Sprintf("SELECT COALESCE(jsonb_agg(to_jsonb(%s)), '[]'::jsonb) FROM %s WHERE %s", table.name, table.name, table.where)
+		if err := tx.QueryRow(query, user_id).Scan(&rows); err != nil {
+			return deletion, fmt.Errorf("failed to snapshot %s: %v", table.name, err)
+		}
+		snapshot[table.name] = rows
+	}
+
+	snapshotJSON, err := json.Marshal(snapshot)
+	if err != nil {
+		return deletion, fmt.Errorf("failed to marshal snapshot: %v", err)
+	}
+
+	err = tx.QueryRow(`
+		INSERT INTO account_deletions (user_id, snapshot, status, purge_after)
+		VALUES ($1, $2::jsonb, $3, NOW() + $4 * INTERVAL '1 second')
+		RETURNING deletion_id, status, requested_at, purge_after`,
+		user_id, string(snapshotJSON), AccountDeletionPending, int(accountDeletionGrace.Seconds()),
+	).Scan(&deletion.DeletionID, &deletion.Status, &deletion.RequestedAt, &deletion.PurgeAfter)
+	if err != nil {
+		return deletion, fmt.Errorf("failed to record deletion: %v", err)
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO storage_deletions (deletion_id, url)
+		SELECT $1, url FROM (
+			SELECT image_url AS url FROM plants WHERE user_id::text = $2
+			UNION
+			SELECT image_url FROM plant_health WHERE plant_id IN (SELECT plant_id FROM plants WHERE user_id::text = $2)
+		) urls
+		WHERE COALESCE(url, '') <> ''`, deletion.DeletionID, user_id)
+	if err != nil {
+		return deletion, fmt.Errorf("failed to queue storage deletions: %v", err)
+	}
+
+	// Same as MergeAccounts, open offers can't be accepted once the plant is gone
+	_, err = tx.Exec("UPDATE plant_transfers SET status = 'cancelled', responded_at = NOW() WHERE from_user_id::text = $1 AND status = 'offered'", user_id)
+	if err != nil {
+		return deletion, fmt.Errorf("failed to cancel transfers: %v", err)
+	}
+
+	// Households go first, while the memberships that say which ones were
+	// the user's alone still exist. The rest go children first, the same
+	// cascade DeletePlant does per plant.
+	order := append([]accountTable{accountTables[0]}, accountLogTables...)
+	for i := len(accountTables) - 1; i > 0; i-- {
+		order = append(order, accountTables[i])
+	}
+	for _, table := range order {
+		if _, err := tx.Exec(fmt.Sprintf("DELETE FROM %s WHERE %s", table.name, table.where), user_id); err != nil {
+			return deletion, fmt.Errorf("failed to delete from %s: %v", table.name, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return deletion, fmt.Errorf("failed to commit transaction: %v", err)
+	}
+	notifyPlantChanged(user_id)
+
+	return deletion, nil
+}
+
+// Puts back the user's most recent deletion if it's still in its grace
+// period. Rows that would clash with anything added since are skipped.
+func (handler *DatabaseHandler) RestoreAccount(user_id string) (AccountDeletion, error) {
+	var deletion AccountDeletion
+
+	tx, err := handler.Db.Begin()
+	if err != nil {
+		return deletion, fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	var snapshotJSON []byte
+	var snapshotPlants int
+	err = tx.QueryRow(`
+		SELECT deletion_id, requested_at, purge_after, snapshot, COALESCE(jsonb_array_length(snapshot->'plants'), 0)
+		FROM account_deletions
+		WHERE user_id::text = $1 AND status = $2 AND purge_after > NOW()
+		ORDER BY requested_at DESC
+		LIMIT 1
+		FOR UPDATE`, user_id, AccountDeletionPending,
+	).Scan(&deletion.DeletionID, &deletion.RequestedAt, &deletion.PurgeAfter, &snapshotJSON, &snapshotPlants)
+	if err == sql.ErrNoRows {
+		return deletion, fmt.Errorf("no deleted account to restore, or the grace period has ended")
+	}
+	if err != nil {
+		return deletion, fmt.Errorf("failed to fetch deletion: %v", err)
+	}
+
+	var snapshot map[string]json.RawMessage
+	if err := json.Unmarshal(snapshotJSON, &snapshot); err != nil {
+		return deletion, fmt.Errorf("failed to read snapshot: %v", err)
+	}
+
+	// Counting anything added since the delete
+	current, err := countPlantsLocked(tx, user_id)
+	if err != nil {
+		return deletion, err
+	}
+	if current+snapshotPlants > maxPlantsPerUser {
+		return deletion, fmt.Errorf("restoring would give you %d plants, the limit is %d", current+snapshotPlants, maxPlantsPerUser)
+	}
+
+	for _, table := range accountTables {
+		rows, ok := snapshot[table.name]
+		if !ok {
+			continue
+		}
+		source := table.restore
+		if source == "" {
+			source = fmt.Sprintf("SELECT * FROM jsonb_populate_recordset(NULL::%s, $1::jsonb)", table.name)
+		}
+		if _, err := tx.Exec("INSERT INTO "+table.name+" "+source+" ON CONFLICT DO NOTHING", string(rows)); err != nil {
+			return deletion, fmt.Errorf("failed to restore %s: %v", table.name, err)
+		}
+	}
+
+	_, err = tx.Exec("UPDATE storage_deletions SET status = 'kept' WHERE deletion_id = $1 AND status = 'pending'", deletion.DeletionID)
+	if err != nil {
+		return deletion, fmt.Errorf("failed to cancel storage deletions: %v", err)
+	}
+
+	_, err = tx.Exec("UPDATE account_deletions SET status = $2, snapshot = NULL, resolved_at = NOW() WHERE deletion_id = $1", deletion.DeletionID, AccountDeletionRestored)
+	if err != nil {
+		return deletion, fmt.Errorf("failed to update deletion: %v", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return deletion, fmt.Errorf("failed to commit transaction: %v", err)
+	}
+	notifyPlantChanged(user_id)
+
+	deletion.Status = AccountDeletionRestored
+	return deletion, nil
+}
+
+// Drops the snapshot of every deletion past its grace period, which makes
+// its photos due for removal.
+func (handler *DatabaseHandler) PurgeAccountDeletions() (int, error) {
+	result, err := handler.Db.Exec(`
+		UPDATE account_deletions
+		SET status = $1, snapshot = NULL, resolved_at = NOW()
+		WHERE status = $2 AND purge_after <= NOW()`, AccountDeletionPurged, AccountDeletionPending)
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge deletions: %v", err)
+	}
+	purged, _ := result.RowsAffected()
+	return int(purged), nil
+}
+
+func (handler *DatabaseHandler) FetchDueStorageDeletions(limit int) ([]storageObject, error) {
+	rows, err := handler.Db.Query(`
+		SELECT s.storage_deletion_id, s.url, s.attempts,
+			EXISTS (SELECT 1 FROM plants WHERE image_url = s.url) OR EXISTS (SELECT 1 FROM plant_health WHERE image_url = s.url)
+		FROM storage_deletions s
+		JOIN account_deletions d ON d.deletion_id = s.deletion_id
+		WHERE s.status = 'pending' AND d.status = $1
+		ORDER BY s.storage_deletion_id
+		LIMIT $2`, AccountDeletionPurged, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch storage deletions: %v", err)
+	}
+	defer rows.Close()
+
+	var objects []storageObject
+	for rows.Next() {
+		var object storageObject
+		if err := rows.Scan(&object.ID, &object.URL, &object.Attempts, &object.StillUsed); err != nil {
+			return nil, fmt.Errorf("failed to scan storage deletion: %v", err)
+		}
+		objects = append(objects, object)
+	}
+	return objects, nil
+}
+
+func (handler *DatabaseHandler) RecordStorageDeletion(storage_deletion_id int, status string, delete_err error) error {
+	var errorText *string
+	attempted := 0
+	if delete_err != nil {
+		text := delete_err.Error()
+		errorText = &text
+		attempted = 1
+	}
+
+	_, err := handler.Db.Exec(`
+		UPDATE storage_deletions
+		SET status = $2, attempts = attempts + $3, last_error = $4,
+			deleted_at = CASE WHEN $2 = 'deleted' THEN NOW() END
+		WHERE storage_deletion_id = $1`, storage_deletion_id, status, attempted, errorText)
+	if err != nil {
+		return fmt.Errorf("failed to record storage deletion: %v", err)
+	}
+	return nil
+}
+
+func (handler *DatabaseHandler) CountPlants(user_id string) (int, error) {
+	var count int
+	err := handler.Db.QueryRow("SELECT COUNT(*) FROM plants WHERE user_id::text = $1", user_id).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count plants: %v", err)
+	}
+	return count, nil
+}
+
+// The most common names and starting interval of plants already identified
+// as this species (by any name), so imports of known species don't need the
+// AI. found is false if we haven't seen it.
+func (handler *DatabaseHandler) KnownSpeciesDefaults(name string) (SpeciesDefaults, bool, error) {
+	var defaults SpeciesDefaults
+	var plantName, scientificName, species sql.NullString
+	var repeatDays sql.NullInt64
+
+	err := handler.Db.QueryRow(`
+		SELECT mode() WITHIN GROUP (ORDER BY p.plant_name),
+			mode() WITHIN GROUP (ORDER BY p.scientific_name),
+			mode() WITHIN GROUP (ORDER BY p.species),
+			mode() WITHIN GROUP (ORDER BY s.initial_repeat_days)
+		FROM plants p
+		JOIN schedule s ON s.plant_id = p.plant_id
+		WHERE s.initial_repeat_days IS NOT NULL
+		AND p.species <> 'Unknown'
+		AND $1 IN (LOWER(p.species), LOWER(p.scientific_name), LOWER(p.plant_name))`,
+		strings.ToLower(strings.TrimSpace(name)),
+	).Scan(&plantName, &scientificName, &species, &repeatDays)
+	if err != nil {
+		return defaults, false, fmt.Errorf("failed to look up species: %v", err)
+	}
+	if !repeatDays.Valid {
+		return defaults, false, nil
+	}
+
+	defaults = SpeciesDefaults{
+		PlantName:      plantName.String,
+		ScientificName: scientificName.String,
+		Species:        species.String,
+		RepeatDays:     int(repeatDays.Int64),
+	}
+	return defaults, true, nil
+}
+
+// Creates a plant, schedule and care history for each validated import
+// row, all or nothing. Sets PlantID on the rows.
+func (handler *DatabaseHandler) ImportPlants(user_id string, rows []ImportRowResult) error {
+	tx, err := handler.Db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	// Checked again in case plants were added since the rows were validated
+	count, err := countPlantsLocked(tx, user_id)
+	if err != nil {
+		return err
+	}
+	if count+len(rows) > maxPlantsPerUser {
+		return fmt.Errorf("importing would give you %d plants, the limit is %d", count+len(rows), maxPlantsPerUser)
+	}
+
+	for i, row := range rows {
+		plant := Plant{
+			PlantName:      row.PlantName,
+			ScientificName: row.ScientificName,
+			Species:        row.Species,
+			ImageURL:       row.PhotoURL,
+			PlantPetName:   row.PetName,
+			PlantHealth:    100,
+			SpeciesID:      row.SpeciesID,
+		}
+		var metadata []byte
+		if len(row.Metadata) > 0 {
+			if metadata, err = json.Marshal(row.Metadata); err != nil {
+				return fmt.Errorf("failed to marshal metadata on line %d: %v", row.Line, err)
+			}
+		}
+
+		err := tx.QueryRow(`
+			INSERT INTO plants (user_id, plant_name, scientific_name, species, image_url, plant_pet_name, plant_health, import_metadata, species_id)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8::jsonb, $9)
+			RETURNING plant_id`,
+			user_id, plant.PlantName, plant.ScientificName, plant.Species, plant.ImageURL, plant.PlantPetName, plant.PlantHealth, metadata, plant.SpeciesID,
+		).Scan(&plant.PlantID)
+		if err != nil {
+			return fmt.Errorf("failed to insert plant on line %d: %v", row.Line, err)
+		}
+		rows[i].PlantID = plant.PlantID
+
+		// Picks up from the last watering if we know it, otherwise it's due today
+		_, err = tx.Exec(`
+			INSERT INTO schedule (
+				user_id, plant_id, plant_pet_name, water_is_completed, water_repeat_every, water_repeat_unit,
+				base_repeat_every, initial_repeat_days, watering_date, next_watering_date
+			)
+			VALUES ($1, $2, $3, false, $4, $5, $4, $6, COALESCE($7::date, CURRENT_DATE),
+				CASE WHEN $7::date IS NULL THEN CURRENT_DATE ELSE $7::date + ($4::text || ' ' || $5)::interval END)`,
+			user_id, plant.PlantID, row.PetName, row.WaterRepeatEvery, row.WaterRepeatUnit,
+			intervalInDays(row.WaterRepeatEvery, row.WaterRepeatUnit), row.LastWatered,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to create schedule on line %d: %v", row.Line, err)
+		}
+
+		loggedLastWatering := false
+		for _, entry := range row.CareLog {
+			entry.UserID, entry.PlantID = user_id, plant.PlantID
+			if err := insertCareHistory(tx, entry); err != nil {
+				return err
+			}
+			if entry.Action == "water" && row.LastWatered != nil && entry.ActionDate.Equal(*row.LastWatered) {
+				loggedLastWatering = true
+			}
+		}
+
+		if row.LastWatered != nil && !loggedLastWatering {
+			entry := CareHistoryEntry{UserID: user_id, PlantID: plant.PlantID, Action: "water", Notes: "Imported", ActionDate: row.LastWatered}
+			if err := insertCareHistory(tx, entry); err != nil {
+				return err
+			}
+		}
+
+		if err := enqueueWebhookEvent(tx, user_id, WebhookPlantCreated, plant); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %v", err)
+	}
+	notifyPlantChanged(user_id)
+
+	return nil
+}
+
+// Inserts new catalog entries and updates existing ones, matched on slug.
+func (handler *DatabaseHandler) SeedSpeciesCatalog(catalog []CatalogSpecies) (int, error) {
+	tx, err := handler.Db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	for _, species := range catalog {
+		_, err := tx.Exec(`
+			INSERT INTO species (slug, common_name, scientific_name, family, care_group, synonyms, water_every_days, fertilize_every_days, light)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+			ON CONFLICT (slug) DO UPDATE SET
+				common_name = EXCLUDED.common_name,
+				scientific_name = EXCLUDED.scientific_name,
+				family = EXCLUDED.family,
+				care_group = EXCLUDED.care_group,
+				synonyms = EXCLUDED.synonyms,
+				water_every_days = EXCLUDED.water_every_days,
+				fertilize_every_days = EXCLUDED.fertilize_every_days,
+				light = EXCLUDED.light`,
+			species.Slug, species.CommonName, species.ScientificName, species.Family, species.CareGroup,
+			pq.Array(species.Synonyms), species.WaterEveryDays, species.FertilizeEveryDays, species.Light,
+		)
+		if err != nil {
+			return 0, fmt.Errorf("failed to seed species %s: %v", species.Slug, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit transaction: %v", err)
+	}
+	return len(catalog), nil
+}
+
+const speciesColumns = `species_id, slug, common_name, scientific_name, family, care_group, synonyms, water_every_days, fertilize_every_days, light`
+
+func scanSpecies(row interface{ Scan(...any) error }) (CatalogSpecies, error) {
+	var species CatalogSpecies
+	err := row.Scan(&species.SpeciesID, &species.Slug, &species.CommonName, &species.ScientificName, &species.Family, &species.CareGroup,
+		pq.Array(&species.Synonyms), &species.WaterEveryDays, &species.FertilizeEveryDays, &species.Light)
+	return species, err
+}
+
+// Exact matches on common name, scientific name or a synonym come first,
+// then prefix matches, then the name appearing anywhere.
+func (handler *DatabaseHandler) SearchSpecies(query string, limit int) ([]CatalogSpecies, error) {
+	pattern := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(strings.ToLower(strings.TrimSpace(query)))
+
+	rows, err := handler.Db.Query(`
+		SELECT `+speciesColumns+` FROM (
+			SELECT s.*, (
+				SELECT MIN(CASE
+					WHEN LOWER(name) = $1 THEN 0
+					WHEN LOWER(name) LIKE $1 || '%' THEN 1
+					WHEN LOWER(name) LIKE '%' || $1 || '%' THEN 2
+				END)
+				FROM unnest(s.synonyms || ARRAY[s.common_name, s.scientific_name]::text[]) AS name
+			) AS rank
+			FROM species s
+		) ranked
+		WHERE rank IS NOT NULL
+		ORDER BY rank, common_name
+		LIMIT $2`, pattern, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search species: %v", err)
+	}
+	defer rows.Close()
+
+	results := []CatalogSpecies{}
+	for rows.Next() {
+		species, err := scanSpecies(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan species: %v", err)
+		}
+		results = append(results, species)
+	}
+	return results, nil
+}
+
+func (handler *DatabaseHandler) FetchSpecies(species_id int) (CatalogSpecies, error) {
+	species, err := scanSpecies(handler.Db.QueryRow("SELECT "+speciesColumns+" FROM species WHERE species_id = $1", species_id))
+	if err == sql.ErrNoRows {
+		return species, fmt.Errorf("no species found for given species_id")
+	}
+	if err != nil {
+		return species, fmt.Errorf("failed to fetch species: %v", err)
+	}
+	return species, nil
+}
+
+// The catalog species matching any of the names exactly (ignoring case), by
+// scientific name, common name or synonym. Earlier names win. nil if none
+// match.
+func (handler *DatabaseHandler) ResolveSpecies(names ...string) (*CatalogSpecies, error) {
+	for _, name := range speciesCandidates(names...) {
+		species, err := scanSpecies(handler.Db.QueryRow(`
+			SELECT `+speciesColumns+` FROM species
+			WHERE LOWER(scientific_name) = $1 OR LOWER(common_name) = $1
+				OR EXISTS (SELECT 1 FROM unnest(synonyms) AS synonym WHERE LOWER(synonym) = $1)
+			ORDER BY LOWER(scientific_name) = $1 DESC, LOWER(common_name) = $1 DESC, species_id
+			LIMIT 1`, name))
+		if err == sql.ErrNoRows {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve species: %v", err)
+		}
+		return &species, nil
+	}
+	return nil, nil
+}
+
+// Keeps what the AI said about a new plant's photo, so a later correction
+// can be paired with it.
+func (handler *DatabaseHandler) RecordClassification(user_id string, plant_id int, image_url string, classification PlantClassification, species_id *int) error {
+	output, err := json.Marshal(classification)
+	if err != nil {
+		return fmt.Errorf("failed to encode classification: %v", err)
+	}
+
+	_, err = handler.Db.Exec(`
+		INSERT INTO plant_classifications (user_id, plant_id, image_url, output, species_id)
+		VALUES ($1, $2, $3, $4, $5)`,
+		user_id, plant_id, image_url, string(output), species_id)
+	if err != nil {
+		return fmt.Errorf("failed to record classification: %v", err)
+	}
+	return nil
+}
+
+// Renames the plant to the corrected species and stores the correction
+// against its latest classification. With regenerate_every > 0 the
+// schedules get that interval, unless the user set one by hand.
+func (handler *DatabaseHandler) CorrectPlantSpecies(owner_id string, corrected_by string, plant_id int, correction SpeciesCorrection, regenerate_every int) (SpeciesCorrection, error) {
+	tx, err := handler.Db.Begin()
+	if err != nil {
+		return correction, fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	var imageURL sql.NullString
+	err = tx.QueryRow(`
+		SELECT COALESCE(plant_name, ''), COALESCE(scientific_name, ''), COALESCE(species, ''), species_id, image_url
+		FROM plants
+		WHERE user_id = $1 AND plant_id = $2
+		FOR UPDATE`, owner_id, plant_id).Scan(
+		&correction.OriginalPlantName, &correction.OriginalScientificName, &correction.OriginalSpecies,
+		&correction.OriginalSpeciesID, &imageURL)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return correction, fmt.Errorf("plant with ID %d not found for user %s", plant_id, owner_id)
+		}
+		return correction, fmt.Errorf("failed to fetch plant: %v", err)
+	}
+	correction.PlantID = &plant_id
+	correction.ImageURL = imageURL.String
+
+	// Plants added by hand or imported have nothing to pair with
+	var classificationID sql.NullInt64
+	var output []byte
+	var classifiedImage sql.NullString
+	err = tx.QueryRow(`
+		SELECT classification_id, output, image_url
+		FROM plant_classifications
+		WHERE plant_id = $1
+		ORDER BY created_at DESC, classification_id DESC
+		LIMIT 1`, plant_id).Scan(&classificationID, &output, &classifiedImage)
+	if err != nil && err != sql.ErrNoRows {
+		return correction, fmt.Errorf("failed to fetch classification: %v", err)
+	}
+	if classificationID.Valid {
+		correction.OriginalOutput = output
+		if classifiedImage.String != "" {
+			correction.ImageURL = classifiedImage.String
+		}
+	}
+
+	_, err = tx.Exec(`
+		UPDATE plants SET plant_name = $2, scientific_name = $3, species = $4, species_id = $5
+		WHERE plant_id = $1`,
+		plant_id, correction.PlantName, correction.ScientificName, correction.Species, correction.SpeciesID)
+	if err != nil {
+		return correction, fmt.Errorf("failed to update plant: %v", err)
+	}
+
+	if regenerate_every > 0 {
+		rows, err := tx.Query(`
+			SELECT schedule_id, COALESCE(interval_overridden, false), COALESCE(season_multiplier_override, season_multiplier, 1)
+			FROM schedule
+			WHERE plant_id = $1
+			FOR UPDATE`, plant_id)
+		if err != nil {
+			return correction, fmt.Errorf("failed to fetch schedules: %v", err)
+		}
+
+		type scheduleRow struct {
+			id         int
+			overridden bool
+			multiplier float64
+		}
+		var schedules []scheduleRow
+		for rows.Next() {
+			var row scheduleRow
+			if err := rows.Scan(&row.id, &row.overridden, &row.multiplier); err != nil {
+				rows.Close()
+				return correction, fmt.Errorf("failed to scan schedule: %v", err)
+			}
+			schedules = append(schedules, row)
+		}
+		rows.Close()
+
+		for _, schedule := range schedules {
+			if schedule.overridden {
+				continue
+			}
+			if err := applyInterval(tx, schedule.id, regenerate_every, "day", schedule.multiplier); err != nil {
+				return correction, err
+			}
+			// Adaptive tuning measures from the new species' interval
+			if _, err := tx.Exec("UPDATE schedule SET initial_repeat_days = $2 WHERE schedule_id = $1", schedule.id, regenerate_every); err != nil {
+				return correction, fmt.Errorf("failed to reset initial interval: %v", err)
+			}
+			if _, err := tx.Exec("UPDATE interval_adjustments SET status = 'dismissed' WHERE schedule_id = $1 AND status = 'suggested'", schedule.id); err != nil {
+				return correction, fmt.Errorf("failed to dismiss pending adjustments: %v", err)
+			}
+			correction.ScheduleRegenerated = true
+		}
+	}
+
+	var originalOutput any
+	if len(correction.OriginalOutput) > 0 {
+		originalOutput = string(correction.OriginalOutput)
+	}
+	err = tx.QueryRow(`
+		INSERT INTO species_corrections (
+			user_id, plant_id, classification_id, image_url, original_output,
+			original_plant_name, original_scientific_name, original_species, original_species_id,
+			plant_name, scientific_name, species, species_id, schedule_regenerated
+		)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14)
+		RETURNING correction_id, created_at`,
+		owner_id, plant_id, classificationID, correction.ImageURL, originalOutput,
+		correction.OriginalPlantName, correction.OriginalScientificName, correction.OriginalSpecies, correction.OriginalSpeciesID,
+		correction.PlantName, correction.ScientificName, correction.Species, correction.SpeciesID, correction.ScheduleRegenerated,
+	).Scan(&correction.CorrectionID, &correction.CreatedAt)
+	if err != nil {
+		return correction, fmt.Errorf("failed to record correction: %v", err)
+	}
+
+	notes := fmt.Sprintf("species corrected from %s to %s", correction.OriginalScientificName, correction.ScientificName)
+	if err := recordCareHistoryBy(tx, owner_id, plant_id, "species_correction", notes, memberAttribution(owner_id, corrected_by)); err != nil {
+		return correction, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return correction, fmt.Errorf("failed to commit transaction: %v", err)
+	}
+	notifyPlantChanged(owner_id)
+
+	return correction, nil
+}
+
+// Every user's corrections, oldest first, for the dataset.
+func (handler *DatabaseHandler) FetchSpeciesCorrections(since time.Time) ([]SpeciesCorrection, error) {
+	rows, err := handler.Db.Query(`
+		SELECT correction_id, plant_id, image_url, original_output,
+			original_plant_name, original_scientific_name, original_species, original_species_id,
+			plant_name, scientific_name, species, species_id, schedule_regenerated, created_at
+		FROM species_corrections
+		WHERE created_at >= $1
+		ORDER BY created_at, correction_id`, since)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch corrections: %v", err)
+	}
+	defer rows.Close()
+
+	var corrections []SpeciesCorrection
+	for rows.Next() {
+		var correction SpeciesCorrection
+		var output []byte
+		err := rows.Scan(&correction.CorrectionID, &correction.PlantID, &correction.ImageURL, &output,
+			&correction.OriginalPlantName, &correction.OriginalScientificName, &correction.OriginalSpecies, &correction.OriginalSpeciesID,
+			&correction.PlantName, &correction.ScientificName, &correction.Species, &correction.SpeciesID,
+			&correction.ScheduleRegenerated, &correction.CreatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan correction: %v", err)
+		}
+		if len(output) > 0 {
+			correction.OriginalOutput = output
+		}
+		corrections = append(corrections, correction)
+	}
+	return corrections, rows.Err()
+}
+
+// A classification counts as wrong once any correction points at it.
+func (handler *DatabaseHandler) FetchClassifierAccuracy(since time.Time) (ClassifierAccuracy, error) {
+	var accuracy ClassifierAccuracy
+	err := handler.Db.QueryRow(`
+		SELECT COUNT(*),
+			COUNT(*) FILTER (WHERE EXISTS (SELECT 1 FROM species_corrections sc WHERE sc.classification_id = c.classification_id))
+		FROM plant_classifications c
+		WHERE c.created_at >= $1`, since).Scan(&accuracy.Classifications, &accuracy.Corrected)
+	if err != nil {
+		return accuracy, fmt.Errorf("failed to measure accuracy: %v", err)
+	}
+	if accuracy.Classifications > 0 {
+		accuracy.Accuracy = 1 - float64(accuracy.Corrected)/float64(accuracy.Classifications)
+	}
+	return accuracy, nil
+}
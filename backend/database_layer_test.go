@@ -0,0 +1,56 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNextOccurrence(t *testing.T) {
+	today := time.Date(2025, time.March, 10, 15, 30, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		anchor   time.Time
+		interval int
+		want     time.Time
+	}{
+		{"anchor in the future", time.Date(2025, time.March, 20, 0, 0, 0, 0, time.UTC), 7, time.Date(2025, time.March, 20, 0, 0, 0, 0, time.UTC)},
+		{"anchor today", time.Date(2025, time.March, 10, 8, 0, 0, 0, time.UTC), 7, time.Date(2025, time.March, 10, 0, 0, 0, 0, time.UTC)},
+		{"lands on today", time.Date(2025, time.March, 3, 0, 0, 0, 0, time.UTC), 7, time.Date(2025, time.March, 10, 0, 0, 0, 0, time.UTC)},
+		{"rounds up to the next one", time.Date(2025, time.March, 1, 0, 0, 0, 0, time.UTC), 7, time.Date(2025, time.March, 15, 0, 0, 0, 0, time.UTC)},
+		{"daily", time.Date(2025, time.January, 1, 0, 0, 0, 0, time.UTC), 1, time.Date(2025, time.March, 10, 0, 0, 0, 0, time.UTC)},
+		{"across a month end", time.Date(2025, time.February, 20, 0, 0, 0, 0, time.UTC), 10, time.Date(2025, time.March, 12, 0, 0, 0, 0, time.UTC)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := nextOccurrence(tt.anchor, tt.interval, today); !got.Equal(tt.want) {
+				t.Errorf("nextOccurrence() = %s, want %s", got.Format("2006-01-02"), tt.want.Format("2006-01-02"))
+			}
+		})
+	}
+}
+
+func TestScheduleEditChangesInterval(t *testing.T) {
+	tests := []struct {
+		name string
+		edit ScheduleEdit
+		want bool
+	}{
+		{"no interval fields", ScheduleEdit{WaterAmountML: intPtr(250)}, false},
+		{"same every and unit", ScheduleEdit{WaterRepeatEvery: intPtr(7), WaterRepeatUnit: strPtr("day")}, false},
+		{"same every only", ScheduleEdit{WaterRepeatEvery: intPtr(7)}, false},
+		{"same unit only", ScheduleEdit{WaterRepeatUnit: strPtr("day")}, false},
+		{"new every", ScheduleEdit{WaterRepeatEvery: intPtr(5)}, true},
+		{"new unit", ScheduleEdit{WaterRepeatUnit: strPtr("week")}, true},
+		{"new every, same unit", ScheduleEdit{WaterRepeatEvery: intPtr(10), WaterRepeatUnit: strPtr("day")}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.edit.changesInterval(7, "day"); got != tt.want {
+				t.Errorf("changesInterval() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,292 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"mime"
+	"mime/quotedprintable"
+	"net/smtp"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Sends mail through any SMTP server. Leaving SMTP_USERNAME empty skips
+// authentication, which is what local catchers like Mailpit expect.
+type SMTPNotifier struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+	From     string
+}
+
+func NewSMTPNotifierFromEnv() *SMTPNotifier {
+	port := os.Getenv("SMTP_PORT")
+	if port == "" {
+		port = "1025"
+	}
+	host := os.Getenv("SMTP_HOST")
+	if host == "" {
+		host = "localhost"
+	}
+	from := os.Getenv("SMTP_FROM")
+	if from == "" {
+		from = "GreenThumb <reminders@greenthumb.app>"
+	}
+	return &SMTPNotifier{
+		Host:     host,
+		Port:     port,
+		Username: os.Getenv("SMTP_USERNAME"),
+		Password: os.Getenv("SMTP_PASSWORD"),
+		From:     from,
+	}
+}
+
+func (notifier *SMTPNotifier) Channel() string {
+	return "email"
+}
+
+func (notifier *SMTPNotifier) CanReach(recipient Recipient) bool {
+	return recipient.Email != ""
+}
+
+func (notifier *SMTPNotifier) Send(recipient Recipient, notification Notification) ([]DeliveryResult, error) {
+	message, err := buildEmail(notifier.From, recipient.Email, notification)
+	if err != nil {
+		return nil, err
+	}
+
+	var auth smtp.Auth
+	if notifier.Username != "" {
+		auth = smtp.PlainAuth("", notifier.Username, notifier.Password, notifier.Host)
+	}
+
+	err = smtp.SendMail(notifier.Host+":"+notifier.Port, auth, envelopeAddress(notifier.From), []string{recipient.Email}, message)
+	if err != nil {
+		return []DeliveryResult{{Target: recipient.Email, Status: "failed", Error: err.Error()}}, fmt.Errorf("failed to send email: %v", err)
+	}
+	return []DeliveryResult{{Target: recipient.Email, Status: "sent"}}, nil
+}
+
+// "Name <addr@host>" -> "addr@host"
+func envelopeAddress(from string) string {
+	if start := strings.LastIndex(from, "<"); start >= 0 {
+		return strings.TrimSuffix(from[start+1:], ">")
+	}
+	return from
+}
+
+// Builds a multipart/alternative message with the plain text body and, when
+// the notification has one, the HTML version.
+func buildEmail(from string, to string, notification Notification) ([]byte, error) {
+	var buf bytes.Buffer
+	boundary := "greenthumb-" + strconv.FormatInt(time.Now().UnixNano(), 36)
+
+	fmt.Fprintf(&buf, "From: %s\r\n", from)
+	fmt.Fprintf(&buf, "To: %s\r\n", to)
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.BEncoding.Encode("UTF-8", notification.Title))
+	fmt.Fprintf(&buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&buf, "Content-Type: multipart/alternative; boundary=%q\r\n\r\n", boundary)
+
+	parts := []struct{ contentType, body string }{{"text/plain", notification.Body}}
+	if notification.HTML != "" {
+		parts = append(parts, struct{ contentType, body string }{"text/html", notification.HTML})
+	}
+
+	for _, part := range parts {
+		fmt.Fprintf(&buf, "--%s\r\n", boundary)
+		fmt.Fprintf(&buf, "Content-Type: %s; charset=UTF-8\r\n", part.contentType)
+		buf.WriteString("Content-Transfer-Encoding: quoted-printable\r\n\r\n")
+		writer := quotedprintable.NewWriter(&buf)
+		if _, err := writer.Write([]byte(part.body)); err != nil {
+			return nil, fmt.Errorf("failed to encode email: %v", err)
+		}
+		writer.Close()
+		buf.WriteString("\r\n")
+	}
+	fmt.Fprintf(&buf, "--%s--\r\n", boundary)
+
+	return buf.Bytes(), nil
+}
+
+type DigestRecipient struct {
+	Recipient
+	LocalDate time.Time
+}
+
+type digestTask struct {
+	PlantPetName string
+	ImageURL     string
+	Status       string
+	CompleteURL  string
+}
+
+var digestTemplate = template.Must(template.New("digest").Parse(`<!DOCTYPE html>
+<html>
+<body style="font-family: sans-serif; color: #1b4332;">
+	<h2>Your garden today 🌱</h2>
+	<table cellpadding="8">
+	{{range .}}
+		<tr>
+			<td>{{if .ImageURL}}<img src="{{.ImageURL}}" width="64" height="64" style="border-radius: 8px; object-fit: cover;" alt="">{{end}}</td>
+			<td><strong>{{.PlantPetName}}</strong><br>{{.Status}}</td>
+			<td>{{if .CompleteURL}}<a href="{{.CompleteURL}}" style="background: #2d6a4f; color: #fff; padding: 8px 12px; border-radius: 6px; text-decoration: none;">Mark watered</a>{{end}}</td>
+		</tr>
+	{{end}}
+	</table>
+</body>
+</html>`))
+
+// Today's and overdue tasks from FetchSchedule, each with a signed link that
+// marks it watered. Tasks already done today are left out.
+func buildDigestNotification(user_id string, schedules []ScheduleDisplay, plants []Plant, today time.Time) (Notification, int, error) {
+	images := map[int]string{}
+	for _, plant := range plants {
+		images[plant.PlantID] = plant.ImageURL
+	}
+
+	todayDate := today.Format("2006-01-02")
+	var tasks []digestTask
+	var lines []string
+
+	for _, schedule := range schedules {
+		if schedule.WaterIsCompleted && schedule.WateringDate.Format("2006-01-02") == todayDate {
+			continue
+		}
+
+		status := "Needs water today"
+		if due := schedule.NextWateringDate.Format("2006-01-02"); due < todayDate {
+			status = "Overdue since " + schedule.NextWateringDate.Format("Jan 2")
+		}
+
+		link, err := completionLink(user_id, schedule.ScheduleID)
+		if err != nil {
+			return Notification{}, 0, err
+		}
+
+		tasks = append(tasks, digestTask{
+			PlantPetName: schedule.PlantPetName,
+			ImageURL:     images[schedule.PlantID],
+			Status:       status,
+			CompleteURL:  link,
+		})
+		lines = append(lines, fmt.Sprintf("- %s: %s\n  Mark watered: %s", schedule.PlantPetName, status, link))
+	}
+
+	if len(tasks) == 0 {
+		return Notification{}, 0, nil
+	}
+
+	var html bytes.Buffer
+	if err := digestTemplate.Execute(&html, tasks); err != nil {
+		return Notification{}, 0, fmt.Errorf("failed to render digest: %v", err)
+	}
+
+	title := fmt.Sprintf("%d plants need you today", len(tasks))
+	if len(tasks) == 1 {
+		title = tasks[0].PlantPetName + " needs you today"
+	}
+
+	return Notification{
+		Title: title,
+		Body:  "Your garden today:\n\n" + strings.Join(lines, "\n"),
+		HTML:  html.String(),
+	}, len(tasks), nil
+}
+
+func digestHour() int {
+	hour, err := strconv.Atoi(os.Getenv("DIGEST_HOUR"))
+	if err != nil || hour < 0 || hour > 23 {
+		return 7
+	}
+	return hour
+}
+
+// Sends each opted-in user one digest per local day, from digest_hour on.
+// Users who turned email off get nothing, and quiet hours push the digest
+// back until they end. With per-plant batching each task is its own email.
+func SendEmailDigests(notifier Notifier, digest_hour int) (int, error) {
+	recipients, err := Handler.FetchDigestRecipients(digest_hour)
+	if err != nil {
+		return 0, err
+	}
+
+	sent := 0
+	for _, recipient := range recipients {
+		prefs, err := Handler.FetchNotificationPreferences(recipient.UserID)
+		if err != nil {
+			return sent, err
+		}
+		if !prefs.channelEnabled(notifier.Channel()) || prefs.inQuietHours(time.Now()) {
+			continue
+		}
+
+		schedules, err := Handler.FetchScheduleOn(recipient.UserID, recipient.LocalDate)
+		if err != nil {
+			return sent, err
+		}
+		plants, err := Handler.FetchPlants(recipient.UserID)
+		if err != nil {
+			return sent, err
+		}
+
+		var wanted []ScheduleDisplay
+		for _, schedule := range schedules {
+			if prefs.wantsTask(schedule.TaskTypes) {
+				wanted = append(wanted, schedule)
+			}
+		}
+
+		var notifications []Notification
+		for _, batch := range batchForPreferences(prefs, wanted) {
+			notification, count, err := buildDigestNotification(recipient.UserID, batch, plants, recipient.LocalDate)
+			if err != nil {
+				return sent, err
+			}
+			if count > 0 {
+				notifications = append(notifications, notification)
+			}
+		}
+
+		// Mark the day first so a failing mail server can't cause repeats
+		if err := Handler.MarkDigestSent(recipient.UserID); err != nil {
+			return sent, err
+		}
+
+		for _, notification := range notifications {
+			batchID, err := generateToken(16)
+			if err != nil {
+				return sent, err
+			}
+			results, sendErr := notifier.Send(recipient.Recipient, notification)
+			if err := Handler.RecordDeliveries(batchID, recipient.UserID, notifier.Channel(), results, sendErr); err != nil {
+				return sent, err
+			}
+			if sendErr != nil {
+				fmt.Println("ERROR sending digest to", recipient.UserID, sendErr)
+				continue
+			}
+			sent++
+		}
+	}
+
+	return sent, nil
+}
+
+func StartEmailDigests(notifier Notifier, digest_hour int, interval time.Duration) {
+	go func() {
+		for {
+			sent, err := SendEmailDigests(notifier, digest_hour)
+			if err != nil {
+				fmt.Println("ERROR sending email digests:", err)
+			} else if sent > 0 {
+				fmt.Println("Email digests sent:", sent)
+			}
+			time.Sleep(interval)
+		}
+	}()
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEnvelopeAddress(t *testing.T) {
+	tests := []struct {
+		from, want string
+	}{
+		{"GreenThumb <reminders@greenthumb.app>", "reminders@greenthumb.app"},
+		{"reminders@greenthumb.app", "reminders@greenthumb.app"},
+		{"<bare@example.com>", "bare@example.com"},
+	}
+
+	for _, tt := range tests {
+		if got := envelopeAddress(tt.from); got != tt.want {
+			t.Errorf("envelopeAddress(%q) = %q, want %q", tt.from, got, tt.want)
+		}
+	}
+}
+
+func TestDigestHour(t *testing.T) {
+	tests := []struct {
+		env  string
+		want int
+	}{
+		{"", 7},
+		{"9", 9},
+		{"24", 7},
+		{"nine", 7},
+	}
+
+	for _, tt := range tests {
+		t.Setenv("DIGEST_HOUR", tt.env)
+		if got := digestHour(); got != tt.want {
+			t.Errorf("digestHour() with %q = %d, want %d", tt.env, got, tt.want)
+		}
+	}
+}
+
+func TestBuildDigestNotification(t *testing.T) {
+	t.Setenv("LINK_SIGNING_SECRET", "link-secret")
+	t.Setenv("PUBLIC_BASE_URL", "https://greenthumb.test/")
+
+	today := testDate(2025, time.June, 10)
+	plants := []Plant{{PlantID: 1, ImageURL: "https://img.test/fern.jpg"}}
+
+	tests := []struct {
+		name       string
+		schedules  []ScheduleDisplay
+		wantCount  int
+		wantTitle  string
+		wantInBody []string
+	}{
+		{
+			"nothing left to do",
+			[]ScheduleDisplay{{ScheduleID: 1, PlantID: 1, PlantPetName: "Fern", WaterIsCompleted: true, WateringDate: today, NextWateringDate: today.AddDate(0, 0, 7)}},
+			0, "", nil,
+		},
+		{
+			"one due today",
+			[]ScheduleDisplay{{ScheduleID: 1, PlantID: 1, PlantPetName: "Fern", NextWateringDate: today}},
+			1, "Fern needs you today",
+			[]string{"Fern: Needs water today", "https://greenthumb.test/schedules/1/complete?token="},
+		},
+		{
+			"overdue and done yesterday",
+			[]ScheduleDisplay{
+				{ScheduleID: 1, PlantID: 1, PlantPetName: "Fern", NextWateringDate: today.AddDate(0, 0, -2)},
+				{ScheduleID: 2, PlantID: 2, PlantPetName: "Basil", WaterIsCompleted: true, WateringDate: today.AddDate(0, 0, -1), NextWateringDate: today},
+			},
+			2, "2 plants need you today",
+			[]string{"Fern: Overdue since Jun 8", "Basil: Needs water today"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			notification, count, err := buildDigestNotification("user-1", tt.schedules, plants, today)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if count != tt.wantCount {
+				t.Fatalf("count = %d, want %d", count, tt.wantCount)
+			}
+			if notification.Title != tt.wantTitle {
+				t.Errorf("Title = %q, want %q", notification.Title, tt.wantTitle)
+			}
+			for _, want := range tt.wantInBody {
+				if !strings.Contains(notification.Body, want) {
+					t.Errorf("Body is missing %q:\n%s", want, notification.Body)
+				}
+			}
+			if count > 0 && !strings.Contains(notification.HTML, "https://img.test/fern.jpg") {
+				t.Error("HTML is missing the plant photo")
+			}
+		})
+	}
+}
+
+func TestBuildEmail(t *testing.T) {
+	message, err := buildEmail("GreenThumb <reminders@greenthumb.app>", "me@example.com", Notification{
+		Title: "Fern needs you today",
+		Body:  "plain body",
+		HTML:  "<p>html body</p>",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	text := string(message)
+	for _, want := range []string{"To: me@example.com\r\n", "Content-Type: text/plain", "Content-Type: text/html", "plain body", "<p>html body</p>"} {
+		if !strings.Contains(text, want) {
+			t.Errorf("email is missing %q", want)
+		}
+	}
+}
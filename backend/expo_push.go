@@ -0,0 +1,172 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// Sends through the Expo push service. BaseURL is normally
+// https://exp.host/--/api/v2/push and can point at a local stub instead.
+type ExpoNotifier struct {
+	BaseURL     string
+	AccessToken string
+	Client      *http.Client
+}
+
+// Expo accepts at most this many messages or receipt ids per request.
+const expoBatchSize = 100
+
+type expoMessage struct {
+	To    string         `json:"to"`
+	Title string         `json:"title"`
+	Body  string         `json:"body"`
+	Data  map[string]any `json:"data,omitempty"`
+	Sound string         `json:"sound,omitempty"`
+}
+
+type expoTicket struct {
+	Status  string `json:"status"`
+	ID      string `json:"id"`
+	Message string `json:"message"`
+	Details struct {
+		Error string `json:"error"`
+	} `json:"details"`
+}
+
+func NewExpoNotifierFromEnv() *ExpoNotifier {
+	baseURL := os.Getenv("EXPO_PUSH_URL")
+	if baseURL == "" {
+		baseURL = "https://exp.host/--/api/v2/push"
+	}
+	return &ExpoNotifier{
+		BaseURL:     strings.TrimSuffix(baseURL, "/"),
+		AccessToken: os.Getenv("EXPO_ACCESS_TOKEN"),
+		Client:      &http.Client{Timeout: 15 * time.Second},
+	}
+}
+
+func (notifier *ExpoNotifier) Channel() string {
+	return "push"
+}
+
+func (notifier *ExpoNotifier) CanReach(recipient Recipient) bool {
+	return len(recipient.PushTokens) > 0
+}
+
+func (notifier *ExpoNotifier) post(path string, payload any, out any) error {
+	jsonData, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to marshal request: %v", err)
+	}
+
+	req, err := http.NewRequest("POST", notifier.BaseURL+path, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	if notifier.AccessToken != "" {
+		req.Header.Set("Authorization", "Bearer "+notifier.AccessToken)
+	}
+
+	resp, err := notifier.Client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to make request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read response: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("expo push error (%d): %s", resp.StatusCode, string(body))
+	}
+
+	if err := json.Unmarshal(body, out); err != nil {
+		return fmt.Errorf("failed to unmarshal response: %v", err)
+	}
+	return nil
+}
+
+func (notifier *ExpoNotifier) Send(recipient Recipient, notification Notification) ([]DeliveryResult, error) {
+	var results []DeliveryResult
+
+	for start := 0; start < len(recipient.PushTokens); start += expoBatchSize {
+		end := min(start+expoBatchSize, len(recipient.PushTokens))
+		tokens := recipient.PushTokens[start:end]
+
+		messages := make([]expoMessage, 0, len(tokens))
+		for _, token := range tokens {
+			messages = append(messages, expoMessage{
+				To:    token,
+				Title: notification.Title,
+				Body:  notification.Body,
+				Data:  notification.Data,
+				Sound: "default",
+			})
+		}
+
+		var response struct {
+			Data []expoTicket `json:"data"`
+		}
+		if err := notifier.post("/send", messages, &response); err != nil {
+			return results, err
+		}
+
+		// Tickets come back in the same order as the messages
+		for i, token := range tokens {
+			result := DeliveryResult{Target: token, Status: "failed", Error: "no ticket returned"}
+			if i < len(response.Data) {
+				ticket := response.Data[i]
+				if ticket.Status == "ok" {
+					result = DeliveryResult{Target: token, TicketID: ticket.ID, Status: "sent"}
+				} else {
+					result.Error = expoError(ticket.Message, ticket.Details.Error)
+				}
+			}
+			results = append(results, result)
+		}
+	}
+
+	return results, nil
+}
+
+func (notifier *ExpoNotifier) CheckReceipts(ticket_ids []string) (map[string]DeliveryResult, error) {
+	receipts := map[string]DeliveryResult{}
+
+	for start := 0; start < len(ticket_ids); start += expoBatchSize {
+		end := min(start+expoBatchSize, len(ticket_ids))
+
+		var response struct {
+			Data map[string]expoTicket `json:"data"`
+		}
+		if err := notifier.post("/getReceipts", map[string]any{"ids": ticket_ids[start:end]}, &response); err != nil {
+			return receipts, err
+		}
+
+		for id, receipt := range response.Data {
+			if receipt.Status == "ok" {
+				receipts[id] = DeliveryResult{TicketID: id, Status: "delivered"}
+			} else {
+				receipts[id] = DeliveryResult{TicketID: id, Status: "failed", Error: expoError(receipt.Message, receipt.Details.Error)}
+			}
+		}
+	}
+
+	return receipts, nil
+}
+
+// Expo puts a machine-readable code such as DeviceNotRegistered in details.
+func expoError(message string, code string) string {
+	if code == "" {
+		return message
+	}
+	return code + ": " + message
+}
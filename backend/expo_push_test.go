@@ -0,0 +1,77 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestExpoError(t *testing.T) {
+	tests := []struct {
+		message, code, want string
+	}{
+		{"Message too big", "", "Message too big"},
+		{"not a registered push token", "DeviceNotRegistered", "DeviceNotRegistered: not a registered push token"},
+		{"", "MessageRateExceeded", "MessageRateExceeded: "},
+	}
+
+	for _, tt := range tests {
+		if got := expoError(tt.message, tt.code); got != tt.want {
+			t.Errorf("expoError(%q, %q) = %q, want %q", tt.message, tt.code, got, tt.want)
+		}
+	}
+}
+
+func TestExpoNotifierSend(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/send" {
+			http.NotFound(w, r)
+			return
+		}
+		var messages []expoMessage
+		if err := json.NewDecoder(r.Body).Decode(&messages); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		// One ticket short, so the last message has nothing to match
+		w.Write([]byte(`{"data": [
+			{"status": "ok", "id": "ticket-1"},
+			{"status": "error", "message": "gone", "details": {"error": "DeviceNotRegistered"}}
+		]}`))
+	}))
+	defer server.Close()
+
+	notifier := &ExpoNotifier{BaseURL: server.URL, Client: server.Client()}
+	recipient := Recipient{PushTokens: []string{"token-a", "token-b", "token-c"}}
+	results, err := notifier.Send(recipient, Notification{Title: "t", Body: "b"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []DeliveryResult{
+		{Target: "token-a", TicketID: "ticket-1", Status: "sent"},
+		{Target: "token-b", Status: "failed", Error: "DeviceNotRegistered: gone"},
+		{Target: "token-c", Status: "failed", Error: "no ticket returned"},
+	}
+	if len(results) != len(want) {
+		t.Fatalf("got %d results, want %d", len(results), len(want))
+	}
+	for i := range want {
+		if results[i] != want[i] {
+			t.Errorf("result %d = %+v, want %+v", i, results[i], want[i])
+		}
+	}
+}
+
+func TestExpoNotifierSendError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	notifier := &ExpoNotifier{BaseURL: server.URL, Client: server.Client()}
+	if _, err := notifier.Send(Recipient{PushTokens: []string{"token-a"}}, Notification{}); err == nil {
+		t.Fatal("expected an error when Expo is unavailable")
+	}
+}
@@ -0,0 +1,373 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+// A user who turned the Home Assistant integration on. NodeID namespaces
+// their topics so one broker can serve several households. CommandKey is
+// never published; each plant's command topic carries a key derived from it.
+type haNode struct {
+	UserID     string
+	NodeID     string
+	CommandKey string
+}
+
+type haPlantState struct {
+	PlantID      int
+	PlantPetName string
+	PlantName    string
+	Health       int
+	NextWatering *time.Time
+	NeedsWater   bool
+}
+
+// What we last sent for a plant, so unchanged config and state aren't
+// republished every sync.
+type haPublished struct {
+	Config string
+	State  string
+}
+
+type HomeAssistantBridge struct {
+	Client          mqtt.Client
+	DiscoveryPrefix string
+
+	mu        sync.Mutex
+	published map[string]map[int]haPublished
+}
+
+// Set while a bridge is running. Completions and health scans write the
+// user id here so their entities update right away instead of at the next
+// periodic sync.
+var plantStateChanged chan string
+
+func notifyPlantChanged(user_id string) {
+	if plantStateChanged == nil {
+		return
+	}
+	select {
+	case plantStateChanged <- user_id:
+	default:
+	}
+}
+
+func haDiscoveryPrefix() string {
+	prefix := os.Getenv("HA_DISCOVERY_PREFIX")
+	if prefix == "" {
+		prefix = "homeassistant"
+	}
+	return strings.TrimSuffix(prefix, "/")
+}
+
+func haPlantTopic(node_id string, plant_id int) string {
+	return mqttTopicPrefix() + "/ha/" + node_id + "/plants/" + strconv.Itoa(plant_id)
+}
+
+// The node id is public, so a command topic built from it alone could be
+// guessed. Each plant's topic instead carries an HMAC of its id under the
+// node's command key, which changes every time the integration is enabled.
+func haCommandTopicKey(command_key string, plant_id int) string {
+	mac := hmac.New(sha256.New, []byte(command_key))
+	mac.Write([]byte(strconv.Itoa(plant_id)))
+	return hex.EncodeToString(mac.Sum(nil))[:32]
+}
+
+// <prefix>/ha/<node_id>/plants/<plant_id>/<key>/mark_watered
+func haCommandTopic(node haNode, plant_id int) string {
+	return haPlantTopic(node.NodeID, plant_id) + "/" + haCommandTopicKey(node.CommandKey, plant_id) + "/mark_watered"
+}
+
+// Discovery configs for the plant's four entities, keyed by config topic.
+// They all hang off one HA device per plant. The button's command topic is
+// only as private as the discovery topics, so on a shared broker those
+// should be readable by Home Assistant alone.
+func (bridge *HomeAssistantBridge) discoveryConfigs(node haNode, plant haPlantState) map[string]map[string]any {
+	base := haPlantTopic(node.NodeID, plant.PlantID)
+	objectID := fmt.Sprintf("greenthumb_%s_%d", node.NodeID, plant.PlantID)
+	device := map[string]any{
+		"identifiers":  []string{objectID},
+		"name":         plant.PlantPetName,
+		"model":        plant.PlantName,
+		"manufacturer": "GreenThumb",
+	}
+
+	entity := func(name string, key string, extra map[string]any) map[string]any {
+		config := map[string]any{
+			"name":      name,
+			"unique_id": objectID + "_" + key,
+			"device":    device,
+		}
+		for k, v := range extra {
+			config[k] = v
+		}
+		return config
+	}
+
+	topic := func(component string, key string) string {
+		return bridge.DiscoveryPrefix + "/" + component + "/" + objectID + "/" + key + "/config"
+	}
+
+	return map[string]map[string]any{
+		topic("sensor", "health"): entity("Health", "health", map[string]any{
+			"state_topic":         base + "/state",
+			"value_template":      "{{ value_json.health }}",
+			"unit_of_measurement": "%",
+			"state_class":         "measurement",
+			"icon":                "mdi:sprout",
+		}),
+		topic("sensor", "next_watering"): entity("Next watering", "next_watering", map[string]any{
+			"state_topic":    base + "/state",
+			"value_template": "{{ value_json.next_watering }}",
+			"device_class":   "date",
+			"icon":           "mdi:calendar-clock",
+		}),
+		topic("binary_sensor", "needs_water"): entity("Needs water", "needs_water", map[string]any{
+			"state_topic":    base + "/state",
+			"value_template": "{{ 'ON' if value_json.needs_water else 'OFF' }}",
+			"icon":           "mdi:watering-can",
+		}),
+		topic("button", "mark_watered"): entity("Mark watered", "mark_watered", map[string]any{
+			"command_topic": haCommandTopic(node, plant.PlantID),
+			"icon":          "mdi:water-check",
+		}),
+	}
+}
+
+func haStatePayload(plant haPlantState) map[string]any {
+	state := map[string]any{"health": plant.Health, "needs_water": plant.NeedsWater, "next_watering": nil}
+	if plant.NextWatering != nil {
+		state["next_watering"] = plant.NextWatering.Format("2006-01-02")
+	}
+	return state
+}
+
+func (bridge *HomeAssistantBridge) publish(topic string, payload []byte) error {
+	token := bridge.Client.Publish(topic, 1, true, payload)
+	if !token.WaitTimeout(10 * time.Second) {
+		return fmt.Errorf("timed out publishing to %s", topic)
+	}
+	if token.Error() != nil {
+		return fmt.Errorf("failed to publish to %s: %v", topic, token.Error())
+	}
+	return nil
+}
+
+// Publishes a node's plants and clears entities for plants that are gone.
+// With no plants (integration turned off) everything is cleared.
+func (bridge *HomeAssistantBridge) syncNode(node haNode, plants []haPlantState) error {
+	bridge.mu.Lock()
+	defer bridge.mu.Unlock()
+
+	node_id := node.NodeID
+	previous := bridge.published[node_id]
+	current := map[int]haPublished{}
+
+	for _, plant := range plants {
+		configs := bridge.discoveryConfigs(node, plant)
+		configJSON, err := json.Marshal(configs)
+		if err != nil {
+			return fmt.Errorf("failed to marshal discovery config: %v", err)
+		}
+		stateJSON, err := json.Marshal(haStatePayload(plant))
+		if err != nil {
+			return fmt.Errorf("failed to marshal plant state: %v", err)
+		}
+
+		last := previous[plant.PlantID]
+		if last.Config != string(configJSON) {
+			for topic, config := range configs {
+				payload, _ := json.Marshal(config)
+				if err := bridge.publish(topic, payload); err != nil {
+					return err
+				}
+			}
+		}
+		if last.State != string(stateJSON) {
+			if err := bridge.publish(haPlantTopic(node_id, plant.PlantID)+"/state", stateJSON); err != nil {
+				return err
+			}
+		}
+		current[plant.PlantID] = haPublished{Config: string(configJSON), State: string(stateJSON)}
+	}
+
+	// An empty retained config removes the entity from Home Assistant
+	for plantID := range previous {
+		if _, ok := current[plantID]; ok {
+			continue
+		}
+		for topic := range bridge.discoveryConfigs(node, haPlantState{PlantID: plantID}) {
+			if err := bridge.publish(topic, nil); err != nil {
+				return err
+			}
+		}
+		if err := bridge.publish(haPlantTopic(node_id, plantID)+"/state", nil); err != nil {
+			return err
+		}
+	}
+
+	if len(current) == 0 {
+		delete(bridge.published, node_id)
+	} else {
+		bridge.published[node_id] = current
+	}
+	return nil
+}
+
+// Brings every enabled node up to date, and clears nodes that were turned
+// off since the last sync.
+func (bridge *HomeAssistantBridge) SyncAll() error {
+	nodes, err := Handler.FetchHomeAssistantNodes()
+	if err != nil {
+		return err
+	}
+
+	enabled := map[string]bool{}
+	for _, node := range nodes {
+		enabled[node.NodeID] = true
+		plants, err := Handler.FetchHomeAssistantPlants(node.UserID)
+		if err != nil {
+			return err
+		}
+		if err := bridge.syncNode(node, plants); err != nil {
+			return err
+		}
+	}
+
+	bridge.mu.Lock()
+	var stale []string
+	for nodeID := range bridge.published {
+		if !enabled[nodeID] {
+			stale = append(stale, nodeID)
+		}
+	}
+	bridge.mu.Unlock()
+
+	for _, nodeID := range stale {
+		if err := bridge.syncNode(haNode{NodeID: nodeID}, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (bridge *HomeAssistantBridge) syncUser(user_id string) error {
+	enabled, nodeID, err := Handler.FetchHomeAssistant(user_id)
+	if err != nil || nodeID == "" {
+		return err
+	}
+	if !enabled {
+		return bridge.syncNode(haNode{NodeID: nodeID}, nil)
+	}
+
+	node, err := Handler.FetchHomeAssistantNode(nodeID)
+	if err != nil {
+		return err
+	}
+	plants, err := Handler.FetchHomeAssistantPlants(user_id)
+	if err != nil {
+		return err
+	}
+	return bridge.syncNode(node, plants)
+}
+
+// A press on a plant's command topic (see haCommandTopic). The payload is
+// whatever Home Assistant sends; the key in the topic is what's checked.
+func (bridge *HomeAssistantBridge) handleButtonPress(topic string) error {
+	parts := strings.Split(strings.TrimPrefix(topic, mqttTopicPrefix()+"/"), "/")
+	if len(parts) != 6 || parts[0] != "ha" || parts[2] != "plants" || parts[5] != "mark_watered" {
+		return fmt.Errorf("unexpected topic %q", topic)
+	}
+	plantID, err := strconv.Atoi(parts[3])
+	if err != nil {
+		return fmt.Errorf("invalid plant id in topic %q", topic)
+	}
+	if parts[4] == "" {
+		return fmt.Errorf("missing command key in topic %q", topic)
+	}
+
+	node, err := Handler.FetchHomeAssistantNode(parts[1])
+	if err != nil {
+		return err
+	}
+	if !hmac.Equal([]byte(parts[4]), []byte(haCommandTopicKey(node.CommandKey, plantID))) {
+		return fmt.Errorf("wrong command key for plant %d on node %s", plantID, node.NodeID)
+	}
+	userID := node.UserID
+
+	scheduleIDs, err := Handler.FetchWaterScheduleIDs(userID, plantID)
+	if err != nil {
+		return err
+	}
+	// MarkWatered pings the bridge, which publishes the new state
+	for _, scheduleID := range scheduleIDs {
+		if _, err := Handler.MarkWatered(userID, scheduleID, "home_assistant"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Connects when MQTT_BROKER_URL is set. Everything is resynced on each
+// connect and then every interval, which also flips "needs water" at the
+// start of a new day.
+func StartHomeAssistantBridge(interval time.Duration) {
+	bridge := &HomeAssistantBridge{DiscoveryPrefix: haDiscoveryPrefix(), published: map[string]map[int]haPublished{}}
+	commandTopic := mqttTopicPrefix() + "/ha/+/plants/+/+/mark_watered"
+	changed := make(chan string, 100)
+	plantStateChanged = changed
+
+	bridge.Client = ConnectMQTTFromEnv("greenthumb-homeassistant", func(client mqtt.Client) {
+		token := client.Subscribe(commandTopic, 1, func(_ mqtt.Client, message mqtt.Message) {
+			if err := bridge.handleButtonPress(message.Topic()); err != nil {
+				fmt.Println("ERROR handling Home Assistant button on", message.Topic(), err)
+			}
+		})
+		if token.Wait() && token.Error() != nil {
+			fmt.Println("ERROR subscribing to", commandTopic, token.Error())
+		}
+
+		// The broker may have lost retained messages, so send everything again
+		bridge.mu.Lock()
+		bridge.published = map[string]map[int]haPublished{}
+		bridge.mu.Unlock()
+		notifyPlantChanged("")
+	})
+	if bridge.Client == nil {
+		plantStateChanged = nil
+		fmt.Println("MQTT_BROKER_URL not set, Home Assistant bridge disabled")
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			var err error
+			select {
+			case userID := <-changed:
+				if userID == "" {
+					err = bridge.SyncAll()
+				} else {
+					err = bridge.syncUser(userID)
+				}
+			case <-ticker.C:
+				err = bridge.SyncAll()
+			}
+			if err != nil {
+				fmt.Println("ERROR syncing Home Assistant:", err)
+			}
+		}
+	}()
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHADiscoveryPrefix(t *testing.T) {
+	tests := []struct {
+		env, want string
+	}{
+		{"", "homeassistant"},
+		{"ha", "ha"},
+		{"ha/", "ha"},
+	}
+
+	for _, tt := range tests {
+		t.Setenv("HA_DISCOVERY_PREFIX", tt.env)
+		if got := haDiscoveryPrefix(); got != tt.want {
+			t.Errorf("haDiscoveryPrefix() with %q = %q, want %q", tt.env, got, tt.want)
+		}
+	}
+}
+
+func TestDiscoveryConfigs(t *testing.T) {
+	t.Setenv("MQTT_TOPIC_PREFIX", "greenthumb")
+	bridge := &HomeAssistantBridge{DiscoveryPrefix: "homeassistant"}
+	node := haNode{NodeID: "abc123", CommandKey: "node-key"}
+	configs := bridge.discoveryConfigs(node, haPlantState{PlantID: 7, PlantPetName: "Fern", PlantName: "Boston Fern"})
+
+	tests := []struct {
+		topic       string
+		wantState   bool
+		wantCommand bool
+	}{
+		{"homeassistant/sensor/greenthumb_abc123_7/health/config", true, false},
+		{"homeassistant/sensor/greenthumb_abc123_7/next_watering/config", true, false},
+		{"homeassistant/binary_sensor/greenthumb_abc123_7/needs_water/config", true, false},
+		{"homeassistant/button/greenthumb_abc123_7/mark_watered/config", false, true},
+	}
+	if len(configs) != len(tests) {
+		t.Fatalf("got %d configs, want %d", len(configs), len(tests))
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.topic, func(t *testing.T) {
+			config, ok := configs[tt.topic]
+			if !ok || config == nil {
+				t.Fatalf("missing config for %s", tt.topic)
+			}
+			if state, ok := config["state_topic"]; ok != tt.wantState || (ok && state != "greenthumb/ha/abc123/plants/7/state") {
+				t.Errorf("state_topic = %v, want it %v", state, tt.wantState)
+			}
+			command, ok := config["command_topic"]
+			if ok != tt.wantCommand {
+				t.Fatalf("command_topic = %v, want it %v", command, tt.wantCommand)
+			}
+			if ok && command != haCommandTopic(node, 7) {
+				t.Errorf("command_topic = %v, want %s", command, haCommandTopic(node, 7))
+			}
+		})
+	}
+}
+
+func TestHACommandTopicKey(t *testing.T) {
+	key := haCommandTopicKey("node-key", 7)
+
+	tests := []struct {
+		name      string
+		other     string
+		wantEqual bool
+	}{
+		{"same key and plant", haCommandTopicKey("node-key", 7), true},
+		{"other plant", haCommandTopicKey("node-key", 8), false},
+		{"rotated key", haCommandTopicKey("new-node-key", 7), false},
+	}
+
+	if len(key) != 32 {
+		t.Fatalf("key %q is %d characters, want 32", key, len(key))
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if (tt.other == key) != tt.wantEqual {
+				t.Errorf("haCommandTopicKey() = %q vs %q, want equal %v", tt.other, key, tt.wantEqual)
+			}
+		})
+	}
+}
+
+func TestHACommandTopic(t *testing.T) {
+	t.Setenv("MQTT_TOPIC_PREFIX", "greenthumb")
+	node := haNode{NodeID: "abc123", CommandKey: "node-key"}
+	want := "greenthumb/ha/abc123/plants/7/" + haCommandTopicKey("node-key", 7) + "/mark_watered"
+	if got := haCommandTopic(node, 7); got != want {
+		t.Errorf("haCommandTopic() = %q, want %q", got, want)
+	}
+}
+
+func TestHAStatePayload(t *testing.T) {
+	next := testDate(2025, time.June, 12)
+
+	tests := []struct {
+		name  string
+		plant haPlantState
+		want  any
+	}{
+		{"scheduled", haPlantState{Health: 80, NextWatering: &next}, "2025-06-12"},
+		{"nothing scheduled", haPlantState{Health: 80}, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			state := haStatePayload(tt.plant)
+			if state["next_watering"] != tt.want {
+				t.Errorf("next_watering = %v, want %v", state["next_watering"], tt.want)
+			}
+			if state["health"] != tt.plant.Health {
+				t.Errorf("health = %v, want %d", state["health"], tt.plant.Health)
+			}
+		})
+	}
+}
+
+func TestHandleButtonPressRejectsBeforeLookup(t *testing.T) {
+	t.Setenv("MQTT_TOPIC_PREFIX", "greenthumb")
+	bridge := &HomeAssistantBridge{}
+
+	tests := []struct {
+		name    string
+		topic   string
+		wantErr string
+	}{
+		{"wrong command", "greenthumb/ha/abc123/plants/7/0123abcd/water", "unexpected topic"},
+		{"no key level", "greenthumb/ha/abc123/plants/7/mark_watered", "unexpected topic"},
+		{"bad plant id", "greenthumb/ha/abc123/plants/seven/0123abcd/mark_watered", "invalid plant id"},
+		{"empty key", "greenthumb/ha/abc123/plants/7//mark_watered", "missing command key"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := bridge.handleButtonPress(tt.topic)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("handleButtonPress() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
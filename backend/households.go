@@ -0,0 +1,133 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	HouseholdOwner  = "owner"
+	HouseholdEditor = "editor"
+	HouseholdViewer = "viewer"
+)
+
+// Viewers can see a household's plants and schedules, editors can also
+// water and change them, and owners manage members and can delete plants.
+var householdRoleRank = map[string]int{HouseholdViewer: 1, HouseholdEditor: 2, HouseholdOwner: 3}
+
+// Invites are good for a week, and each one can only be used once.
+const householdInviteTTL = 7 * 24 * time.Hour
+
+type Household struct {
+	HouseholdID int       `json:"household_id"`
+	Name        string    `json:"name"`
+	Role        string    `json:"role"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+type HouseholdMember struct {
+	UserID   string    `json:"user_id"`
+	Role     string    `json:"role"`
+	JoinedAt time.Time `json:"joined_at"`
+}
+
+type HouseholdInvite struct {
+	InviteID      int       `json:"invite_id"`
+	HouseholdID   int       `json:"household_id"`
+	HouseholdName string    `json:"household_name"`
+	Role          string    `json:"role"`
+	Email         string    `json:"email,omitempty"`
+	ExpiresAt     time.Time `json:"expires_at"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+func validHouseholdRole(role string) bool {
+	_, ok := householdRoleRank[role]
+	return ok
+}
+
+func roleAllows(role string, min_role string) bool {
+	return householdRoleRank[role] >= householdRoleRank[min_role]
+}
+
+// Plants (aliased as p) the user can see: their personal plants plus every
+// plant in a household they belong to. $1 is the user.
+const accessiblePlantsCondition = `(
+	(p.household_id IS NULL AND p.user_id = $1)
+	OR p.household_id IN (SELECT household_id FROM household_members WHERE user_id = $1)
+)`
+
+// Plant and schedule rows stay keyed by the user who added the plant, so
+// once membership is checked the handlers act on the owner's rows. Returns
+// that owner's id, or writes the error response and returns false.
+func resolvePlantAccess(c *gin.Context, user_id string, plant_id int, min_role string) (string, bool) {
+	ownerID, role, err := Handler.PlantAccess(user_id, plant_id)
+	return checkHouseholdAccess(c, ownerID, role, err, min_role)
+}
+
+func resolveScheduleAccess(c *gin.Context, user_id string, schedule_id int, min_role string) (string, bool) {
+	ownerID, role, err := Handler.ScheduleAccess(user_id, schedule_id)
+	return checkHouseholdAccess(c, ownerID, role, err, min_role)
+}
+
+func checkHouseholdAccess(c *gin.Context, owner_id string, role string, err error, min_role string) (string, bool) {
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Not found", "details": err.Error()})
+		return "", false
+	}
+	if !roleAllows(role, min_role) {
+		c.JSON(http.StatusForbidden, gin.H{"error": fmt.Sprintf("This needs the %s role, you are a %s", min_role, role)})
+		return "", false
+	}
+	return owner_id, true
+}
+
+// Empty when the owner did it themselves, like sitterAttribution.
+func memberAttribution(owner_id string, user_id string) string {
+	if owner_id == user_id {
+		return ""
+	}
+	return user_id
+}
+
+// Parses :household_id and checks the caller's role in it.
+func resolveHouseholdRole(c *gin.Context, user_id string, min_role string) (int, bool) {
+	householdID, err := strconv.Atoi(c.Param("household_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid household ID"})
+		return 0, false
+	}
+
+	role, err := Handler.HouseholdRole(user_id, householdID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Household not found", "details": err.Error()})
+		return 0, false
+	}
+	if !roleAllows(role, min_role) {
+		c.JSON(http.StatusForbidden, gin.H{"error": fmt.Sprintf("This needs the %s role, you are a %s", min_role, role)})
+		return 0, false
+	}
+	return householdID, true
+}
+
+// Adding a plant to a household needs editor access there. The plant still
+// counts towards the adder's own plant limit.
+func checkCanAddToHousehold(c *gin.Context, user_id string, household_id *int) bool {
+	if household_id == nil {
+		return true
+	}
+	role, err := Handler.HouseholdRole(user_id, *household_id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Household not found", "details": err.Error()})
+		return false
+	}
+	if !roleAllows(role, HouseholdEditor) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You need to be an editor to add plants to this household"})
+		return false
+	}
+	return true
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestRoleAllows(t *testing.T) {
+	tests := []struct {
+		role, min string
+		want      bool
+	}{
+		{HouseholdOwner, HouseholdOwner, true},
+		{HouseholdOwner, HouseholdViewer, true},
+		{HouseholdEditor, HouseholdEditor, true},
+		{HouseholdEditor, HouseholdOwner, false},
+		{HouseholdViewer, HouseholdEditor, false},
+		{"", HouseholdViewer, false},
+		{"admin", HouseholdViewer, false},
+	}
+
+	for _, tt := range tests {
+		if got := roleAllows(tt.role, tt.min); got != tt.want {
+			t.Errorf("roleAllows(%q, %q) = %v, want %v", tt.role, tt.min, got, tt.want)
+		}
+	}
+}
+
+func TestValidHouseholdRole(t *testing.T) {
+	for _, role := range []string{HouseholdOwner, HouseholdEditor, HouseholdViewer} {
+		if !validHouseholdRole(role) {
+			t.Errorf("validHouseholdRole(%q) = false", role)
+		}
+	}
+	for _, role := range []string{"", "Owner", "admin"} {
+		if validHouseholdRole(role) {
+			t.Errorf("validHouseholdRole(%q) = true", role)
+		}
+	}
+}
+
+func TestMemberAttribution(t *testing.T) {
+	if got := memberAttribution("owner-1", "owner-1"); got != "" {
+		t.Errorf("memberAttribution() for the owner = %q, want empty", got)
+	}
+	if got := memberAttribution("owner-1", "member-2"); got != "member-2" {
+		t.Errorf("memberAttribution() for a member = %q, want member-2", got)
+	}
+}
+
+func TestCheckHouseholdAccess(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name       string
+		role       string
+		err        error
+		min        string
+		wantOK     bool
+		wantStatus int
+	}{
+		{"owner of a personal plant", HouseholdOwner, nil, HouseholdEditor, true, http.StatusOK},
+		{"editor may edit", HouseholdEditor, nil, HouseholdEditor, true, http.StatusOK},
+		{"viewer may not edit", HouseholdViewer, nil, HouseholdEditor, false, http.StatusForbidden},
+		{"not a member", "", fmt.Errorf("no plant found"), HouseholdViewer, false, http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(rec)
+
+			ownerID, ok := checkHouseholdAccess(c, "owner-1", tt.role, tt.err, tt.min)
+			if ok != tt.wantOK {
+				t.Fatalf("checkHouseholdAccess() ok = %v, want %v", ok, tt.wantOK)
+			}
+			if ok && ownerID != "owner-1" {
+				t.Errorf("ownerID = %q, want owner-1", ownerID)
+			}
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestCheckCanAddToHouseholdPersonal(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	rec := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(rec)
+
+	if !checkCanAddToHousehold(c, "owner-1", nil) {
+		t.Error("checkCanAddToHousehold() without a household should allow the add")
+	}
+	if rec.Code != http.StatusOK {
+		t.Errorf("status = %d, want nothing written", rec.Code)
+	}
+}
+
+// A database that only knows how many plants the user has. Every query is
+// recorded, and anything other than the count fails.
+type plantCountDriver struct {
+	mu      sync.Mutex
+	count   int64
+	queries []string
+}
+
+func (d *plantCountDriver) Open(string) (driver.Conn, error) { return plantCountConn{d}, nil }
+func (d *plantCountDriver) Connect(context.Context) (driver.Conn, error) {
+	return plantCountConn{d}, nil
+}
+func (d *plantCountDriver) Driver() driver.Driver { return d }
+
+type plantCountConn struct{ driver *plantCountDriver }
+
+func (c plantCountConn) Prepare(query string) (driver.Stmt, error) {
+	c.driver.mu.Lock()
+	c.driver.queries = append(c.driver.queries, query)
+	c.driver.mu.Unlock()
+	if !strings.Contains(query, "COUNT(*) FROM plants") {
+		return nil, fmt.Errorf("unexpected query: %s", query)
+	}
+	return plantCountStmt{c.driver.count}, nil
+}
+func (c plantCountConn) Close() error { return nil }
+func (c plantCountConn) Begin() (driver.Tx, error) {
+	return nil, fmt.Errorf("transactions not supported")
+}
+
+type plantCountStmt struct{ count int64 }
+
+func (s plantCountStmt) Close() error  { return nil }
+func (s plantCountStmt) NumInput() int { return -1 }
+func (s plantCountStmt) Exec([]driver.Value) (driver.Result, error) {
+	return nil, fmt.Errorf("exec not supported")
+}
+func (s plantCountStmt) Query([]driver.Value) (driver.Rows, error) {
+	return &plantCountRows{count: s.count}, nil
+}
+
+type plantCountRows struct {
+	count int64
+	done  bool
+}
+
+func (r *plantCountRows) Columns() []string { return []string{"count"} }
+func (r *plantCountRows) Close() error      { return nil }
+func (r *plantCountRows) Next(dest []driver.Value) error {
+	if r.done {
+		return io.EOF
+	}
+	r.done = true
+	dest[0] = r.count
+	return nil
+}
+
+func TestHandleAddPlantFromCatalogAtLimit(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	fake := &plantCountDriver{count: maxPlantsPerUser}
+	db := sql.OpenDB(fake)
+	defer db.Close()
+
+	previous := Handler
+	Handler = &DatabaseHandler{Db: db}
+	defer func() { Handler = previous }()
+
+	token := signTestJWT(t, testJWTSecret, jwt.MapClaims{"sub": "owner-1"})
+	body := `{"species_id": 3, "plant_pet_name": "Fernando", "image_url": "https://example.com/fern.jpg"}`
+	rec := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(rec)
+	c.Request = httptest.NewRequest(http.MethodPost, "/plants/catalog", strings.NewReader(body))
+	c.Request.Header.Set("Authorization", "Bearer "+token)
+	c.Request.Header.Set("Content-Type", "application/json")
+
+	HandleAddPlantFromCatalog(c)
+
+	if rec.Code != http.StatusConflict {
+		t.Fatalf("status = %d, want %d (body %s)", rec.Code, http.StatusConflict, rec.Body.String())
+	}
+	// The species lookup the health check needs never ran
+	if len(fake.queries) != 1 {
+		t.Errorf("queries = %q, want only the plant count", fake.queries)
+	}
+}
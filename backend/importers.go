@@ -0,0 +1,342 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Reads one app's export into rows for importPlants. Fields an importer
+// doesn't map go into ImportRow.Metadata, which is kept on the plant.
+type Importer interface {
+	Parse(body io.Reader) ([]ImportRow, error)
+}
+
+var importers = map[string]Importer{
+	"csv":     csvImporter{},
+	"json":    jsonImporter{},
+	"journal": journalImporter{},
+}
+
+func importerFor(format string) (Importer, error) {
+	importer, ok := importers[format]
+	if !ok {
+		var formats []string
+		for name := range importers {
+			formats = append(formats, name)
+		}
+		sort.Strings(formats)
+		return nil, fmt.Errorf("unknown format %q, must be one of %s", format, strings.Join(formats, ", "))
+	}
+	return importer, nil
+}
+
+// Column names we understand for each field in our own CSV and JSON.
+var importColumnAliases = map[string][]string{
+	"name":         {"name", "plant_name", "common_name"},
+	"species":      {"species", "scientific_name"},
+	"pet_name":     {"pet_name", "plant_pet_name", "nickname"},
+	"last_watered": {"last_watered", "last_watered_at", "watered_at"},
+	"interval":     {"interval", "watering_interval", "water_every", "watering_interval_days"},
+	"photo_url":    {"photo_url", "image_url", "photo"},
+}
+
+var nonAlphanumeric = regexp.MustCompile(`[^a-z0-9]+`)
+
+// "Watering Frequency (days)" becomes "watering_frequency_days".
+func normalizeImportColumn(column string) string {
+	return strings.Trim(nonAlphanumeric.ReplaceAllString(strings.ToLower(column), "_"), "_")
+}
+
+// Picks out the fields named in aliases. Every other non-empty value is
+// returned as metadata.
+func splitImportFields(record map[string]string, aliases map[string][]string) (map[string]string, map[string]any) {
+	fields := map[string]string{}
+	known := map[string]bool{}
+	for field, names := range aliases {
+		for _, name := range names {
+			known[name] = true
+			if value := strings.TrimSpace(record[name]); value != "" && fields[field] == "" {
+				fields[field] = value
+			}
+		}
+	}
+
+	metadata := map[string]any{}
+	for key, value := range record {
+		if !known[key] && strings.TrimSpace(value) != "" {
+			metadata[key] = value
+		}
+	}
+	return fields, metadata
+}
+
+func importRowFromFields(line int, record map[string]string, aliases map[string][]string) ImportRow {
+	fields, metadata := splitImportFields(record, aliases)
+	return ImportRow{
+		Line:        line,
+		Name:        fields["name"],
+		Species:     fields["species"],
+		PetName:     fields["pet_name"],
+		LastWatered: fields["last_watered"],
+		Interval:    fields["interval"],
+		PhotoURL:    fields["photo_url"],
+		Metadata:    metadata,
+	}
+}
+
+// Reads a CSV with a header line into one map per line, keyed by the
+// normalized column name.
+func readImportCSV(body io.Reader) ([]map[string]string, error) {
+	reader := csv.NewReader(body)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	lines, err := reader.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("invalid CSV: %v", err)
+	}
+	if len(lines) == 0 {
+		return nil, fmt.Errorf("CSV is empty")
+	}
+
+	header := lines[0]
+	var records []map[string]string
+	for _, line := range lines[1:] {
+		record := map[string]string{}
+		for i, value := range line {
+			if i < len(header) {
+				record[normalizeImportColumn(header[i])] = value
+			}
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+func importString(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		encoded, _ := json.Marshal(v)
+		return string(encoded)
+	}
+}
+
+// Reads a JSON array of objects. Nested objects are flattened into
+// parent_child keys, and the array under log_key (if any) is returned
+// separately as each object's care log.
+func readImportJSON(body io.Reader, log_key string) ([]map[string]string, [][]map[string]string, error) {
+	var objects []map[string]any
+	if err := json.NewDecoder(body).Decode(&objects); err != nil {
+		return nil, nil, fmt.Errorf("invalid JSON, expected an array of objects: %v", err)
+	}
+
+	var records []map[string]string
+	var logs [][]map[string]string
+	for _, object := range objects {
+		record := map[string]string{}
+		var log []map[string]string
+
+		var flatten func(prefix string, object map[string]any)
+		flatten = func(prefix string, object map[string]any) {
+			for key, value := range object {
+				key = normalizeImportColumn(prefix + key)
+				if nested, ok := value.(map[string]any); ok {
+					flatten(key+"_", nested)
+					continue
+				}
+				if key == log_key {
+					entries, _ := value.([]any)
+					for _, entry := range entries {
+						fields, _ := entry.(map[string]any)
+						event := map[string]string{}
+						for name, value := range fields {
+							event[normalizeImportColumn(name)] = importString(value)
+						}
+						log = append(log, event)
+					}
+					continue
+				}
+				record[key] = importString(value)
+			}
+		}
+		flatten("", object)
+
+		records = append(records, record)
+		logs = append(logs, log)
+	}
+	return records, logs, nil
+}
+
+// Our own CSV layout, one plant per line.
+type csvImporter struct{}
+
+func (csvImporter) Parse(body io.Reader) ([]ImportRow, error) {
+	records, err := readImportCSV(body)
+	if err != nil {
+		return nil, err
+	}
+	var rows []ImportRow
+	for i, record := range records {
+		rows = append(rows, importRowFromFields(i+2, record, importColumnAliases))
+	}
+	return rows, nil
+}
+
+// Our own JSON layout, the same fields as the CSV plus an optional
+// care_log of {"action", "date", "notes"} objects.
+type jsonImporter struct{}
+
+func (jsonImporter) Parse(body io.Reader) ([]ImportRow, error) {
+	records, logs, err := readImportJSON(body, "care_log")
+	if err != nil {
+		return nil, err
+	}
+	var rows []ImportRow
+	for i, record := range records {
+		row := importRowFromFields(i+1, record, importColumnAliases)
+		row.CareLog = careEventsFromLog(logs[i], []string{"action", "type"}, []string{"date"}, []string{"notes", "note"})
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// Fields other than the action, date and notes go into the event's metadata
+// rather than being dropped.
+func careEventsFromLog(log []map[string]string, action_keys []string, date_keys []string, notes_keys []string) []ImportCareEvent {
+	var events []ImportCareEvent
+	for _, entry := range log {
+		used := map[string]bool{}
+		first := func(keys []string) string {
+			for _, key := range keys {
+				if value := strings.TrimSpace(entry[key]); value != "" {
+					used[key] = true
+					return value
+				}
+			}
+			return ""
+		}
+
+		event := ImportCareEvent{
+			Action: first(action_keys),
+			Date:   first(date_keys),
+			Notes:  first(notes_keys),
+		}
+		for key, value := range entry {
+			if !used[key] && strings.TrimSpace(value) != "" {
+				if event.Metadata == nil {
+					event.Metadata = map[string]any{}
+				}
+				event.Metadata[key] = value
+			}
+		}
+		events = append(events, event)
+	}
+	return events
+}
+
+// A garden journal: one line per thing done, with date, plant, activity and
+// notes columns. Lines are grouped into plants by name, and the interval
+// and last watering come from the waterings.
+type journalImporter struct{}
+
+var journalColumns = map[string][]string{
+	"date":     {"date", "day"},
+	"plant":    {"plant", "plant_name", "name"},
+	"species":  {"species", "scientific_name"},
+	"activity": {"activity", "action", "task"},
+	"notes":    {"notes", "note", "comment"},
+}
+
+func (journalImporter) Parse(body io.Reader) ([]ImportRow, error) {
+	records, err := readImportCSV(body)
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []ImportRow
+	byName := map[string]int{}
+	for i, record := range records {
+		fields, extra := splitImportFields(record, journalColumns)
+		key := strings.ToLower(fields["plant"])
+		index, ok := byName[key]
+		if !ok {
+			index = len(rows)
+			byName[key] = index
+			rows = append(rows, ImportRow{Line: i + 2, Name: fields["plant"], Metadata: map[string]any{}})
+		}
+
+		row := &rows[index]
+		if row.Species == "" {
+			row.Species = fields["species"]
+		}
+		row.CareLog = append(row.CareLog, ImportCareEvent{Action: fields["activity"], Date: fields["date"], Notes: fields["notes"]})
+
+		// Extra columns vary line by line, so they're kept per line
+		if len(extra) > 0 {
+			extra["line"] = i + 2
+			entries, _ := row.Metadata["journal_lines"].([]map[string]any)
+			row.Metadata["journal_lines"] = append(entries, extra)
+		}
+	}
+	return rows, nil
+}
+
+// Maps other apps' names for things onto our care history actions.
+var importCareActions = map[string]string{
+	"water": "water", "watering": "water", "watered": "water",
+	"fertilize": "fertilize", "fertilizing": "fertilize", "fertilized": "fertilize",
+	"fertilise": "fertilize", "fertilising": "fertilize", "fertilised": "fertilize",
+	"feed": "fertilize", "feeding": "fertilize", "fed": "fertilize",
+	"mist": "mist", "misting": "mist", "misted": "mist",
+	"rotate": "rotate", "rotating": "rotate", "rotated": "rotate",
+	"prune": "prune", "pruning": "prune", "pruned": "prune",
+	"repot": "repot", "repotting": "repot", "repotted": "repot",
+	"note": "note", "notes": "note", "observation": "note",
+}
+
+// Anything we don't have an action for is kept as a note saying what it was.
+func importCareAction(action string, notes string) (string, string) {
+	if mapped, ok := importCareActions[normalizeImportColumn(action)]; ok {
+		return mapped, notes
+	}
+	if notes == "" {
+		return "note", action
+	}
+	return "note", action + ": " + notes
+}
+
+// The typical gap between waterings, or 0 with fewer than two.
+func intervalFromWaterings(dates []time.Time) int {
+	days := map[time.Time]bool{}
+	for _, date := range dates {
+		days[date] = true
+	}
+	var sorted []time.Time
+	for day := range days {
+		sorted = append(sorted, day)
+	}
+	if len(sorted) < 2 {
+		return 0
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Before(sorted[j]) })
+
+	var gaps []int
+	for i := 1; i < len(sorted); i++ {
+		gaps = append(gaps, int(sorted[i].Sub(sorted[i-1]).Hours()/24))
+	}
+	sort.Ints(gaps)
+	gap := gaps[len(gaps)/2]
+	return max(1, min(gap, 365))
+}
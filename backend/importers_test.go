@@ -0,0 +1,249 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNormalizeImportColumn(t *testing.T) {
+	tests := []struct {
+		column string
+		want   string
+	}{
+		{"name", "name"},
+		{"Plant Name", "plant_name"},
+		{"Watering Frequency (days)", "watering_frequency_days"},
+		{"  Last-Watered  ", "last_watered"},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.column, func(t *testing.T) {
+			if got := normalizeImportColumn(tt.column); got != tt.want {
+				t.Errorf("normalizeImportColumn(%q) = %q, want %q", tt.column, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCareEventsFromLog(t *testing.T) {
+	actions, dates, notes := []string{"type", "action"}, []string{"completed_at", "date"}, []string{"note", "notes"}
+
+	tests := []struct {
+		name string
+		log  []map[string]string
+		want []ImportCareEvent
+	}{
+		{"empty", nil, nil},
+		{
+			"first non-empty key wins",
+			[]map[string]string{{"type": "", "action": "water", "date": "2025-03-01", "note": "Bottom watered"}},
+			[]ImportCareEvent{{Action: "water", Date: "2025-03-01", Notes: "Bottom watered"}},
+		},
+		{
+			"leftover keys become metadata",
+			[]map[string]string{{"type": "water", "completed_at": "2025-03-01", "amount_ml": "250", "notes": "from the tap", "photo": ""}},
+			[]ImportCareEvent{{Action: "water", Date: "2025-03-01", Notes: "from the tap", Metadata: map[string]any{"amount_ml": "250"}}},
+		},
+		{
+			"unused alias kept",
+			[]map[string]string{{"type": "mist", "completed_at": "2025-03-02", "date": "2025-03-03"}},
+			[]ImportCareEvent{{Action: "mist", Date: "2025-03-02", Metadata: map[string]any{"date": "2025-03-03"}}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := careEventsFromLog(tt.log, actions, dates, notes)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("careEventsFromLog() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestImportCareAction(t *testing.T) {
+	tests := []struct {
+		action     string
+		notes      string
+		wantAction string
+		wantNotes  string
+	}{
+		{"Watered", "", "water", ""},
+		{"fertilising", "half strength", "fertilize", "half strength"},
+		{"Repotted", "", "repot", ""},
+		{"Harvest", "", "note", "Harvest"},
+		{"Harvest", "3 tomatoes", "note", "Harvest: 3 tomatoes"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.action+"/"+tt.notes, func(t *testing.T) {
+			action, notes := importCareAction(tt.action, tt.notes)
+			if action != tt.wantAction || notes != tt.wantNotes {
+				t.Errorf("importCareAction(%q, %q) = (%q, %q), want (%q, %q)", tt.action, tt.notes, action, notes, tt.wantAction, tt.wantNotes)
+			}
+		})
+	}
+}
+
+func datesFromStrings(t *testing.T, dates []string) []time.Time {
+	t.Helper()
+	var parsed []time.Time
+	for _, date := range dates {
+		day, err := time.Parse("2006-01-02", date)
+		if err != nil {
+			t.Fatal(err)
+		}
+		parsed = append(parsed, day)
+	}
+	return parsed
+}
+
+func TestIntervalFromWaterings(t *testing.T) {
+	tests := []struct {
+		name  string
+		dates []string
+		want  int
+	}{
+		{"none", nil, 0},
+		{"one", []string{"2025-03-01"}, 0},
+		{"same day twice", []string{"2025-03-01", "2025-03-01"}, 0},
+		{"weekly", []string{"2025-02-15", "2025-02-22", "2025-03-01"}, 7},
+		{"unordered", []string{"2025-03-01", "2025-02-15", "2025-02-22"}, 7},
+		{"median gap", []string{"2025-02-01", "2025-02-04", "2025-02-11", "2025-02-18"}, 7},
+		{"capped at a year", []string{"2022-01-01", "2025-01-01"}, 365},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := intervalFromWaterings(datesFromStrings(t, tt.dates))
+			if got != tt.want {
+				t.Errorf("intervalFromWaterings() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestImporterFor(t *testing.T) {
+	for _, format := range []string{"csv", "json", "journal"} {
+		if _, err := importerFor(format); err != nil {
+			t.Errorf("importerFor(%q) error = %v", format, err)
+		}
+	}
+	if _, err := importerFor("xlsx"); err == nil {
+		t.Error("importerFor(\"xlsx\") should fail")
+	}
+}
+
+// What a parsed row should look like, with the care log compared by action
+// and date only.
+type wantImportRow struct {
+	Line        int
+	Name        string
+	Species     string
+	PetName     string
+	LastWatered string
+	Interval    string
+	PhotoURL    string
+	CareLog     []string
+	Metadata    map[string]any
+}
+
+func checkImportRows(t *testing.T, got []ImportRow, want []wantImportRow) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("got %d rows, want %d: %+v", len(got), len(want), got)
+	}
+	for i, row := range got {
+		var careLog []string
+		for _, event := range row.CareLog {
+			careLog = append(careLog, event.Action+" "+event.Date)
+		}
+		gotRow := wantImportRow{row.Line, row.Name, row.Species, row.PetName, row.LastWatered, row.Interval, row.PhotoURL, careLog, row.Metadata}
+		if len(gotRow.Metadata) == 0 {
+			gotRow.Metadata = nil
+		}
+		if !reflect.DeepEqual(gotRow, want[i]) {
+			t.Errorf("row %d = %+v, want %+v", i, gotRow, want[i])
+		}
+	}
+}
+
+func TestImportersParse(t *testing.T) {
+	tests := []struct {
+		format string
+		body   string
+		want   []wantImportRow
+	}{
+		{
+			format: "csv",
+			body:   "Name,Species,Nickname,Last Watered,Interval,Photo URL,Pot\nMonstera,Monstera deliciosa,Monty,2025-03-01,7 days,,terracotta\n,Ficus lyrata,,,2 weeks,,\n",
+			want: []wantImportRow{
+				{Line: 2, Name: "Monstera", Species: "Monstera deliciosa", PetName: "Monty", LastWatered: "2025-03-01", Interval: "7 days", Metadata: map[string]any{"pot": "terracotta"}},
+				{Line: 3, Species: "Ficus lyrata", Interval: "2 weeks"},
+			},
+		},
+		{
+			format: "json",
+			body:   `[{"name": "Monstera", "interval": 7, "care_log": [{"action": "water", "date": "2025-03-01"}], "pot": {"size_cm": 20}}]`,
+			want: []wantImportRow{
+				{Line: 1, Name: "Monstera", Interval: "7", CareLog: []string{"water 2025-03-01"}, Metadata: map[string]any{"pot_size_cm": "20"}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			importer, err := importerFor(tt.format)
+			if err != nil {
+				t.Fatal(err)
+			}
+			rows, err := importer.Parse(strings.NewReader(tt.body))
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			checkImportRows(t, rows, tt.want)
+		})
+	}
+}
+
+func TestJournalImporterParse(t *testing.T) {
+	body := "Date,Plant,Activity,Notes,Weather\n" +
+		"2025-02-20,Tomato,Watered,,sunny\n" +
+		"2025-02-21,Basil,Watered,,\n" +
+		"2025-02-27,tomato,Watered,Deep soak,\n" +
+		"2025-03-01,Tomato,Harvest,3 ripe,\n"
+
+	rows, err := journalImporter{}.Parse(strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name        string
+		wantLine    int
+		wantEvents  int
+		wantJournal int
+	}{
+		{"Tomato", 2, 3, 1},
+		{"Basil", 3, 1, 0},
+	}
+
+	if len(rows) != len(tests) {
+		t.Fatalf("got %d plants, want %d", len(rows), len(tests))
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			row := rows[i]
+			if row.Name != tt.name || row.Line != tt.wantLine || len(row.CareLog) != tt.wantEvents {
+				t.Errorf("row = %q line %d with %d events, want %q line %d with %d", row.Name, row.Line, len(row.CareLog), tt.name, tt.wantLine, tt.wantEvents)
+			}
+			lines, _ := row.Metadata["journal_lines"].([]map[string]any)
+			if len(lines) != tt.wantJournal {
+				t.Errorf("journal_lines = %v, want %d", lines, tt.wantJournal)
+			}
+		})
+	}
+}
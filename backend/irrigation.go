@@ -0,0 +1,411 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+const (
+	ValveDriverMQTT = "mqtt"
+	ValveDriverHTTP = "http"
+)
+
+// A relay-driven valve feeding one plant or a zone of plants that share a
+// line. Address is the controller's URL for the HTTP driver; MQTT valves use
+// <prefix>/valves/<valve_id>/command and report on .../state.
+type Valve struct {
+	ValveID         int       `json:"valve_id"`
+	Name            string    `json:"name"`
+	Driver          string    `json:"driver"`
+	Address         string    `json:"address,omitempty"`
+	PlantIDs        []int     `json:"plant_ids"`
+	FlowMLPerMinute float64   `json:"flow_ml_per_minute"`
+	DefaultAmountML int       `json:"default_amount_ml"`
+	MaxRunSeconds   int       `json:"max_run_seconds"`
+	MaxDailySeconds int       `json:"max_daily_seconds"`
+	StartHour       int       `json:"start_hour"`
+	Enabled         bool      `json:"enabled"`
+	CreatedAt       time.Time `json:"created_at"`
+	UserID          string    `json:"-"`
+}
+
+type ValveCommand struct {
+	CommandID string `json:"command_id"`
+	Action    string `json:"action"`
+	Seconds   int    `json:"seconds"`
+}
+
+// What a controller reports back: "opened" once water is flowing, "closed"
+// when the run finished and "error" if it couldn't run.
+type ValveFeedback struct {
+	Token      string `json:"token,omitempty"`
+	CommandID  string `json:"command_id"`
+	State      string `json:"state"`
+	SecondsRun int    `json:"seconds_run"`
+	Error      string `json:"error"`
+}
+
+type IrrigationRun struct {
+	RunID            int        `json:"run_id"`
+	ScheduleIDs      []int      `json:"schedule_ids"`
+	CommandID        string     `json:"command_id"`
+	RequestedSeconds int        `json:"requested_seconds"`
+	Status           string     `json:"status"`
+	SecondsRun       *int       `json:"seconds_run"`
+	Error            string     `json:"error,omitempty"`
+	CreatedAt        time.Time  `json:"created_at"`
+	ConfirmedAt      *time.Time `json:"confirmed_at"`
+}
+
+// Due watering for the plants behind one valve. A zone gets the largest
+// amount any of its due plants needs.
+type IrrigationJob struct {
+	Valve       Valve
+	ScheduleIDs []int
+	AmountML    int
+}
+
+type ValveDriver interface {
+	// Returns feedback when the controller answers straight away, or nil
+	// when confirmation arrives later on its own.
+	Open(valve Valve, command ValveCommand) (*ValveFeedback, error)
+}
+
+func validateValve(valve Valve) error {
+	switch valve.Driver {
+	case ValveDriverMQTT:
+	case ValveDriverHTTP:
+		if err := validateWebhookURL(valve.Address); err != nil {
+			return fmt.Errorf("address: %v", err)
+		}
+	default:
+		return fmt.Errorf("driver must be %q or %q", ValveDriverMQTT, ValveDriverHTTP)
+	}
+
+	if len(valve.PlantIDs) == 0 {
+		return fmt.Errorf("link at least one plant")
+	}
+	if valve.FlowMLPerMinute <= 0 {
+		return fmt.Errorf("flow_ml_per_minute must be positive")
+	}
+	if valve.DefaultAmountML <= 0 {
+		return fmt.Errorf("default_amount_ml must be positive")
+	}
+	if valve.MaxRunSeconds < 1 || valve.MaxRunSeconds > 3600 {
+		return fmt.Errorf("max_run_seconds must be between 1 and 3600")
+	}
+	if valve.MaxDailySeconds < valve.MaxRunSeconds || valve.MaxDailySeconds > 4*3600 {
+		return fmt.Errorf("max_daily_seconds must be at least max_run_seconds and at most 14400")
+	}
+	if valve.StartHour < 0 || valve.StartHour > 23 {
+		return fmt.Errorf("start_hour must be between 0 and 23")
+	}
+	return nil
+}
+
+// How long to keep the valve open to deliver amount_ml, never longer than a
+// single run is allowed to take.
+func wateringSeconds(amount_ml int, flow_ml_per_minute float64, max_run_seconds int) int {
+	seconds := int(math.Ceil(float64(amount_ml) / flow_ml_per_minute * 60))
+	return min(max(seconds, 1), max_run_seconds)
+}
+
+// Millilitres per unit for the ways the model tends to write an amount.
+var waterAmountUnits = []struct {
+	names []string
+	ml    float64
+}{
+	{[]string{"ml", "milliliter", "milliliters", "millilitre", "millilitres"}, 1},
+	{[]string{"l", "liter", "liters", "litre", "litres"}, 1000},
+	{[]string{"cup", "cups"}, 240},
+	{[]string{"fl oz", "oz", "ounce", "ounces"}, 30},
+}
+
+var waterAmountPattern = regexp.MustCompile(`(\d+(?:\.\d+)?)(?:\s*(?:-|to)\s*(\d+(?:\.\d+)?))?\s*([a-z]+(?: oz)?)`)
+
+// The AI's water_amount ("250 ml", "1-2 cups") in ml, or nil when it isn't
+// an amount we can measure out. A range becomes its midpoint.
+func parseWaterAmountML(text string) *int {
+	match := waterAmountPattern.FindStringSubmatch(strings.ToLower(text))
+	if match == nil {
+		return nil
+	}
+
+	amount, err := strconv.ParseFloat(match[1], 64)
+	if err != nil {
+		return nil
+	}
+	if match[2] != "" {
+		upper, err := strconv.ParseFloat(match[2], 64)
+		if err != nil {
+			return nil
+		}
+		amount = (amount + upper) / 2
+	}
+
+	for _, unit := range waterAmountUnits {
+		if slices.Contains(unit.names, match[3]) {
+			ml := int(math.Round(amount * unit.ml))
+			if ml < 1 || ml > 100000 {
+				return nil
+			}
+			return &ml
+		}
+	}
+	return nil
+}
+
+type MQTTValveDriver struct {
+	Client mqtt.Client
+}
+
+func (driver *MQTTValveDriver) Open(valve Valve, command ValveCommand) (*ValveFeedback, error) {
+	payload, err := json.Marshal(command)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal valve command: %v", err)
+	}
+
+	topic := mqttTopicPrefix() + "/valves/" + strconv.Itoa(valve.ValveID) + "/command"
+	token := driver.Client.Publish(topic, 1, false, payload)
+	if !token.WaitTimeout(10 * time.Second) {
+		return nil, fmt.Errorf("timed out publishing to %s", topic)
+	}
+	if token.Error() != nil {
+		return nil, fmt.Errorf("failed to publish to %s: %v", topic, token.Error())
+	}
+	return nil, nil
+}
+
+type HTTPValveDriver struct {
+	Client *http.Client
+}
+
+// Valve addresses are user-supplied like webhook URLs, so commands go
+// through the same dialer and never reach private or loopback addresses.
+func NewHTTPValveDriver(timeout time.Duration) *HTTPValveDriver {
+	dialer := &net.Dialer{Timeout: timeout, Control: webhookDialControl}
+	return &HTTPValveDriver{Client: &http.Client{
+		Timeout:   timeout,
+		Transport: &http.Transport{DialContext: dialer.DialContext, TLSHandshakeTimeout: timeout},
+	}}
+}
+
+func (driver *HTTPValveDriver) Open(valve Valve, command ValveCommand) (*ValveFeedback, error) {
+	payload, err := json.Marshal(command)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal valve command: %v", err)
+	}
+
+	resp, err := driver.Client.Post(valve.Address, "application/json", bytes.NewBuffer(payload))
+	if err != nil {
+		return nil, fmt.Errorf("failed to reach valve controller: %v", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %v", err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("valve controller returned %d: %s", resp.StatusCode, string(body))
+	}
+
+	// Controllers that don't answer with feedback report later through
+	// POST /valves/:valve_id/feedback
+	var feedback ValveFeedback
+	if json.Unmarshal(body, &feedback) != nil || feedback.State == "" {
+		return nil, nil
+	}
+	if feedback.CommandID == "" {
+		feedback.CommandID = command.CommandID
+	}
+	return &feedback, nil
+}
+
+type IrrigationController struct {
+	Drivers map[string]ValveDriver
+}
+
+// Opens each valve with due watering, at most once per schedule per day and
+// never past the valve's daily runtime cap. The watering only counts as done
+// once the controller confirms the run.
+func (controller *IrrigationController) Run() (int, error) {
+	if _, err := Handler.ExpireIrrigationRuns(); err != nil {
+		return 0, err
+	}
+
+	jobs, err := Handler.FetchDueIrrigation()
+	if err != nil {
+		return 0, err
+	}
+
+	started := 0
+	for _, job := range jobs {
+		valve := job.Valve
+		seconds := wateringSeconds(job.AmountML, valve.FlowMLPerMinute, valve.MaxRunSeconds)
+
+		commandID, err := generateToken(8)
+		if err != nil {
+			return started, err
+		}
+
+		used, err := Handler.ValveRuntimeToday(valve.ValveID)
+		if err != nil {
+			return started, err
+		}
+		if used+seconds > valve.MaxDailySeconds {
+			reason := fmt.Sprintf("daily cap of %ds reached (%ds used, %ds needed)", valve.MaxDailySeconds, used, seconds)
+			if err := Handler.CreateIrrigationRun(valve.ValveID, job.ScheduleIDs, commandID, seconds, "capped", reason); err != nil {
+				return started, err
+			}
+			continue
+		}
+
+		// Nothing was sent, so unlike a failed run this can't have opened it
+		driver, ok := controller.Drivers[valve.Driver]
+		if !ok {
+			if err := Handler.CreateIrrigationRun(valve.ValveID, job.ScheduleIDs, commandID, seconds, "unsent", valve.Driver+" driver is not configured"); err != nil {
+				return started, err
+			}
+			continue
+		}
+
+		// Recorded before sending so the runtime counts against the cap even
+		// if we never hear back
+		if err := Handler.CreateIrrigationRun(valve.ValveID, job.ScheduleIDs, commandID, seconds, "sent", ""); err != nil {
+			return started, err
+		}
+
+		feedback, err := driver.Open(valve, ValveCommand{CommandID: commandID, Action: "open", Seconds: seconds})
+		if err != nil {
+			fmt.Println("ERROR opening valve", valve.ValveID, err)
+			if err := Handler.UpdateIrrigationRun(valve.ValveID, commandID, "failed", nil, err.Error()); err != nil {
+				return started, err
+			}
+			continue
+		}
+		started++
+
+		if feedback != nil {
+			if err := handleValveFeedback(valve, *feedback); err != nil {
+				fmt.Println("ERROR handling valve feedback", valve.ValveID, err)
+			}
+		}
+	}
+
+	return started, nil
+}
+
+// A run that stopped well short of what was asked for isn't counted as a
+// watering.
+func handleValveFeedback(valve Valve, feedback ValveFeedback) error {
+	switch feedback.State {
+	case "opened":
+		return Handler.UpdateIrrigationRun(valve.ValveID, feedback.CommandID, "opened", nil, "")
+	case "error":
+		return Handler.UpdateIrrigationRun(valve.ValveID, feedback.CommandID, "failed", nil, feedback.Error)
+	case "closed":
+	default:
+		return fmt.Errorf("unknown valve state %q", feedback.State)
+	}
+
+	run, err := Handler.FetchIrrigationRun(valve.ValveID, feedback.CommandID)
+	if err != nil {
+		return err
+	}
+	if run.Status == "confirmed" || run.Status == "incomplete" {
+		return nil
+	}
+
+	secondsRun := feedback.SecondsRun
+	if secondsRun == 0 {
+		secondsRun = run.RequestedSeconds
+	}
+	if secondsRun*2 < run.RequestedSeconds {
+		return Handler.UpdateIrrigationRun(valve.ValveID, feedback.CommandID, "incomplete", &secondsRun, "valve closed early")
+	}
+
+	if err := Handler.UpdateIrrigationRun(valve.ValveID, feedback.CommandID, "confirmed", &secondsRun, ""); err != nil {
+		return err
+	}
+	for _, scheduleID := range run.ScheduleIDs {
+		if _, err := Handler.MarkWatered(valve.UserID, scheduleID, "valve:"+valve.Name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func handleValveStateMessage(topic string, body []byte) error {
+	// <prefix>/valves/<valve_id>/state
+	parts := strings.Split(strings.TrimPrefix(topic, mqttTopicPrefix()+"/"), "/")
+	if len(parts) != 3 || parts[0] != "valves" || parts[2] != "state" {
+		return fmt.Errorf("unexpected topic %q", topic)
+	}
+	valveID, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return fmt.Errorf("invalid valve id in topic %q", topic)
+	}
+
+	var feedback ValveFeedback
+	if err := json.Unmarshal(body, &feedback); err != nil {
+		return fmt.Errorf("invalid valve feedback: %v", err)
+	}
+
+	valve, err := Handler.AuthenticateValve(valveID, feedback.Token)
+	if err != nil {
+		return err
+	}
+	return handleValveFeedback(valve, feedback)
+}
+
+// Builds the controller with whichever drivers are configured. MQTT valves
+// share one connection for commands and their state reports.
+func NewIrrigationControllerFromEnv() *IrrigationController {
+	controller := &IrrigationController{Drivers: map[string]ValveDriver{
+		ValveDriverHTTP: NewHTTPValveDriver(15 * time.Second),
+	}}
+
+	topic := mqttTopicPrefix() + "/valves/+/state"
+	client := ConnectMQTTFromEnv("greenthumb-valves", func(client mqtt.Client) {
+		token := client.Subscribe(topic, 1, func(_ mqtt.Client, message mqtt.Message) {
+			if err := handleValveStateMessage(message.Topic(), message.Payload()); err != nil {
+				fmt.Println("ERROR handling valve state on", message.Topic(), err)
+			}
+		})
+		if token.Wait() && token.Error() != nil {
+			fmt.Println("ERROR subscribing to", topic, token.Error())
+		}
+	})
+	if client != nil {
+		controller.Drivers[ValveDriverMQTT] = &MQTTValveDriver{Client: client}
+	}
+
+	return controller
+}
+
+func StartIrrigation(controller *IrrigationController, interval time.Duration) {
+	go func() {
+		for {
+			started, err := controller.Run()
+			if err != nil {
+				fmt.Println("ERROR running irrigation:", err)
+			} else if started > 0 {
+				fmt.Println("Valves opened:", started)
+			}
+			time.Sleep(interval)
+		}
+	}()
+}
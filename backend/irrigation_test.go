@@ -0,0 +1,89 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWateringSeconds(t *testing.T) {
+	tests := []struct {
+		name     string
+		amountML int
+		flow     float64
+		maxRun   int
+		want     int
+	}{
+		{"exact minute", 1000, 1000, 600, 60},
+		{"rounds up", 250, 1000, 600, 15},
+		{"partial second rounds up", 10, 1000, 600, 1},
+		{"never zero", 0, 1000, 600, 1},
+		{"capped by the longest run", 50000, 1000, 600, 600},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := wateringSeconds(tt.amountML, tt.flow, tt.maxRun); got != tt.want {
+				t.Errorf("wateringSeconds(%d, %v, %d) = %d, want %d", tt.amountML, tt.flow, tt.maxRun, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseWaterAmountML(t *testing.T) {
+	tests := []struct {
+		text string
+		want *int
+	}{
+		{"250 ml", intPtr(250)},
+		{"250ml", intPtr(250)},
+		{"About 500 milliliters", intPtr(500)},
+		{"0.5 L", intPtr(500)},
+		{"1 litre", intPtr(1000)},
+		{"1 cup", intPtr(240)},
+		{"1-2 cups", intPtr(360)},
+		{"200 to 300 ml", intPtr(250)},
+		{"8 fl oz", intPtr(240)},
+		{"4 ounces", intPtr(120)},
+		{"Water thoroughly until it drains", nil},
+		{"2 splashes", nil},
+		{"", nil},
+		{"0 ml", nil},
+		{"500 l", nil},
+	}
+
+	for _, tt := range tests {
+		got := parseWaterAmountML(tt.text)
+		switch {
+		case got == nil && tt.want == nil:
+		case got == nil || tt.want == nil || *got != *tt.want:
+			t.Errorf("parseWaterAmountML(%q) = %v, want %v", tt.text, deref(got), deref(tt.want))
+		}
+	}
+}
+
+func deref(v *int) any {
+	if v == nil {
+		return nil
+	}
+	return *v
+}
+
+func TestHTTPValveDriverRefusesLoopback(t *testing.T) {
+	reached := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reached = true
+	}))
+	defer server.Close()
+
+	driver := NewHTTPValveDriver(time.Second)
+	_, err := driver.Open(Valve{Address: server.URL}, ValveCommand{})
+	if err == nil || !strings.Contains(err.Error(), "not allowed") {
+		t.Errorf("Open() error = %v, want the address refused", err)
+	}
+	if reached {
+		t.Error("Open() reached a loopback address")
+	}
+}
@@ -6,6 +6,8 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"time"
+	_ "time/tzdata"
 
 	"github.com/gin-gonic/gin"
 	_ "github.com/lib/pq"
@@ -33,6 +35,13 @@ func InitDatabaseHandler(connString string) error {
 }
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "import" {
+		os.Exit(runImportCommand(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "corrections" {
+		os.Exit(runCorrectionsCommand(os.Args[2:]))
+	}
+
 	// Load environment variables from .env file
 	apiKey := os.Getenv("OPENAI_API_KEY")
 	if apiKey == "" {
@@ -49,7 +58,33 @@ func main() {
 	}
 	log.Println("TEST PRINTING")
 
+	if os.Getenv("SUPABASE_JWT_SECRET") == "" {
+		log.Println("SUPABASE_JWT_SECRET is not set, email invites can't be claimed")
+	}
+
+	if err := seedSpeciesCatalog(); err != nil {
+		log.Println("Error seeding species catalog:", err)
+	}
+
+	StartSeasonalRecalculation(6 * time.Hour)
+	StartWeatherSkipping(NewWeatherProviderFromEnv(), rainSkipThreshold(), 3*time.Hour)
+	StartVacationSummaries(time.Hour)
+	StartAdaptiveIntervals(24 * time.Hour)
+	StartChoreRotation(time.Hour)
+	StartAccountPurge(NewStorageDeleterFromEnv(), time.Hour)
+
+	dispatcher := &Dispatcher{
+		Notifiers: []Notifier{NewExpoNotifierFromEnv(), &WebhookNotifier{}},
+	}
+	StartNotificationDispatcher(dispatcher, 15*time.Minute)
+	StartEmailDigests(NewSMTPNotifierFromEnv(), digestHour(), 15*time.Minute)
+	StartSensorSubscriber()
+	StartIrrigation(NewIrrigationControllerFromEnv(), 5*time.Minute)
+	StartHomeAssistantBridge(10 * time.Minute)
+	StartWebhookDelivery(NewWebhookSender(10*time.Second), 30*time.Second)
+
 	router := gin.Default()
+	router.Use(AccessTokenScopes())
 
 	router.GET("/ping", func(c *gin.Context) {
 		c.JSON(http.StatusOK, gin.H{
@@ -59,12 +94,92 @@ func main() {
 
 	// Commenting out undefined handlers for now
 	router.POST("/plants", HandleAddPlant)
+	router.POST("/plants/import", HandleImportPlants)
+	router.POST("/plants/catalog", HandleAddPlantFromCatalog)
+	router.POST("/care/recommendation", HandleCareRecommendation)
 	router.GET("/plants", HandleFetchPlants)
 	router.GET("/schedules", HandleFetchSchedule)
 	router.PATCH("/plants/:plantid", HandleUpdatePlantPetName)
 	router.PATCH("/schedules/:schedule_id", HandleCompleteSchedule)
+	router.PUT("/schedules/:schedule_id", HandleEditSchedule)
+	router.DELETE("/schedules/:schedule_id/override", HandleClearScheduleOverride)
 	router.DELETE("/plants/:plantid", HandleDeletePlant)
 	router.PUT("/plants/:plantid", HandleUpdatePlantPhoto)
+	router.PATCH("/plants/:plantid/environment", HandleUpdatePlantEnvironment)
+	router.PUT("/plants/:plantid/species", HandleCorrectPlantSpecies)
+	router.POST("/plants/:plantid/notes", HandleAddCareNote)
+	router.PUT("/location", HandleSaveLocation)
+	router.GET("/seasons", HandleFetchSeasonalProfiles)
+	router.POST("/seasons", HandleAddSeasonalProfile)
+	router.DELETE("/seasons/:profile_id", HandleDeleteSeasonalProfile)
+	router.PUT("/schedules/:schedule_id/season", HandleOverrideSeasonMultiplier)
+	router.POST("/schedules/:schedule_id/snooze", HandleSnoozeSchedule)
+	router.POST("/schedules/:schedule_id/reschedule", HandleRescheduleSchedule)
+	router.POST("/schedules/:schedule_id/skip", HandleSkipSchedule)
+	router.PUT("/schedules/:schedule_id/adaptive", HandleSetAdaptiveMode)
+	router.GET("/schedules/:schedule_id/adjustments", HandleFetchIntervalAdjustments)
+	router.POST("/schedules/:schedule_id/adjustments/:adjustment_id/:decision", HandleResolveIntervalAdjustment)
+	router.POST("/vacations", HandleCreateVacation)
+	router.GET("/vacations", HandleFetchVacations)
+	router.GET("/vacations/sitting", HandleFetchSittingVacations)
+	router.GET("/schedules/:schedule_id/complete", HandleConfirmScheduleFromLink)
+	router.POST("/schedules/:schedule_id/complete", HandleCompleteScheduleFromLink)
+	router.GET("/digest", HandleFetchEmailDigest)
+	router.PUT("/digest", HandleUpdateEmailDigest)
+	router.GET("/notifications/preferences", HandleFetchNotificationPreferences)
+	router.PUT("/notifications/preferences", HandleUpdateNotificationPreferences)
+	router.POST("/webhooks", HandleCreateWebhook)
+	router.GET("/webhooks", HandleFetchWebhooks)
+	router.DELETE("/webhooks/:endpoint_id", HandleDeleteWebhook)
+	router.GET("/webhooks/:endpoint_id/deliveries", HandleFetchWebhookDeliveries)
+	router.POST("/webhooks/:endpoint_id/deliveries/:delivery_id/redeliver", HandleRedeliverWebhook)
+	router.POST("/sensors", HandleRegisterSensor)
+	router.GET("/sensors", HandleFetchSensors)
+	router.PATCH("/sensors/:sensor_id", HandleUpdateSensor)
+	router.DELETE("/sensors/:sensor_id", HandleDeleteSensor)
+	router.GET("/sensors/:sensor_id/readings", HandleFetchSensorReadings)
+	router.POST("/sensors/:sensor_id/readings", HandleIngestSensorReadings)
+	router.POST("/valves", HandleRegisterValve)
+	router.GET("/valves", HandleFetchValves)
+	router.DELETE("/valves/:valve_id", HandleDeleteValve)
+	router.GET("/valves/:valve_id/runs", HandleFetchIrrigationRuns)
+	router.POST("/valves/:valve_id/feedback", HandleValveFeedback)
+	router.GET("/integrations/home-assistant", HandleFetchHomeAssistant)
+	router.PUT("/integrations/home-assistant", HandleUpdateHomeAssistant)
+	router.PUT("/plants/:plantid/household", HandleSetPlantHousehold)
+	router.GET("/plants/:plantid/history", HandleFetchCareHistory)
+	router.PUT("/schedules/:schedule_id/assignment", HandleSetAssignment)
+	router.POST("/plants/:plantid/transfers", HandleOfferPlantTransfer)
+	router.GET("/transfers", HandleFetchPlantTransfers)
+	router.GET("/transfers/events", HandleFetchPlantTransferEvents)
+	router.POST("/transfers/:transfer_id/:decision", HandleRespondPlantTransfer)
+	router.DELETE("/transfers/:transfer_id", HandleCancelPlantTransfer)
+	router.POST("/account/merge", HandleMergeAccount)
+	router.GET("/account/export", HandleExportAccount)
+	router.DELETE("/account", HandleDeleteAccount)
+	router.POST("/account/restore", HandleRestoreAccount)
+	router.GET("/species", HandleSearchSpecies)
+	router.GET("/species/:species_id", HandleFetchSpecies)
+	router.POST("/households", HandleCreateHousehold)
+	router.GET("/households", HandleFetchHouseholds)
+	router.DELETE("/households/:household_id", HandleDeleteHousehold)
+	router.GET("/households/:household_id/members", HandleFetchHouseholdMembers)
+	router.PATCH("/households/:household_id/members/:user_id", HandleUpdateHouseholdMember)
+	router.DELETE("/households/:household_id/members/:user_id", HandleRemoveHouseholdMember)
+	router.POST("/households/:household_id/invites", HandleCreateHouseholdInvite)
+	router.GET("/households/:household_id/invites", HandleFetchHouseholdInvites)
+	router.DELETE("/households/:household_id/invites/:invite_id", HandleDeleteHouseholdInvite)
+	router.GET("/invites", HandleFetchMyInvites)
+	router.POST("/invites/accept", HandleAcceptHouseholdInvite)
+	router.POST("/tokens", HandleCreateAccessToken)
+	router.GET("/tokens", HandleFetchAccessTokens)
+	router.DELETE("/tokens/:token_id", HandleDeleteAccessToken)
+	router.POST("/devices", HandleRegisterDevice)
+	router.DELETE("/devices", HandleUnregisterDevice)
+	router.DELETE("/vacations/:vacation_id", HandleCancelVacation)
+	router.GET("/vacations/:vacation_id/summary", HandleFetchVacationSummary)
+	router.GET("/vacations/:vacation_id/sitter/schedule", HandleSitterFetchSchedule)
+	router.PATCH("/vacations/:vacation_id/sitter/schedules/:schedule_id", HandleSitterCompleteSchedule)
 
 	router.GET("/", func(c *gin.Context) {
 		c.JSON(http.StatusOK, gin.H{
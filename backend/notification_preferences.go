@@ -0,0 +1,131 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"time"
+)
+
+const (
+	BatchingSummary  = "summary"
+	BatchingPerPlant = "per_plant"
+)
+
+var notificationChannels = []string{"push", "email", "webhook"}
+
+// Every sender checks these before notifying someone. Quiet hours are
+// "HH:MM" in the user's timezone and may wrap past midnight.
+type NotificationPreferences struct {
+	Channels   []string `json:"channels"`
+	TaskTypes  []string `json:"task_types"`
+	QuietStart *string  `json:"quiet_start"`
+	QuietEnd   *string  `json:"quiet_end"`
+	Batching   string   `json:"batching"`
+	Timezone   string   `json:"timezone"`
+}
+
+// What users get before saving their own preferences: every task type, and
+// nothing overnight. Email and webhooks still need to be set up separately.
+func defaultNotificationPreferences() NotificationPreferences {
+	quietStart := "21:00"
+	quietEnd := fmt.Sprintf("%02d:00", reminderHour())
+	return NotificationPreferences{
+		Channels:   []string{"push", "email", "webhook"},
+		TaskTypes:  append([]string{}, careTaskTypes...),
+		QuietStart: &quietStart,
+		QuietEnd:   &quietEnd,
+		Batching:   BatchingSummary,
+		Timezone:   "UTC",
+	}
+}
+
+func (prefs NotificationPreferences) channelEnabled(channel string) bool {
+	return slices.Contains(prefs.Channels, channel)
+}
+
+// A task notifies when any of its types is one the user wants to hear about.
+func (prefs NotificationPreferences) wantsTask(task_types []string) bool {
+	if len(task_types) == 0 {
+		task_types = []string{"water"}
+	}
+	for _, taskType := range task_types {
+		if slices.Contains(prefs.TaskTypes, taskType) {
+			return true
+		}
+	}
+	return false
+}
+
+func (prefs NotificationPreferences) location() *time.Location {
+	location, err := time.LoadLocation(prefs.Timezone)
+	if err != nil {
+		return time.UTC
+	}
+	return location
+}
+
+func (prefs NotificationPreferences) inQuietHours(now time.Time) bool {
+	if prefs.QuietStart == nil || prefs.QuietEnd == nil {
+		return false
+	}
+
+	local := now.In(prefs.location()).Format("15:04")
+	start, end := *prefs.QuietStart, *prefs.QuietEnd
+	if start == end {
+		return false
+	}
+	if start < end {
+		return local >= start && local < end
+	}
+	return local >= start || local < end
+}
+
+// Checks a preferences payload from the API before it is stored.
+func validateNotificationPreferences(prefs NotificationPreferences) error {
+	for _, channel := range prefs.Channels {
+		if !slices.Contains(notificationChannels, channel) {
+			return fmt.Errorf("unknown channel %q", channel)
+		}
+	}
+	for _, taskType := range prefs.TaskTypes {
+		if !slices.Contains(careTaskTypes, taskType) {
+			return fmt.Errorf("unknown task type %q", taskType)
+		}
+	}
+
+	if (prefs.QuietStart == nil) != (prefs.QuietEnd == nil) {
+		return fmt.Errorf("quiet_start and quiet_end must be set together")
+	}
+	for _, value := range []*string{prefs.QuietStart, prefs.QuietEnd} {
+		if value == nil {
+			continue
+		}
+		if _, err := time.Parse("15:04", *value); err != nil {
+			return fmt.Errorf("quiet hours must be in HH:MM format")
+		}
+	}
+
+	if prefs.Batching != BatchingSummary && prefs.Batching != BatchingPerPlant {
+		return fmt.Errorf("batching must be %q or %q", BatchingSummary, BatchingPerPlant)
+	}
+	if _, err := time.LoadLocation(prefs.Timezone); err != nil {
+		return fmt.Errorf("unknown timezone %q", prefs.Timezone)
+	}
+	return nil
+}
+
+// Splits tasks into the notifications the user's batching asks for.
+func batchForPreferences[T any](prefs NotificationPreferences, items []T) [][]T {
+	if len(items) == 0 {
+		return nil
+	}
+	if prefs.Batching != BatchingPerPlant {
+		return [][]T{items}
+	}
+
+	batches := make([][]T, 0, len(items))
+	for _, item := range items {
+		batches = append(batches, []T{item})
+	}
+	return batches
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func strPtr(v string) *string {
+	return &v
+}
+
+func TestInQuietHours(t *testing.T) {
+	at := func(hour, minute int) time.Time {
+		return time.Date(2025, time.June, 10, hour, minute, 0, 0, time.UTC)
+	}
+
+	tests := []struct {
+		name       string
+		start, end *string
+		timezone   string
+		now        time.Time
+		want       bool
+	}{
+		{"no quiet hours", nil, nil, "UTC", at(3, 0), false},
+		{"wrapping, late evening", strPtr("21:00"), strPtr("08:00"), "UTC", at(22, 30), true},
+		{"wrapping, early morning", strPtr("21:00"), strPtr("08:00"), "UTC", at(7, 59), true},
+		{"wrapping, end is exclusive", strPtr("21:00"), strPtr("08:00"), "UTC", at(8, 0), false},
+		{"wrapping, daytime", strPtr("21:00"), strPtr("08:00"), "UTC", at(12, 0), false},
+		{"same day range", strPtr("13:00"), strPtr("15:00"), "UTC", at(14, 0), true},
+		{"same day range, outside", strPtr("13:00"), strPtr("15:00"), "UTC", at(16, 0), false},
+		{"equal start and end", strPtr("08:00"), strPtr("08:00"), "UTC", at(8, 0), false},
+		{"uses the user's timezone", strPtr("21:00"), strPtr("08:00"), "America/New_York", at(11, 0), true},
+		{"unknown timezone falls back to UTC", strPtr("21:00"), strPtr("08:00"), "Mars/Base", at(12, 0), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			prefs := NotificationPreferences{QuietStart: tt.start, QuietEnd: tt.end, Timezone: tt.timezone}
+			if got := prefs.inQuietHours(tt.now); got != tt.want {
+				t.Errorf("inQuietHours() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWantsTask(t *testing.T) {
+	prefs := NotificationPreferences{TaskTypes: []string{"water", "fertilize"}}
+
+	tests := []struct {
+		taskTypes []string
+		want      bool
+	}{
+		{nil, true},
+		{[]string{"water"}, true},
+		{[]string{"mist", "fertilize"}, true},
+		{[]string{"mist", "prune"}, false},
+	}
+
+	for _, tt := range tests {
+		if got := prefs.wantsTask(tt.taskTypes); got != tt.want {
+			t.Errorf("wantsTask(%q) = %v, want %v", tt.taskTypes, got, tt.want)
+		}
+	}
+}
+
+func TestValidateNotificationPreferences(t *testing.T) {
+	valid := func() NotificationPreferences {
+		prefs := defaultNotificationPreferences()
+		prefs.Timezone = "Europe/London"
+		return prefs
+	}
+
+	tests := []struct {
+		name    string
+		change  func(*NotificationPreferences)
+		wantErr bool
+	}{
+		{"defaults", func(*NotificationPreferences) {}, false},
+		{"no quiet hours", func(p *NotificationPreferences) { p.QuietStart, p.QuietEnd = nil, nil }, false},
+		{"unknown channel", func(p *NotificationPreferences) { p.Channels = []string{"sms"} }, true},
+		{"unknown task type", func(p *NotificationPreferences) { p.TaskTypes = []string{"sing"} }, true},
+		{"only one quiet bound", func(p *NotificationPreferences) { p.QuietEnd = nil }, true},
+		{"bad quiet time", func(p *NotificationPreferences) { p.QuietStart = strPtr("9pm") }, true},
+		{"unknown batching", func(p *NotificationPreferences) { p.Batching = "weekly" }, true},
+		{"unknown timezone", func(p *NotificationPreferences) { p.Timezone = "Mars/Base" }, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			prefs := valid()
+			tt.change(&prefs)
+			if err := validateNotificationPreferences(prefs); (err != nil) != tt.wantErr {
+				t.Errorf("validateNotificationPreferences() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestBatchForPreferences(t *testing.T) {
+	items := []int{1, 2, 3}
+
+	tests := []struct {
+		batching string
+		items    []int
+		want     int
+	}{
+		{BatchingSummary, items, 1},
+		{BatchingPerPlant, items, 3},
+		{"", items, 1},
+		{BatchingPerPlant, nil, 0},
+	}
+
+	for _, tt := range tests {
+		batches := batchForPreferences(NotificationPreferences{Batching: tt.batching}, tt.items)
+		if len(batches) != tt.want {
+			t.Errorf("batchForPreferences(%q) made %d batches, want %d", tt.batching, len(batches), tt.want)
+		}
+		total := 0
+		for _, batch := range batches {
+			total += len(batch)
+		}
+		if total != len(tt.items) {
+			t.Errorf("batchForPreferences(%q) kept %d items, want %d", tt.batching, total, len(tt.items))
+		}
+	}
+}
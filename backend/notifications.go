@@ -0,0 +1,262 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Who a notification goes to and how they can be reached on each channel.
+type Recipient struct {
+	UserID     string
+	PushTokens []string
+	Email      string
+	// Whether an active webhook endpoint subscribes to task.due
+	TaskDueWebhooks bool
+}
+
+type Notification struct {
+	Title string
+	Body  string
+	// Optional rich version for channels that can show it, like email
+	HTML string
+	Data map[string]any
+}
+
+// One attempt to reach one target (a device token, an email address...).
+type DeliveryResult struct {
+	Target   string `json:"target"`
+	TicketID string `json:"ticket_id"`
+	Status   string `json:"status"`
+	Error    string `json:"error"`
+}
+
+type Notifier interface {
+	Channel() string
+	// False when the recipient has nothing this channel can deliver to.
+	CanReach(recipient Recipient) bool
+	Send(recipient Recipient, notification Notification) ([]DeliveryResult, error)
+}
+
+// Implemented by notifiers whose provider confirms delivery after the fact.
+type ReceiptChecker interface {
+	CheckReceipts(ticket_ids []string) (map[string]DeliveryResult, error)
+}
+
+// A due or overdue task for one occurrence of a schedule. Recipient is the
+// owner, or their plant sitter while they are away.
+type DueReminder struct {
+	ScheduleID    int
+	PlantID       int
+	OwnerID       string
+	RecipientID   string
+	PlantPetName  string
+	ImageURL      string
+	DueDate       time.Time
+	LocalDate     time.Time
+	OccurrenceKey string
+	TaskTypes     []string
+	// Sent to someone other than the assignee because it's overdue
+	Escalated bool
+}
+
+func (reminder DueReminder) daysOverdue() int {
+	return int(reminder.LocalDate.Sub(reminder.DueDate).Hours() / 24)
+}
+
+func buildReminderNotification(reminders []DueReminder) Notification {
+	scheduleIDs := make([]int, 0, len(reminders))
+	names := make([]string, 0, len(reminders))
+	overdue := 0
+	escalated := 0
+	for _, reminder := range reminders {
+		scheduleIDs = append(scheduleIDs, reminder.ScheduleID)
+		names = append(names, reminder.PlantPetName)
+		if reminder.daysOverdue() > 0 {
+			overdue++
+		}
+		if reminder.Escalated {
+			escalated++
+		}
+	}
+
+	notification := Notification{
+		Title: "Time to water 🌱",
+		Data:  map[string]any{"schedule_ids": scheduleIDs},
+	}
+	// Everything here is someone else's overdue task
+	if escalated == len(reminders) {
+		notification.Title = "Can you help out? 🌱"
+	}
+
+	if len(reminders) == 1 {
+		reminder := reminders[0]
+		switch days := reminder.daysOverdue(); {
+		case days == 1:
+			notification.Body = reminder.PlantPetName + " was due for water yesterday"
+		case days > 1:
+			notification.Body = fmt.Sprintf("%s is %d days overdue for water", reminder.PlantPetName, days)
+		default:
+			notification.Body = reminder.PlantPetName + " needs water today"
+		}
+		notification.Data["plant_id"] = reminder.PlantID
+		return notification
+	}
+
+	listed := names
+	if len(names) > 3 {
+		listed = append(names[:3:3], fmt.Sprintf("%d more", len(names)-3))
+	}
+	notification.Body = joinNames(listed) + " need water"
+	if overdue > 0 {
+		notification.Body += fmt.Sprintf(" (%d overdue)", overdue)
+	}
+	return notification
+}
+
+func joinNames(names []string) string {
+	if len(names) <= 1 {
+		return strings.Join(names, "")
+	}
+	return strings.Join(names[:len(names)-1], ", ") + " and " + names[len(names)-1]
+}
+
+// Local hour the default quiet hours end, so nobody is woken at midnight.
+func reminderHour() int {
+	hour, err := strconv.Atoi(os.Getenv("REMINDER_HOUR"))
+	if err != nil || hour < 0 || hour > 23 {
+		return 8
+	}
+	return hour
+}
+
+// A batch the provider never accepted is retried this many times, waiting
+// twice as long each time.
+const (
+	maxReminderAttempts = 5
+	reminderRetryDelay  = 15 * time.Minute
+)
+
+// Expo keeps receipts for about a day after sending.
+const (
+	receiptCheckDelay = 15 * time.Minute
+	receiptExpiry     = 24 * time.Hour
+)
+
+type Dispatcher struct {
+	Notifiers []Notifier
+}
+
+// Sends every reminder that hasn't gone out yet on each channel. Reminders
+// are claimed in notification_log before sending, so an occurrence is
+// notified at most once per channel even if two dispatchers overlap.
+// Anything held back by quiet hours stays unclaimed and goes out later, and
+// a batch the provider didn't accept is claimed again once its retry is due.
+func (dispatcher *Dispatcher) Run() (int, error) {
+	sent := 0
+	for _, notifier := range dispatcher.Notifiers {
+		reminders, err := Handler.FetchDueReminders(notifier.Channel())
+		if err != nil {
+			return sent, err
+		}
+
+		byRecipient := map[string][]DueReminder{}
+		var order []string
+		for _, reminder := range reminders {
+			if _, ok := byRecipient[reminder.RecipientID]; !ok {
+				order = append(order, reminder.RecipientID)
+			}
+			byRecipient[reminder.RecipientID] = append(byRecipient[reminder.RecipientID], reminder)
+		}
+
+		for _, recipientID := range order {
+			recipient, err := Handler.FetchRecipient(recipientID)
+			if err != nil {
+				return sent, err
+			}
+			if !notifier.CanReach(recipient) {
+				continue
+			}
+
+			prefs, err := Handler.FetchNotificationPreferences(recipientID)
+			if err != nil {
+				return sent, err
+			}
+			if prefs.inQuietHours(time.Now()) {
+				continue
+			}
+
+			for _, batch := range batchForPreferences(prefs, byRecipient[recipientID]) {
+				n, err := dispatcher.deliver(notifier, recipient, batch)
+				if err != nil {
+					fmt.Println("ERROR delivering", notifier.Channel(), "reminders to", recipientID, err)
+					continue
+				}
+				sent += n
+			}
+		}
+
+		if checker, ok := notifier.(ReceiptChecker); ok {
+			if err := dispatcher.checkReceipts(notifier.Channel(), checker); err != nil {
+				fmt.Println("ERROR checking", notifier.Channel(), "receipts:", err)
+			}
+		}
+	}
+	return sent, nil
+}
+
+func (dispatcher *Dispatcher) deliver(notifier Notifier, recipient Recipient, reminders []DueReminder) (int, error) {
+	batchID, err := generateToken(16)
+	if err != nil {
+		return 0, err
+	}
+
+	claimed, err := Handler.ClaimReminders(batchID, notifier.Channel(), reminders)
+	if err != nil || len(claimed) == 0 {
+		return 0, err
+	}
+
+	results, sendErr := notifier.Send(recipient, buildReminderNotification(claimed))
+	if err := Handler.RecordDeliveries(batchID, recipient.UserID, notifier.Channel(), results, sendErr); err != nil {
+		return 0, err
+	}
+	if sendErr != nil {
+		return 0, sendErr
+	}
+	return len(claimed), nil
+}
+
+// Providers like Expo only know whether a push reached the device some time
+// after accepting it.
+func (dispatcher *Dispatcher) checkReceipts(channel string, checker ReceiptChecker) error {
+	if err := Handler.ExpireUncheckedTickets(channel, receiptExpiry); err != nil {
+		return err
+	}
+
+	ticketIDs, err := Handler.FetchUncheckedTickets(channel, receiptCheckDelay, receiptExpiry)
+	if err != nil || len(ticketIDs) == 0 {
+		return err
+	}
+
+	receipts, err := checker.CheckReceipts(ticketIDs)
+	if err != nil {
+		return err
+	}
+	return Handler.RecordReceipts(channel, receipts)
+}
+
+func StartNotificationDispatcher(dispatcher *Dispatcher, interval time.Duration) {
+	go func() {
+		for {
+			sent, err := dispatcher.Run()
+			if err != nil {
+				fmt.Println("ERROR dispatching notifications:", err)
+			} else if sent > 0 {
+				fmt.Println("Reminders sent:", sent)
+			}
+			time.Sleep(interval)
+		}
+	}()
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDaysOverdue(t *testing.T) {
+	tests := []struct {
+		due, local time.Time
+		want       int
+	}{
+		{testDate(2025, time.June, 10), testDate(2025, time.June, 10), 0},
+		{testDate(2025, time.June, 9), testDate(2025, time.June, 10), 1},
+		{testDate(2025, time.May, 31), testDate(2025, time.June, 3), 3},
+	}
+
+	for _, tt := range tests {
+		reminder := DueReminder{DueDate: tt.due, LocalDate: tt.local}
+		if got := reminder.daysOverdue(); got != tt.want {
+			t.Errorf("daysOverdue(%s, %s) = %d, want %d", tt.due.Format("2006-01-02"), tt.local.Format("2006-01-02"), got, tt.want)
+		}
+	}
+}
+
+func TestJoinNames(t *testing.T) {
+	tests := []struct {
+		names []string
+		want  string
+	}{
+		{nil, ""},
+		{[]string{"Fern"}, "Fern"},
+		{[]string{"Fern", "Basil"}, "Fern and Basil"},
+		{[]string{"Fern", "Basil", "Monty"}, "Fern, Basil and Monty"},
+	}
+
+	for _, tt := range tests {
+		if got := joinNames(tt.names); got != tt.want {
+			t.Errorf("joinNames(%q) = %q, want %q", tt.names, got, tt.want)
+		}
+	}
+}
+
+func TestBuildReminderNotification(t *testing.T) {
+	today := testDate(2025, time.June, 10)
+	reminder := func(id int, name string, daysLate int, escalated bool) DueReminder {
+		return DueReminder{
+			ScheduleID:   id,
+			PlantID:      id * 10,
+			PlantPetName: name,
+			DueDate:      today.AddDate(0, 0, -daysLate),
+			LocalDate:    today,
+			Escalated:    escalated,
+		}
+	}
+
+	tests := []struct {
+		name      string
+		reminders []DueReminder
+		wantTitle string
+		wantBody  string
+	}{
+		{"due today", []DueReminder{reminder(1, "Fern", 0, false)}, "Time to water 🌱", "Fern needs water today"},
+		{"due yesterday", []DueReminder{reminder(1, "Fern", 1, false)}, "Time to water 🌱", "Fern was due for water yesterday"},
+		{"several days late", []DueReminder{reminder(1, "Fern", 4, false)}, "Time to water 🌱", "Fern is 4 days overdue for water"},
+		{
+			"someone else's task",
+			[]DueReminder{reminder(1, "Fern", 3, true)},
+			"Can you help out? 🌱", "Fern is 3 days overdue for water",
+		},
+		{
+			"a few plants",
+			[]DueReminder{reminder(1, "Fern", 0, false), reminder(2, "Basil", 2, true)},
+			"Time to water 🌱", "Fern and Basil need water (1 overdue)",
+		},
+		{
+			"more than three plants",
+			[]DueReminder{
+				reminder(1, "Fern", 0, false), reminder(2, "Basil", 0, false), reminder(3, "Monty", 0, false),
+				reminder(4, "Cactus", 0, false), reminder(5, "Ivy", 0, false),
+			},
+			"Time to water 🌱", "Fern, Basil, Monty and 2 more need water",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			notification := buildReminderNotification(tt.reminders)
+			if notification.Title != tt.wantTitle {
+				t.Errorf("Title = %q, want %q", notification.Title, tt.wantTitle)
+			}
+			if notification.Body != tt.wantBody {
+				t.Errorf("Body = %q, want %q", notification.Body, tt.wantBody)
+			}
+
+			var wantIDs []int
+			for _, reminder := range tt.reminders {
+				wantIDs = append(wantIDs, reminder.ScheduleID)
+			}
+			if got := notification.Data["schedule_ids"]; !reflect.DeepEqual(got, wantIDs) {
+				t.Errorf("schedule_ids = %v, want %v", got, wantIDs)
+			}
+			_, hasPlant := notification.Data["plant_id"]
+			if hasPlant != (len(tt.reminders) == 1) {
+				t.Errorf("plant_id present = %v with %d reminders", hasPlant, len(tt.reminders))
+			}
+		})
+	}
+}
+
+func TestBuildReminderNotificationKeepsNames(t *testing.T) {
+	reminders := make([]DueReminder, 5)
+	for i, name := range []string{"A", "B", "C", "D", "E"} {
+		reminders[i] = DueReminder{ScheduleID: i, PlantPetName: name}
+	}
+	buildReminderNotification(reminders)
+	for i, name := range []string{"A", "B", "C", "D", "E"} {
+		if reminders[i].PlantPetName != name {
+			t.Fatalf("reminder %d renamed to %q", i, reminders[i].PlantPetName)
+		}
+	}
+}
+
+func TestReminderHour(t *testing.T) {
+	tests := []struct {
+		env  string
+		want int
+	}{
+		{"", 8},
+		{"7", 7},
+		{"0", 0},
+		{"23", 23},
+		{"24", 8},
+		{"-1", 8},
+		{"seven", 8},
+	}
+
+	for _, tt := range tests {
+		t.Setenv("REMINDER_HOUR", tt.env)
+		if got := reminderHour(); got != tt.want {
+			t.Errorf("reminderHour() with %q = %d, want %d", tt.env, got, tt.want)
+		}
+	}
+}
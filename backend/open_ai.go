@@ -44,12 +44,14 @@ type OpenAIResponse struct {
 }
 
 type PlantClassification struct {
-	PlantName        string `json:"plant_name"`
-	ScientificName   string `json:"scientific_name"`
-	Species          string `json:"species"`
-	WaterRepeatEvery int    `json:"water_repeat_every"`
-	WaterRepeatUnit  string `json:"water_repeat_unit"`
-	PlantHealth      int    `json:"plant_health"`
+	PlantName        string  `json:"plant_name"`
+	ScientificName   string  `json:"scientific_name"`
+	Species          string  `json:"species"`
+	WaterRepeatEvery int     `json:"water_repeat_every"`
+	WaterRepeatUnit  string  `json:"water_repeat_unit"`
+	WaterAmount      string  `json:"water_amount"`
+	PlantHealth      int     `json:"plant_health"`
+	Confidence       float64 `json:"confidence"`
 }
 
 // Function to classify plant using OpenAI Vision API
@@ -62,6 +64,8 @@ func classifyPlantWithOpenAI(imageURL string, openaiAPIKey string) (*PlantClassi
 	3. Plant species/variety if identifiable
 	5. How often to water this specific plant
 	6. The current health of the plant on a scale from 1 - 100
+	7. How confident you are in the identification, from 0 to 1
+	8. How much water to give it each time, in ml
    
 	Respond ONLY in valid JSON format like this:
 	{
@@ -70,7 +74,9 @@ func classifyPlantWithOpenAI(imageURL string, openaiAPIKey string) (*PlantClassi
 		"species": "Specific species or variety",
 		"water_repeat_every": "some number",
 		"water_repeat_unit": "a unit of measurement correlated to the water_repeat_every field",
-		"plant_health": "a number representing the current health of this plant"
+		"water_amount": "how much water to give each time, like 250 ml",
+		"plant_health": "a number representing the current health of this plant",
+		"confidence": "a number from 0 to 1 for how sure you are of the identification"
 	}
 		
 	Example 1:
@@ -82,11 +88,65 @@ func classifyPlantWithOpenAI(imageURL string, openaiAPIKey string) (*PlantClassi
 		"species": "deliciosa",
 		"water_repeat_every": 7,
 		"water_repeat_unit": "days",
+		"water_amount": "500 ml",
+		"plant_health": 83,
+		"confidence": 0.95
+	}
+	Do not include any explanation or markdown formatting, just the JSON.
+	`
+
+	content, err := askOpenAIAboutImage(prompt, imageURL, openaiAPIKey)
+	if err != nil {
+		return nil, err
+	}
+
+	// Parse the plant classification
+	var classification PlantClassification
+	if err := json.Unmarshal([]byte(content), &classification); err != nil {
+		// Callers fall back to the offline care rules
+		return nil, fmt.Errorf("failed to parse classification: %v", err)
+	}
+	fmt.Println("classification", classification)
+	return &classification, nil
+}
+
+// Scores a photo of a plant whose species we already know, for adds that
+// skip classification. Unlike classifyPlantWithOpenAI a bad answer is an
+// error rather than a default.
+func checkPlantHealthWithOpenAI(imageURL string, openaiAPIKey string, species string) (int, error) {
+	prompt := `This is a photo of a ` + species + ` plant. Rate its current health on a scale from 1 - 100,
+	with 1 being nearly dead and 100 being in perfect condition.
+
+	Respond ONLY in valid JSON format like this:
+	{
 		"plant_health": 83
 	}
 	Do not include any explanation or markdown formatting, just the JSON.
 	`
 
+	content, err := askOpenAIAboutImage(prompt, imageURL, openaiAPIKey)
+	if err != nil {
+		return 0, err
+	}
+	return parseHealthCheck(content)
+}
+
+func parseHealthCheck(content string) (int, error) {
+	var answer struct {
+		PlantHealth int `json:"plant_health"`
+	}
+	if err := json.Unmarshal([]byte(content), &answer); err != nil {
+		return 0, fmt.Errorf("failed to parse health check: %v", err)
+	}
+	if answer.PlantHealth < 1 || answer.PlantHealth > 100 {
+		return 0, fmt.Errorf("health score %d out of range", answer.PlantHealth)
+	}
+	return answer.PlantHealth, nil
+}
+
+// Sends the prompt and image to the vision model and returns its answer,
+// with any markdown code fence stripped.
+func askOpenAIAboutImage(prompt string, imageURL string, openaiAPIKey string) (string, error) {
 	// Prepare the request payload
 	requestPayload := OpenAIRequest{
 		Model: "gpt-4o", // or "gpt-4o" if available
@@ -113,13 +173,13 @@ func classifyPlantWithOpenAI(imageURL string, openaiAPIKey string) (*PlantClassi
 	// Convert to JSON
 	jsonData, err := json.Marshal(requestPayload)
 	if err != nil {
-		return nil, fmt.Errorf("failed to marshal request: %v", err)
+		return "", fmt.Errorf("failed to marshal request: %v", err)
 	}
 
 	// Create HTTP request
 	req, err := http.NewRequest("POST", "https://api.openai.com/v1/chat/completions", bytes.NewBuffer(jsonData))
 	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %v", err)
+		return "", fmt.Errorf("failed to create request: %v", err)
 	}
 
 	// Set headers
@@ -130,7 +190,7 @@ func classifyPlantWithOpenAI(imageURL string, openaiAPIKey string) (*PlantClassi
 	client := &http.Client{}
 	resp, err := client.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("failed to make request: %v", err)
+		return "", fmt.Errorf("failed to make request: %v", err)
 	}
 	defer resp.Body.Close()
 
@@ -138,23 +198,23 @@ func classifyPlantWithOpenAI(imageURL string, openaiAPIKey string) (*PlantClassi
 	body, err := io.ReadAll(resp.Body)
 	fmt.Println("BODY", body)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read response: %v", err)
+		return "", fmt.Errorf("failed to read response: %v", err)
 	}
 
 	// Parse response
 	var openaiResp OpenAIResponse
 	if err := json.Unmarshal(body, &openaiResp); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal response: %v", err)
+		return "", fmt.Errorf("failed to unmarshal response: %v", err)
 	}
 	fmt.Println("OPENAIRESPONSE", openaiResp)
 	// Check for API errors
 	if openaiResp.Error != nil {
-		return nil, fmt.Errorf("OpenAI API error: %s", openaiResp.Error.Message)
+		return "", fmt.Errorf("OpenAI API error: %s", openaiResp.Error.Message)
 	}
 
 	// Check if we got a response
 	if len(openaiResp.Choices) == 0 {
-		return nil, fmt.Errorf("no response from OpenAI")
+		return "", fmt.Errorf("no response from OpenAI")
 	}
 
 	// Extract and parse the JSON content
@@ -166,19 +226,5 @@ func classifyPlantWithOpenAI(imageURL string, openaiAPIKey string) (*PlantClassi
 	content = strings.TrimSuffix(content, "```")
 	content = strings.TrimSpace(content)
 
-	// Parse the plant classification
-	var classification PlantClassification
-	if err := json.Unmarshal([]byte(content), &classification); err != nil {
-		// If JSON parsing fails, return default values
-		return &PlantClassification{
-			PlantName:        "Unknown Plant",
-			ScientificName:   "Unknown Species",
-			Species:          "Unknown",
-			WaterRepeatEvery: 1,
-			WaterRepeatUnit:  "day",
-			PlantHealth:      100,
-		}, nil
-	}
-	fmt.Println("classification", classification)
-	return &classification, nil
+	return content, nil
 }
@@ -0,0 +1,33 @@
+package main
+
+import "testing"
+
+func TestParseHealthCheck(t *testing.T) {
+	tests := []struct {
+		content string
+		want    int
+		wantErr bool
+	}{
+		{`{"plant_health": 83}`, 83, false},
+		{`{"plant_health": 1}`, 1, false},
+		{`{"plant_health": 100}`, 100, false},
+		{`{"plant_health": 0}`, 0, true},
+		{`{"plant_health": 101}`, 0, true},
+		{`{"health": 80}`, 0, true},
+		{`{"plant_health": "good"}`, 0, true},
+		{`It looks healthy`, 0, true},
+		{``, 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.content, func(t *testing.T) {
+			got, err := parseHealthCheck(tt.content)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseHealthCheck(%q) error = %v, wantErr %v", tt.content, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("parseHealthCheck(%q) = %d, want %d", tt.content, got, tt.want)
+			}
+		})
+	}
+}
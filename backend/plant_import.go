@@ -0,0 +1,412 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Enough for a big spreadsheet, the plant limit still applies on top.
+const maxImportRows = 500
+
+// A plant to import, from one CSV line or JSON object. Line counts the CSV
+// header, so it matches what a spreadsheet shows.
+type ImportRow struct {
+	Line        int
+	Name        string
+	Species     string
+	PetName     string
+	LastWatered string
+	Interval    string
+	PhotoURL    string
+	CareLog     []ImportCareEvent
+	// Whatever else the export had, kept on the plant as import_metadata
+	Metadata map[string]any
+}
+
+// Something done to the plant before it was imported, as the export had it.
+type ImportCareEvent struct {
+	Action string
+	Date   string
+	Notes  string
+	// The rest of the event's fields, kept on the care history entry
+	Metadata map[string]any
+}
+
+// What happened to one row, or would have on a dry run.
+type ImportRowResult struct {
+	Line             int        `json:"line"`
+	PetName          string     `json:"plant_pet_name"`
+	PlantName        string     `json:"plant_name"`
+	ScientificName   string     `json:"scientific_name"`
+	Species          string     `json:"species"`
+	PhotoURL         string     `json:"photo_url,omitempty"`
+	LastWatered      *time.Time `json:"last_watered"`
+	WaterRepeatEvery int        `json:"water_repeat_every"`
+	WaterRepeatUnit  string     `json:"water_repeat_unit"`
+	// Where the interval came from: the row itself, the gaps between
+	// waterings in its care log, the species catalog, plants we already know
+	// of that species, or the AI looking at the photo.
+	IntervalSource string             `json:"interval_source,omitempty"`
+	SpeciesID      *int               `json:"species_id,omitempty"`
+	CareEvents     int                `json:"care_events,omitempty"`
+	Metadata       map[string]any     `json:"metadata,omitempty"`
+	PlantID        int                `json:"plant_id,omitempty"`
+	Errors         []string           `json:"errors,omitempty"`
+	CareLog        []CareHistoryEntry `json:"-"`
+}
+
+type ImportReport struct {
+	Format   string            `json:"format"`
+	DryRun   bool              `json:"dry_run"`
+	Valid    int               `json:"valid"`
+	Invalid  int               `json:"invalid"`
+	Imported int               `json:"imported"`
+	Rows     []ImportRowResult `json:"rows"`
+}
+
+// Names and interval that plants of a species have been given before.
+type SpeciesDefaults struct {
+	PlantName      string
+	ScientificName string
+	Species        string
+	RepeatDays     int
+}
+
+// Reads an export in the given format (see importers).
+func parseImportRows(format string, body io.Reader) ([]ImportRow, error) {
+	importer, err := importerFor(format)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := importer.Parse(body)
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) > maxImportRows {
+		return nil, fmt.Errorf("too many plants (%d), the most one import can take is %d", len(rows), maxImportRows)
+	}
+	return rows, nil
+}
+
+// Accepts "7", "7 days", "2 weeks" or "every 3 days".
+func parseImportInterval(interval string) (int, string, error) {
+	fields := strings.Fields(strings.ToLower(interval))
+	if len(fields) > 0 && fields[0] == "every" {
+		fields = fields[1:]
+	}
+	if len(fields) == 0 || len(fields) > 2 {
+		return 0, "", fmt.Errorf("interval %q should look like \"7\" or \"2 weeks\"", interval)
+	}
+
+	every, err := strconv.Atoi(fields[0])
+	if err != nil || every < 1 {
+		return 0, "", fmt.Errorf("interval %q should start with a whole number of at least 1", interval)
+	}
+
+	unit := "day"
+	if len(fields) == 2 {
+		unit = strings.TrimSuffix(fields[1], "s")
+		if unit != "day" && unit != "week" && unit != "month" {
+			return 0, "", fmt.Errorf("interval unit %q must be days, weeks or months", fields[1])
+		}
+	}
+	if intervalInDays(every, unit) > 365 {
+		return 0, "", fmt.Errorf("interval %q is longer than a year", interval)
+	}
+	return every, unit, nil
+}
+
+func parseImportDate(date string, today time.Time) (time.Time, error) {
+	for _, layout := range []string{"2006-01-02", time.RFC3339} {
+		if parsed, err := time.Parse(layout, date); err == nil {
+			day := time.Date(parsed.Year(), parsed.Month(), parsed.Day(), 0, 0, 0, 0, time.UTC)
+			if day.After(today) {
+				return time.Time{}, fmt.Errorf("last_watered %s is in the future", date)
+			}
+			return day, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("last_watered %q must be a date like 2024-05-31", date)
+}
+
+// Checks everything that doesn't need the database.
+func validateImportRow(row ImportRow, today time.Time) ImportRowResult {
+	result := ImportRowResult{
+		Line:           row.Line,
+		PetName:        row.PetName,
+		PlantName:      row.Name,
+		ScientificName: row.Species,
+		Species:        row.Species,
+		PhotoURL:       row.PhotoURL,
+		Metadata:       row.Metadata,
+	}
+
+	if row.Name == "" && row.Species == "" {
+		result.Errors = append(result.Errors, "name or species is required")
+	}
+	if result.PlantName == "" {
+		result.PlantName = row.Species
+	}
+	if result.PetName == "" {
+		result.PetName = result.PlantName
+	}
+	if len(result.PetName) > 75 {
+		result.Errors = append(result.Errors, "pet name is longer than 75 characters")
+	}
+
+	if row.LastWatered != "" {
+		day, err := parseImportDate(row.LastWatered, today)
+		if err != nil {
+			result.Errors = append(result.Errors, err.Error())
+		} else {
+			result.LastWatered = &day
+		}
+	}
+
+	if row.Interval != "" {
+		every, unit, err := parseImportInterval(row.Interval)
+		if err != nil {
+			result.Errors = append(result.Errors, err.Error())
+		} else {
+			result.WaterRepeatEvery, result.WaterRepeatUnit, result.IntervalSource = every, unit, "row"
+		}
+	}
+
+	var waterings []time.Time
+	for _, event := range row.CareLog {
+		day, err := parseImportDate(event.Date, today)
+		if err != nil {
+			result.Errors = append(result.Errors, "care log: "+err.Error())
+			continue
+		}
+		action, notes := importCareAction(event.Action, event.Notes)
+		result.CareLog = append(result.CareLog, CareHistoryEntry{Action: action, Notes: notes, ActionDate: &day, Metadata: event.Metadata})
+		if action == "water" {
+			waterings = append(waterings, day)
+			if result.LastWatered == nil || day.After(*result.LastWatered) {
+				result.LastWatered = &day
+			}
+		}
+	}
+	result.CareEvents = len(result.CareLog)
+	if result.IntervalSource == "" {
+		if days := intervalFromWaterings(waterings); days > 0 {
+			result.WaterRepeatEvery, result.WaterRepeatUnit, result.IntervalSource = days, "day", "care_log"
+		}
+	}
+
+	if row.PhotoURL != "" {
+		parsed, err := url.Parse(row.PhotoURL)
+		if err != nil || parsed.Host == "" || (parsed.Scheme != "http" && parsed.Scheme != "https") {
+			result.Errors = append(result.Errors, "photo_url must be an absolute http or https URL")
+		}
+	}
+
+	return result
+}
+
+// Fills in names and the interval from the species catalog, or failing that
+// from plants we already know of that species. Unknown species with a photo
+// are sent to the AI, except on a dry run, where the report just says it
+// would be. If the AI can't identify it the care rules pick an interval from
+// the names instead.
+func resolveImportSpecies(result *ImportRowResult, row ImportRow, dry_run bool) error {
+	species, err := Handler.ResolveSpecies(row.Species, row.Name)
+	if err != nil {
+		return err
+	}
+	if species != nil {
+		result.SpeciesID = &species.SpeciesID
+		if row.Name == "" {
+			result.PlantName = species.CommonName
+		}
+		result.ScientificName, result.Species = species.ScientificName, species.ScientificName
+		if result.IntervalSource == "" {
+			result.WaterRepeatEvery, result.WaterRepeatUnit, result.IntervalSource = species.WaterEveryDays, "day", "catalog"
+		}
+		return nil
+	}
+
+	for _, name := range []string{row.Species, row.Name} {
+		if name == "" {
+			continue
+		}
+		defaults, found, err := Handler.KnownSpeciesDefaults(name)
+		if err != nil {
+			return err
+		}
+		if !found {
+			continue
+		}
+
+		if row.Name == "" {
+			result.PlantName = defaults.PlantName
+		}
+		result.ScientificName, result.Species = defaults.ScientificName, defaults.Species
+		if result.IntervalSource == "" {
+			result.WaterRepeatEvery, result.WaterRepeatUnit, result.IntervalSource = defaults.RepeatDays, "day", "species"
+		}
+		return nil
+	}
+
+	if result.IntervalSource != "" {
+		return nil
+	}
+	if row.PhotoURL == "" {
+		result.Errors = append(result.Errors, "interval is required for species we don't know yet")
+		return nil
+	}
+
+	result.IntervalSource = "ai"
+	if dry_run {
+		return nil
+	}
+	classification, err := classifyPlantWithOpenAI(row.PhotoURL, os.Getenv("OPENAI_API_KEY"))
+	if err != nil {
+		fmt.Println(err)
+		care := recommendCare(careConditionsFor(nil, row.Name, row.Species))
+		result.WaterRepeatEvery, result.WaterRepeatUnit, result.IntervalSource = care.WaterEveryDays, "day", "rules"
+		return nil
+	}
+	result.PlantName, result.ScientificName, result.Species = classification.PlantName, classification.ScientificName, classification.Species
+	result.WaterRepeatEvery, result.WaterRepeatUnit = classification.WaterRepeatEvery, classification.WaterRepeatUnit
+	if species := resolveClassification(classification); species != nil {
+		result.SpeciesID = &species.SpeciesID
+	} else if classification.Unsure() {
+		care := recommendCare(careConditionsFor(nil, row.Name, classification.PlantName, classification.ScientificName))
+		result.WaterRepeatEvery, result.WaterRepeatUnit, result.IntervalSource = care.WaterEveryDays, "day", "rules"
+	}
+	return nil
+}
+
+// Checks every row and the plant limit without touching the catalog or the
+// AI, counting rows against the limit in file order.
+func validateImportRows(rows []ImportRow, today time.Time, count int) []ImportRowResult {
+	results := make([]ImportRowResult, 0, len(rows))
+	for _, row := range rows {
+		result := validateImportRow(row, today)
+		if len(result.Errors) == 0 && count >= maxPlantsPerUser {
+			result.Errors = append(result.Errors, fmt.Sprintf("over the limit of %d plants", maxPlantsPerUser))
+		}
+		if len(result.Errors) == 0 {
+			count++
+		}
+		results = append(results, result)
+	}
+	return results
+}
+
+// Recounts the valid and invalid rows.
+func (report *ImportReport) tally() {
+	report.Valid, report.Invalid = 0, 0
+	for _, result := range report.Rows {
+		if len(result.Errors) > 0 {
+			report.Invalid++
+		} else {
+			report.Valid++
+		}
+	}
+}
+
+// Validates every row and, unless it's a dry run or any row is invalid,
+// creates all the plants and schedules in one transaction.
+func importPlants(user_id string, format string, rows []ImportRow, dry_run bool) (ImportReport, error) {
+	report := ImportReport{Format: format, DryRun: dry_run}
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+
+	count, err := Handler.CountPlants(user_id)
+	if err != nil {
+		return report, err
+	}
+
+	// Every row is checked before any species is resolved, so a file with a
+	// bad row never costs an AI call
+	report.Rows = validateImportRows(rows, today, count)
+	report.tally()
+	if report.Invalid > 0 || report.Valid == 0 {
+		return report, nil
+	}
+
+	for i, row := range rows {
+		if err := resolveImportSpecies(&report.Rows[i], row, dry_run); err != nil {
+			return report, err
+		}
+	}
+	report.tally()
+	if dry_run || report.Invalid > 0 {
+		return report, nil
+	}
+
+	if err := Handler.ImportPlants(user_id, report.Rows); err != nil {
+		return report, err
+	}
+	report.Imported = report.Valid
+
+	// Apply the current season to the imported intervals
+	if _, err := Handler.RecalculateSeasonalIntervals(user_id); err != nil {
+		fmt.Println(err)
+	}
+	return report, nil
+}
+
+// go run . import -user <uuid> -file plants.csv [-dry-run]
+func runImportCommand(args []string) int {
+	flags := flag.NewFlagSet("import", flag.ContinueOnError)
+	userID := flags.String("user", "", "id of the user to import plants for")
+	path := flags.String("file", "", "CSV or JSON file to import")
+	format := flags.String("format", "", "csv, json or journal (default: csv or json from the file extension)")
+	dryRun := flags.Bool("dry-run", false, "validate and report without creating anything")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if *userID == "" || *path == "" {
+		fmt.Fprintln(os.Stderr, "usage: import -user <uuid> -file <path> [-format csv|json|journal] [-dry-run]")
+		return 2
+	}
+	if *format == "" {
+		*format = "csv"
+		if strings.HasSuffix(strings.ToLower(*path), ".json") {
+			*format = "json"
+		}
+	}
+
+	file, err := os.Open(*path)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error opening file:", err)
+		return 1
+	}
+	defer file.Close()
+
+	rows, err := parseImportRows(*format, file)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error reading file:", err)
+		return 1
+	}
+
+	if err := InitDatabaseHandler(os.Getenv("CONN_STRING")); err != nil {
+		fmt.Fprintln(os.Stderr, "Error connecting to database:", err)
+		return 1
+	}
+
+	report, err := importPlants(*userID, *format, rows, *dryRun)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error importing plants:", err)
+		return 1
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(report)
+	if report.Invalid > 0 {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseImportInterval(t *testing.T) {
+	tests := []struct {
+		interval  string
+		wantEvery int
+		wantUnit  string
+		wantErr   bool
+	}{
+		{"7", 7, "day", false},
+		{"7 days", 7, "day", false},
+		{"1 day", 1, "day", false},
+		{"2 weeks", 2, "week", false},
+		{"Every 3 Days", 3, "day", false},
+		{"1 month", 1, "month", false},
+		{"12 months", 12, "month", false},
+		{"13 months", 0, "", true},
+		{"366", 0, "", true},
+		{"0", 0, "", true},
+		{"-2 days", 0, "", true},
+		{"2 years", 0, "", true},
+		{"weekly", 0, "", true},
+		{"every", 0, "", true},
+		{"every 2 weeks or so", 0, "", true},
+		{"", 0, "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.interval, func(t *testing.T) {
+			every, unit, err := parseImportInterval(tt.interval)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseImportInterval(%q) error = %v, wantErr %v", tt.interval, err, tt.wantErr)
+			}
+			if every != tt.wantEvery || unit != tt.wantUnit {
+				t.Errorf("parseImportInterval(%q) = (%d, %q), want (%d, %q)", tt.interval, every, unit, tt.wantEvery, tt.wantUnit)
+			}
+		})
+	}
+}
+
+func TestParseImportDate(t *testing.T) {
+	today := time.Date(2025, time.March, 10, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		date    string
+		want    time.Time
+		wantErr bool
+	}{
+		{"2025-03-01", time.Date(2025, time.March, 1, 0, 0, 0, 0, time.UTC), false},
+		{"2025-03-10", today, false},
+		{"2025-03-09T18:45:00Z", time.Date(2025, time.March, 9, 0, 0, 0, 0, time.UTC), false},
+		{"2025-03-11", time.Time{}, true},
+		{"03/01/2025", time.Time{}, true},
+		{"yesterday", time.Time{}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.date, func(t *testing.T) {
+			got, err := parseImportDate(tt.date, today)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseImportDate(%q) error = %v, wantErr %v", tt.date, err, tt.wantErr)
+			}
+			if !got.Equal(tt.want) {
+				t.Errorf("parseImportDate(%q) = %v, want %v", tt.date, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateImportRow(t *testing.T) {
+	today := time.Date(2025, time.March, 10, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name            string
+		row             ImportRow
+		wantErrors      int
+		wantPetName     string
+		wantEvery       int
+		wantSource      string
+		wantLastWatered string
+	}{
+		{
+			name:        "name and interval",
+			row:         ImportRow{Line: 2, Name: "Monstera", Interval: "7 days"},
+			wantPetName: "Monstera", wantEvery: 7, wantSource: "row",
+		},
+		{
+			name:        "species stands in for the name",
+			row:         ImportRow{Line: 2, Species: "Ficus lyrata", PetName: "Figgy"},
+			wantPetName: "Figgy",
+		},
+		{
+			name:       "neither name nor species",
+			row:        ImportRow{Line: 2, Interval: "7"},
+			wantErrors: 1, wantEvery: 7, wantSource: "row",
+		},
+		{
+			name:        "pet name too long",
+			row:         ImportRow{Line: 2, Name: "Monstera", PetName: strings.Repeat("a", 76)},
+			wantErrors:  1,
+			wantPetName: strings.Repeat("a", 76),
+		},
+		{
+			name:        "bad interval and date",
+			row:         ImportRow{Line: 2, Name: "Monstera", Interval: "often", LastWatered: "2025-04-01"},
+			wantErrors:  2,
+			wantPetName: "Monstera",
+		},
+		{
+			name:        "relative photo URL",
+			row:         ImportRow{Line: 2, Name: "Monstera", PhotoURL: "/photos/monstera.jpg"},
+			wantErrors:  1,
+			wantPetName: "Monstera",
+		},
+		{
+			name: "interval and last watered from the care log",
+			row: ImportRow{Line: 2, Name: "Monstera", CareLog: []ImportCareEvent{
+				{Action: "water", Date: "2025-02-20"},
+				{Action: "water", Date: "2025-02-27"},
+				{Action: "water", Date: "2025-03-06"},
+			}},
+			wantPetName: "Monstera", wantEvery: 7, wantSource: "care_log", wantLastWatered: "2025-03-06",
+		},
+		{
+			name: "row interval beats the care log",
+			row: ImportRow{Line: 2, Name: "Monstera", Interval: "10", LastWatered: "2025-03-08", CareLog: []ImportCareEvent{
+				{Action: "water", Date: "2025-02-20"},
+				{Action: "water", Date: "2025-02-27"},
+			}},
+			wantPetName: "Monstera", wantEvery: 10, wantSource: "row", wantLastWatered: "2025-03-08",
+		},
+		{
+			name:        "bad care log date",
+			row:         ImportRow{Line: 2, Name: "Monstera", CareLog: []ImportCareEvent{{Action: "water", Date: "soon"}}},
+			wantErrors:  1,
+			wantPetName: "Monstera",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := validateImportRow(tt.row, today)
+			if len(got.Errors) != tt.wantErrors {
+				t.Errorf("errors = %q, want %d", got.Errors, tt.wantErrors)
+			}
+			if got.PetName != tt.wantPetName {
+				t.Errorf("PetName = %q, want %q", got.PetName, tt.wantPetName)
+			}
+			if got.WaterRepeatEvery != tt.wantEvery || got.IntervalSource != tt.wantSource {
+				t.Errorf("interval = (%d, %q), want (%d, %q)", got.WaterRepeatEvery, got.IntervalSource, tt.wantEvery, tt.wantSource)
+			}
+			lastWatered := ""
+			if got.LastWatered != nil {
+				lastWatered = got.LastWatered.Format("2006-01-02")
+			}
+			if lastWatered != tt.wantLastWatered {
+				t.Errorf("LastWatered = %q, want %q", lastWatered, tt.wantLastWatered)
+			}
+		})
+	}
+}
+
+func TestParseImportRowsLimit(t *testing.T) {
+	tests := []struct {
+		name    string
+		rows    int
+		wantErr bool
+	}{
+		{"at the limit", maxImportRows, false},
+		{"over the limit", maxImportRows + 1, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body := "name,interval\n" + strings.Repeat("Monstera,7\n", tt.rows)
+			rows, err := parseImportRows("csv", strings.NewReader(body))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseImportRows() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && len(rows) != tt.rows {
+				t.Errorf("parseImportRows() = %d rows, want %d", len(rows), tt.rows)
+			}
+		})
+	}
+}
+
+func TestValidateImportRows(t *testing.T) {
+	today := time.Date(2025, time.March, 10, 0, 0, 0, 0, time.UTC)
+	good := ImportRow{Line: 2, Name: "Monstera", Interval: "7"}
+	bad := ImportRow{Line: 3, Interval: "7"}
+
+	tests := []struct {
+		name        string
+		rows        []ImportRow
+		count       int
+		wantInvalid []bool
+	}{
+		{"all valid", []ImportRow{good, good}, 0, []bool{false, false}},
+		{"one bad row", []ImportRow{good, bad, good}, 0, []bool{false, true, false}},
+		{"fills the limit in order", []ImportRow{good, good, good}, maxPlantsPerUser - 2, []bool{false, false, true}},
+		{"invalid rows don't count toward the limit", []ImportRow{bad, good}, maxPlantsPerUser - 1, []bool{true, false}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			results := validateImportRows(tt.rows, today, tt.count)
+			if len(results) != len(tt.wantInvalid) {
+				t.Fatalf("got %d results, want %d", len(results), len(tt.wantInvalid))
+			}
+			for i, want := range tt.wantInvalid {
+				if got := len(results[i].Errors) > 0; got != want {
+					t.Errorf("row %d invalid = %v, want %v (errors %v)", i, got, want, results[i].Errors)
+				}
+			}
+		})
+	}
+}
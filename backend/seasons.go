@@ -0,0 +1,132 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+// Months in a SeasonalProfile are always written in northern-hemisphere terms
+// (e.g. dormancy from November to February). For users in the southern
+// hemisphere the calendar is shifted by six months before matching.
+type SeasonalProfile struct {
+	ProfileID  int     `json:"profile_id"`
+	PlantID    *int    `json:"plant_id"`
+	Species    string  `json:"species"`
+	Label      string  `json:"label"`
+	StartMonth int     `json:"start_month"`
+	EndMonth   int     `json:"end_month"`
+	Multiplier float64 `json:"multiplier"`
+}
+
+// Used when the user has not configured a profile for a plant or its species.
+var defaultSeasonalProfiles = []SeasonalProfile{
+	{Label: "Winter dormancy", StartMonth: 11, EndMonth: 2, Multiplier: 1.5},
+}
+
+func isSouthernHemisphere(latitude *float64) bool {
+	return latitude != nil && *latitude < 0
+}
+
+func (profile SeasonalProfile) activeOn(date time.Time, southern bool) bool {
+	month := int(date.Month())
+	if southern {
+		month = (month+5)%12 + 1
+	}
+
+	if profile.StartMonth <= profile.EndMonth {
+		return month >= profile.StartMonth && month <= profile.EndMonth
+	}
+	return month >= profile.StartMonth || month <= profile.EndMonth
+}
+
+func (profile SeasonalProfile) matches(plant_id int, species string, scientific_name string) bool {
+	if profile.PlantID != nil {
+		return *profile.PlantID == plant_id
+	}
+	if profile.Species != "" {
+		return strings.EqualFold(profile.Species, species) || strings.EqualFold(profile.Species, scientific_name)
+	}
+	return true
+}
+
+// Plant specific profiles win over species profiles, which win over the
+// user's catch-all profiles. The built-in defaults only apply when the user
+// has nothing configured for the plant.
+func seasonalMultiplier(profiles []SeasonalProfile, plant_id int, species string, scientific_name string, date time.Time, southern bool) float64 {
+	var plantMatch, speciesMatch, generalMatch *SeasonalProfile
+	configured := false
+
+	for i := range profiles {
+		profile := profiles[i]
+		if !profile.matches(plant_id, species, scientific_name) {
+			continue
+		}
+		configured = true
+		if !profile.activeOn(date, southern) {
+			continue
+		}
+
+		switch {
+		case profile.PlantID != nil && plantMatch == nil:
+			plantMatch = &profiles[i]
+		case profile.PlantID == nil && profile.Species != "" && speciesMatch == nil:
+			speciesMatch = &profiles[i]
+		case profile.PlantID == nil && profile.Species == "" && generalMatch == nil:
+			generalMatch = &profiles[i]
+		}
+	}
+
+	switch {
+	case plantMatch != nil:
+		return plantMatch.Multiplier
+	case speciesMatch != nil:
+		return speciesMatch.Multiplier
+	case generalMatch != nil:
+		return generalMatch.Multiplier
+	case configured:
+		return 1
+	}
+
+	for _, profile := range defaultSeasonalProfiles {
+		if profile.activeOn(date, southern) {
+			return profile.Multiplier
+		}
+	}
+	return 1
+}
+
+func adjustedRepeatEvery(base_repeat_every int, multiplier float64) int {
+	adjusted := int(math.Round(float64(base_repeat_every) * multiplier))
+	if adjusted < 1 {
+		return 1
+	}
+	return adjusted
+}
+
+func validateSeasonalProfile(profile SeasonalProfile) error {
+	if profile.StartMonth < 1 || profile.StartMonth > 12 || profile.EndMonth < 1 || profile.EndMonth > 12 {
+		return fmt.Errorf("start_month and end_month must be between 1 and 12")
+	}
+	if profile.Multiplier <= 0 || profile.Multiplier > 10 {
+		return fmt.Errorf("multiplier must be greater than 0 and at most 10")
+	}
+	return nil
+}
+
+// Re-evaluates every schedule once in a while so intervals change on their own
+// when a season boundary passes.
+func StartSeasonalRecalculation(interval time.Duration) {
+	go func() {
+		for {
+			updated, err := Handler.RecalculateSeasonalIntervals("")
+			if err != nil {
+				fmt.Println("ERROR recalculating seasonal intervals:", err)
+			} else if updated > 0 {
+				fmt.Println("Seasonal recalculation updated schedules:", updated)
+			}
+			time.Sleep(interval)
+		}
+	}()
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func testDate(year int, month time.Month, day int) time.Time {
+	return time.Date(year, month, day, 12, 0, 0, 0, time.UTC)
+}
+
+func intPtr(v int) *int {
+	return &v
+}
+
+func TestSeasonalProfileActiveOn(t *testing.T) {
+	winter := SeasonalProfile{StartMonth: 11, EndMonth: 2}
+	summer := SeasonalProfile{StartMonth: 6, EndMonth: 8}
+
+	tests := []struct {
+		name     string
+		profile  SeasonalProfile
+		date     time.Time
+		southern bool
+		want     bool
+	}{
+		{"wrapping range, start month", winter, testDate(2025, time.November, 1), false, true},
+		{"wrapping range, january", winter, testDate(2025, time.January, 15), false, true},
+		{"wrapping range, outside", winter, testDate(2025, time.March, 1), false, false},
+		{"plain range, inside", summer, testDate(2025, time.July, 4), false, true},
+		{"plain range, outside", summer, testDate(2025, time.September, 1), false, false},
+		{"southern july is northern january", winter, testDate(2025, time.July, 10), true, true},
+		{"southern january is northern july", winter, testDate(2025, time.January, 10), true, false},
+		{"southern december is northern june", summer, testDate(2025, time.December, 1), true, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.profile.activeOn(tt.date, tt.southern); got != tt.want {
+				t.Errorf("activeOn(%s, %v) = %v, want %v", tt.date.Format("Jan"), tt.southern, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSeasonalMultiplier(t *testing.T) {
+	january := testDate(2025, time.January, 15)
+	june := testDate(2025, time.June, 15)
+
+	tests := []struct {
+		name     string
+		profiles []SeasonalProfile
+		date     time.Time
+		southern bool
+		want     float64
+	}{
+		{"default dormancy in winter", nil, january, false, 1.5},
+		{"default outside winter", nil, june, false, 1},
+		{"default shifted for the southern hemisphere", nil, june, true, 1.5},
+		{
+			"plant profile beats species and general",
+			[]SeasonalProfile{
+				{Species: "Monstera deliciosa", StartMonth: 1, EndMonth: 12, Multiplier: 2},
+				{StartMonth: 1, EndMonth: 12, Multiplier: 3},
+				{PlantID: intPtr(7), StartMonth: 1, EndMonth: 12, Multiplier: 1.2},
+			},
+			june, false, 1.2,
+		},
+		{
+			"species profile matches the scientific name too",
+			[]SeasonalProfile{
+				{StartMonth: 1, EndMonth: 12, Multiplier: 3},
+				{Species: "monstera deliciosa", StartMonth: 1, EndMonth: 12, Multiplier: 2},
+			},
+			june, false, 2,
+		},
+		{
+			"profile for another plant is ignored",
+			[]SeasonalProfile{{PlantID: intPtr(8), StartMonth: 1, EndMonth: 12, Multiplier: 4}},
+			june, false, 1,
+		},
+		{
+			"configured but inactive means no change, not the default",
+			[]SeasonalProfile{{StartMonth: 6, EndMonth: 8, Multiplier: 0.8}},
+			january, false, 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := seasonalMultiplier(tt.profiles, 7, "Swiss Cheese Plant", "Monstera deliciosa", tt.date, tt.southern)
+			if got != tt.want {
+				t.Errorf("seasonalMultiplier() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAdjustedRepeatEvery(t *testing.T) {
+	tests := []struct {
+		base       int
+		multiplier float64
+		want       int
+	}{
+		{7, 1, 7},
+		{7, 1.5, 11},
+		{4, 0.5, 2},
+		{1, 0.1, 1},
+		{3, 0, 1},
+	}
+
+	for _, tt := range tests {
+		if got := adjustedRepeatEvery(tt.base, tt.multiplier); got != tt.want {
+			t.Errorf("adjustedRepeatEvery(%d, %v) = %d, want %d", tt.base, tt.multiplier, got, tt.want)
+		}
+	}
+}
+
+func TestValidateSeasonalProfile(t *testing.T) {
+	tests := []struct {
+		name    string
+		profile SeasonalProfile
+		wantErr bool
+	}{
+		{"valid", SeasonalProfile{StartMonth: 11, EndMonth: 2, Multiplier: 1.5}, false},
+		{"month zero", SeasonalProfile{StartMonth: 0, EndMonth: 2, Multiplier: 1.5}, true},
+		{"month thirteen", SeasonalProfile{StartMonth: 1, EndMonth: 13, Multiplier: 1.5}, true},
+		{"zero multiplier", SeasonalProfile{StartMonth: 1, EndMonth: 2, Multiplier: 0}, true},
+		{"multiplier too large", SeasonalProfile{StartMonth: 1, EndMonth: 2, Multiplier: 11}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := validateSeasonalProfile(tt.profile); (err != nil) != tt.wantErr {
+				t.Errorf("validateSeasonalProfile() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+// A soil-moisture probe sitting in one plant's pot. Moisture is a percentage,
+// and the thresholds decide when the reading should drive the schedule.
+type Sensor struct {
+	SensorID      int        `json:"sensor_id"`
+	PlantID       int        `json:"plant_id"`
+	Name          string     `json:"name"`
+	DryThreshold  float64    `json:"dry_threshold"`
+	WetThreshold  float64    `json:"wet_threshold"`
+	LastMoisture  *float64   `json:"last_moisture"`
+	LastReadingAt *time.Time `json:"last_reading_at"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UserID        string     `json:"-"`
+}
+
+type SensorReading struct {
+	Moisture   float64   `json:"moisture"`
+	RecordedAt time.Time `json:"recorded_at"`
+}
+
+// What a sensor sends, over HTTP or MQTT. recorded_at defaults to now so
+// boards without a clock can leave it out.
+type sensorPayload struct {
+	Token      string     `json:"token"`
+	Moisture   *float64   `json:"moisture"`
+	RecordedAt *time.Time `json:"recorded_at"`
+}
+
+func (payload sensorPayload) reading() (SensorReading, error) {
+	if payload.Moisture == nil {
+		return SensorReading{}, fmt.Errorf("moisture is required")
+	}
+	if *payload.Moisture < 0 || *payload.Moisture > 100 {
+		return SensorReading{}, fmt.Errorf("moisture must be a percentage between 0 and 100")
+	}
+
+	reading := SensorReading{Moisture: *payload.Moisture, RecordedAt: time.Now()}
+	if payload.RecordedAt != nil {
+		if payload.RecordedAt.After(time.Now().Add(5 * time.Minute)) {
+			return SensorReading{}, fmt.Errorf("recorded_at is in the future")
+		}
+		reading.RecordedAt = *payload.RecordedAt
+	}
+	return reading, nil
+}
+
+func validateSensorThresholds(dry float64, wet float64) error {
+	if dry < 0 || wet > 100 || dry >= wet {
+		return fmt.Errorf("thresholds must satisfy 0 <= dry_threshold < wet_threshold <= 100")
+	}
+	return nil
+}
+
+func (sensor Sensor) attribution() string {
+	return "sensor:" + sensor.Name
+}
+
+// Dry soil makes the plant's watering due today even if the interval says
+// otherwise, and wet soil marks a due watering as done. Between the two
+// thresholds the schedule is left alone, so readings near a threshold don't
+// flap back and forth.
+func applyMoistureRules(sensor Sensor, reading SensorReading) error {
+	// Old readings backfilled from a buffer shouldn't move today's schedule
+	if time.Since(reading.RecordedAt) > 6*time.Hour {
+		return nil
+	}
+
+	switch {
+	case reading.Moisture <= sensor.DryThreshold:
+		return Handler.MarkPlantDueFromSensor(sensor, reading.Moisture)
+	case reading.Moisture >= sensor.WetThreshold:
+		return Handler.CompleteDueWateringFromSensor(sensor)
+	}
+	return nil
+}
+
+// Stores the readings and runs the threshold rules against the newest one.
+func ingestSensorReadings(sensor Sensor, readings []SensorReading) error {
+	if len(readings) == 0 {
+		return nil
+	}
+	if err := Handler.RecordSensorReadings(sensor.SensorID, readings); err != nil {
+		return err
+	}
+
+	latest := readings[0]
+	for _, reading := range readings[1:] {
+		if reading.RecordedAt.After(latest.RecordedAt) {
+			latest = reading
+		}
+	}
+	return applyMoistureRules(sensor, latest)
+}
+
+func mqttTopicPrefix() string {
+	prefix := os.Getenv("MQTT_TOPIC_PREFIX")
+	if prefix == "" {
+		prefix = "greenthumb"
+	}
+	return strings.TrimSuffix(prefix, "/")
+}
+
+// Connects to MQTT_BROKER_URL in the background and returns nil when it
+// isn't set. on_connect runs after every (re)connect, since the broker drops
+// subscriptions along with the session.
+func ConnectMQTTFromEnv(client_id string, on_connect func(client mqtt.Client)) mqtt.Client {
+	broker := os.Getenv("MQTT_BROKER_URL")
+	if broker == "" {
+		return nil
+	}
+
+	options := mqtt.NewClientOptions().
+		AddBroker(broker).
+		SetClientID(client_id).
+		SetUsername(os.Getenv("MQTT_USERNAME")).
+		SetPassword(os.Getenv("MQTT_PASSWORD")).
+		SetAutoReconnect(true).
+		SetConnectRetry(true).
+		SetConnectRetryInterval(10 * time.Second).
+		// Handlers hit the database and publish, so don't make them queue up
+		SetOrderMatters(false).
+		SetOnConnectHandler(on_connect).
+		SetConnectionLostHandler(func(_ mqtt.Client, err error) {
+			fmt.Println("ERROR lost MQTT connection:", err)
+		})
+
+	client := mqtt.NewClient(options)
+	// With ConnectRetry the token only completes once connected, so don't wait
+	client.Connect()
+	return client
+}
+
+func handleSensorMessage(topic string, body []byte) error {
+	// <prefix>/sensors/<sensor_id>/moisture
+	parts := strings.Split(strings.TrimPrefix(topic, mqttTopicPrefix()+"/"), "/")
+	if len(parts) != 3 || parts[0] != "sensors" || parts[2] != "moisture" {
+		return fmt.Errorf("unexpected topic %q", topic)
+	}
+	sensorID, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return fmt.Errorf("invalid sensor id in topic %q", topic)
+	}
+
+	var payload sensorPayload
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return fmt.Errorf("invalid sensor payload: %v", err)
+	}
+
+	sensor, err := Handler.AuthenticateSensor(sensorID, payload.Token)
+	if err != nil {
+		return err
+	}
+	reading, err := payload.reading()
+	if err != nil {
+		return err
+	}
+	return ingestSensorReadings(sensor, []SensorReading{reading})
+}
+
+// Sensors publish to <prefix>/sensors/<sensor_id>/moisture with the same
+// JSON body as the HTTP endpoint, token included.
+func StartSensorSubscriber() {
+	topic := mqttTopicPrefix() + "/sensors/+/moisture"
+	client := ConnectMQTTFromEnv("greenthumb-sensors", func(client mqtt.Client) {
+		token := client.Subscribe(topic, 1, func(_ mqtt.Client, message mqtt.Message) {
+			if err := handleSensorMessage(message.Topic(), message.Payload()); err != nil {
+				fmt.Println("ERROR handling sensor message on", message.Topic(), err)
+			}
+		})
+		if token.Wait() && token.Error() != nil {
+			fmt.Println("ERROR subscribing to", topic, token.Error())
+		}
+	})
+	if client == nil {
+		fmt.Println("MQTT_BROKER_URL not set, sensor subscriber disabled")
+	}
+}
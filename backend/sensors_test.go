@@ -0,0 +1,105 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSensorPayloadReading(t *testing.T) {
+	past := time.Now().Add(-time.Hour).Truncate(time.Second)
+	future := time.Now().Add(time.Hour)
+
+	tests := []struct {
+		name     string
+		payload  sensorPayload
+		wantErr  bool
+		wantTime *time.Time
+	}{
+		{"moisture only", sensorPayload{Moisture: floatPtr(42)}, false, nil},
+		{"with recorded_at", sensorPayload{Moisture: floatPtr(42), RecordedAt: &past}, false, &past},
+		{"bounds are allowed", sensorPayload{Moisture: floatPtr(100)}, false, nil},
+		{"missing moisture", sensorPayload{}, true, nil},
+		{"negative moisture", sensorPayload{Moisture: floatPtr(-1)}, true, nil},
+		{"over a hundred", sensorPayload{Moisture: floatPtr(100.5)}, true, nil},
+		{"recorded in the future", sensorPayload{Moisture: floatPtr(42), RecordedAt: &future}, true, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reading, err := tt.payload.reading()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("reading() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if reading.Moisture != *tt.payload.Moisture {
+				t.Errorf("Moisture = %v, want %v", reading.Moisture, *tt.payload.Moisture)
+			}
+			if tt.wantTime != nil && !reading.RecordedAt.Equal(*tt.wantTime) {
+				t.Errorf("RecordedAt = %v, want %v", reading.RecordedAt, *tt.wantTime)
+			}
+			if tt.wantTime == nil && time.Since(reading.RecordedAt) > time.Minute {
+				t.Errorf("RecordedAt = %v, want now", reading.RecordedAt)
+			}
+		})
+	}
+}
+
+func TestValidateSensorThresholds(t *testing.T) {
+	tests := []struct {
+		dry, wet float64
+		wantErr  bool
+	}{
+		{30, 70, false},
+		{0, 100, false},
+		{-1, 70, true},
+		{30, 101, true},
+		{50, 50, true},
+		{70, 30, true},
+	}
+
+	for _, tt := range tests {
+		if err := validateSensorThresholds(tt.dry, tt.wet); (err != nil) != tt.wantErr {
+			t.Errorf("validateSensorThresholds(%v, %v) error = %v, wantErr %v", tt.dry, tt.wet, err, tt.wantErr)
+		}
+	}
+}
+
+func TestMQTTTopicPrefix(t *testing.T) {
+	tests := []struct {
+		env, want string
+	}{
+		{"", "greenthumb"},
+		{"home/garden", "home/garden"},
+		{"home/garden/", "home/garden"},
+	}
+
+	for _, tt := range tests {
+		t.Setenv("MQTT_TOPIC_PREFIX", tt.env)
+		if got := mqttTopicPrefix(); got != tt.want {
+			t.Errorf("mqttTopicPrefix() with %q = %q, want %q", tt.env, got, tt.want)
+		}
+	}
+}
+
+func TestHandleSensorMessageRejectsBadTopics(t *testing.T) {
+	t.Setenv("MQTT_TOPIC_PREFIX", "greenthumb")
+
+	tests := []struct {
+		topic string
+		body  string
+	}{
+		{"greenthumb/sensors/1/temperature", `{}`},
+		{"greenthumb/sensors/abc/moisture", `{}`},
+		{"greenthumb/valves/1/moisture", `{}`},
+		{"greenthumb/sensors/1/moisture", `not json`},
+	}
+
+	// All of these fail before the database is touched
+	for _, tt := range tests {
+		if err := handleSensorMessage(tt.topic, []byte(tt.body)); err == nil {
+			t.Errorf("handleSensorMessage(%q, %q) accepted a bad message", tt.topic, tt.body)
+		}
+	}
+}
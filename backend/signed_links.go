@@ -0,0 +1,97 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// What a one-click "mark watered" link is allowed to do.
+type completionClaims struct {
+	ScheduleID int    `json:"s"`
+	UserID     string `json:"u"`
+	ExpiresAt  int64  `json:"e"`
+}
+
+func linkSigningSecret() []byte {
+	secret := os.Getenv("LINK_SIGNING_SECRET")
+	if secret == "" {
+		secret = os.Getenv("JWT_SECRET")
+	}
+	return []byte(secret)
+}
+
+func signLinkPayload(payload string) string {
+	mac := hmac.New(sha256.New, linkSigningSecret())
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func signCompletionToken(user_id string, schedule_id int, ttl time.Duration) (string, error) {
+	if len(linkSigningSecret()) == 0 {
+		return "", fmt.Errorf("LINK_SIGNING_SECRET is not set")
+	}
+
+	claims, err := json.Marshal(completionClaims{ScheduleID: schedule_id, UserID: user_id, ExpiresAt: time.Now().Add(ttl).Unix()})
+	if err != nil {
+		return "", fmt.Errorf("failed to encode link claims: %v", err)
+	}
+
+	payload := base64.RawURLEncoding.EncodeToString(claims)
+	return payload + "." + signLinkPayload(payload), nil
+}
+
+func verifyCompletionToken(token string, schedule_id int) (completionClaims, error) {
+	var claims completionClaims
+	if len(linkSigningSecret()) == 0 {
+		return claims, fmt.Errorf("LINK_SIGNING_SECRET is not set")
+	}
+
+	payload, signature, found := strings.Cut(token, ".")
+	if !found || !hmac.Equal([]byte(signature), []byte(signLinkPayload(payload))) {
+		return claims, fmt.Errorf("invalid link signature")
+	}
+
+	decoded, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return claims, fmt.Errorf("invalid link payload")
+	}
+	if err := json.Unmarshal(decoded, &claims); err != nil {
+		return claims, fmt.Errorf("invalid link payload")
+	}
+
+	if claims.ScheduleID != schedule_id {
+		return claims, fmt.Errorf("link is for a different schedule")
+	}
+	if time.Now().Unix() > claims.ExpiresAt {
+		return claims, fmt.Errorf("link has expired")
+	}
+	return claims, nil
+}
+
+func completionLink(user_id string, schedule_id int) (string, error) {
+	token, err := signCompletionToken(user_id, schedule_id, 72*time.Hour)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(os.Getenv("PUBLIC_BASE_URL"), "/") + "/schedules/" + strconv.Itoa(schedule_id) + "/complete?token=" + token, nil
+}
+
+// Posts back to the link's own URL with the token from the query string.
+var completionPageTemplate = template.Must(template.New("complete").Parse(`<!DOCTYPE html>
+<html>
+<body style="font-family: sans-serif; color: #1b4332;">
+	<form method="post">
+		<input type="hidden" name="token" value="{{.}}">
+		<p>Mark this plant as watered?</p>
+		<button type="submit" style="background: #2d6a4f; color: #fff; padding: 8px 12px; border: 0; border-radius: 6px;">Mark watered 🌱</button>
+	</form>
+</body>
+</html>`))
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestVerifyCompletionToken(t *testing.T) {
+	t.Setenv("LINK_SIGNING_SECRET", "link-secret")
+
+	valid, err := signCompletionToken("user-1", 42, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expired, err := signCompletionToken("user-1", 42, -time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload, _, _ := strings.Cut(valid, ".")
+
+	tests := []struct {
+		name       string
+		token      string
+		scheduleID int
+		wantErr    bool
+	}{
+		{"valid", valid, 42, false},
+		{"different schedule", valid, 43, true},
+		{"expired", expired, 42, true},
+		{"tampered signature", payload + ".AAAA", 42, true},
+		{"missing signature", payload, 42, true},
+		{"empty", "", 42, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims, err := verifyCompletionToken(tt.token, tt.scheduleID)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("verifyCompletionToken() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && claims.UserID != "user-1" {
+				t.Errorf("UserID = %q, want user-1", claims.UserID)
+			}
+		})
+	}
+}
+
+func TestVerifyCompletionTokenOtherSecret(t *testing.T) {
+	t.Setenv("LINK_SIGNING_SECRET", "link-secret")
+	token, err := signCompletionToken("user-1", 42, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("LINK_SIGNING_SECRET", "rotated")
+	if _, err := verifyCompletionToken(token, 42); err == nil {
+		t.Error("token signed with another secret was accepted")
+	}
+}
+
+func TestCompletionTokenNeedsSecret(t *testing.T) {
+	t.Setenv("LINK_SIGNING_SECRET", "")
+	t.Setenv("JWT_SECRET", "")
+
+	if _, err := signCompletionToken("user-1", 42, time.Hour); err == nil {
+		t.Error("signed a link without a secret")
+	}
+	if _, err := verifyCompletionToken("a.b", 42); err == nil {
+		t.Error("verified a link without a secret")
+	}
+}
+
+func TestCompletionPageEscapesToken(t *testing.T) {
+	var page bytes.Buffer
+	if err := completionPageTemplate.Execute(&page, `"><script>`); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(page.String(), "<script>") {
+		t.Errorf("token was not escaped: %s", page.String())
+	}
+	if !strings.Contains(page.String(), `method="post"`) {
+		t.Error("confirmation page should post the form")
+	}
+}
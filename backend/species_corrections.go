@@ -0,0 +1,117 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+)
+
+// A user saying what a plant really is, next to what the AI said from the
+// photo. Kept as labeled data for measuring the classifier.
+type SpeciesCorrection struct {
+	CorrectionID           int             `json:"correction_id"`
+	PlantID                *int            `json:"plant_id"`
+	ImageURL               string          `json:"image_url"`
+	OriginalOutput         json.RawMessage `json:"original_output"`
+	OriginalPlantName      string          `json:"original_plant_name"`
+	OriginalScientificName string          `json:"original_scientific_name"`
+	OriginalSpecies        string          `json:"original_species"`
+	OriginalSpeciesID      *int            `json:"original_species_id"`
+	PlantName              string          `json:"plant_name"`
+	ScientificName         string          `json:"scientific_name"`
+	Species                string          `json:"species"`
+	SpeciesID              *int            `json:"species_id"`
+	ScheduleRegenerated    bool            `json:"schedule_regenerated"`
+	CreatedAt              time.Time       `json:"created_at"`
+}
+
+// How often the species the AI picked when adding a plant was left alone.
+type ClassifierAccuracy struct {
+	Classifications int     `json:"classifications"`
+	Corrected       int     `json:"corrected"`
+	Accuracy        float64 `json:"accuracy"`
+}
+
+// Fills in whatever names the correction left blank, from the catalog when
+// the species resolved and from the other names otherwise.
+func completeCorrection(correction *SpeciesCorrection, species *CatalogSpecies) {
+	if species != nil {
+		correction.SpeciesID = &species.SpeciesID
+		if correction.PlantName == "" {
+			correction.PlantName = species.CommonName
+		}
+		if correction.ScientificName == "" {
+			correction.ScientificName = species.ScientificName
+		}
+	}
+	if correction.PlantName == "" {
+		correction.PlantName = correction.ScientificName
+	}
+	if correction.ScientificName == "" {
+		correction.ScientificName = correction.PlantName
+	}
+	if correction.Species == "" {
+		correction.Species = correction.ScientificName
+	}
+}
+
+// `corrections` writes every correction as a line of JSON for the team's
+// dataset and prints the classifier's accuracy.
+func runCorrectionsCommand(args []string) int {
+	flags := flag.NewFlagSet("corrections", flag.ContinueOnError)
+	path := flags.String("out", "", "file to write the dataset to (default: stdout)")
+	since := flags.String("since", "", "only corrections made on or after this date (YYYY-MM-DD)")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	var from time.Time
+	if *since != "" {
+		parsed, err := time.Parse("2006-01-02", *since)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "usage: corrections [-out <path>] [-since YYYY-MM-DD]")
+			return 2
+		}
+		from = parsed
+	}
+
+	if err := InitDatabaseHandler(os.Getenv("CONN_STRING")); err != nil {
+		fmt.Fprintln(os.Stderr, "Error connecting to database:", err)
+		return 1
+	}
+
+	out := os.Stdout
+	if *path != "" {
+		file, err := os.Create(*path)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error creating file:", err)
+			return 1
+		}
+		defer file.Close()
+		out = file
+	}
+
+	corrections, err := Handler.FetchSpeciesCorrections(from)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error fetching corrections:", err)
+		return 1
+	}
+	encoder := json.NewEncoder(out)
+	for _, correction := range corrections {
+		if err := encoder.Encode(correction); err != nil {
+			fmt.Fprintln(os.Stderr, "Error writing dataset:", err)
+			return 1
+		}
+	}
+
+	accuracy, err := Handler.FetchClassifierAccuracy(from)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error measuring accuracy:", err)
+		return 1
+	}
+	fmt.Fprintf(os.Stderr, "%d corrections, %d of %d classifications corrected, accuracy %.1f%%\n",
+		len(corrections), accuracy.Corrected, accuracy.Classifications, accuracy.Accuracy*100)
+	return 0
+}
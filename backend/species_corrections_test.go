@@ -0,0 +1,59 @@
+package main
+
+import "testing"
+
+func TestCompleteCorrection(t *testing.T) {
+	species := &CatalogSpecies{SpeciesID: 3, CommonName: "Fiddle Leaf Fig", ScientificName: "Ficus lyrata"}
+
+	tests := []struct {
+		name           string
+		correction     SpeciesCorrection
+		species        *CatalogSpecies
+		wantPlantName  string
+		wantScientific string
+		wantSpecies    string
+		wantSpeciesID  *int
+	}{
+		{
+			name:          "names from the catalog",
+			correction:    SpeciesCorrection{Species: "Ficus"},
+			species:       species,
+			wantPlantName: "Fiddle Leaf Fig", wantScientific: "Ficus lyrata", wantSpecies: "Ficus", wantSpeciesID: intPtr(3),
+		},
+		{
+			name:          "user's names kept over the catalog's",
+			correction:    SpeciesCorrection{PlantName: "Fiddle Fig", ScientificName: "Ficus lyrata 'Bambino'"},
+			species:       species,
+			wantPlantName: "Fiddle Fig", wantScientific: "Ficus lyrata 'Bambino'", wantSpecies: "Ficus lyrata 'Bambino'", wantSpeciesID: intPtr(3),
+		},
+		{
+			name:          "only a scientific name",
+			correction:    SpeciesCorrection{ScientificName: "Pilea peperomioides"},
+			wantPlantName: "Pilea peperomioides", wantScientific: "Pilea peperomioides", wantSpecies: "Pilea peperomioides",
+		},
+		{
+			name:          "only a common name",
+			correction:    SpeciesCorrection{PlantName: "Chinese Money Plant"},
+			wantPlantName: "Chinese Money Plant", wantScientific: "Chinese Money Plant", wantSpecies: "Chinese Money Plant",
+		},
+		{
+			name:          "everything given",
+			correction:    SpeciesCorrection{PlantName: "Pilea", ScientificName: "Pilea peperomioides", Species: "Pilea"},
+			wantPlantName: "Pilea", wantScientific: "Pilea peperomioides", wantSpecies: "Pilea",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			correction := tt.correction
+			completeCorrection(&correction, tt.species)
+			if correction.PlantName != tt.wantPlantName || correction.ScientificName != tt.wantScientific || correction.Species != tt.wantSpecies {
+				t.Errorf("names = (%q, %q, %q), want (%q, %q, %q)", correction.PlantName, correction.ScientificName, correction.Species,
+					tt.wantPlantName, tt.wantScientific, tt.wantSpecies)
+			}
+			if (correction.SpeciesID == nil) != (tt.wantSpeciesID == nil) || (correction.SpeciesID != nil && *correction.SpeciesID != *tt.wantSpeciesID) {
+				t.Errorf("SpeciesID = %v, want %v", correction.SpeciesID, tt.wantSpeciesID)
+			}
+		})
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"net/mail"
+	"strings"
+	"time"
+)
+
+const (
+	TransferOffered   = "offered"
+	TransferAccepted  = "accepted"
+	TransferDeclined  = "declined"
+	TransferCancelled = "cancelled"
+	TransferExpired   = "expired"
+)
+
+// Which side of an accepted transfer a PlantTransferEvent is for.
+const (
+	TransferGiven    = "given"
+	TransferReceived = "received"
+)
+
+// Unanswered offers lapse after two weeks.
+const plantTransferTTL = 14 * 24 * time.Hour
+
+// An offer to hand a plant to someone else, addressed by email. Rows are kept
+// once answered, so both sides have a record of where the plant went.
+type PlantTransfer struct {
+	TransferID   int        `json:"transfer_id"`
+	PlantID      int        `json:"plant_id"`
+	PlantPetName string     `json:"plant_pet_name"`
+	FromUserID   string     `json:"from_user_id"`
+	ToEmail      string     `json:"to_email"`
+	ToUserID     *string    `json:"to_user_id"`
+	Status       string     `json:"status"`
+	Message      string     `json:"message,omitempty"`
+	ExpiresAt    time.Time  `json:"expires_at"`
+	CreatedAt    time.Time  `json:"created_at"`
+	RespondedAt  *time.Time `json:"responded_at"`
+}
+
+// One side's record of an accepted transfer. Kept apart from the plant's
+// care history, which moves to the new owner, so the sender still has an
+// entry after the plant is gone from their account.
+type PlantTransferEvent struct {
+	EventID      int       `json:"event_id"`
+	TransferID   int       `json:"transfer_id"`
+	UserID       string    `json:"user_id"`
+	Direction    string    `json:"direction"`
+	OtherUserID  string    `json:"other_user_id"`
+	PlantID      int       `json:"plant_id"`
+	PlantPetName string    `json:"plant_pet_name"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// The sender's and recipient's records of an accepted transfer.
+func plantTransferEvents(transfer PlantTransfer, to_user_id string) []PlantTransferEvent {
+	event := PlantTransferEvent{TransferID: transfer.TransferID, PlantID: transfer.PlantID, PlantPetName: transfer.PlantPetName}
+	given, received := event, event
+	given.UserID, given.Direction, given.OtherUserID = transfer.FromUserID, TransferGiven, to_user_id
+	received.UserID, received.Direction, received.OtherUserID = to_user_id, TransferReceived, transfer.FromUserID
+	return []PlantTransferEvent{given, received}
+}
+
+// Checks an offer before it's stored. own_email is empty when the sender's
+// token carries no email, in which case self-transfers can't be caught here.
+func validateTransferOffer(to_email string, own_email string, message string) error {
+	if _, err := mail.ParseAddress(to_email); err != nil {
+		return fmt.Errorf("Invalid email address")
+	}
+	if own_email != "" && strings.EqualFold(own_email, to_email) {
+		return fmt.Errorf("You can't transfer a plant to yourself")
+	}
+	if len(message) > 500 {
+		return fmt.Errorf("message must be at most 500 characters")
+	}
+	return nil
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestValidateTransferOffer(t *testing.T) {
+	tests := []struct {
+		name     string
+		toEmail  string
+		ownEmail string
+		message  string
+		wantErr  bool
+	}{
+		{"valid", "friend@example.com", "me@example.com", "Water it on Sundays", false},
+		{"no message", "friend@example.com", "me@example.com", "", false},
+		{"no own email", "friend@example.com", "", "", false},
+		{"invalid email", "not-an-email", "me@example.com", "", true},
+		{"empty email", "", "me@example.com", "", true},
+		{"to yourself", "me@example.com", "me@example.com", "", true},
+		{"to yourself, different case", "Me@Example.com", "me@example.com", "", true},
+		{"message at the limit", "friend@example.com", "", strings.Repeat("a", 500), false},
+		{"message too long", "friend@example.com", "", strings.Repeat("a", 501), true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateTransferOffer(tt.toEmail, tt.ownEmail, tt.message)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("validateTransferOffer() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+type fakeTransferRow []any
+
+func (row fakeTransferRow) Scan(dest ...any) error {
+	for i, value := range row {
+		switch d := dest[i].(type) {
+		case *int:
+			*d = value.(int)
+		case *string:
+			*d = value.(string)
+		case **string:
+			*d = value.(*string)
+		case *time.Time:
+			*d = value.(time.Time)
+		case **time.Time:
+			*d = value.(*time.Time)
+		}
+	}
+	return nil
+}
+
+func TestScanPlantTransfer(t *testing.T) {
+	created := time.Date(2025, time.March, 1, 9, 0, 0, 0, time.UTC)
+	expires := created.Add(plantTransferTTL)
+	responded := created.Add(time.Hour)
+	toUser := "user-b"
+
+	tests := []struct {
+		name string
+		row  fakeTransferRow
+		want PlantTransfer
+	}{
+		{
+			"offered",
+			fakeTransferRow{1, 7, "Fernando", "user-a", "b@example.com", (*string)(nil), TransferOffered, "", expires, created, (*time.Time)(nil)},
+			PlantTransfer{TransferID: 1, PlantID: 7, PlantPetName: "Fernando", FromUserID: "user-a", ToEmail: "b@example.com", Status: TransferOffered, ExpiresAt: expires, CreatedAt: created},
+		},
+		{
+			"accepted",
+			fakeTransferRow{2, 7, "Fernando", "user-a", "b@example.com", &toUser, TransferAccepted, "Enjoy", expires, created, &responded},
+			PlantTransfer{TransferID: 2, PlantID: 7, PlantPetName: "Fernando", FromUserID: "user-a", ToEmail: "b@example.com", ToUserID: &toUser, Status: TransferAccepted, Message: "Enjoy", ExpiresAt: expires, CreatedAt: created, RespondedAt: &responded},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := scanPlantTransfer(tt.row)
+			if err != nil {
+				t.Fatalf("scanPlantTransfer() error = %v", err)
+			}
+			if got.TransferID != tt.want.TransferID || got.PlantID != tt.want.PlantID || got.PlantPetName != tt.want.PlantPetName ||
+				got.FromUserID != tt.want.FromUserID || got.ToEmail != tt.want.ToEmail || got.Status != tt.want.Status ||
+				got.Message != tt.want.Message || !got.ExpiresAt.Equal(tt.want.ExpiresAt) || !got.CreatedAt.Equal(tt.want.CreatedAt) {
+				t.Errorf("scanPlantTransfer() = %+v, want %+v", got, tt.want)
+			}
+			if (got.ToUserID == nil) != (tt.want.ToUserID == nil) || (got.ToUserID != nil && *got.ToUserID != *tt.want.ToUserID) {
+				t.Errorf("ToUserID = %v, want %v", got.ToUserID, tt.want.ToUserID)
+			}
+			if (got.RespondedAt == nil) != (tt.want.RespondedAt == nil) {
+				t.Errorf("RespondedAt = %v, want %v", got.RespondedAt, tt.want.RespondedAt)
+			}
+		})
+	}
+}
+
+func TestPlantTransferEvents(t *testing.T) {
+	transfer := PlantTransfer{TransferID: 4, PlantID: 12, PlantPetName: "Fernando", FromUserID: "sender"}
+	events := plantTransferEvents(transfer, "recipient")
+	if len(events) != 2 {
+		t.Fatalf("expected 2 events, got %d", len(events))
+	}
+
+	want := []PlantTransferEvent{
+		{TransferID: 4, UserID: "sender", Direction: TransferGiven, OtherUserID: "recipient", PlantID: 12, PlantPetName: "Fernando"},
+		{TransferID: 4, UserID: "recipient", Direction: TransferReceived, OtherUserID: "sender", PlantID: 12, PlantPetName: "Fernando"},
+	}
+	for i := range want {
+		if events[i] != want[i] {
+			t.Errorf("event %d = %+v, want %+v", i, events[i], want[i])
+		}
+	}
+}
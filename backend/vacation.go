@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	VacationModePause  = "pause"
+	VacationModeSitter = "sitter"
+)
+
+// During a vacation the owner's reminders either pause or go to a plant
+// sitter. A sitter gets in through the share link token or by signing in with
+// the invited email address, and only while the vacation is running.
+type Vacation struct {
+	VacationID   int              `json:"vacation_id"`
+	UserID       string           `json:"user_id"`
+	StartDate    time.Time        `json:"start_date"`
+	EndDate      time.Time        `json:"end_date"`
+	Mode         string           `json:"mode"`
+	SitterName   string           `json:"sitter_name"`
+	SitterEmail  string           `json:"sitter_email"`
+	SitterUserID *string          `json:"sitter_user_id"`
+	HasShareLink bool             `json:"has_share_link"`
+	Summary      *VacationSummary `json:"summary,omitempty"`
+}
+
+type VacationCareAction struct {
+	PlantID      int       `json:"plant_id"`
+	PlantPetName string    `json:"plant_pet_name"`
+	Action       string    `json:"action"`
+	ActionDate   time.Time `json:"action_date"`
+	PerformedBy  string    `json:"performed_by"`
+}
+
+type VacationMissedTask struct {
+	ScheduleID   int       `json:"schedule_id"`
+	PlantID      int       `json:"plant_id"`
+	PlantPetName string    `json:"plant_pet_name"`
+	DueDate      time.Time `json:"due_date"`
+}
+
+type VacationSummary struct {
+	Done   []VacationCareAction `json:"done"`
+	Missed []VacationMissedTask `json:"missed"`
+}
+
+func (vacation Vacation) activeOn(date time.Time) bool {
+	day := date.Format("2006-01-02")
+	return day >= vacation.StartDate.Format("2006-01-02") && day <= vacation.EndDate.Format("2006-01-02")
+}
+
+// How a sitter's actions show up in the care history.
+func sitterAttribution(vacation Vacation, sitter_user_id string) string {
+	if sitter_user_id != "" {
+		return sitter_user_id
+	}
+	if vacation.SitterName != "" {
+		return "sitter:" + vacation.SitterName
+	}
+	return "sitter"
+}
+
+// Builds the owner's summary once a vacation has ended.
+func StartVacationSummaries(interval time.Duration) {
+	go func() {
+		for {
+			summarized, err := Handler.SummarizeEndedVacations()
+			if err != nil {
+				fmt.Println("ERROR summarizing vacations:", err)
+			} else if summarized > 0 {
+				fmt.Println("Vacation summaries created:", summarized)
+			}
+			time.Sleep(interval)
+		}
+	}()
+}
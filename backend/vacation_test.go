@@ -0,0 +1,54 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestVacationActiveOn(t *testing.T) {
+	vacation := Vacation{
+		StartDate: time.Date(2025, time.July, 1, 0, 0, 0, 0, time.UTC),
+		EndDate:   time.Date(2025, time.July, 14, 0, 0, 0, 0, time.UTC),
+	}
+
+	tests := []struct {
+		name string
+		date time.Time
+		want bool
+	}{
+		{"day before", time.Date(2025, time.June, 30, 23, 59, 0, 0, time.UTC), false},
+		{"first day", time.Date(2025, time.July, 1, 0, 0, 0, 0, time.UTC), true},
+		{"middle", time.Date(2025, time.July, 7, 12, 0, 0, 0, time.UTC), true},
+		{"last day, late", time.Date(2025, time.July, 14, 23, 59, 0, 0, time.UTC), true},
+		{"day after", time.Date(2025, time.July, 15, 0, 0, 0, 0, time.UTC), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := vacation.activeOn(tt.date); got != tt.want {
+				t.Errorf("activeOn(%v) = %v, want %v", tt.date, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSitterAttribution(t *testing.T) {
+	tests := []struct {
+		name     string
+		vacation Vacation
+		userID   string
+		want     string
+	}{
+		{"signed in sitter", Vacation{SitterName: "Sam"}, "user-2", "user-2"},
+		{"share link with a name", Vacation{SitterName: "Sam"}, "", "sitter:Sam"},
+		{"share link without a name", Vacation{}, "", "sitter"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := sitterAttribution(tt.vacation, tt.userID); got != tt.want {
+				t.Errorf("sitterAttribution() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
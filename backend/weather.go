@@ -0,0 +1,176 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Rain that fell over the last couple of days and rain expected today and tomorrow, in millimetres.
+// LastRainDate is the latest of those days with any rain, and identifies the
+// rain event so it only postpones a schedule once.
+type RainfallReport struct {
+	RecentMM     float64 `json:"recent_mm"`
+	ForecastMM   float64 `json:"forecast_mm"`
+	LastRainDate string  `json:"last_rain_date"`
+}
+
+type WeatherProvider interface {
+	Rainfall(latitude float64, longitude float64) (RainfallReport, error)
+}
+
+// Talks to an Open-Meteo compatible forecast API.
+type OpenMeteoProvider struct {
+	BaseURL string
+	Client  *http.Client
+}
+
+type openMeteoResponse struct {
+	Daily struct {
+		Time             []string   `json:"time"`
+		PrecipitationSum []*float64 `json:"precipitation_sum"`
+	} `json:"daily"`
+	UTCOffsetSeconds int    `json:"utc_offset_seconds"`
+	Error            bool   `json:"error"`
+	Reason           string `json:"reason"`
+}
+
+func (provider *OpenMeteoProvider) Rainfall(latitude float64, longitude float64) (RainfallReport, error) {
+	params := url.Values{}
+	params.Set("latitude", strconv.FormatFloat(latitude, 'f', 4, 64))
+	params.Set("longitude", strconv.FormatFloat(longitude, 'f', 4, 64))
+	params.Set("daily", "precipitation_sum")
+	params.Set("past_days", "2")
+	params.Set("forecast_days", "2")
+	params.Set("timezone", "auto")
+
+	resp, err := provider.Client.Get(provider.BaseURL + "?" + params.Encode())
+	if err != nil {
+		return RainfallReport{}, fmt.Errorf("failed to make request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return RainfallReport{}, fmt.Errorf("failed to read response: %v", err)
+	}
+
+	var forecast openMeteoResponse
+	if err := json.Unmarshal(body, &forecast); err != nil {
+		return RainfallReport{}, fmt.Errorf("failed to unmarshal response: %v", err)
+	}
+	if forecast.Error || resp.StatusCode != http.StatusOK {
+		return RainfallReport{}, fmt.Errorf("weather API error (%d): %s", resp.StatusCode, forecast.Reason)
+	}
+
+	// With timezone=auto the days are local to the coordinates, so today is too
+	today := time.Now().UTC().Add(time.Duration(forecast.UTCOffsetSeconds) * time.Second).Format("2006-01-02")
+	return rainfallFromDaily(forecast.Daily.Time, forecast.Daily.PrecipitationSum, today), nil
+}
+
+// Splits daily sums into what already fell and what's forecast from today
+// on. Days are YYYY-MM-DD, so they compare as strings.
+func rainfallFromDaily(days []string, sums []*float64, today string) RainfallReport {
+	var report RainfallReport
+	for i, day := range days {
+		if i >= len(sums) || sums[i] == nil {
+			continue
+		}
+		if day < today {
+			report.RecentMM += *sums[i]
+		} else {
+			report.ForecastMM += *sums[i]
+		}
+		if *sums[i] > 0 && day > report.LastRainDate {
+			report.LastRainDate = day
+		}
+	}
+	return report
+}
+
+// Reads rainfall from a JSON file so the engine can be exercised offline, e.g.
+//
+//	{"default": {"recent_mm": 0, "forecast_mm": 0}, "locations": {"51.51,-0.13": {"recent_mm": 12}}}
+//
+// Location keys are latitude and longitude rounded to two decimals. The file is
+// read on every call so it can be edited while the server is running. Rain
+// without a last_rain_date counts as today's (UTC), so a stub postpones each
+// schedule at most once a day.
+type FileWeatherProvider struct {
+	Path string
+}
+
+type weatherStubFile struct {
+	Default   RainfallReport            `json:"default"`
+	Locations map[string]RainfallReport `json:"locations"`
+}
+
+func (provider *FileWeatherProvider) Rainfall(latitude float64, longitude float64) (RainfallReport, error) {
+	data, err := os.ReadFile(provider.Path)
+	if err != nil {
+		return RainfallReport{}, fmt.Errorf("failed to read weather stub: %v", err)
+	}
+
+	var stub weatherStubFile
+	if err := json.Unmarshal(data, &stub); err != nil {
+		return RainfallReport{}, fmt.Errorf("failed to parse weather stub: %v", err)
+	}
+
+	report, ok := stub.Locations[coordinateKey(latitude, longitude)]
+	if !ok {
+		report = stub.Default
+	}
+	if report.LastRainDate == "" && report.RecentMM+report.ForecastMM > 0 {
+		report.LastRainDate = time.Now().UTC().Format("2006-01-02")
+	}
+	return report, nil
+}
+
+func coordinateKey(latitude float64, longitude float64) string {
+	return fmt.Sprintf("%.2f,%.2f", latitude, longitude)
+}
+
+// WEATHER_PROVIDER=file uses WEATHER_STUB_FILE, anything else talks to
+// WEATHER_API_URL (Open-Meteo by default).
+func NewWeatherProviderFromEnv() WeatherProvider {
+	if os.Getenv("WEATHER_PROVIDER") == "file" {
+		return &FileWeatherProvider{Path: os.Getenv("WEATHER_STUB_FILE")}
+	}
+
+	baseURL := os.Getenv("WEATHER_API_URL")
+	if baseURL == "" {
+		baseURL = "https://api.open-meteo.com/v1/forecast"
+	}
+	return &OpenMeteoProvider{BaseURL: baseURL, Client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+func rainSkipThreshold() float64 {
+	threshold, err := strconv.ParseFloat(os.Getenv("RAIN_SKIP_THRESHOLD_MM"), 64)
+	if err != nil || threshold <= 0 {
+		return 5
+	}
+	return threshold
+}
+
+func rainSkipReason(report RainfallReport) string {
+	return fmt.Sprintf("Postponed after rain: %.1f mm in the last 2 days, %.1f mm forecast", report.RecentMM, report.ForecastMM)
+}
+
+func StartWeatherSkipping(provider WeatherProvider, threshold_mm float64, interval time.Duration) {
+	go func() {
+		for {
+			postponed, err := Handler.ApplyWeatherSkips(provider, threshold_mm)
+			if err != nil {
+				fmt.Println("ERROR applying weather skips:", err)
+			} else if postponed > 0 {
+				fmt.Println("Weather skipping postponed schedules:", postponed)
+			}
+			time.Sleep(interval)
+		}
+	}()
+}
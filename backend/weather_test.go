@@ -0,0 +1,123 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func floatPtr(v float64) *float64 {
+	return &v
+}
+
+func TestRainfallFromDaily(t *testing.T) {
+	days := []string{"2025-06-08", "2025-06-09", "2025-06-10", "2025-06-11"}
+
+	tests := []struct {
+		name  string
+		sums  []*float64
+		today string
+		want  RainfallReport
+	}{
+		{
+			"past and forecast",
+			[]*float64{floatPtr(4), floatPtr(2.5), floatPtr(1), floatPtr(0)},
+			"2025-06-10",
+			RainfallReport{RecentMM: 6.5, ForecastMM: 1, LastRainDate: "2025-06-10"},
+		},
+		{
+			"missing values are skipped",
+			[]*float64{nil, floatPtr(3), nil, floatPtr(2)},
+			"2025-06-10",
+			RainfallReport{RecentMM: 3, ForecastMM: 2, LastRainDate: "2025-06-11"},
+		},
+		{
+			"dry days don't make an event",
+			[]*float64{floatPtr(0), floatPtr(0), floatPtr(0), floatPtr(0)},
+			"2025-06-10",
+			RainfallReport{},
+		},
+		{
+			"today decides what counts as recent",
+			[]*float64{floatPtr(1), floatPtr(1), floatPtr(1), floatPtr(1)},
+			"2025-06-09",
+			RainfallReport{RecentMM: 1, ForecastMM: 3, LastRainDate: "2025-06-11"},
+		},
+		{
+			"fewer sums than days",
+			[]*float64{floatPtr(5)},
+			"2025-06-10",
+			RainfallReport{RecentMM: 5, LastRainDate: "2025-06-08"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := rainfallFromDaily(days, tt.sums, tt.today); got != tt.want {
+				t.Errorf("rainfallFromDaily() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCoordinateKey(t *testing.T) {
+	tests := []struct {
+		latitude, longitude float64
+		want                string
+	}{
+		{51.5072, -0.1276, "51.51,-0.13"},
+		{-33.8688, 151.2093, "-33.87,151.21"},
+		{0, 0, "0.00,0.00"},
+	}
+
+	for _, tt := range tests {
+		if got := coordinateKey(tt.latitude, tt.longitude); got != tt.want {
+			t.Errorf("coordinateKey(%v, %v) = %q, want %q", tt.latitude, tt.longitude, got, tt.want)
+		}
+	}
+}
+
+func TestFileWeatherProvider(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "weather.json")
+	stub := `{
+		"default": {"recent_mm": 0, "forecast_mm": 0},
+		"locations": {
+			"51.51,-0.13": {"recent_mm": 12.5, "forecast_mm": 3, "last_rain_date": "2025-06-09"},
+			"48.86,2.35": {"forecast_mm": 8}
+		}
+	}`
+	if err := os.WriteFile(path, []byte(stub), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	provider := &FileWeatherProvider{Path: path}
+
+	tests := []struct {
+		name                string
+		latitude, longitude float64
+		wantMM              float64
+		wantEvent           bool
+		wantDate            string
+	}{
+		{"configured location", 51.5072, -0.1276, 15.5, true, "2025-06-09"},
+		{"rain without a date gets one", 48.8566, 2.3522, 8, true, ""},
+		{"unknown location uses the default", 10, 10, 0, false, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			report, err := provider.Rainfall(tt.latitude, tt.longitude)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := report.RecentMM + report.ForecastMM; got != tt.wantMM {
+				t.Errorf("rain = %v mm, want %v", got, tt.wantMM)
+			}
+			if (report.LastRainDate != "") != tt.wantEvent {
+				t.Errorf("LastRainDate = %q, want an event: %v", report.LastRainDate, tt.wantEvent)
+			}
+			if tt.wantDate != "" && report.LastRainDate != tt.wantDate {
+				t.Errorf("LastRainDate = %q, want %q", report.LastRainDate, tt.wantDate)
+			}
+		})
+	}
+}
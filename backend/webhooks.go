@@ -0,0 +1,236 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+const (
+	WebhookPlantCreated  = "plant.created"
+	WebhookPlantDeleted  = "plant.deleted"
+	WebhookTaskDue       = "task.due"
+	WebhookTaskCompleted = "task.completed"
+	WebhookHealthDropped = "health.dropped"
+)
+
+var webhookEvents = []string{WebhookPlantCreated, WebhookPlantDeleted, WebhookTaskDue, WebhookTaskCompleted, WebhookHealthDropped}
+
+// Wait before each retry. A delivery that still fails after the last one is
+// given up on and can only be sent again through the redeliver endpoint.
+var webhookRetryBackoff = []time.Duration{time.Minute, 5 * time.Minute, 30 * time.Minute, 2 * time.Hour, 6 * time.Hour, 12 * time.Hour}
+
+type WebhookEndpoint struct {
+	EndpointID int       `json:"endpoint_id"`
+	URL        string    `json:"url"`
+	Events     []string  `json:"events"`
+	Active     bool      `json:"active"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+type WebhookDelivery struct {
+	DeliveryID    int        `json:"delivery_id"`
+	EventID       int        `json:"event_id"`
+	EventType     string     `json:"event_type"`
+	Status        string     `json:"status"`
+	Attempts      int        `json:"attempts"`
+	NextAttemptAt *time.Time `json:"next_attempt_at"`
+	StatusCode    *int       `json:"last_status_code"`
+	Error         string     `json:"last_error,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+	DeliveredAt   *time.Time `json:"delivered_at"`
+}
+
+// A delivery claimed by the sender, with everything needed to post it.
+type pendingWebhook struct {
+	DeliveryID int
+	EventID    int
+	EventType  string
+	Payload    json.RawMessage
+	CreatedAt  time.Time
+	URL        string
+	Secret     string
+	Attempts   int
+}
+
+// Receivers recompute HMAC-SHA256(secret, timestamp + "." + body) and compare
+// it with the X-GreenThumb-Signature header.
+func signWebhook(secret string, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Carrier-grade NAT space, which net.IP has no helper for.
+var sharedAddressSpace = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+// Addresses a user's webhook must never reach: our own host, the private
+// network around it and the cloud metadata service on link-local.
+func blockedWebhookIP(ip net.IP) bool {
+	return ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || ip.IsUnspecified() || sharedAddressSpace.Contains(ip)
+}
+
+func validateWebhookURL(raw string) error {
+	parsed, err := url.Parse(raw)
+	if err != nil || parsed.Hostname() == "" || (parsed.Scheme != "http" && parsed.Scheme != "https") {
+		return fmt.Errorf("url must be an absolute http or https URL")
+	}
+
+	ips, err := net.LookupIP(parsed.Hostname())
+	if err != nil || len(ips) == 0 {
+		return fmt.Errorf("url host could not be resolved")
+	}
+	for _, ip := range ips {
+		if blockedWebhookIP(ip) {
+			return fmt.Errorf("url must not point at a private or local address")
+		}
+	}
+	return nil
+}
+
+// Checked again on every connection, after DNS, so a host that resolved to a
+// public address when the endpoint was saved can't be pointed inside later.
+func webhookDialControl(network string, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	if ip := net.ParseIP(host); ip == nil || blockedWebhookIP(ip) {
+		return fmt.Errorf("webhook address %s is not allowed", host)
+	}
+	return nil
+}
+
+// How long to wait after the given number of failed attempts, or false once
+// we've run out of retries.
+func webhookRetryDelay(attempts int) (time.Duration, bool) {
+	if attempts < 1 || attempts > len(webhookRetryBackoff) {
+		return 0, false
+	}
+	return webhookRetryBackoff[attempts-1], true
+}
+
+type WebhookSender struct {
+	Client *http.Client
+}
+
+// Deliveries go straight to the endpoint, never through a proxy, and only to
+// addresses webhookDialControl allows.
+func NewWebhookSender(timeout time.Duration) *WebhookSender {
+	dialer := &net.Dialer{Timeout: timeout, Control: webhookDialControl}
+	return &WebhookSender{Client: &http.Client{
+		Timeout:   timeout,
+		Transport: &http.Transport{DialContext: dialer.DialContext, TLSHandshakeTimeout: timeout},
+	}}
+}
+
+func (sender *WebhookSender) post(delivery pendingWebhook) (int, error) {
+	body, err := json.Marshal(map[string]any{
+		"id":         delivery.EventID,
+		"type":       delivery.EventType,
+		"created_at": delivery.CreatedAt,
+		"data":       delivery.Payload,
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to marshal event: %v", err)
+	}
+
+	req, err := http.NewRequest("POST", delivery.URL, bytes.NewBuffer(body))
+	if err != nil {
+		return 0, fmt.Errorf("failed to create request: %v", err)
+	}
+
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "GreenThumb-Webhooks/1.0")
+	req.Header.Set("X-GreenThumb-Event", delivery.EventType)
+	req.Header.Set("X-GreenThumb-Delivery", strconv.Itoa(delivery.DeliveryID))
+	req.Header.Set("X-GreenThumb-Timestamp", timestamp)
+	req.Header.Set("X-GreenThumb-Signature", signWebhook(delivery.Secret, timestamp, body))
+
+	resp, err := sender.Client.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("failed to make request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		snippet, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return resp.StatusCode, fmt.Errorf("endpoint returned %d: %s", resp.StatusCode, string(snippet))
+	}
+	return resp.StatusCode, nil
+}
+
+// Turns new outbox events into deliveries, then sends whatever is due.
+func (sender *WebhookSender) Run() (int, error) {
+	if _, err := Handler.FanOutWebhookEvents(); err != nil {
+		return 0, err
+	}
+
+	deliveries, err := Handler.ClaimWebhookDeliveries(50)
+	if err != nil {
+		return 0, err
+	}
+
+	delivered := 0
+	for _, delivery := range deliveries {
+		statusCode, sendErr := sender.post(delivery)
+		if err := Handler.RecordWebhookAttempt(delivery, statusCode, sendErr); err != nil {
+			return delivered, err
+		}
+		if sendErr == nil {
+			delivered++
+		}
+	}
+	return delivered, nil
+}
+
+func StartWebhookDelivery(sender *WebhookSender, interval time.Duration) {
+	go func() {
+		for {
+			delivered, err := sender.Run()
+			if err != nil {
+				fmt.Println("ERROR delivering webhooks:", err)
+			} else if delivered > 0 {
+				fmt.Println("Webhooks delivered:", delivered)
+			}
+			time.Sleep(interval)
+		}
+	}()
+}
+
+// Lets task.due ride on the reminder dispatcher, so it follows the same
+// once-per-occurrence claims and notification preferences as push.
+type WebhookNotifier struct{}
+
+func (notifier *WebhookNotifier) Channel() string {
+	return "webhook"
+}
+
+func (notifier *WebhookNotifier) CanReach(recipient Recipient) bool {
+	return recipient.TaskDueWebhooks
+}
+
+func (notifier *WebhookNotifier) Send(recipient Recipient, notification Notification) ([]DeliveryResult, error) {
+	data := map[string]any{"title": notification.Title, "body": notification.Body}
+	for key, value := range notification.Data {
+		data[key] = value
+	}
+
+	if err := enqueueWebhookEvent(Handler.Db, recipient.UserID, WebhookTaskDue, data); err != nil {
+		return []DeliveryResult{{Target: "outbox", Status: "failed", Error: err.Error()}}, err
+	}
+	return []DeliveryResult{{Target: "outbox", Status: "sent"}}, nil
+}
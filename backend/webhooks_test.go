@@ -0,0 +1,150 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestSignWebhook(t *testing.T) {
+	body := []byte(`{"id":1}`)
+	signature := signWebhook("secret", "1700000000", body)
+
+	// HMAC-SHA256("secret", "1700000000." + body)
+	want := "sha256=3dd1b9aef568d75f6790a84bd2e5dfa1f44409eef3cbdbd3f10b837376100c11"
+	if signature != want {
+		t.Fatalf("signWebhook() = %q, want %q", signature, want)
+	}
+
+	tests := []struct {
+		name      string
+		secret    string
+		timestamp string
+		body      []byte
+		same      bool
+	}{
+		{"same input", "secret", "1700000000", body, true},
+		{"other secret", "other", "1700000000", body, false},
+		{"other timestamp", "secret", "1700000001", body, false},
+		{"other body", "secret", "1700000000", []byte(`{"id":2}`), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := signWebhook(tt.secret, tt.timestamp, tt.body); (got == signature) != tt.same {
+				t.Errorf("signWebhook() = %q, matches original: %v, want %v", got, got == signature, tt.same)
+			}
+		})
+	}
+}
+
+func TestWebhookRetryDelay(t *testing.T) {
+	tests := []struct {
+		attempts int
+		want     time.Duration
+		ok       bool
+	}{
+		{0, 0, false},
+		{1, time.Minute, true},
+		{3, 30 * time.Minute, true},
+		{len(webhookRetryBackoff), 12 * time.Hour, true},
+		{len(webhookRetryBackoff) + 1, 0, false},
+	}
+
+	for _, tt := range tests {
+		got, ok := webhookRetryDelay(tt.attempts)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("webhookRetryDelay(%d) = %v, %v, want %v, %v", tt.attempts, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestBlockedWebhookIP(t *testing.T) {
+	tests := []struct {
+		ip   string
+		want bool
+	}{
+		{"127.0.0.1", true},
+		{"10.1.2.3", true},
+		{"172.16.0.1", true},
+		{"192.168.1.10", true},
+		{"169.254.169.254", true},
+		{"100.64.0.1", true},
+		{"0.0.0.0", true},
+		{"224.0.0.1", true},
+		{"::1", true},
+		{"fd00::1", true},
+		{"fe80::1", true},
+		{"::ffff:127.0.0.1", true},
+		{"93.184.216.34", false},
+		{"2606:2800:220:1:248:1893:25c8:1946", false},
+	}
+
+	for _, tt := range tests {
+		if got := blockedWebhookIP(net.ParseIP(tt.ip)); got != tt.want {
+			t.Errorf("blockedWebhookIP(%s) = %v, want %v", tt.ip, got, tt.want)
+		}
+	}
+}
+
+func TestValidateWebhookURL(t *testing.T) {
+	tests := []struct {
+		url     string
+		wantErr bool
+	}{
+		{"https://93.184.216.34/hooks", false},
+		{"http://93.184.216.34:8080/hooks", false},
+		{"ftp://93.184.216.34/hooks", true},
+		{"/relative", true},
+		{"https://", true},
+		{"http://localhost/hooks", true},
+		{"http://127.0.0.1:8080/hooks", true},
+		{"http://169.254.169.254/latest/meta-data", true},
+		{"http://10.0.0.5/hooks", true},
+		{"http://[::1]/hooks", true},
+		{"http://[fd12:3456::1]/hooks", true},
+	}
+
+	for _, tt := range tests {
+		if err := validateWebhookURL(tt.url); (err != nil) != tt.wantErr {
+			t.Errorf("validateWebhookURL(%q) error = %v, wantErr %v", tt.url, err, tt.wantErr)
+		}
+	}
+}
+
+func TestWebhookDialControl(t *testing.T) {
+	tests := []struct {
+		address string
+		wantErr bool
+	}{
+		{"93.184.216.34:443", false},
+		{"127.0.0.1:80", true},
+		{"169.254.169.254:80", true},
+		{"[fd00::1]:443", true},
+		{"not-an-address", true},
+	}
+
+	for _, tt := range tests {
+		if err := webhookDialControl("tcp", tt.address, nil); (err != nil) != tt.wantErr {
+			t.Errorf("webhookDialControl(%q) error = %v, wantErr %v", tt.address, err, tt.wantErr)
+		}
+	}
+}
+
+func TestWebhookSenderRefusesLoopback(t *testing.T) {
+	hit := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hit = true
+	}))
+	defer server.Close()
+
+	sender := NewWebhookSender(time.Second)
+	if _, err := sender.post(pendingWebhook{DeliveryID: 1, URL: server.URL, Secret: "s"}); err == nil {
+		t.Error("expected the loopback endpoint to be refused")
+	}
+	if hit {
+		t.Error("request reached the loopback endpoint")
+	}
+}
@@ -44,4 +44,397 @@ CREATE TABLE PlantCareHistory (
     action VARCHAR(50),
     action_date TIMESTAMP DEFAULT NOW(),
     notes TEXT
-);
\ No newline at end of file
+);
+
+CREATE TABLE user_locations (
+    user_id UUID PRIMARY KEY,
+    latitude DOUBLE PRECISION NOT NULL,
+    longitude DOUBLE PRECISION NOT NULL,
+    updated_at TIMESTAMP DEFAULT NOW()
+);
+
+CREATE TABLE seasonal_profiles (
+    profile_id SERIAL PRIMARY KEY,
+    user_id UUID NOT NULL,
+    plant_id INTEGER REFERENCES Plants(plant_id) ON DELETE CASCADE,
+    species VARCHAR(100),
+    label VARCHAR(75),
+    start_month INTEGER NOT NULL CHECK (start_month BETWEEN 1 AND 12),
+    end_month INTEGER NOT NULL CHECK (end_month BETWEEN 1 AND 12),
+    multiplier NUMERIC(4, 2) NOT NULL DEFAULT 1
+);
+
+ALTER TABLE Schedule ADD COLUMN base_repeat_every INTEGER;
+ALTER TABLE Schedule ADD COLUMN season_multiplier NUMERIC(4, 2) DEFAULT 1;
+ALTER TABLE Schedule ADD COLUMN season_multiplier_override NUMERIC(4, 2);
+
+ALTER TABLE Plants ADD COLUMN is_outdoor BOOLEAN DEFAULT FALSE;
+ALTER TABLE Plants ADD COLUMN latitude DOUBLE PRECISION;
+ALTER TABLE Plants ADD COLUMN longitude DOUBLE PRECISION;
+ALTER TABLE Schedule ADD COLUMN postponed_reason TEXT;
+-- The last rain day that postponed the schedule, so one event doesn't do it twice
+ALTER TABLE Schedule ADD COLUMN rain_event_date DATE;
+
+-- The code has always used snake_case names for these
+ALTER TABLE PlantHealth RENAME TO plant_health;
+ALTER TABLE PlantCareHistory RENAME TO plant_care_history;
+ALTER TABLE Schedule ADD COLUMN snoozed_until TIMESTAMPTZ;
+
+ALTER TABLE plant_care_history ADD COLUMN performed_by TEXT;
+
+CREATE TABLE vacations (
+    vacation_id SERIAL PRIMARY KEY,
+    user_id UUID NOT NULL,
+    start_date DATE NOT NULL,
+    end_date DATE NOT NULL,
+    mode VARCHAR(10) NOT NULL CHECK (mode IN ('pause', 'sitter')),
+    sitter_name VARCHAR(75),
+    sitter_email VARCHAR(255),
+    sitter_user_id UUID,
+    share_token_hash CHAR(64) UNIQUE,
+    summary JSONB,
+    created_at TIMESTAMP DEFAULT NOW(),
+    CHECK (end_date >= start_date)
+);
+
+ALTER TABLE plant_care_history ADD COLUMN due_date DATE;
+-- History outlives the plant, deleting one only clears the reference
+ALTER TABLE plant_care_history DROP CONSTRAINT plantcarehistory_plant_id_fkey;
+ALTER TABLE plant_care_history ADD CONSTRAINT plant_care_history_plant_id_fkey
+    FOREIGN KEY (plant_id) REFERENCES Plants(plant_id) ON DELETE SET NULL;
+ALTER TABLE Schedule ADD COLUMN initial_repeat_days INTEGER;
+ALTER TABLE Schedule ADD COLUMN adaptive_mode VARCHAR(10) DEFAULT 'suggest' CHECK (adaptive_mode IN ('off', 'suggest', 'auto'));
+
+CREATE TABLE interval_adjustments (
+    adjustment_id SERIAL PRIMARY KEY,
+    schedule_id INTEGER REFERENCES Schedule(schedule_id) ON DELETE CASCADE,
+    plant_id INTEGER REFERENCES Plants(plant_id) ON DELETE CASCADE,
+    user_id UUID NOT NULL,
+    old_every INTEGER NOT NULL,
+    old_unit VARCHAR(20) NOT NULL,
+    new_every INTEGER NOT NULL,
+    new_unit VARCHAR(20) NOT NULL,
+    reasons JSONB NOT NULL DEFAULT '[]',
+    status VARCHAR(10) NOT NULL CHECK (status IN ('suggested', 'applied', 'accepted', 'dismissed')),
+    created_at TIMESTAMP DEFAULT NOW()
+);
+
+ALTER TABLE Schedule ADD COLUMN task_types TEXT[] DEFAULT '{water}';
+ALTER TABLE Schedule ADD COLUMN interval_overridden BOOLEAN DEFAULT FALSE;
+ALTER TABLE Schedule ADD COLUMN overridden_at TIMESTAMP;
+
+CREATE TABLE user_settings (
+    user_id UUID PRIMARY KEY,
+    timezone VARCHAR(64) NOT NULL DEFAULT 'UTC',
+    updated_at TIMESTAMP DEFAULT NOW()
+);
+
+CREATE TABLE device_tokens (
+    device_id SERIAL PRIMARY KEY,
+    user_id UUID NOT NULL,
+    token TEXT NOT NULL UNIQUE,
+    platform VARCHAR(20),
+    created_at TIMESTAMP DEFAULT NOW(),
+    last_seen_at TIMESTAMP DEFAULT NOW()
+);
+
+CREATE TABLE notification_log (
+    notification_id SERIAL PRIMARY KEY,
+    batch_id VARCHAR(32) NOT NULL,
+    schedule_id INTEGER REFERENCES Schedule(schedule_id) ON DELETE CASCADE,
+    recipient_id UUID NOT NULL,
+    channel VARCHAR(20) NOT NULL,
+    occurrence_key VARCHAR(40) NOT NULL,
+    status VARCHAR(10) NOT NULL,
+    error TEXT,
+    attempts INTEGER NOT NULL DEFAULT 1,
+    retry_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT NOW(),
+    sent_at TIMESTAMP,
+    UNIQUE (schedule_id, recipient_id, channel, occurrence_key)
+);
+
+CREATE TABLE notification_deliveries (
+    delivery_id SERIAL PRIMARY KEY,
+    batch_id VARCHAR(32) NOT NULL,
+    recipient_id UUID NOT NULL,
+    channel VARCHAR(20) NOT NULL,
+    target TEXT NOT NULL,
+    ticket_id TEXT,
+    status VARCHAR(10) NOT NULL,
+    error TEXT,
+    receipt_status VARCHAR(10),
+    receipt_error TEXT,
+    created_at TIMESTAMP DEFAULT NOW(),
+    checked_at TIMESTAMP
+);
+
+ALTER TABLE user_settings ADD COLUMN email VARCHAR(255);
+ALTER TABLE user_settings ADD COLUMN email_digest BOOLEAN DEFAULT FALSE;
+ALTER TABLE user_settings ADD COLUMN last_digest_date DATE;
+
+CREATE TABLE notification_preferences (
+    user_id UUID PRIMARY KEY,
+    channels TEXT[] NOT NULL DEFAULT '{push,email,webhook}',
+    task_types TEXT[] NOT NULL DEFAULT '{water,fertilize,mist,rotate,prune,repot}',
+    quiet_start TIME,
+    quiet_end TIME,
+    batching VARCHAR(20) NOT NULL DEFAULT 'summary',
+    updated_at TIMESTAMP DEFAULT NOW()
+);
+
+CREATE TABLE webhook_endpoints (
+    endpoint_id SERIAL PRIMARY KEY,
+    user_id UUID NOT NULL,
+    url TEXT NOT NULL,
+    secret VARCHAR(64) NOT NULL,
+    events TEXT[] NOT NULL,
+    active BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at TIMESTAMP DEFAULT NOW()
+);
+
+CREATE TABLE webhook_outbox (
+    event_id SERIAL PRIMARY KEY,
+    user_id UUID NOT NULL,
+    event_type VARCHAR(40) NOT NULL,
+    payload JSONB NOT NULL,
+    created_at TIMESTAMP DEFAULT NOW(),
+    dispatched_at TIMESTAMP
+);
+
+CREATE INDEX webhook_outbox_pending ON webhook_outbox (event_id) WHERE dispatched_at IS NULL;
+
+CREATE TABLE webhook_deliveries (
+    delivery_id SERIAL PRIMARY KEY,
+    event_id INTEGER REFERENCES webhook_outbox(event_id) ON DELETE CASCADE,
+    endpoint_id INTEGER REFERENCES webhook_endpoints(endpoint_id) ON DELETE CASCADE,
+    status VARCHAR(10) NOT NULL DEFAULT 'pending',
+    attempts INTEGER NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMP DEFAULT NOW(),
+    last_status_code INTEGER,
+    last_error TEXT,
+    created_at TIMESTAMP DEFAULT NOW(),
+    delivered_at TIMESTAMP
+);
+
+CREATE INDEX webhook_deliveries_due ON webhook_deliveries (next_attempt_at) WHERE status = 'pending';
+
+CREATE TABLE sensors (
+    sensor_id SERIAL PRIMARY KEY,
+    user_id UUID NOT NULL,
+    plant_id INTEGER REFERENCES Plants(plant_id),
+    name VARCHAR(100) NOT NULL,
+    token_hash VARCHAR(64) NOT NULL UNIQUE,
+    dry_threshold REAL NOT NULL DEFAULT 30,
+    wet_threshold REAL NOT NULL DEFAULT 60,
+    last_moisture REAL,
+    last_reading_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT NOW()
+);
+
+CREATE TABLE sensor_readings (
+    reading_id BIGSERIAL PRIMARY KEY,
+    sensor_id INTEGER REFERENCES sensors(sensor_id) ON DELETE CASCADE,
+    moisture REAL NOT NULL,
+    recorded_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX sensor_readings_by_time ON sensor_readings (sensor_id, recorded_at);
+
+ALTER TABLE Schedule ADD COLUMN water_amount_ml INTEGER;
+
+CREATE TABLE valves (
+    valve_id SERIAL PRIMARY KEY,
+    user_id UUID NOT NULL,
+    name VARCHAR(100) NOT NULL,
+    driver VARCHAR(10) NOT NULL,
+    address TEXT,
+    plant_ids INTEGER[] NOT NULL,
+    flow_ml_per_minute REAL NOT NULL,
+    default_amount_ml INTEGER NOT NULL,
+    max_run_seconds INTEGER NOT NULL DEFAULT 300,
+    max_daily_seconds INTEGER NOT NULL DEFAULT 900,
+    start_hour INTEGER NOT NULL DEFAULT 6,
+    enabled BOOLEAN NOT NULL DEFAULT TRUE,
+    token_hash VARCHAR(64) NOT NULL UNIQUE,
+    created_at TIMESTAMP DEFAULT NOW()
+);
+
+CREATE TABLE irrigation_runs (
+    run_id SERIAL PRIMARY KEY,
+    valve_id INTEGER REFERENCES valves(valve_id) ON DELETE CASCADE,
+    schedule_ids INTEGER[] NOT NULL,
+    command_id VARCHAR(32) NOT NULL,
+    requested_seconds INTEGER NOT NULL,
+    status VARCHAR(12) NOT NULL,
+    seconds_run INTEGER,
+    error TEXT,
+    created_at TIMESTAMP DEFAULT NOW(),
+    confirmed_at TIMESTAMP,
+    UNIQUE (valve_id, command_id)
+);
+
+ALTER TABLE user_settings ADD COLUMN ha_enabled BOOLEAN DEFAULT FALSE;
+ALTER TABLE user_settings ADD COLUMN ha_node_id VARCHAR(16) UNIQUE;
+ALTER TABLE user_settings ADD COLUMN ha_command_key VARCHAR(64);
+
+CREATE TABLE personal_access_tokens (
+    token_id SERIAL PRIMARY KEY,
+    user_id UUID NOT NULL,
+    name VARCHAR(100) NOT NULL,
+    scopes TEXT[] NOT NULL,
+    token_hash VARCHAR(64) NOT NULL UNIQUE,
+    expires_at TIMESTAMP,
+    last_used_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT NOW()
+);
+
+CREATE TABLE households (
+    household_id SERIAL PRIMARY KEY,
+    name VARCHAR(100) NOT NULL,
+    created_by UUID NOT NULL,
+    created_at TIMESTAMP DEFAULT NOW()
+);
+
+CREATE TABLE household_members (
+    household_id INTEGER REFERENCES households(household_id) ON DELETE CASCADE,
+    user_id UUID NOT NULL,
+    role VARCHAR(10) NOT NULL CHECK (role IN ('owner', 'editor', 'viewer')),
+    joined_at TIMESTAMP DEFAULT NOW(),
+    PRIMARY KEY (household_id, user_id)
+);
+
+CREATE INDEX household_members_by_user ON household_members (user_id);
+
+-- Link invites have a token_hash, email invites have an email. Either way
+-- they can be used once.
+CREATE TABLE household_invites (
+    invite_id SERIAL PRIMARY KEY,
+    household_id INTEGER REFERENCES households(household_id) ON DELETE CASCADE,
+    invited_by UUID NOT NULL,
+    role VARCHAR(10) NOT NULL CHECK (role IN ('owner', 'editor', 'viewer')),
+    email VARCHAR(255),
+    token_hash VARCHAR(64) UNIQUE,
+    expires_at TIMESTAMP NOT NULL,
+    accepted_by UUID,
+    accepted_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT NOW()
+);
+
+ALTER TABLE Plants ADD COLUMN household_id INTEGER REFERENCES households(household_id) ON DELETE SET NULL;
+
+ALTER TABLE Schedule ADD COLUMN assignee_user_id UUID;
+ALTER TABLE Schedule ADD COLUMN rotation VARCHAR(15) CHECK (rotation IN ('round_robin', 'weekly', 'least_recent'));
+
+CREATE TABLE plant_transfers (
+    transfer_id SERIAL PRIMARY KEY,
+    plant_id INTEGER NOT NULL,
+    plant_pet_name VARCHAR(75) NOT NULL,
+    from_user_id UUID NOT NULL,
+    to_email VARCHAR(255) NOT NULL,
+    to_user_id UUID,
+    status VARCHAR(10) NOT NULL CHECK (status IN ('offered', 'accepted', 'declined', 'cancelled', 'expired')),
+    message TEXT,
+    expires_at TIMESTAMP NOT NULL,
+    created_at TIMESTAMP DEFAULT NOW(),
+    responded_at TIMESTAMP
+);
+
+-- One open offer per plant
+CREATE UNIQUE INDEX plant_transfers_one_offer ON plant_transfers (plant_id) WHERE status = 'offered';
+
+-- Each side's audit entry for an accepted transfer. No foreign key on the
+-- plant, the sender's entry has to outlive it leaving their account
+CREATE TABLE plant_transfer_events (
+    event_id SERIAL PRIMARY KEY,
+    transfer_id INTEGER NOT NULL REFERENCES plant_transfers(transfer_id),
+    user_id UUID NOT NULL,
+    direction VARCHAR(8) NOT NULL CHECK (direction IN ('given', 'received')),
+    other_user_id UUID NOT NULL,
+    plant_id INTEGER NOT NULL,
+    plant_pet_name VARCHAR(75) NOT NULL,
+    created_at TIMESTAMP DEFAULT NOW()
+);
+
+CREATE INDEX plant_transfer_events_user ON plant_transfer_events (user_id, created_at);
+
+CREATE TABLE account_merges (
+    merge_id SERIAL PRIMARY KEY,
+    anonymous_id UUID NOT NULL,
+    user_id UUID NOT NULL,
+    plants_moved INTEGER NOT NULL,
+    merged_at TIMESTAMP DEFAULT NOW()
+);
+
+-- The snapshot is what DELETE /account removed, kept until purge_after so
+-- the deletion can be undone.
+CREATE TABLE account_deletions (
+    deletion_id SERIAL PRIMARY KEY,
+    user_id UUID NOT NULL,
+    snapshot JSONB,
+    status VARCHAR(10) NOT NULL CHECK (status IN ('pending', 'restored', 'purged')),
+    requested_at TIMESTAMP DEFAULT NOW(),
+    purge_after TIMESTAMP NOT NULL,
+    resolved_at TIMESTAMP
+);
+
+CREATE TABLE storage_deletions (
+    storage_deletion_id SERIAL PRIMARY KEY,
+    deletion_id INTEGER REFERENCES account_deletions(deletion_id) ON DELETE CASCADE,
+    url TEXT NOT NULL,
+    status VARCHAR(10) NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'deleted', 'kept', 'failed')),
+    attempts INTEGER NOT NULL DEFAULT 0,
+    last_error TEXT,
+    deleted_at TIMESTAMP
+);
+
+-- Fields from another app's export that we have no column for
+ALTER TABLE Plants ADD COLUMN import_metadata JSONB;
+ALTER TABLE plant_care_history ADD COLUMN metadata JSONB;
+
+-- Seeded from backend/species_catalog.json on startup
+CREATE TABLE species (
+    species_id SERIAL PRIMARY KEY,
+    slug VARCHAR(100) NOT NULL UNIQUE,
+    common_name VARCHAR(100) NOT NULL,
+    scientific_name VARCHAR(100) NOT NULL,
+    family VARCHAR(100) NOT NULL,
+    care_group VARCHAR(20) NOT NULL,
+    synonyms TEXT[] NOT NULL DEFAULT '{}',
+    water_every_days INTEGER NOT NULL,
+    fertilize_every_days INTEGER,
+    light VARCHAR(20)
+);
+
+ALTER TABLE Plants ADD COLUMN species_id INTEGER REFERENCES species(species_id);
+
+-- What the AI said when a plant was added, and what users corrected it to.
+-- Together they're the labeled data for measuring the classifier.
+CREATE TABLE plant_classifications (
+    classification_id SERIAL PRIMARY KEY,
+    user_id UUID NOT NULL,
+    plant_id INTEGER REFERENCES Plants(plant_id) ON DELETE SET NULL,
+    image_url TEXT,
+    output JSONB NOT NULL,
+    species_id INTEGER REFERENCES species(species_id),
+    created_at TIMESTAMP DEFAULT NOW()
+);
+
+CREATE TABLE species_corrections (
+    correction_id SERIAL PRIMARY KEY,
+    user_id UUID NOT NULL,
+    plant_id INTEGER REFERENCES Plants(plant_id) ON DELETE SET NULL,
+    classification_id INTEGER REFERENCES plant_classifications(classification_id) ON DELETE SET NULL,
+    image_url TEXT,
+    original_output JSONB,
+    original_plant_name VARCHAR(75),
+    original_scientific_name VARCHAR(100),
+    original_species VARCHAR(100),
+    original_species_id INTEGER REFERENCES species(species_id),
+    plant_name VARCHAR(75) NOT NULL,
+    scientific_name VARCHAR(100) NOT NULL,
+    species VARCHAR(100) NOT NULL,
+    species_id INTEGER REFERENCES species(species_id),
+    schedule_regenerated BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMP DEFAULT NOW()
+);